@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/joho/godotenv"
@@ -11,6 +14,73 @@ import (
 var JwtSecret string
 var SendGridAPIKey string
 
+// QuoteValidity adalah lama harga pada quote dikunci (default 15 menit)
+var QuoteValidity = 15 * time.Minute
+
+// Penyimpanan lampiran pesanan: "local" (folder UPLOAD_DIR) atau "supabase" (Supabase Storage)
+var (
+	StorageDriver      = "local"
+	UploadDir          = "uploads"
+	SupabaseURL        string
+	SupabaseServiceKey string
+	SupabaseBucket     = "order-attachments"
+)
+
+// Tarif pengiriman: "static" (tabel shipping_rates) atau "http" (layanan tarif eksternal di SHIPPING_RATE_URL)
+var (
+	ShippingRateProvider = "static"
+	ShippingRateURL      string
+	ShippingRateAPIKey   string
+	ShippingOrigin       = "Bandung"
+)
+
+// Kop nota dan sertifikat
+var (
+	StoreName    = "Toko Emas"
+	StoreAddress string
+	StorePhone   string
+	StoreNPWP    string
+)
+
+// CertificateSecret adalah kunci HMAC kode verifikasi sertifikat. Terpisah dari JwtSecret supaya
+// rotasi JWT tidak membatalkan sertifikat yang sudah tercetak. Sertifikat lama ditandatangani dengan
+// JWT_SECRET, jadi saat pertama kali diatur isi CERTIFICATE_SECRET dengan nilai JWT_SECRET lama.
+var CertificateSecret string
+
+// PublicBaseURL adalah alamat publik API, dipakai untuk tautan verifikasi pada QR code sertifikat
+var PublicBaseURL = "http://localhost:8081"
+
+// Pengingat tagihan cicilan: dikirim sekian hari sebelum jatuh tempo. CronSecret dipakai
+// penjadwal (misalnya Vercel Cron) untuk memanggil endpoint pengingat tanpa login admin.
+var (
+	InstallmentReminderDays = 3
+	CronSecret              string
+)
+
+// Payment gateway: "midtrans" atau "fake" (simulasi di memori untuk pengujian tanpa jaringan).
+// MidtransEnv "sandbox" atau "production". PaymentWebhookURL adalah tujuan webhook simulasi
+// gateway fake (default PublicBaseURL + /webhook/midtrans).
+var (
+	PaymentGateway    = "midtrans"
+	MidtransServerKey string
+	MidtransClientKey string
+	MidtransEnv       = "sandbox"
+	PaymentWebhookURL string
+)
+
+// Rekonsiliasi pembayaran: pembayaran pending lebih lama dari PaymentReconcileAfter dicek ke gateway
+// dan dianggap kedaluwarsa setelah PaymentExpiry. PaymentReconcileInterval adalah jeda worker
+// rekonsiliasi pada server lokal (0 menonaktifkan worker; di Vercel dijalankan cron).
+var (
+	PaymentExpiry            = 24 * time.Hour
+	PaymentReconcileAfter    = 15 * time.Minute
+	PaymentReconcileInterval = 15 * time.Minute
+)
+
+// MidtransVerifyStatus mengaktifkan konfirmasi ulang status transaksi ke API Midtrans
+// sebelum notifikasi webhook diterapkan
+var MidtransVerifyStatus bool
+
 type Claims struct {
 	UserID int    `json:"user_id"`
 	Email  string `json:"email"`
@@ -37,4 +107,106 @@ func InitConfig() {
 		log.Fatal("SENDGRID_API_KEY is not set in the .env file")
 	}
 	log.Println("SENDGRID_API_KEY loaded successfully")
+
+	// Lama penguncian harga quote, opsional
+	if minutes, err := strconv.Atoi(os.Getenv("QUOTE_VALIDITY_MINUTES")); err == nil && minutes > 0 {
+		QuoteValidity = time.Duration(minutes) * time.Minute
+	}
+
+	// Penyimpanan lampiran, opsional (default folder lokal)
+	if driver := os.Getenv("STORAGE_DRIVER"); driver != "" {
+		StorageDriver = driver
+	}
+	if dir := os.Getenv("UPLOAD_DIR"); dir != "" {
+		UploadDir = dir
+	}
+	SupabaseURL = os.Getenv("SUPABASE_URL")
+	SupabaseServiceKey = os.Getenv("SUPABASE_SERVICE_KEY")
+	if bucket := os.Getenv("SUPABASE_BUCKET"); bucket != "" {
+		SupabaseBucket = bucket
+	}
+	if StorageDriver == "supabase" && (SupabaseURL == "" || SupabaseServiceKey == "") {
+		log.Fatal("SUPABASE_URL and SUPABASE_SERVICE_KEY must be set when STORAGE_DRIVER=supabase")
+	}
+
+	// Kop nota, opsional
+	if name := os.Getenv("STORE_NAME"); name != "" {
+		StoreName = name
+	}
+	StoreAddress = os.Getenv("STORE_ADDRESS")
+	StorePhone = os.Getenv("STORE_PHONE")
+	StoreNPWP = os.Getenv("STORE_NPWP")
+
+	CertificateSecret = os.Getenv("CERTIFICATE_SECRET")
+	if CertificateSecret == "" {
+		log.Fatal("CERTIFICATE_SECRET is not set in the .env file")
+	}
+
+	// Alamat publik untuk tautan verifikasi sertifikat, opsional
+	if baseURL := os.Getenv("PUBLIC_BASE_URL"); baseURL != "" {
+		PublicBaseURL = baseURL
+	}
+
+	// Pengingat cicilan, opsional
+	if days, err := strconv.Atoi(os.Getenv("INSTALLMENT_REMINDER_DAYS")); err == nil && days >= 0 {
+		InstallmentReminderDays = days
+	}
+	CronSecret = os.Getenv("CRON_SECRET")
+
+	// Payment gateway; key Midtrans wajib kecuali memakai gateway fake
+	if gateway := os.Getenv("PAYMENT_GATEWAY"); gateway != "" {
+		PaymentGateway = gateway
+	}
+	MidtransServerKey = os.Getenv("MIDTRANS_SERVER_KEY")
+	MidtransClientKey = os.Getenv("MIDTRANS_CLIENT_KEY")
+	if env := os.Getenv("MIDTRANS_ENV"); env != "" {
+		MidtransEnv = env
+	}
+	if MidtransEnv != "sandbox" && MidtransEnv != "production" {
+		log.Fatal("MIDTRANS_ENV must be sandbox or production")
+	}
+	if PaymentGateway != "midtrans" && PaymentGateway != "fake" {
+		log.Fatal("PAYMENT_GATEWAY must be midtrans or fake")
+	}
+	// Gateway fake membuka endpoint simulasi tanpa login dan menandatangani webhook dengan key
+	// yang diketahui umum, sehingga tidak boleh aktif di production
+	if PaymentGateway == "fake" && MidtransEnv == "production" {
+		log.Fatal("PAYMENT_GATEWAY=fake cannot be used with MIDTRANS_ENV=production")
+	}
+	PaymentWebhookURL = os.Getenv("PAYMENT_WEBHOOK_URL")
+	if PaymentWebhookURL == "" {
+		PaymentWebhookURL = strings.TrimRight(PublicBaseURL, "/") + "/webhook/midtrans"
+	}
+	if PaymentGateway == "fake" && MidtransServerKey == "" {
+		// Signature webhook simulasi tetap diverifikasi dengan key ini
+		MidtransServerKey = "fake-server-key"
+	}
+	if PaymentGateway == "midtrans" && (MidtransServerKey == "" || MidtransClientKey == "") {
+		log.Fatal("MIDTRANS_SERVER_KEY and MIDTRANS_CLIENT_KEY must be set when PAYMENT_GATEWAY=midtrans")
+	}
+	MidtransVerifyStatus = os.Getenv("MIDTRANS_VERIFY_STATUS") == "true"
+
+	// Rekonsiliasi pembayaran, opsional
+	if hours, err := strconv.Atoi(os.Getenv("PAYMENT_EXPIRY_HOURS")); err == nil && hours > 0 {
+		PaymentExpiry = time.Duration(hours) * time.Hour
+	}
+	if minutes, err := strconv.Atoi(os.Getenv("PAYMENT_RECONCILE_AFTER_MINUTES")); err == nil && minutes > 0 {
+		PaymentReconcileAfter = time.Duration(minutes) * time.Minute
+	}
+	if minutes, err := strconv.Atoi(os.Getenv("PAYMENT_RECONCILE_INTERVAL_MINUTES")); err == nil && minutes >= 0 {
+		PaymentReconcileInterval = time.Duration(minutes) * time.Minute
+	}
+
+	// Tarif pengiriman, opsional (default tabel statis)
+	if provider := os.Getenv("SHIPPING_RATE_PROVIDER"); provider != "" {
+		ShippingRateProvider = provider
+	}
+	ShippingRateURL = os.Getenv("SHIPPING_RATE_URL")
+	ShippingRateAPIKey = os.Getenv("SHIPPING_RATE_API_KEY")
+	if origin := os.Getenv("SHIPPING_ORIGIN"); origin != "" {
+		ShippingOrigin = origin
+	}
+	if ShippingRateProvider == "http" && ShippingRateURL == "" {
+		log.Fatal("SHIPPING_RATE_URL must be set when SHIPPING_RATE_PROVIDER=http")
+	}
 }
@@ -0,0 +1,348 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// buybackErrorStatus memetakan error buyback dan tukar tambah ke status HTTP; 0 jika error tidak dikenal
+func buybackErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidBuyback), errors.Is(err, services.ErrUnknownJenisEmas):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrBuybackNotFound), errors.Is(err, services.ErrCertificateNotFound),
+		errors.Is(err, services.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrBuybackStatus), errors.Is(err, services.ErrCertificateRevoked),
+		errors.Is(err, services.ErrTradeInLocked), errors.Is(err, services.ErrNoTradeInCredit), errors.Is(err, services.ErrScheduleActive),
+		errors.Is(err, services.ErrInvalidTransition):
+		return http.StatusConflict
+	}
+	return 0
+}
+
+// HandleCreateBuyback mencatat penawaran buyback dari sertifikat atau perhiasan walk-in (admin)
+func HandleCreateBuyback(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireRole(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req services.BuybackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	buyback, err := services.CreateBuyback(database.DB, req, services.ActorUser(adminID))
+	if status := buybackErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating buyback: %v", err)
+		http.Error(w, "Error creating buyback", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(buyback)
+}
+
+// HandleGetBuybacks mengembalikan transaksi buyback terbaru, ?status= untuk filter (admin)
+func HandleGetBuybacks(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	buybacks, err := services.ListBuybacks(database.DB, r.URL.Query().Get("status"))
+	if err != nil {
+		log.Printf("Error fetching buybacks: %v", err)
+		http.Error(w, "Error fetching buybacks", http.StatusInternalServerError)
+		return
+	}
+	if buybacks == nil {
+		buybacks = []model.Buyback{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buybacks)
+}
+
+// HandleGetBuyback mengembalikan satu transaksi buyback (admin)
+func HandleGetBuyback(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid buyback ID", http.StatusBadRequest)
+		return
+	}
+
+	buyback, err := services.GetBuyback(database.DB, id, false)
+	if status := buybackErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching buyback %d: %v", id, err)
+		http.Error(w, "Error fetching buyback", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buyback)
+}
+
+// HandlePayBuyback mencatat pembayaran buyback ke penjual secara tunai atau transfer (admin)
+func HandlePayBuyback(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireRole(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid buyback ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Metode    string `json:"metode"`
+		Referensi string `json:"referensi"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error recording payout", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	buyback, err := services.PayBuyback(tx, id, req.Metode, req.Referensi, services.ActorUser(adminID))
+	if status := buybackErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error recording payout of buyback %d: %v", id, err)
+		http.Error(w, "Error recording payout", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing payout of buyback %d: %v", id, err)
+		http.Error(w, "Error recording payout", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buyback)
+}
+
+// HandleCreditBuyback menjadikan buyback kredit tukar tambah untuk pelanggan (admin)
+func HandleCreditBuyback(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireRole(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid buyback ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating trade-in credit", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	buyback, credit, err := services.CreditBuyback(tx, id, services.ActorUser(adminID))
+	if status := buybackErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error crediting buyback %d: %v", id, err)
+		http.Error(w, "Error creating trade-in credit", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing trade-in credit of buyback %d: %v", id, err)
+		http.Error(w, "Error creating trade-in credit", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"buyback": buyback,
+		"kredit":  credit,
+	})
+}
+
+// HandleCancelBuyback membatalkan penawaran buyback yang belum dibayar (admin)
+func HandleCancelBuyback(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid buyback ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error cancelling buyback", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	buyback, err := services.CancelBuyback(tx, id)
+	if status := buybackErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error cancelling buyback %d: %v", id, err)
+		http.Error(w, "Error cancelling buyback", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing cancellation of buyback %d: %v", id, err)
+		http.Error(w, "Error cancelling buyback", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buyback)
+}
+
+// HandleGetTradeInCredits mengembalikan kredit tukar tambah milik user yang login
+func HandleGetTradeInCredits(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	credits, err := services.TradeInCredits(database.DB, userID, false)
+	if err != nil {
+		log.Printf("Error fetching trade-in credits of user %d: %v", userID, err)
+		http.Error(w, "Error fetching trade-in credits", http.StatusInternalServerError)
+		return
+	}
+	var sisa model.Rupiah
+	for _, credit := range credits {
+		sisa += credit.Sisa
+	}
+	if credits == nil {
+		credits = []model.TradeInCredit{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"kredit": credits,
+		"sisa":   sisa,
+	})
+}
+
+// HandleSetOrderTradeIn memakai kredit tukar tambah untuk pesanan yang belum dibayar.
+// Tanpa jumlah kredit dipakai semaksimal mungkin; jumlah 0 melepas kredit.
+// Pesanan yang lunas sepenuhnya dengan kredit langsung berstatus paid tanpa Midtrans.
+func HandleSetOrderTradeIn(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Jumlah *model.Rupiah `json:"jumlah"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	if err := database.DB.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1`, orderID).Scan(&status); err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
+		return
+	}
+	if status != services.OrderDraft && status != services.OrderAwaitingPayment {
+		http.Error(w, services.ErrTradeInLocked.Error(), http.StatusConflict)
+		return
+	}
+	if status == services.OrderAwaitingPayment {
+		if err := services.CancelPendingPayments(database.DB, orderID); err != nil {
+			writeCancelPaymentsError(w, orderID, err)
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error applying trade-in credit", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	actor := services.ActorUser(userID)
+	breakdown, err := services.SetOrderTradeIn(tx, orderID, req.Jumlah, actor)
+	if status := buybackErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error applying trade-in credit to order %d: %v", orderID, err)
+		http.Error(w, "Error applying trade-in credit", http.StatusInternalServerError)
+		return
+	}
+
+	// Total nol tidak bisa ditagih lewat Midtrans, jadi pesanan langsung dianggap lunas
+	paid := breakdown.Total == 0 && (breakdown.TukarTambah > 0 || breakdown.TabunganEmas > 0)
+	if paid {
+		if err := markOrderPaid(tx, orderID, status, actor, "Lunas dengan kredit tukar tambah"); err != nil {
+			log.Printf("Error settling order %d with trade-in credit: %v", orderID, err)
+			http.Error(w, "Error applying trade-in credit", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing trade-in credit of order %d: %v", orderID, err)
+		http.Error(w, "Error applying trade-in credit", http.StatusInternalServerError)
+		return
+	}
+
+	if paid {
+		invoice, created, err := issueInvoice(orderID, "", "trade_in")
+		if err != nil {
+			log.Printf("Error issuing invoice for order %d: %v", orderID, err)
+		} else if created {
+			services.SendInvoiceEmail(invoice)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total_harga": breakdown.Total,
+		"rincian":     breakdown,
+		"lunas":       paid,
+	})
+}
@@ -0,0 +1,324 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// cartItemRequest adalah payload untuk menambah item ke keranjang
+type cartItemRequest struct {
+	ItemType string              `json:"item_type"`
+	EmasID   int                 `json:"emas_id"`
+	Qty      int                 `json:"qty"`
+	Custom   *model.OrderRequest `json:"custom"`
+}
+
+// checkoutRequest adalah payload checkout keranjang
+type checkoutRequest struct {
+	KodeVoucher     string                       `json:"kode_voucher"`
+	CustomerDetails CustomerDetails              `json:"customer_details"`
+	Pengiriman      *services.FulfillmentRequest `json:"pengiriman"` // opsional, bisa dipilih nanti lewat /fulfillment
+}
+
+// HandleGetCart mengembalikan keranjang user dengan harga dan stok terkini
+func HandleGetCart(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	items, err := services.LoadCart(database.DB, userID)
+	if err != nil {
+		log.Printf("Error loading cart of user %d: %v", userID, err)
+		http.Error(w, "Error fetching cart", http.StatusInternalServerError)
+		return
+	}
+	writeCart(w, http.StatusOK, items)
+}
+
+// HandleAddCartItem menambah perhiasan jadi atau perhiasan custom ke keranjang.
+// Perhiasan jadi yang sudah ada di keranjang ditambah jumlahnya.
+func HandleAddCartItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	var req cartItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if req.Qty == 0 {
+		req.Qty = 1
+	}
+	if req.Qty < 0 || req.Qty > services.MaxCartQty {
+		http.Error(w, fmt.Sprintf("qty harus antara 1 dan %d", services.MaxCartQty), http.StatusBadRequest)
+		return
+	}
+
+	switch req.ItemType {
+	case model.ItemEmas:
+		// Stok tidak dikunci di keranjang; kekurangan stok ditandai saat keranjang dibaca
+		var exists int
+		err := database.DB.QueryRow(`SELECT 1 FROM emas WHERE id = $1`, req.EmasID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Produk tidak ditemukan", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching emas %d: %v", req.EmasID, err)
+			http.Error(w, "Error adding cart item", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = database.DB.Exec(`
+			INSERT INTO cart_items (user_id, item_type, emas_id, qty)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, emas_id) WHERE item_type = 'emas'
+			DO UPDATE SET qty = LEAST(cart_items.qty + EXCLUDED.qty, $5)`,
+			userID, model.ItemEmas, req.EmasID, req.Qty, services.MaxCartQty)
+		if err != nil {
+			log.Printf("Error adding emas %d to cart: %v", req.EmasID, err)
+			http.Error(w, "Error adding cart item", http.StatusInternalServerError)
+			return
+		}
+	case model.ItemCustom:
+		if req.Custom == nil {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+		if err := services.ValidateOrderRequest(*req.Custom); err != nil {
+			http.Error(w, orderRequestError(err), http.StatusBadRequest)
+			return
+		}
+		custom, err := json.Marshal(req.Custom)
+		if err != nil {
+			http.Error(w, "Invalid custom item", http.StatusBadRequest)
+			return
+		}
+		_, err = database.DB.Exec(`
+			INSERT INTO cart_items (user_id, item_type, custom, qty) VALUES ($1, $2, $3, $4)`,
+			userID, model.ItemCustom, custom, req.Qty)
+		if err != nil {
+			log.Printf("Error adding custom item to cart: %v", err)
+			http.Error(w, "Error adding cart item", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "item_type harus emas atau custom", http.StatusBadRequest)
+		return
+	}
+
+	items, err := services.LoadCart(database.DB, userID)
+	if err != nil {
+		log.Printf("Error loading cart of user %d: %v", userID, err)
+		http.Error(w, "Error fetching cart", http.StatusInternalServerError)
+		return
+	}
+	writeCart(w, http.StatusCreated, items)
+}
+
+// HandleUpdateCartItem mengubah jumlah item keranjang; qty 0 menghapus item
+func HandleUpdateCartItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	itemID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid cart item ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Qty int `json:"qty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if req.Qty < 0 || req.Qty > services.MaxCartQty {
+		http.Error(w, fmt.Sprintf("qty harus antara 0 dan %d", services.MaxCartQty), http.StatusBadRequest)
+		return
+	}
+
+	var res sql.Result
+	if req.Qty == 0 {
+		res, err = database.DB.Exec(`DELETE FROM cart_items WHERE id = $1 AND user_id = $2`, itemID, userID)
+	} else {
+		res, err = database.DB.Exec(`UPDATE cart_items SET qty = $1 WHERE id = $2 AND user_id = $3`, req.Qty, itemID, userID)
+	}
+	respondCartChange(w, userID, itemID, res, err)
+}
+
+// HandleDeleteCartItem menghapus satu item dari keranjang
+func HandleDeleteCartItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	itemID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid cart item ID", http.StatusBadRequest)
+		return
+	}
+
+	res, err := database.DB.Exec(`DELETE FROM cart_items WHERE id = $1 AND user_id = $2`, itemID, userID)
+	respondCartChange(w, userID, itemID, res, err)
+}
+
+// HandleCheckoutCart mengubah isi keranjang menjadi satu pesanan dan satu transaksi Midtrans
+func HandleCheckoutCart(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	var req checkoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error checking out cart", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	order, err := services.CheckoutCart(tx, userID, req.KodeVoucher, time.Now())
+	switch {
+	case errors.Is(err, services.ErrCartEmpty):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrCartItemInvalid):
+		// Kirim keranjang terbaru supaya klien bisa menampilkan item yang bermasalah
+		tx.Rollback()
+		items, loadErr := services.LoadCart(database.DB, userID)
+		if loadErr != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": err.Error(),
+			"items":   items,
+		})
+		return
+	case isVoucherError(err):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Error checking out cart of user %d: %v", userID, err)
+		http.Error(w, "Error checking out cart", http.StatusInternalServerError)
+		return
+	}
+
+	// Ongkos kirim ditambahkan sebelum transaksi pembayaran dibuat
+	if req.Pengiriman != nil {
+		fulfillment, breakdown, err := services.SetFulfillment(tx, services.NewShippingRateProvider(), order.ID, *req.Pengiriman, services.ActorUser(userID))
+		if status := fulfillmentErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if err != nil {
+			log.Printf("Error saving fulfillment of order %d: %v", order.ID, err)
+			http.Error(w, "Error checking out cart", http.StatusInternalServerError)
+			return
+		}
+		order.Pengiriman = &fulfillment
+		order.Rincian = &breakdown
+		order.TotalHarga = breakdown.Total
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing checkout: %v", err)
+		http.Error(w, "Error checking out cart", http.StatusInternalServerError)
+		return
+	}
+
+	// Pesanan sudah tersimpan; jika pembuatan transaksi gagal pelanggan bisa membayar lewat /payment
+	orderID, snapResp, err := startOrderPayment(order, req.CustomerDetails, services.ActorUser(userID))
+	if err != nil {
+		log.Printf("Error creating payment for order %d: %v", order.ID, err)
+		http.Error(w, "Pesanan dibuat tetapi pembayaran gagal dibuat, silakan coba bayar ulang", http.StatusBadGateway)
+		return
+	}
+	order.MidtransOrderID = orderID
+	order.Status = services.OrderAwaitingPayment
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"order":        order,
+		"token":        snapResp.Token,
+		"redirect_url": snapResp.RedirectURL,
+		"gross_amount": order.TotalHarga,
+	})
+}
+
+// respondCartChange mengirim keranjang terbaru setelah item diubah atau dihapus
+func respondCartChange(w http.ResponseWriter, userID, itemID int, res sql.Result, err error) {
+	if err != nil {
+		log.Printf("Error updating cart item %d: %v", itemID, err)
+		http.Error(w, "Error updating cart", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Item keranjang tidak ditemukan", http.StatusNotFound)
+		return
+	}
+
+	items, err := services.LoadCart(database.DB, userID)
+	if err != nil {
+		log.Printf("Error loading cart of user %d: %v", userID, err)
+		http.Error(w, "Error fetching cart", http.StatusInternalServerError)
+		return
+	}
+	writeCart(w, http.StatusOK, items)
+}
+
+// writeCart mengirim isi keranjang beserta subtotal, pajak dan total item yang tersedia
+func writeCart(w http.ResponseWriter, status int, items []model.CartItem) {
+	valid := true
+	for _, item := range items {
+		valid = valid && item.Tersedia
+	}
+	breakdown, err := services.CartBreakdown(items, services.CurrentPricingRules().TaxRateAt(time.Now()))
+	if err != nil {
+		log.Printf("Error calculating cart total: %v", err)
+		http.Error(w, "Error fetching cart", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items":         items,
+		"subtotal":      breakdown.Subtotal,
+		"pajak":         breakdown.Pajak,
+		"total":         breakdown.Total,
+		"bisa_checkout": valid && len(items) > 0,
+	})
+}
@@ -0,0 +1,315 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleIssueOrderCertificates menerbitkan sertifikat keaslian untuk perhiasan pada pesanan
+// yang sudah jadi (admin). Penerbitan ulang mengembalikan sertifikat yang sudah ada.
+func HandleIssueOrderCertificates(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireRole(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID format", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error issuing certificates", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	certificates, created, err := services.IssueOrderCertificates(tx, orderID, services.ActorUser(adminID))
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrCertificateOrderStatus):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error issuing certificates for order %d: %v", orderID, err)
+		http.Error(w, "Error issuing certificates", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing certificates of order %d: %v", orderID, err)
+		http.Error(w, "Error issuing certificates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		services.NotifyOrderOwner(database.DB, orderID, fmt.Sprintf("Sertifikat keaslian pesanan #%d", orderID),
+			fmt.Sprintf("<p>Sertifikat keaslian untuk %d perhiasan pada pesanan #%d sudah terbit dan dapat diunduh dari halaman pesanan.</p>",
+				len(certificates), orderID))
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(certificates)
+}
+
+// HandleGetOrderCertificates mengembalikan sertifikat pesanan untuk pemilik pesanan atau admin
+func HandleGetOrderCertificates(w http.ResponseWriter, r *http.Request) {
+	_, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	certificates, err := services.ListOrderCertificates(database.DB, orderID)
+	if err != nil {
+		log.Printf("Error fetching certificates of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching certificates", http.StatusInternalServerError)
+		return
+	}
+	if certificates == nil {
+		certificates = []model.Certificate{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(certificates)
+}
+
+// HandleDownloadOrderCertificate mengirim PDF sertifikat milik pesanan
+func HandleDownloadOrderCertificate(w http.ResponseWriter, r *http.Request) {
+	_, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	certificate, err := services.GetCertificate(database.DB, mux.Vars(r)["serial"])
+	if errors.Is(err, services.ErrCertificateNotFound) || (err == nil && certificate.OrderID != orderID) {
+		http.Error(w, services.ErrCertificateNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching certificate %s: %v", mux.Vars(r)["serial"], err)
+		http.Error(w, "Error fetching certificate", http.StatusInternalServerError)
+		return
+	}
+	writeCertificatePDF(w, certificate)
+}
+
+// HandleIssueInventoryCertificates menerbitkan sertifikat untuk stok perhiasan jadi (admin)
+func HandleIssueInventoryCertificates(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+	emasID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid emas ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Jumlah int `json:"jumlah"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if req.Jumlah == 0 {
+		req.Jumlah = 1
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error issuing certificates", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	certificates, err := services.IssueInventoryCertificates(tx, emasID, req.Jumlah)
+	switch {
+	case errors.Is(err, services.ErrEmasNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrCertificateQuantity):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Error issuing certificates for emas %d: %v", emasID, err)
+		http.Error(w, "Error issuing certificates", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing certificates of emas %d: %v", emasID, err)
+		http.Error(w, "Error issuing certificates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(certificates)
+}
+
+// HandleAdminDownloadCertificate mengirim PDF sertifikat apa pun berdasarkan serial (admin)
+func HandleAdminDownloadCertificate(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+	serial := mux.Vars(r)["serial"]
+
+	certificate, err := services.GetCertificate(database.DB, serial)
+	if errors.Is(err, services.ErrCertificateNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching certificate %s: %v", serial, err)
+		http.Error(w, "Error fetching certificate", http.StatusInternalServerError)
+		return
+	}
+	writeCertificatePDF(w, certificate)
+}
+
+// HandleRevokeCertificate mencabut sertifikat sehingga verifikasi publik menyatakan tidak berlaku (admin)
+func HandleRevokeCertificate(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireRole(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+	serial := mux.Vars(r)["serial"]
+
+	var req struct {
+		Alasan string `json:"alasan"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	req.Alasan = strings.TrimSpace(req.Alasan)
+	if req.Alasan == "" {
+		http.Error(w, "alasan wajib diisi", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error revoking certificate", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	certificate, err := services.RevokeCertificate(tx, serial, req.Alasan, services.ActorUser(adminID))
+	switch {
+	case errors.Is(err, services.ErrCertificateNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrCertificateRevoked):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error revoking certificate %s: %v", serial, err)
+		http.Error(w, "Error revoking certificate", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing revocation of certificate %s: %v", serial, err)
+		http.Error(w, "Error revoking certificate", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(certificate)
+}
+
+// HandleVerifyCertificate adalah halaman verifikasi publik yang dibuka dari QR code sertifikat.
+// Spesifikasi perhiasan hanya ditampilkan jika kode verifikasi cocok; data pemilik tidak pernah dikirim.
+// Browser mendapat halaman HTML, klien lain mendapat JSON.
+func HandleVerifyCertificate(w http.ResponseWriter, r *http.Request) {
+	serial := mux.Vars(r)["serial"]
+
+	status := http.StatusOK
+	verification, err := services.VerifyCertificate(database.DB, serial, r.URL.Query().Get("kode"))
+	switch {
+	case errors.Is(err, services.ErrCertificateNotFound):
+		status = http.StatusNotFound
+		verification = model.CertificateVerification{
+			Serial: serial,
+			Pesan:  "Serial tidak terdaftar. Sertifikat ini tidak diterbitkan oleh toko kami.",
+		}
+	case err != nil:
+		log.Printf("Error verifying certificate %s: %v", serial, err)
+		http.Error(w, "Error verifying certificate", http.StatusInternalServerError)
+		return
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(verification)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprint(w, renderVerificationHTML(verification))
+}
+
+// renderVerificationHTML membuat halaman hasil verifikasi sederhana untuk browser ponsel
+func renderVerificationHTML(v model.CertificateVerification) string {
+	color, title := "#b00020", "Tidak terverifikasi"
+	if v.Asli {
+		color, title = "#1b7f3b", "Sertifikat asli"
+	}
+
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">`)
+	b.WriteString(`<title>Verifikasi Sertifikat</title></head><body style="font-family: sans-serif; max-width: 480px; margin: 24px auto; padding: 0 16px">`)
+	fmt.Fprintf(&b, `<h2 style="color: %s">%s</h2><p>%s</p>`, color, title, html.EscapeString(v.Pesan))
+	if v.IssuedAt != nil {
+		b.WriteString(`<table style="border-collapse: collapse">`)
+		row := func(label, value string) {
+			fmt.Fprintf(&b, `<tr><td style="padding: 4px 12px 4px 0; color: #555">%s</td><td><b>%s</b></td></tr>`,
+				label, html.EscapeString(value))
+		}
+		row("Nomor seri", v.Serial)
+		row("Perhiasan", v.Nama)
+		row("Jenis emas", v.JenisEmas)
+		row("Karat", fmt.Sprintf("%dK", v.Karat))
+		row("Kadar", v.Kadar.String()+"%")
+		row("Berat", v.Berat.String()+" g")
+		for _, batu := range v.Batu {
+			row("Batu", fmt.Sprintf("%s x%d", batu.Jenis, batu.Jumlah))
+		}
+		row("Terbit", v.IssuedAt.Format("02-01-2006"))
+		row("Status", v.Status)
+		b.WriteString(`</table>`)
+	}
+	b.WriteString(`</body></html>`)
+	return b.String()
+}
+
+// writeCertificatePDF mengirim sertifikat sebagai file PDF
+func writeCertificatePDF(w http.ResponseWriter, certificate model.Certificate) {
+	pdf, err := services.RenderCertificatePDF(certificate)
+	if err != nil {
+		log.Printf("Error rendering certificate %s: %v", certificate.Serial, err)
+		http.Error(w, "Error rendering certificate", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", services.CertificateFilename(certificate)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.Write(pdf)
+}
@@ -0,0 +1,310 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// orderOpenForDesign menolak lampiran dan persetujuan desain untuk pesanan yang sudah ditutup
+func orderOpenForDesign(w http.ResponseWriter, orderID int) bool {
+	var status string
+	if err := database.DB.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1`, orderID).Scan(&status); err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
+		return false
+	}
+	switch status {
+	case services.OrderCompleted, services.OrderCancelled, services.OrderRefunded, services.OrderPartiallyRefunded:
+		http.Error(w, "Pesanan sudah ditutup", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// HandleUploadAttachment menerima lampiran multipart (field "file"). Pelanggan mengirim foto
+// referensi, admin mengirim sketsa atau render (field "jenis").
+func HandleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, isAdmin, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+	if !orderOpenForDesign(w, orderID) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, services.MaxAttachmentSize+1<<20)
+	if err := r.ParseMultipartForm(services.MaxAttachmentSize); err != nil {
+		http.Error(w, "File terlalu besar atau form tidak valid (maksimal 10 MB)", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Field file wajib diisi", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	if header.Size > services.MaxAttachmentSize {
+		http.Error(w, "File terlalu besar (maksimal 10 MB)", http.StatusBadRequest)
+		return
+	}
+
+	jenis := services.AttachmentReference
+	if isAdmin {
+		jenis = r.FormValue("jenis")
+		if jenis == "" {
+			jenis = services.AttachmentSketch
+		}
+		if jenis != services.AttachmentSketch && jenis != services.AttachmentRender && jenis != services.AttachmentReference {
+			http.Error(w, "jenis harus sketch, render atau reference", http.StatusBadRequest)
+			return
+		}
+	}
+
+	att := model.OrderAttachment{
+		OrderID:    orderID,
+		UploaderID: userID,
+		Jenis:      jenis,
+		NamaFile:   header.Filename,
+		Ukuran:     header.Size,
+	}
+	err = services.SaveAttachment(database.DB, services.NewStorage(), &att, file)
+	if errors.Is(err, services.ErrAttachmentType) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving attachment for order %d: %v", orderID, err)
+		http.Error(w, "Error saving attachment", http.StatusInternalServerError)
+		return
+	}
+
+	if isAdmin {
+		services.NotifyOrderOwner(database.DB, orderID,
+			fmt.Sprintf("Desain baru untuk pesanan #%d", orderID),
+			fmt.Sprintf("<p>Tim kami mengunggah %s baru untuk pesanan #%d. Silakan lihat di halaman pesanan Anda.</p>", jenis, orderID))
+	} else {
+		services.NotifyAdmins(database.DB,
+			fmt.Sprintf("Referensi baru pada pesanan #%d", orderID),
+			fmt.Sprintf("<p>Pelanggan mengunggah foto referensi <b>%s</b> untuk pesanan #%d.</p>", html.EscapeString(att.NamaFile), orderID))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(att)
+}
+
+// HandleGetAttachments mengembalikan daftar lampiran pesanan
+func HandleGetAttachments(w http.ResponseWriter, r *http.Request) {
+	_, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	attachments, err := services.ListAttachments(database.DB, orderID)
+	if err != nil {
+		log.Printf("Error fetching attachments of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching attachments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// HandleDownloadAttachment mengirim isi file lampiran ke pemilik pesanan atau admin
+func HandleDownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	_, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+	attachmentID, err := strconv.Atoi(mux.Vars(r)["attachmentId"])
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	att, err := services.GetAttachment(database.DB, orderID, attachmentID)
+	if errors.Is(err, services.ErrAttachmentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching attachment %d: %v", attachmentID, err)
+		http.Error(w, "Error fetching attachment", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := services.NewStorage().Get(att.StorageKey)
+	if errors.Is(err, services.ErrFileNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading attachment %d from storage: %v", attachmentID, err)
+		http.Error(w, "Error fetching attachment", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", att.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", att.NamaFile))
+	w.Header().Set("Content-Length", strconv.FormatInt(att.Ukuran, 10))
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Error sending attachment %d: %v", attachmentID, err)
+	}
+}
+
+// HandleRequestDesignApproval mengirim sketsa/render ke pelanggan untuk disetujui (admin)
+func HandleRequestDesignApproval(w http.ResponseWriter, r *http.Request) {
+	adminID, orderID, isAdmin, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+	if !isAdmin {
+		http.Error(w, `{"message": "Forbidden"}`, http.StatusForbidden)
+		return
+	}
+	if !orderOpenForDesign(w, orderID) {
+		return
+	}
+
+	var req struct {
+		AttachmentIDs []int64 `json:"attachment_ids"`
+		Pesan         string  `json:"pesan"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error requesting approval", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	approval, err := services.RequestDesignApproval(tx, orderID, req.AttachmentIDs, strings.TrimSpace(req.Pesan), services.ActorUser(adminID))
+	if errors.Is(err, services.ErrApprovalAttachment) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error requesting design approval for order %d: %v", orderID, err)
+		http.Error(w, "Error requesting approval", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing design approval for order %d: %v", orderID, err)
+		http.Error(w, "Error requesting approval", http.StatusInternalServerError)
+		return
+	}
+
+	services.NotifyOrderOwner(database.DB, orderID,
+		fmt.Sprintf("Persetujuan desain pesanan #%d", orderID),
+		fmt.Sprintf("<p>Desain untuk pesanan #%d siap ditinjau. Silakan setujui atau minta revisi di halaman pesanan Anda.</p><p>%s</p>", orderID, html.EscapeString(approval.Pesan)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(approval)
+}
+
+// HandleGetDesignApprovals mengembalikan riwayat persetujuan desain pesanan
+func HandleGetDesignApprovals(w http.ResponseWriter, r *http.Request) {
+	_, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	approvals, err := services.ListDesignApprovals(database.DB, orderID)
+	if err != nil {
+		log.Printf("Error fetching design approvals of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching design approvals", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(approvals)
+}
+
+// HandleRespondDesignApproval menerima jawaban pelanggan: setuju atau minta revisi dengan komentar
+func HandleRespondDesignApproval(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+	var ownerID int
+	if err := database.DB.QueryRow(`SELECT user_id FROM custom_orders WHERE id = $1`, orderID).Scan(&ownerID); err != nil || ownerID != userID {
+		http.Error(w, "Hanya pemilik pesanan yang dapat menyetujui desain", http.StatusForbidden)
+		return
+	}
+	approvalID, err := strconv.Atoi(mux.Vars(r)["approvalId"])
+	if err != nil {
+		http.Error(w, "Invalid approval ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Setuju   bool   `json:"setuju"`
+		Komentar string `json:"komentar"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	req.Komentar = strings.TrimSpace(req.Komentar)
+	if !req.Setuju && req.Komentar == "" {
+		http.Error(w, "Komentar wajib diisi saat meminta revisi", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error saving response", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	approval, err := services.RespondDesignApproval(tx, orderID, approvalID, req.Setuju, req.Komentar, services.ActorUser(userID))
+	switch {
+	case errors.Is(err, services.ErrApprovalNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrApprovalAnswered):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error responding to design approval %d: %v", approvalID, err)
+		http.Error(w, "Error saving response", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing design approval %d: %v", approvalID, err)
+		http.Error(w, "Error saving response", http.StatusInternalServerError)
+		return
+	}
+
+	hasil := "meminta revisi"
+	if req.Setuju {
+		hasil = "menyetujui"
+	}
+	services.NotifyAdmins(database.DB,
+		fmt.Sprintf("Pelanggan %s desain pesanan #%d", hasil, orderID),
+		fmt.Sprintf("<p>Pelanggan %s desain pesanan #%d.</p><p>%s</p>", hasil, orderID, html.EscapeString(approval.Komentar)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(approval)
+}
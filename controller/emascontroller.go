@@ -19,8 +19,8 @@ func TambahEmas(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Query untuk memasukkan data ke database
-	query := `INSERT INTO emas (nama, karatan, berat, harga) VALUES ($1, $2, $3, $4)`
-	_, err = database.DB.Exec(query, emas.Nama, emas.Karatan, emas.Berat, emas.Harga)
+	query := `INSERT INTO emas (nama, karatan, berat, harga, stok) VALUES ($1, $2, $3, $4, $5)`
+	_, err = database.DB.Exec(query, emas.Nama, emas.Karatan, emas.Berat, emas.Harga, emas.Stok)
 	if err != nil {
 		log.Printf("Error inserting data into database: %v", err)
 		http.Error(w, "Error saving to database", http.StatusInternalServerError)
@@ -40,7 +40,7 @@ func GetAllEmas(w http.ResponseWriter, r *http.Request) {
 	var emasList []model.Emas
 
 	// Query untuk mengambil semua data emas
-	Query := `SELECT id, nama, karatan, berat, harga FROM emas`
+	Query := `SELECT id, nama, karatan, berat, harga, stok FROM emas`
 	rows, err := database.DB.Query(Query)
 	if err != nil {
 		log.Printf("Error reading data from database: %v", err)
@@ -53,7 +53,7 @@ func GetAllEmas(w http.ResponseWriter, r *http.Request) {
 	// Iterasi hasil query
 	for rows.Next() {
 		var emas model.Emas
-		if err := rows.Scan(&emas.ID, &emas.Nama, &emas.Karatan, &emas.Berat, &emas.Harga); err != nil {
+		if err := rows.Scan(&emas.ID, &emas.Nama, &emas.Karatan, &emas.Berat, &emas.Harga, &emas.Stok); err != nil {
 			log.Printf("Error scanning data: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": "Error scanning data"})
@@ -89,10 +89,11 @@ func UpdateEmas(w http.ResponseWriter, r *http.Request) {
 
 	// Parse data dari body request
 	var emasRequest struct {
-		Nama    string  `json:"nama"`
-		Karatan int     `json:"karatan"`
-		Berat   float64 `json:"berat"`
-		Harga   float64 `json:"harga"`
+		Nama    string       `json:"nama"`
+		Karatan int          `json:"karatan"`
+		Berat   model.Gram   `json:"berat"`
+		Harga   model.Rupiah `json:"harga"`
+		Stok    int          `json:"stok"`
 	}
 	err := json.NewDecoder(r.Body).Decode(&emasRequest)
 	if err != nil {
@@ -100,8 +101,8 @@ func UpdateEmas(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	Query := `UPDATE emas SET nama=$1, karatan=$2, berat=$3, harga=$4 WHERE id=$5`
-	_, err = database.DB.Exec(Query, emasRequest.Nama, emasRequest.Karatan, emasRequest.Berat, emasRequest.Harga, id)
+	Query := `UPDATE emas SET nama=$1, karatan=$2, berat=$3, harga=$4, stok=$5 WHERE id=$6`
+	_, err = database.DB.Exec(Query, emasRequest.Nama, emasRequest.Karatan, emasRequest.Berat, emasRequest.Harga, emasRequest.Stok, id)
 	if err != nil {
 		log.Printf("Error updating data: %v", err)
 		http.Error(w, "Error updating data", http.StatusInternalServerError)
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// fakeGatewayFromRequest mengembalikan gateway fake; endpoint simulasi tidak ada jika gateway
+// yang aktif adalah Midtrans
+func fakeGatewayFromRequest(w http.ResponseWriter, r *http.Request) (*services.FakeGateway, bool) {
+	gateway, ok := services.NewPaymentGateway().(*services.FakeGateway)
+	if !ok {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return gateway, true
+}
+
+// HandleGetFakePayment menampilkan status transaksi di gateway fake (halaman bayar simulasi)
+func HandleGetFakePayment(w http.ResponseWriter, r *http.Request) {
+	gateway, ok := fakeGatewayFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	transaction, err := gateway.GetStatus(mux.Vars(r)["order_id"])
+	if errors.Is(err, services.ErrGatewayTransactionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transaction)
+}
+
+// HandleSimulateFakePayment mengubah status transaksi di gateway fake, misalnya
+// {"transaction_status": "settlement", "payment_type": "bank_transfer"}, lalu mengirim webhook
+func HandleSimulateFakePayment(w http.ResponseWriter, r *http.Request) {
+	gateway, ok := fakeGatewayFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		TransactionStatus string `json:"transaction_status"`
+		PaymentType       string `json:"payment_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TransactionStatus == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	orderID := mux.Vars(r)["order_id"]
+	body, err := gateway.Simulate(orderID, req.TransactionStatus, req.PaymentType)
+	if errors.Is(err, services.ErrGatewayTransactionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error sending simulated webhook for %s: %v", orderID, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,341 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// hidePickupCode menyembunyikan kode pengambilan dari selain pemilik pesanan,
+// supaya kode hanya bisa ditunjukkan pelanggan saat mengambil di cabang
+func hidePickupCode(f *model.Fulfillment, ownerID, userID int) {
+	if ownerID != userID {
+		f.KodePickup = ""
+	}
+}
+
+// fulfillmentErrorStatus memetakan error pengambilan/pengiriman ke status HTTP; 0 untuk error lain
+func fulfillmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidFulfillment), errors.Is(err, services.ErrNoShippingRate),
+		errors.Is(err, services.ErrPickupCode), errors.Is(err, services.ErrShipmentStatus):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrBranchNotFound), errors.Is(err, services.ErrFulfillmentNotFound),
+		errors.Is(err, services.ErrShipmentNotFound), errors.Is(err, services.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrFulfillmentLocked), errors.Is(err, services.ErrFulfillmentMethod),
+		errors.Is(err, services.ErrScheduleActive), errors.Is(err, services.ErrInvalidTransition):
+		return http.StatusConflict
+	}
+	return 0
+}
+
+// HandleGetBranches mengembalikan cabang tempat pesanan bisa diambil
+func HandleGetBranches(w http.ResponseWriter, r *http.Request) {
+	branches, err := services.ListBranches(database.DB)
+	if err != nil {
+		log.Printf("Error fetching branches: %v", err)
+		http.Error(w, "Error fetching branches", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(branches)
+}
+
+// HandleGetShippingRates menampilkan tarif kurir untuk paket pesanan.
+// Query: ?kota= (wajib), ?kode_pos= dan ?kurir= (opsional).
+func HandleGetShippingRates(w http.ResponseWriter, r *http.Request) {
+	_, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	alamat := model.AlamatPengiriman{
+		Kota:    r.URL.Query().Get("kota"),
+		KodePos: r.URL.Query().Get("kode_pos"),
+	}
+	rates, err := services.ShippingRatesForOrder(database.DB, services.NewShippingRateProvider(), orderID, alamat, r.URL.Query().Get("kurir"))
+	if status := fulfillmentErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching shipping rates for order %d: %v", orderID, err)
+		http.Error(w, "Gagal mengambil tarif pengiriman", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
+
+// HandleGetFulfillment mengembalikan pilihan pengambilan pesanan beserta riwayat pengirimannya
+func HandleGetFulfillment(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	fulfillment, err := services.GetFulfillment(database.DB, orderID)
+	if errors.Is(err, services.ErrFulfillmentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching fulfillment of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching fulfillment", http.StatusInternalServerError)
+		return
+	}
+
+	var ownerID int
+	if err := database.DB.QueryRow(`SELECT user_id FROM custom_orders WHERE id = $1`, orderID).Scan(&ownerID); err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		http.Error(w, "Error fetching fulfillment", http.StatusInternalServerError)
+		return
+	}
+	hidePickupCode(&fulfillment, ownerID, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fulfillment)
+}
+
+// HandleSetFulfillment memilih ambil di cabang atau kirim kurir untuk pesanan yang belum dibayar.
+// Ongkos kirim dan asuransi masuk ke total; tagihan yang masih pending dibatalkan karena totalnya berubah.
+func HandleSetFulfillment(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	var req services.FulfillmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	if err := database.DB.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1`, orderID).Scan(&status); err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
+		return
+	}
+	if status != services.OrderDraft && status != services.OrderAwaitingPayment {
+		http.Error(w, services.ErrFulfillmentLocked.Error(), http.StatusConflict)
+		return
+	}
+	// Tagihan cicilan yang masih pending tidak boleh ikut dibatalkan
+	if active, err := services.HasActivePaymentSchedule(database.DB, orderID); err != nil {
+		log.Printf("Error checking payment schedule of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
+		return
+	} else if active {
+		http.Error(w, services.ErrScheduleActive.Error(), http.StatusConflict)
+		return
+	}
+	if status == services.OrderAwaitingPayment {
+		if err := services.CancelPendingPayments(database.DB, orderID); err != nil {
+			writeCancelPaymentsError(w, orderID, err)
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error saving fulfillment", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	fulfillment, breakdown, err := services.SetFulfillment(tx, services.NewShippingRateProvider(), orderID, req, services.ActorUser(userID))
+	if status := fulfillmentErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving fulfillment of order %d: %v", orderID, err)
+		http.Error(w, "Error saving fulfillment", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing fulfillment of order %d: %v", orderID, err)
+		http.Error(w, "Error saving fulfillment", http.StatusInternalServerError)
+		return
+	}
+
+	var ownerID int
+	if err := database.DB.QueryRow(`SELECT user_id FROM custom_orders WHERE id = $1`, orderID).Scan(&ownerID); err == nil {
+		hidePickupCode(&fulfillment, ownerID, userID)
+	} else {
+		fulfillment.KodePickup = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pengiriman":  fulfillment,
+		"total_harga": breakdown.Total,
+		"rincian":     breakdown,
+	})
+}
+
+// HandleCreateShipment mencatat paket yang diserahkan ke kurir beserta nomor resinya (admin)
+func HandleCreateShipment(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireRole(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Kurir   string `json:"kurir"`
+		Layanan string `json:"layanan"`
+		NoResi  string `json:"no_resi"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating shipment", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	shipment, err := services.CreateShipment(tx, orderID, req.Kurir, req.Layanan, req.NoResi, services.ActorUser(adminID))
+	if status := fulfillmentErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating shipment for order %d: %v", orderID, err)
+		http.Error(w, "Error creating shipment", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing shipment for order %d: %v", orderID, err)
+		http.Error(w, "Error creating shipment", http.StatusInternalServerError)
+		return
+	}
+
+	services.NotifyOrderOwner(database.DB, orderID,
+		fmt.Sprintf("Pesanan #%d sudah dikirim", orderID),
+		fmt.Sprintf("<p>Pesanan #%d sudah diserahkan ke kurir %s %s dengan nomor resi <b>%s</b>.</p>",
+			orderID, html.EscapeString(shipment.Kurir), html.EscapeString(shipment.Layanan), html.EscapeString(shipment.NoResi)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(shipment)
+}
+
+// HandleUpdateShipment mencatat paket diterima (delivered) atau dikembalikan kurir (returned) (admin)
+func HandleUpdateShipment(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireRole(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+	shipmentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid shipment ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Status  string `json:"status"`
+		Catatan string `json:"catatan"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error updating shipment", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	shipment, err := services.UpdateShipmentStatus(tx, shipmentID, req.Status, strings.TrimSpace(req.Catatan), services.ActorUser(adminID))
+	if status := fulfillmentErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating shipment %d: %v", shipmentID, err)
+		http.Error(w, "Error updating shipment", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing shipment %d: %v", shipmentID, err)
+		http.Error(w, "Error updating shipment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shipment)
+}
+
+// HandleConfirmPickup mencocokkan kode pengambilan yang ditunjukkan pelanggan di cabang (admin)
+func HandleConfirmPickup(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireRole(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		KodePickup string `json:"kode_pickup"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error confirming pickup", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	fulfillment, err := services.ConfirmPickup(tx, orderID, req.KodePickup, services.ActorUser(adminID))
+	if status := fulfillmentErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error confirming pickup of order %d: %v", orderID, err)
+		http.Error(w, "Error confirming pickup", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing pickup of order %d: %v", orderID, err)
+		http.Error(w, "Error confirming pickup", http.StatusInternalServerError)
+		return
+	}
+
+	fulfillment.KodePickup = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fulfillment)
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"proyek3/config"
+	"proyek3/database"
+	"proyek3/services"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+)
+
+// Role user
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var (
+	errMissingAuthHeader = errors.New("authorization header missing")
+	errInvalidAuthFormat = errors.New("invalid authorization format")
+	errInvalidToken      = errors.New("invalid token")
+)
+
+// getUserIDFromRequest mengambil user_id dari token JWT pada header Authorization
+func getUserIDFromRequest(r *http.Request) (int, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return 0, errMissingAuthHeader
+	}
+
+	// Pisahkan "Bearer" dan tokennya
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return 0, errInvalidAuthFormat
+	}
+
+	claims := &config.Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.JwtSecret), nil
+	})
+	if err != nil || !token.Valid || claims.UserID == 0 {
+		return 0, errInvalidToken
+	}
+
+	return claims.UserID, nil
+}
+
+// writeAuthError mengirim respons 401 sesuai error autentikasi
+func writeAuthError(w http.ResponseWriter, err error) {
+	switch err {
+	case errMissingAuthHeader:
+		http.Error(w, `{"message": "Authorization header missing"}`, http.StatusUnauthorized)
+	case errInvalidAuthFormat:
+		http.Error(w, `{"message": "Invalid Authorization format"}`, http.StatusUnauthorized)
+	default:
+		http.Error(w, `{"message": "Invalid token"}`, http.StatusUnauthorized)
+	}
+}
+
+// isVoucherError bernilai true untuk error voucher yang boleh ditampilkan ke klien
+func isVoucherError(err error) bool {
+	switch err {
+	case services.ErrVoucherNotFound, services.ErrVoucherNotActive, services.ErrVoucherNotApplicable,
+		services.ErrVoucherMinPurchase, services.ErrVoucherExhausted:
+		return true
+	}
+	return false
+}
+
+// orderRequestError mengubah error validasi OrderRequest menjadi pesan untuk klien
+func orderRequestError(err error) string {
+	if errors.Is(err, services.ErrInvalidPersonalisasi) || errors.Is(err, services.ErrOrderInputTooLarge) {
+		return err.Error()
+	}
+	return "Missing required fields"
+}
+
+// getUserRole membaca role user dari database. Role tidak diambil dari token
+// karena token login tidak selalu memuat role.
+func getUserRole(userID int) (string, error) {
+	var role string
+	err := database.DB.QueryRow(`SELECT role FROM "user" WHERE id = $1`, userID).Scan(&role)
+	return role, err
+}
+
+// requireRole memastikan pemanggil sudah login dan memiliki salah satu role yang diizinkan.
+// Jika tidak, respons error sudah dikirim dan ok bernilai false.
+func requireRole(w http.ResponseWriter, r *http.Request, roles ...string) (userID int, ok bool) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return 0, false
+	}
+
+	role, err := getUserRole(userID)
+	if err != nil {
+		log.Printf("Error fetching role for user %d: %v", userID, err)
+		http.Error(w, `{"message": "Forbidden"}`, http.StatusForbidden)
+		return 0, false
+	}
+	for _, allowed := range roles {
+		if role == allowed {
+			return userID, true
+		}
+	}
+
+	http.Error(w, `{"message": "Forbidden"}`, http.StatusForbidden)
+	return 0, false
+}
+
+// authorizeOrderAccess memastikan pesanan {id} ada dan milik pemanggil, atau pemanggil adalah admin.
+// Pesanan milik user lain dilaporkan sebagai 404 agar keberadaannya tidak bocor.
+func authorizeOrderAccess(w http.ResponseWriter, r *http.Request) (userID, orderID int, isAdmin, ok bool) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return 0, 0, false, false
+	}
+
+	orderID, err = strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID format", http.StatusBadRequest)
+		return 0, 0, false, false
+	}
+
+	role, err := getUserRole(userID)
+	if err != nil {
+		log.Printf("Error fetching role for user %d: %v", userID, err)
+		http.Error(w, `{"message": "Forbidden"}`, http.StatusForbidden)
+		return 0, 0, false, false
+	}
+	isAdmin = role == RoleAdmin
+
+	var ownerID int
+	err = database.DB.QueryRow(`SELECT user_id FROM custom_orders WHERE id = $1`, orderID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID && !isAdmin) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return 0, 0, false, false
+	}
+	if err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
+		return 0, 0, false, false
+	}
+
+	return userID, orderID, isAdmin, true
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"proyek3/database"
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleDownloadInvoice mengirim nota PDF pesanan ke pemilik pesanan atau admin
+func HandleDownloadInvoice(w http.ResponseWriter, r *http.Request) {
+	_, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	invoice, err := services.GetInvoice(database.DB, orderID)
+	if errors.Is(err, services.ErrInvoiceNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching invoice of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching invoice", http.StatusInternalServerError)
+		return
+	}
+
+	pdf := services.RenderInvoicePDF(invoice)
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", services.InvoiceFilename(invoice)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.Write(pdf)
+}
+
+// HandleIssueInvoice menerbitkan nota untuk pesanan lunas yang belum memiliki nota,
+// misalnya pesanan lama atau jika penerbitan dari webhook gagal (admin).
+// Query ?kirim=true mengirim ulang email nota ke pelanggan.
+func HandleIssueInvoice(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID format", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	err = database.DB.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1`, orderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		http.Error(w, "Error issuing invoice", http.StatusInternalServerError)
+		return
+	}
+	switch status {
+	case services.OrderDraft, services.OrderAwaitingPayment, services.OrderCancelled:
+		http.Error(w, "Nota hanya untuk pesanan yang sudah dibayar", http.StatusConflict)
+		return
+	}
+
+	// Metode pembayaran diambil dari pembayaran utama yang lunas
+	var paymentOrderID, paymentType string
+	err = database.DB.QueryRow(`
+		SELECT order_id, COALESCE(payment_type, '') FROM payments
+		WHERE custom_order_id = $1 AND kind = $2 AND status = 'settlement'
+		ORDER BY updated_at DESC LIMIT 1`, orderID, services.PaymentKindOrder).Scan(&paymentOrderID, &paymentType)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error fetching payment of order %d: %v", orderID, err)
+		http.Error(w, "Error issuing invoice", http.StatusInternalServerError)
+		return
+	}
+
+	invoice, created, err := issueInvoice(orderID, paymentOrderID, paymentType)
+	if err != nil {
+		log.Printf("Error issuing invoice for order %d: %v", orderID, err)
+		http.Error(w, "Error issuing invoice", http.StatusInternalServerError)
+		return
+	}
+	if created || r.URL.Query().Get("kirim") == "true" {
+		services.SendInvoiceEmail(invoice)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(invoice)
+}
@@ -0,0 +1,402 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+)
+
+// HandleCancelOrder membatalkan pesanan oleh pelanggan atau admin selama produksi belum dimulai.
+// Pesanan dikunci selama pembatalan supaya notifikasi pembayaran yang datang bersamaan menunggu.
+// Transaksi Midtrans yang masih pending ikut dibatalkan dan pesanan yang sudah dibayar
+// dicatat sebagai refund yang harus diproses admin.
+func HandleCancelOrder(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, isAdmin, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Alasan string `json:"alasan"`
+	}
+	json.NewDecoder(r.Body).Decode(&req) // alasan bersifat opsional
+
+	actor, catatan := services.ActorUser(userID), "Dibatalkan pelanggan: "+req.Alasan
+	if isAdmin {
+		actor, catatan = services.ActorAdmin(userID), "Dibatalkan admin: "+req.Alasan
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error cancelling order", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	order, err := scanOrder(tx.QueryRow(`SELECT `+orderColumns+` FROM custom_orders WHERE id = $1 FOR UPDATE`, orderID))
+	if err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
+		return
+	}
+
+	switch order.Status {
+	case services.OrderDraft, services.OrderAwaitingPayment, services.OrderPaid:
+	default:
+		http.Error(w, "Pesanan yang sudah masuk produksi tidak dapat dibatalkan", http.StatusConflict)
+		return
+	}
+
+	// Batalkan transaksi pending di Midtrans sebelum status pesanan diubah. Kunci pesanan dilepas
+	// lebih dulu supaya pembayaran yang ternyata sudah diterima bisa dicatat.
+	if err := services.CancelPendingPayments(tx, orderID); err != nil {
+		tx.Rollback()
+		writeCancelPaymentsError(w, orderID, err)
+		return
+	}
+
+	paid, err := services.PaidAmount(tx, orderID)
+	if err != nil {
+		log.Printf("Error fetching paid amount of order %d: %v", orderID, err)
+		http.Error(w, "Error cancelling order", http.StatusInternalServerError)
+		return
+	}
+
+	if err := services.TransitionOrder(tx, orderID, services.OrderCancelled, actor, catatan); err != nil {
+		log.Printf("Error cancelling order %d: %v", orderID, err)
+		http.Error(w, "Pesanan tidak dapat dibatalkan", http.StatusConflict)
+		return
+	}
+	if err := services.ReleaseRedemptions(tx, orderID); err != nil {
+		log.Printf("Error releasing vouchers of order %d: %v", orderID, err)
+		http.Error(w, "Error cancelling order", http.StatusInternalServerError)
+		return
+	}
+	if err := services.ReleaseTradeInCredits(tx, orderID); err != nil {
+		log.Printf("Error releasing trade-in credits of order %d: %v", orderID, err)
+		http.Error(w, "Error cancelling order", http.StatusInternalServerError)
+		return
+	}
+	if err := services.ReverseOrderSavings(tx, orderID, actor); err != nil {
+		log.Printf("Error reversing gold savings of order %d: %v", orderID, err)
+		http.Error(w, "Error cancelling order", http.StatusInternalServerError)
+		return
+	}
+	if err := services.CancelPaymentSchedule(tx, orderID); err != nil {
+		log.Printf("Error cancelling payment schedule of order %d: %v", orderID, err)
+		http.Error(w, "Error cancelling order", http.StatusInternalServerError)
+		return
+	}
+	if err := services.RestockOrderItems(tx, orderID); err != nil {
+		log.Printf("Error restocking items of order %d: %v", orderID, err)
+		http.Error(w, "Error cancelling order", http.StatusInternalServerError)
+		return
+	}
+
+	adjustment := model.OrderAdjustment{
+		OrderID:   orderID,
+		Jenis:     services.AdjustmentCancellation,
+		Sebelum:   order,
+		Sesudah:   order,
+		TotalLama: order.TotalHarga,
+		TotalBaru: 0,
+		Selisih:   -paid,
+		Tindakan:  services.AdjustmentActionNone,
+		Alasan:    req.Alasan,
+		Actor:     actor,
+	}
+	adjustment.Sesudah.Status = services.OrderCancelled
+	if paid > 0 {
+		adjustment.Tindakan = services.AdjustmentActionRefundDue
+	}
+	if err := services.RecordAdjustment(tx, &adjustment); err != nil {
+		log.Printf("Error recording cancellation of order %d: %v", orderID, err)
+		http.Error(w, "Error cancelling order", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing cancellation of order %d: %v", orderID, err)
+		http.Error(w, "Error cancelling order", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Pesanan dibatalkan",
+		"id":         orderID,
+		"refund_due": paid,
+		"adjustment": adjustment.ID,
+		"status":     services.OrderCancelled,
+	})
+}
+
+// amendOrderRequest berisi field yang boleh diubah admin; field kosong tidak diubah
+type amendOrderRequest struct {
+	JenisEmas        string       `json:"jenis_emas"`
+	BeratEmas        model.Gram   `json:"berat_emas"`
+	CampuranTambahan *string      `json:"campuran_tambahan"`
+	PersentaseEmas   model.Persen `json:"persentase_emas"`
+	Alasan           string       `json:"alasan"`
+}
+
+// HandleAmendOrder mengubah berat, karat atau campuran pesanan oleh admin lalu menghitung ulang harga.
+// Pesanan yang sudah dibayar mendapat tagihan baru untuk kekurangan atau catatan refund untuk kelebihan bayar.
+func HandleAmendOrder(w http.ResponseWriter, r *http.Request) {
+	adminID, orderID, isAdmin, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+	if !isAdmin {
+		http.Error(w, `{"message": "Forbidden"}`, http.StatusForbidden)
+		return
+	}
+
+	var req amendOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Alasan) == "" {
+		http.Error(w, "Alasan perubahan wajib diisi", http.StatusBadRequest)
+		return
+	}
+
+	// Pesanan dikunci dari dibaca sampai diperbarui supaya notifikasi pembayaran yang datang
+	// bersamaan menunggu dan jumlah yang sudah dibayar tidak berubah di tengah perhitungan
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error amending order", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := scanOrder(tx.QueryRow(`SELECT `+orderColumns+` FROM custom_orders WHERE id = $1 FOR UPDATE`, orderID))
+	if err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
+		return
+	}
+	if before.Tipe == services.OrderTypeCart {
+		http.Error(w, "Pesanan keranjang tidak dapat diubah, batalkan dan buat pesanan baru", http.StatusConflict)
+		return
+	}
+
+	switch before.Status {
+	case services.OrderDraft, services.OrderAwaitingPayment, services.OrderPaid, services.OrderInProduction, services.OrderQualityCheck:
+	default:
+		http.Error(w, "Pesanan tidak dapat diubah pada status "+before.Status, http.StatusConflict)
+		return
+	}
+
+	after := before
+	if req.JenisEmas != "" {
+		after.JenisEmas = req.JenisEmas
+	}
+	if req.BeratEmas > 0 {
+		if req.BeratEmas > services.MaxBeratEmas {
+			http.Error(w, services.ErrOrderInputTooLarge.Error(), http.StatusBadRequest)
+			return
+		}
+		after.BeratEmas = req.BeratEmas
+	}
+	if req.CampuranTambahan != nil {
+		after.CampuranTambahan = *req.CampuranTambahan
+	}
+	if req.PersentaseEmas > 0 {
+		if req.PersentaseEmas > model.PersenDenominator {
+			http.Error(w, "persentase_emas maksimal 100", http.StatusBadRequest)
+			return
+		}
+		after.PersentaseEmas = req.PersentaseEmas
+	}
+
+	// Hitung ulang harga; diskon, ongkos kirim, kredit tukar tambah dan tabungan emas yang
+	// sudah ada tetap berlaku dengan nominal yang sama
+	rules := services.CurrentPricingRules()
+	breakdown, err := services.CalculateServerBreakdown(after, rules)
+	if err != nil {
+		http.Error(w, "Jenis emas atau batu tidak valid", http.StatusBadRequest)
+		return
+	}
+	if before.Rincian != nil {
+		var shipping, tradeIn, savings []model.PriceLine
+		for _, line := range before.Rincian.Items {
+			switch line.Kode {
+			case "diskon":
+				breakdown = services.ApplyDiscount(breakdown, line)
+			case "ongkir":
+				shipping = append(shipping, line)
+			case "tukar_tambah":
+				tradeIn = append(tradeIn, line)
+			case "tabungan_emas":
+				savings = append(savings, line)
+			}
+		}
+		breakdown = services.ApplyShipping(breakdown, shipping)
+		breakdown = services.ApplyTradeIn(breakdown, tradeIn)
+		breakdown = services.ApplySavings(breakdown, savings)
+	}
+	after.Rincian = &breakdown
+	after.TotalHarga = breakdown.Total
+	after.PriceSheetVersion, err = services.RecordPriceSheet(tx, rules)
+	if err != nil {
+		log.Printf("Error recording price sheet for order %d: %v", orderID, err)
+		http.Error(w, "Error amending order", http.StatusInternalServerError)
+		return
+	}
+
+	// Tagihan lama yang masih pending tidak berlaku lagi. Kunci pesanan dilepas lebih dulu
+	// supaya pembayaran yang ternyata sudah diterima bisa dicatat.
+	if err := services.CancelPendingPayments(tx, orderID); err != nil {
+		tx.Rollback()
+		writeCancelPaymentsError(w, orderID, err)
+		return
+	}
+
+	paid, err := services.PaidAmount(tx, orderID)
+	if err != nil {
+		log.Printf("Error fetching paid amount of order %d: %v", orderID, err)
+		http.Error(w, "Error amending order", http.StatusInternalServerError)
+		return
+	}
+
+	adjustment := model.OrderAdjustment{
+		OrderID:   orderID,
+		Jenis:     services.AdjustmentAmendment,
+		Sebelum:   before,
+		Sesudah:   after,
+		TotalLama: before.TotalHarga,
+		TotalBaru: after.TotalHarga,
+		Tindakan:  services.AdjustmentActionNone,
+		Alasan:    req.Alasan,
+		Actor:     services.ActorAdmin(adminID),
+	}
+
+	scheduled, err := services.HasActivePaymentSchedule(tx, orderID)
+	if err != nil {
+		log.Printf("Error checking payment schedule of order %d: %v", orderID, err)
+		http.Error(w, "Error amending order", http.StatusInternalServerError)
+		return
+	}
+
+	// Pesanan yang belum dibayar cukup membayar total baru lewat CreatePayment; pesanan dengan
+	// jadwal cicilan menyesuaikan tagihan yang belum dibayar
+	var snapResp services.PaymentCharge
+	if paid > 0 && !scheduled {
+		adjustment.Selisih = after.TotalHarga - paid
+		switch {
+		case adjustment.Selisih > 0:
+			adjustment.Tindakan = services.AdjustmentActionPaymentRequest
+			adjustment.PaymentOrderID = services.NewMidtransOrderID("adj")
+
+			var customer services.PaymentCustomer
+			err := tx.QueryRow(`SELECT name, email FROM "user" WHERE id = $1`, before.UserID).Scan(&customer.Name, &customer.Email)
+			if err != nil {
+				log.Printf("Error fetching customer of order %d: %v", orderID, err)
+				http.Error(w, "Error amending order", http.StatusInternalServerError)
+				return
+			}
+			snapResp, err = services.CreateCharge(adjustment.PaymentOrderID, adjustment.Selisih.Int64(), customer)
+			if err != nil {
+				// Tagihan lama sudah dibatalkan di gateway, jadi pembatalannya tetap disimpan
+				log.Printf("Error creating adjustment payment for order %d: %v", orderID, err)
+				if err := tx.Commit(); err != nil {
+					log.Printf("Error committing cancelled payments of order %d: %v", orderID, err)
+				}
+				http.Error(w, "Failed to create payment", http.StatusBadGateway)
+				return
+			}
+		case adjustment.Selisih < 0:
+			adjustment.Tindakan = services.AdjustmentActionRefundDue
+		}
+	}
+
+	rincian, err := json.Marshal(breakdown)
+	if err != nil {
+		http.Error(w, "Error encoding breakdown", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE custom_orders
+		SET jenis_emas = $1, berat_emas = $2, campuran_tambahan = $3, persentase_emas = $4,
+			total_harga = $5, rincian_harga = $6, price_sheet_version = $7, updated_at = NOW()
+		WHERE id = $8`,
+		after.JenisEmas, after.BeratEmas, after.CampuranTambahan, after.PersentaseEmas,
+		after.TotalHarga, rincian, after.PriceSheetVersion, orderID)
+	if err != nil {
+		log.Printf("Error updating order %d: %v", orderID, err)
+		http.Error(w, "Error amending order", http.StatusInternalServerError)
+		return
+	}
+
+	if scheduled {
+		_, err := services.ResizePaymentSchedule(tx, orderID, after.TotalHarga)
+		if errors.Is(err, services.ErrScheduleLocked) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Error resizing payment schedule of order %d: %v", orderID, err)
+			http.Error(w, "Error amending order", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if adjustment.Tindakan == services.AdjustmentActionPaymentRequest {
+		_, err = tx.Exec(`
+			INSERT INTO payments (order_id, custom_order_id, kind, gross_amount, customer_name, customer_email, token, redirect_url, status)
+			SELECT $1, $2, $3, $4, name, email, $5, $6, 'pending' FROM "user" WHERE id = $7`,
+			adjustment.PaymentOrderID, orderID, services.PaymentKindAdjustment, adjustment.Selisih,
+			snapResp.Token, snapResp.RedirectURL, before.UserID)
+		if err != nil {
+			log.Printf("Error saving adjustment payment for order %d: %v", orderID, err)
+			http.Error(w, "Error amending order", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := services.RecordAdjustment(tx, &adjustment); err != nil {
+		log.Printf("Error recording amendment of order %d: %v", orderID, err)
+		http.Error(w, "Error amending order", http.StatusInternalServerError)
+		return
+	}
+
+	err = services.RecordOrderEvent(tx, model.OrderEvent{
+		OrderID: orderID,
+		Tipe:    services.EventNote,
+		Keterangan: fmt.Sprintf("Pesanan diubah (%s): %s %s gram, total %s -> %s",
+			req.Alasan, after.JenisEmas, after.BeratEmas, before.TotalHarga, after.TotalHarga),
+		Actor: adjustment.Actor,
+	})
+	if err != nil {
+		log.Printf("Error recording amendment event of order %d: %v", orderID, err)
+		http.Error(w, "Error amending order", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing amendment of order %d: %v", orderID, err)
+		http.Error(w, "Error amending order", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":    "Pesanan diperbarui",
+		"adjustment": adjustment,
+	}
+	if snapResp.Token != "" {
+		response["token"] = snapResp.Token
+		response["redirect_url"] = snapResp.RedirectURL
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
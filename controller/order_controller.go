@@ -1,155 +1,268 @@
 package controller
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"time"
 
 	"log"
 	"net/http"
-	"proyek3/config"
 	"proyek3/database"
 	"proyek3/model"
+	"proyek3/services"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
 )
 
-// HandleGetOrders mengembalikan semua data pesanan dari database
-func HandleGetOrders(w http.ResponseWriter, r *http.Request) {
-	// Ambil data orders dari database, pastikan query mengambil id
-	rows, err := database.DB.Query(`SELECT id, jenis_perhiasan, jenis_emas, berat_emas, campuran_tambahan, persentase_emas, total_harga FROM custom_orders`)
+// orderColumns adalah kolom custom_orders yang dibaca oleh scanOrder
+const orderColumns = `id, COALESCE(tipe, 'custom'), user_id, jenis_perhiasan, jenis_emas, berat_emas, campuran_tambahan, persentase_emas,
+	total_harga, COALESCE(status, ''), COALESCE(price_sheet_version, ''), batu, personalisasi, rincian_harga,
+	COALESCE(order_id, ''), created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOrder membaca satu baris custom_orders sesuai urutan orderColumns
+func scanOrder(row rowScanner) (model.Order, error) {
+	var order model.Order
+	var batu, personalisasi, rincian []byte
+	err := row.Scan(&order.ID, &order.Tipe, &order.UserID, &order.JenisPerhiasan, &order.JenisEmas, &order.BeratEmas,
+		&order.CampuranTambahan, &order.PersentaseEmas, &order.TotalHarga, &order.Status,
+		&order.PriceSheetVersion, &batu, &personalisasi, &rincian, &order.MidtransOrderID, &order.CreatedAt)
+	if err != nil {
+		return order, err
+	}
+	if len(batu) > 0 {
+		if err := json.Unmarshal(batu, &order.Batu); err != nil {
+			return order, err
+		}
+	}
+	if order.Personalisasi, err = services.DecodePersonalisasi(personalisasi); err != nil {
+		return order, err
+	}
+	if len(rincian) > 0 {
+		order.Rincian = &model.PriceBreakdown{}
+		if err := json.Unmarshal(rincian, order.Rincian); err != nil {
+			return order, err
+		}
+	}
+	return order, nil
+}
+
+// parsePagination membaca ?page= dan ?limit= (default 1 dan 20, limit maksimal 100)
+func parsePagination(r *http.Request) (page, limit int) {
+	page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	return page, limit
+}
+
+// queryOrderPage menjalankan query daftar pesanan dengan filter dan paginasi lalu mengirim respons JSON
+func queryOrderPage(w http.ResponseWriter, r *http.Request, where []string, args []interface{}) {
+	page, limit := parsePagination(r)
+	whereSQL := ""
+	if len(where) > 0 {
+		whereSQL = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM custom_orders`+whereSQL, args...).Scan(&total); err != nil {
+		log.Printf("Error counting orders: %v", err)
+		http.Error(w, "Error fetching orders", http.StatusInternalServerError)
+		return
+	}
+
+	args = append(args, limit, (page-1)*limit)
+	query := fmt.Sprintf(`SELECT %s FROM custom_orders%s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d`,
+		orderColumns, whereSQL, len(args)-1, len(args))
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
+		log.Printf("Error fetching orders: %v", err)
 		http.Error(w, "Error fetching orders", http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 
-	var orders []model.Order
+	orders := []model.Order{}
 	for rows.Next() {
-		var order model.Order
-		// Scan nilai id bersama dengan kolom lainnya
-		if err := rows.Scan(&order.ID, &order.JenisPerhiasan, &order.JenisEmas, &order.BeratEmas, &order.CampuranTambahan, &order.PersentaseEmas, &order.TotalHarga); err != nil {
+		order, err := scanOrder(rows)
+		if err != nil {
+			log.Printf("Error scanning order: %v", err)
 			http.Error(w, "Error scanning order data", http.StatusInternalServerError)
 			return
 		}
 		orders = append(orders, order)
 	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating orders: %v", err)
+		http.Error(w, "Error fetching orders", http.StatusInternalServerError)
+		return
+	}
 
-	// Kirimkan respons sebagai JSON
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(orders); err != nil {
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data":  orders,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// HandleGetMyOrders mengembalikan pesanan milik user yang login, dengan paginasi
+func HandleGetMyOrders(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
 		return
 	}
+
+	queryOrderPage(w, r, []string{"user_id = $1"}, []interface{}{userID})
 }
 
-var jwtKey = []byte("ClWIuIWqLaIhl1GRZi-bYjsM4niJxUeQe4Ot4nObVHY") // Ganti dengan secret key Anda
-// HandleGetOrderById mengembalikan detail pesanan berdasarkan ID
-func HandleGetOrdersByUserId(w http.ResponseWriter, r *http.Request) {
-	// Ambil token dari header Authorization
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, `{"message": "Authorization header missing"}`, http.StatusUnauthorized)
+// HandleGetOrderByID mengembalikan detail satu pesanan beserta rincian harga dan pembayarannya.
+// Pesanan milik user lain dijawab 404.
+func HandleGetOrderByID(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
 		return
 	}
 
-	// Pisahkan "Bearer" dan tokennya
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		http.Error(w, `{"message": "Invalid Authorization format"}`, http.StatusUnauthorized)
+	order, err := scanOrder(database.DB.QueryRow(`SELECT `+orderColumns+` FROM custom_orders WHERE id = $1`, orderID))
+	if err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
 		return
 	}
 
-	// Parsing token
-	claims := &config.Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JwtSecret), nil
-	})
+	if order.Tipe == services.OrderTypeCart {
+		if order.Items, err = services.OrderItems(database.DB, order.ID); err != nil {
+			log.Printf("Error fetching items of order %d: %v", orderID, err)
+			http.Error(w, "Error fetching order", http.StatusInternalServerError)
+			return
+		}
+	}
 
-	// Periksa jika token valid
-	if err != nil || !token.Valid {
-		http.Error(w, `{"message": "Invalid token"}`, http.StatusUnauthorized)
+	fulfillment, err := services.GetFulfillment(database.DB, order.ID)
+	if err != nil && !errors.Is(err, services.ErrFulfillmentNotFound) {
+		log.Printf("Error fetching fulfillment of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
 		return
 	}
+	if err == nil {
+		hidePickupCode(&fulfillment, order.UserID, userID)
+		order.Pengiriman = &fulfillment
+	}
 
-	// Ambil user_id dari klaim token
-	userID := claims.UserID
-	fmt.Println("User ID:", userID)
-
-	// Query untuk mengambil data pesanan berdasarkan user_id
 	rows, err := database.DB.Query(`
-        SELECT id, jenis_perhiasan, jenis_emas, berat_emas, campuran_tambahan, persentase_emas, total_harga
-        FROM custom_orders
-        WHERE user_id = $1
-    `, userID)
+		SELECT id, order_id, COALESCE(custom_order_id, 0), COALESCE(transaction_id, ''), gross_amount,
+			COALESCE(status, ''), COALESCE(redirect_url, ''), created_at
+		FROM payments
+		WHERE custom_order_id = $1 OR (custom_order_id IS NULL AND order_id = NULLIF($2, ''))
+		ORDER BY created_at, id`, order.ID, order.MidtransOrderID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Internal server error"})
-		fmt.Println("Database query error:", err)
+		log.Printf("Error fetching payments of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 
-	// Parsing hasil query ke dalam slice
-	var orders []model.Order
 	for rows.Next() {
-		var order model.Order
-		if err := rows.Scan(
-			&order.ID,
-			&order.JenisPerhiasan,
-			&order.JenisEmas,
-			&order.BeratEmas,
-			&order.CampuranTambahan,
-			&order.PersentaseEmas,
-			&order.TotalHarga,
-		); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Error reading data"})
-			fmt.Println("Error scanning row:", err)
+		var p model.Payment
+		if err := rows.Scan(&p.ID, &p.OrderID, &p.CustomOrderID, &p.TransactionID, &p.GrossAmount, &p.Status, &p.RedirectURL, &p.CreatedAt); err != nil {
+			log.Printf("Error scanning payment: %v", err)
+			http.Error(w, "Error fetching order", http.StatusInternalServerError)
 			return
 		}
-		orders = append(orders, order)
+		order.Payments = append(order.Payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating payments: %v", err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
+		return
 	}
 
-	// Kirim respons JSON
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(orders)
+	json.NewEncoder(w).Encode(order)
 }
 
-// HandleAddOrder meng-handle POST request untuk menambahkan order ke database
-func HandleAddOrder(w http.ResponseWriter, r *http.Request) {
-	// Logging untuk debugging
-	log.Println("Handling Add Order Request")
-
-	// Ambil token dari header Authorization
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, `{"message": "Authorization header missing"}`, http.StatusUnauthorized)
+// HandleAdminGetOrders mengembalikan semua pesanan untuk admin dengan filter
+// ?status=, ?from= dan ?to= (YYYY-MM-DD), ?user_id= dan ?jenis_emas=
+func HandleAdminGetOrders(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
 		return
 	}
 
-	// Pisahkan "Bearer" dan tokennya
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		http.Error(w, `{"message": "Invalid Authorization format"}`, http.StatusUnauthorized)
-		return
+	var where []string
+	var args []interface{}
+	addFilter := func(clause string, value interface{}) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(clause, len(args)))
 	}
 
-	// Parsing token
-	claims := &config.Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JwtSecret), nil
-	})
+	q := r.URL.Query()
+	if status := q.Get("status"); status != "" {
+		if !services.IsValidOrderStatus(status) {
+			http.Error(w, "Unknown order status", http.StatusBadRequest)
+			return
+		}
+		addFilter("status = $%d", status)
+	}
+	if from := q.Get("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			http.Error(w, "Invalid from date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		addFilter("created_at >= $%d", t)
+	}
+	if to := q.Get("to"); to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			http.Error(w, "Invalid to date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		addFilter("created_at < $%d", t.AddDate(0, 0, 1))
+	}
+	if customer := q.Get("user_id"); customer != "" {
+		customerID, err := strconv.Atoi(customer)
+		if err != nil {
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+		addFilter("user_id = $%d", customerID)
+	}
+	if karat := q.Get("jenis_emas"); karat != "" {
+		addFilter("jenis_emas = $%d", karat)
+	}
+
+	queryOrderPage(w, r, where, args)
+}
 
-	// Periksa jika token valid
-	if err != nil || !token.Valid {
-		http.Error(w, `{"message": "Invalid token"}`, http.StatusUnauthorized)
+// HandleAddOrder meng-handle POST request untuk menambahkan order ke database
+func HandleAddOrder(w http.ResponseWriter, r *http.Request) {
+	// Logging untuk debugging
+	log.Println("Handling Add Order Request")
+
+	// Ambil user_id dari token di header Authorization
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
 		return
 	}
-
-	// Ambil user_id dari klaim token
-	userID := claims.UserID
 	log.Printf("User ID from token: %d", userID)
 
 	// Parse data dari body request
@@ -170,33 +283,250 @@ func HandleAddOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validasi data yang diperlukan
-	if order.JenisPerhiasan == "" || order.JenisEmas == "" || order.BeratEmas == 0 || order.PersentaseEmas == 0 || order.TotalHarga == 0 {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
-		log.Println("Validation failed: Missing required fields")
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error saving to database", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Jika pesanan memakai quote, harga dan spesifikasi diambil dari quote yang terkunci
+	var quoteID *string
+	var breakdown model.PriceBreakdown
+	var priceSheetVersion string
+	if order.QuoteID != "" {
+		quote, err := loadQuoteForUpdate(tx, order.QuoteID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Quote tidak ditemukan atau sudah dipakai", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error reading quote", http.StatusInternalServerError)
+			log.Printf("Error loading quote %s: %v", order.QuoteID, err)
+			return
+		}
+		if quote.UserID != userID {
+			http.Error(w, "Quote tidak ditemukan atau sudah dipakai", http.StatusNotFound)
+			return
+		}
+		if err := services.VerifyQuote(quote, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			log.Printf("Quote %s rejected: %v", quote.ID, err)
+			return
+		}
+
+		order.JenisPerhiasan = quote.JenisPerhiasan
+		order.JenisEmas = quote.JenisEmas
+		order.BeratEmas = quote.BeratEmas
+		order.CampuranTambahan = quote.CampuranTambahan
+		order.PersentaseEmas = quote.PersentaseEmas
+		order.Batu = quote.Batu
+		order.Personalisasi = quote.Personalisasi
+		breakdown = quote.Rincian // VerifyQuote memastikan totalnya sama dengan TotalHarga yang ditandatangani
+		priceSheetVersion = quote.PriceSheetVersion
+		quoteID = &quote.ID
+	}
+
+	// Validasi data yang diperlukan; total_harga tidak wajib karena dihitung server
+	if err := services.ValidateOrderRequest(order); err != nil {
+		http.Error(w, orderRequestError(err), http.StatusBadRequest)
+		log.Printf("Validation failed: %v", err)
 		return
 	}
 
 	// Logging data yang diterima
 	log.Printf("Received Order Data: %+v", order)
 
+	// Harga pesanan dengan quote sudah dikunci dan ditandatangani saat quote dibuat
+	if quoteID == nil {
+		// Hitung ulang rincian harga di server, jangan percaya total dari klien
+		spec := model.Order{
+			JenisPerhiasan:   order.JenisPerhiasan,
+			JenisEmas:        order.JenisEmas,
+			BeratEmas:        order.BeratEmas,
+			CampuranTambahan: order.CampuranTambahan,
+			PersentaseEmas:   order.PersentaseEmas,
+			Batu:             order.Batu,
+			Personalisasi:    order.Personalisasi,
+		}
+		rules := services.CurrentPricingRules()
+		breakdown, err = services.CalculateServerBreakdown(spec, rules)
+		if err != nil {
+			http.Error(w, "Jenis emas atau batu tidak valid", http.StatusBadRequest)
+			log.Printf("Error calculating price: %v", err)
+			return
+		}
+
+		// Promosi otomatis dan voucher diterapkan di atas harga server
+		breakdown, err = services.ApplyVouchers(tx, userID, spec, breakdown, order.KodeVoucher, time.Now())
+		if isVoucherError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error applying voucher", http.StatusInternalServerError)
+			log.Printf("Error applying vouchers: %v", err)
+			return
+		}
+
+		priceSheetVersion, err = services.RecordPriceSheet(tx, rules)
+		if err != nil {
+			http.Error(w, "Error saving to database", http.StatusInternalServerError)
+			log.Printf("Error recording price sheet: %v", err)
+			return
+		}
+
+		if err := services.VerifyClientTotal(order.TotalHarga, breakdown.Total); err != nil {
+			log.Printf("Price mismatch for user %d: client=%s server=%s", userID, order.TotalHarga, breakdown.Total)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":     "Total harga tidak sesuai, silakan muat ulang harga",
+				"total_harga": breakdown.Total,
+				"rincian":     breakdown,
+			})
+			return
+		}
+	}
+	totalHarga := breakdown.Total
+
+	batu, err := json.Marshal(order.Batu)
+	if err != nil {
+		http.Error(w, "Error encoding stones", http.StatusInternalServerError)
+		return
+	}
+	rincian, err := json.Marshal(breakdown)
+	if err != nil {
+		http.Error(w, "Error encoding breakdown", http.StatusInternalServerError)
+		return
+	}
+
+	personalisasi, err := services.EncodePersonalisasi(order.Personalisasi)
+	if err != nil {
+		http.Error(w, "Error encoding personalization", http.StatusInternalServerError)
+		return
+	}
+
 	// Query untuk memasukkan data ke database
-	query := `INSERT INTO custom_orders (user_id, jenis_perhiasan, jenis_emas, berat_emas, campuran_tambahan, persentase_emas, total_harga) 
-              VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	query := `INSERT INTO custom_orders (user_id, jenis_perhiasan, jenis_emas, berat_emas, campuran_tambahan, persentase_emas, batu, personalisasi, total_harga, rincian_harga, price_sheet_version, quote_id) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`
 	var id int
-	err = database.DB.QueryRow(query, userID, order.JenisPerhiasan, order.JenisEmas, order.BeratEmas, order.CampuranTambahan, order.PersentaseEmas, order.TotalHarga).Scan(&id)
+	err = tx.QueryRow(query, userID, order.JenisPerhiasan, order.JenisEmas, order.BeratEmas, order.CampuranTambahan, order.PersentaseEmas, batu, personalisasi, totalHarga, rincian, priceSheetVersion, quoteID).Scan(&id)
 	if err != nil {
 		http.Error(w, "Error saving to database", http.StatusInternalServerError)
 		log.Printf("Error inserting data into database: %v", err)
 		return
 	}
 
+	if err := services.InitOrderStatus(tx, id, services.ActorUser(userID)); err != nil {
+		http.Error(w, "Error saving to database", http.StatusInternalServerError)
+		log.Printf("Error setting initial order status: %v", err)
+		return
+	}
+
+	// Catat pemakaian voucher; kuota dikembalikan jika pembayaran gagal atau kedaluwarsa
+	if err := services.ReserveRedemptions(tx, id, userID, breakdown, time.Now()); err != nil {
+		if isVoucherError(err) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error saving to database", http.StatusInternalServerError)
+		log.Printf("Error reserving vouchers: %v", err)
+		return
+	}
+
+	if quoteID != nil {
+		if _, err := tx.Exec(`UPDATE quotes SET custom_order_id = $1 WHERE id = $2`, id, *quoteID); err != nil {
+			http.Error(w, "Error saving to database", http.StatusInternalServerError)
+			log.Printf("Error marking quote as used: %v", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error saving to database", http.StatusInternalServerError)
+		log.Printf("Error committing order: %v", err)
+		return
+	}
+
 	// Response sukses
 	response := map[string]interface{}{
-		"message": "Emas berhasil ditambahkan",
-		"id":      id,
+		"message":             "Emas berhasil ditambahkan",
+		"id":                  id,
+		"total_harga":         totalHarga,
+		"rincian":             breakdown,
+		"price_sheet_version": priceSheetVersion,
+		"status":              services.OrderDraft,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// HandleUpdateOrderStatus mengubah status produksi pesanan (in_production, quality_check, ready) oleh
+// admin melalui state machine. Pembayaran, pembatalan, refund dan pengiriman punya endpoint sendiri.
+func HandleUpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireRole(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if !services.IsValidOrderStatus(req.Status) {
+		http.Error(w, "Unknown order status", http.StatusBadRequest)
+		return
+	}
+	if !services.IsProductionStatus(req.Status) {
+		http.Error(w, "Status "+req.Status+" diubah lewat endpoint pembayaran, pembatalan, refund atau pengiriman", http.StatusConflict)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error updating order status", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	err = services.TransitionOrder(tx, orderID, req.Status, services.ActorAdmin(adminID), req.Note)
+	if err == services.ErrOrderNotFound {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, services.ErrInvalidTransition) || errors.Is(err, services.ErrDesignNotApproved) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating status of order %d: %v", orderID, err)
+		http.Error(w, "Error updating order status", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing status of order %d: %v", orderID, err)
+		http.Error(w, "Error updating order status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Status pesanan diperbarui",
+		"id":      orderID,
+		"status":  req.Status,
+	})
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+)
+
+// HandleGetOrderTimeline mengembalikan riwayat pesanan untuk halaman pelacakan (pemilik atau admin)
+func HandleGetOrderTimeline(w http.ResponseWriter, r *http.Request) {
+	_, orderID, isAdmin, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := services.OrderTimeline(database.DB, orderID, isAdmin)
+	if err != nil {
+		log.Printf("Error fetching timeline of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching timeline", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"order_id": orderID,
+		"events":   events,
+	})
+}
+
+// HandleAddOrderEvent menambahkan catatan admin atau foto produksi ke timeline pesanan
+func HandleAddOrderEvent(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, isAdmin, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+	if !isAdmin {
+		http.Error(w, `{"message": "Forbidden"}`, http.StatusForbidden)
+		return
+	}
+
+	var event model.OrderEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	switch event.Tipe {
+	case services.EventNote:
+		if strings.TrimSpace(event.Keterangan) == "" {
+			http.Error(w, "Keterangan wajib diisi", http.StatusBadRequest)
+			return
+		}
+		event.FotoURL = ""
+	case services.EventPhoto:
+		if !strings.HasPrefix(event.FotoURL, "https://") {
+			http.Error(w, "foto_url harus berupa URL https", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Tipe harus note atau photo", http.StatusBadRequest)
+		return
+	}
+
+	event.OrderID = orderID
+	event.Status = ""
+	event.Actor = services.ActorUser(userID)
+	if err := services.RecordOrderEvent(database.DB, event); err != nil {
+		log.Printf("Error recording event for order %d: %v", orderID, err)
+		http.Error(w, "Error saving event", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Kejadian ditambahkan ke timeline"})
+}
@@ -1,16 +1,22 @@
 package controller
 
 import (
+	"database/sql"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"proyek3/config"
 	"proyek3/database"
+	"proyek3/model"
 	"proyek3/services"
-
-	"github.com/veritrans/go-midtrans"
 )
 
 type CustomerDetails struct {
@@ -21,11 +27,18 @@ type CustomerDetails struct {
 
 type PaymentRequest struct {
 	CustomOrderID   int             `json:"custom_order_id"`
-	GrossAmount     int64           `json:"gross_amount"`
+	GrossAmount     model.Rupiah    `json:"gross_amount"`
 	CustomerDetails CustomerDetails `json:"customer_details"`
 }
 
 func CreatePayment(w http.ResponseWriter, r *http.Request) {
+	// Pembayaran hanya boleh dibuat oleh pemilik pesanan
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
 	var req PaymentRequest
 
 	// Decode JSON request
@@ -34,76 +47,192 @@ func CreatePayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate Order ID
-	orderID := "order-" + time.Now().Format("20060102150405")
+	// Ambil pesanan yang tersimpan, bukan data dari klien
+	var order model.Order
+	var priceSheetVersion, status sql.NullString
+	err = database.DB.QueryRow(`
+		SELECT id, jenis_perhiasan, jenis_emas, berat_emas, campuran_tambahan, persentase_emas, total_harga, price_sheet_version, status
+		FROM custom_orders
+		WHERE id = $1 AND user_id = $2`,
+		req.CustomOrderID, userID).Scan(&order.ID, &order.JenisPerhiasan, &order.JenisEmas, &order.BeratEmas, &order.CampuranTambahan, &order.PersentaseEmas, &order.TotalHarga, &priceSheetVersion, &status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching custom order %d: %v", req.CustomOrderID, err)
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		return
+	}
 
-	// Dapatkan client Midtrans
-	midtransClient := services.MidtransClient()
+	// Pembayaran hanya untuk pesanan yang belum dibayar
+	if status.String != services.OrderDraft && status.String != services.OrderAwaitingPayment {
+		http.Error(w, "Order cannot be paid in its current status", http.StatusConflict)
+		return
+	}
 
-	// Prepare Snap transaction request
-	snapGateway := midtrans.SnapGateway{Client: *midtransClient}
-	snapReq := &midtrans.SnapReq{
-		TransactionDetails: midtrans.TransactionDetails{
-			OrderID:  orderID,
-			GrossAmt: req.GrossAmount,
-		},
-		CustomerDetail: &midtrans.CustDetail{
-			FName: req.CustomerDetails.Name,
-			Email: req.CustomerDetails.Email,
-			Phone: req.CustomerDetails.Phone,
-		},
+	// Pesanan dengan jadwal cicilan dibayar per tagihan
+	if active, err := services.HasActivePaymentSchedule(database.DB, order.ID); err != nil {
+		log.Printf("Error checking payment schedule of order %d: %v", order.ID, err)
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		return
+	} else if active {
+		http.Error(w, services.ErrScheduleActive.Error(), http.StatusConflict)
+		return
 	}
 
-	// Dapatkan token Snap
-	snapResp, err := snapGateway.GetToken(snapReq)
+	// Jumlah yang ditagihkan selalu hasil hitungan server. Pesanan yang sudah
+	// memiliki versi daftar harga dihitung server saat dibuat (termasuk harga
+	// terkunci dari quote); pesanan lama dihitung ulang.
+	totalHarga := order.TotalHarga
+	if !priceSheetVersion.Valid {
+		rules := services.CurrentPricingRules()
+		totalHarga, err = services.CalculateServerPrice(order, rules)
+		if err != nil {
+			log.Printf("Error calculating price for order %d: %v", order.ID, err)
+			http.Error(w, "Invalid order data", http.StatusBadRequest)
+			return
+		}
+		priceSheetVersion.String, err = services.RecordPriceSheet(database.DB, rules)
+		if err != nil {
+			log.Printf("Error recording price sheet for order %d: %v", order.ID, err)
+			http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := services.VerifyClientTotal(req.GrossAmount, totalHarga); err != nil {
+		log.Printf("Gross amount mismatch for order %d: client=%s server=%s", order.ID, req.GrossAmount, totalHarga)
+		http.Error(w, "Gross amount does not match order total", http.StatusConflict)
+		return
+	}
+	order.TotalHarga = totalHarga
+	order.PriceSheetVersion = priceSheetVersion.String
+
+	orderID, snapResp, err := startOrderPayment(order, req.CustomerDetails, services.ActorUser(userID))
+	var completed *services.PaymentCompletedError
+	if errors.As(err, &completed) {
+		writeCancelPaymentsError(w, order.ID, err)
+		return
+	}
+	if errors.Is(err, services.ErrInvalidTransition) {
+		http.Error(w, "Order cannot be paid in its current status", http.StatusConflict)
+		return
+	}
 	if err != nil {
+		log.Printf("Error creating payment for order %d: %v", order.ID, err)
 		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
-		log.Printf("Error getting snap token: %v", err)
 		return
 	}
+	log.Printf("Pembayaran %s dibuat untuk pesanan %d", orderID, order.ID)
 
-	// Simpan pembayaran ke `payments`
-	// Pastikan order_id ada di custom_orders sebelum menyimpan di payments
-_, err = database.DB.Exec(`
-UPDATE custom_orders
-SET order_id = $1
-WHERE id = $2`,
-orderID, req.CustomOrderID) // pastikan req.CustomOrderID adalah ID order yang benar
-
-if err != nil {
-log.Printf("Error updating custom_orders with order_id: %v", err)
-http.Error(w, "Failed to update custom_orders", http.StatusInternalServerError)
-return
+	// Kirim response token dan redirect URL
+	response := map[string]interface{}{
+		"token":        snapResp.Token,
+		"redirect_url": snapResp.RedirectURL,
+		"gross_amount": totalHarga,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
+// writeCancelPaymentsError menjawab kegagalan membatalkan transaksi pending pesanan. Transaksi yang
+// ternyata sudah dibayar diterapkan lewat inbox pembayaran dan perubahan pesanan ditolak, sehingga
+// pembayaran pelanggan tidak pernah ditandai batal. Pemanggil yang memegang transaksi database
+// harus melepasnya lebih dulu karena pesanan akan dikunci ulang.
+func writeCancelPaymentsError(w http.ResponseWriter, orderID int, err error) {
+	var completed *services.PaymentCompletedError
+	if errors.As(err, &completed) {
+		log.Printf("Transaksi pesanan %d sudah dibayar sebelum dibatalkan: %v", orderID, err)
+		if err := applyGatewayStatus(completed.Notification, "dibayar sebelum transaksi pending dibatalkan"); err != nil {
+			log.Printf("Error applying completed payment %s: %v", completed.Notification.OrderID, err)
+		}
+		http.Error(w, "Pembayaran pesanan sudah diterima, muat ulang pesanan", http.StatusConflict)
+		return
+	}
+	log.Printf("Error cancelling pending payments of order %d: %v", orderID, err)
+	http.Error(w, "Gagal membatalkan transaksi pembayaran", http.StatusBadGateway)
+}
 
-	// **Update order_id di custom_orders**
-	_, err = database.DB.Exec(`
-    INSERT INTO payments (
-        order_id, gross_amount, customer_name, customer_email, 
-        customer_phone, token, redirect_url, status
-    ) VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending')`,
-    orderID, req.GrossAmount, req.CustomerDetails.Name, req.CustomerDetails.Email, 
-    req.CustomerDetails.Phone, snapResp.Token, snapResp.RedirectURL)
+// startOrderPayment membuat tagihan di payment gateway untuk total pesanan, lalu dalam satu transaksi
+// database menyimpan order_id Midtrans ke custom_orders, mengubah status menjadi awaiting_payment
+// dan mencatat baris payments. Pesanan dikunci selama proses dan tagihan lama yang masih pending
+// dibatalkan lebih dulu sehingga pesanan hanya punya satu tagihan aktif.
+func startOrderPayment(order model.Order, customer CustomerDetails, actor string) (string, services.PaymentCharge, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", services.PaymentCharge{}, err
+	}
+	defer tx.Rollback()
 
-if err != nil {
-    log.Printf("Error saving payment data: %v", err)
-    http.Error(w, "Failed to save payment data", http.StatusInternalServerError)
-    return
-}
+	var status string
+	if err := tx.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1 FOR UPDATE`, order.ID).Scan(&status); err != nil {
+		return "", services.PaymentCharge{}, fmt.Errorf("lock custom_orders: %w", err)
+	}
+	if status != services.OrderDraft && status != services.OrderAwaitingPayment {
+		return "", services.PaymentCharge{}, fmt.Errorf("%w: %s", services.ErrInvalidTransition, status)
+	}
+	if err := services.CancelPendingPayments(tx, order.ID); err != nil {
+		return "", services.PaymentCharge{}, err
+	}
 
+	orderID := services.NewMidtransOrderID("order")
+	snapResp, err := services.CreateCharge(orderID, order.TotalHarga.Int64(), services.PaymentCustomer{
+		Name:  customer.Name,
+		Email: customer.Email,
+		Phone: customer.Phone,
+	})
+	if err != nil {
+		// Tagihan lama sudah dibatalkan di gateway; status cancel-nya tetap disimpan
+		if err := tx.Commit(); err != nil {
+			log.Printf("Error saving cancelled payments of order %d: %v", order.ID, err)
+		}
+		return orderID, snapResp, fmt.Errorf("snap token: %w", err)
+	}
 
-	// Kirim response token dan redirect URL
-	response := map[string]string{
-		"token":        snapResp.Token,
-		"redirect_url": snapResp.RedirectURL,
+	// **Update order_id dan total_harga di custom_orders**
+	_, err = tx.Exec(`
+		UPDATE custom_orders
+		SET order_id = $1, total_harga = $2, price_sheet_version = $3
+		WHERE id = $4`,
+		orderID, order.TotalHarga, order.PriceSheetVersion, order.ID)
+	if err != nil {
+		return orderID, snapResp, fmt.Errorf("update custom_orders: %w", err)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	if err := services.TransitionOrder(tx, order.ID, services.OrderAwaitingPayment, actor, "Pembayaran dibuat: "+orderID); err != nil {
+		return orderID, snapResp, fmt.Errorf("update order status: %w", err)
+	}
+
+	// Simpan pembayaran ke `payments`
+	_, err = tx.Exec(`
+		INSERT INTO payments (
+			order_id, custom_order_id, kind, gross_amount, customer_name, customer_email,
+			customer_phone, token, redirect_url, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 'pending')`,
+		orderID, order.ID, services.PaymentKindOrder, order.TotalHarga, customer.Name, customer.Email,
+		customer.Phone, snapResp.Token, snapResp.RedirectURL)
+	if err != nil {
+		return orderID, snapResp, fmt.Errorf("save payment: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return orderID, snapResp, fmt.Errorf("commit payment: %w", err)
+	}
+	return orderID, snapResp, nil
 }
 
+// notificationResponseStatus memetakan hasil verifikasi notifikasi yang ditolak ke status HTTP
+var notificationResponseStatus = map[string]int{
+	services.NotificationInvalidPayload:   http.StatusBadRequest,
+	services.NotificationInvalidSignature: http.StatusForbidden,
+	services.NotificationAmountMismatch:   http.StatusConflict,
+	services.NotificationUnknownPayment:   http.StatusNotFound,
+	services.NotificationStatusUnverified: http.StatusServiceUnavailable, // Midtrans akan mengirim ulang
+}
 
+// WebhookHandler menerima notifikasi Midtrans. Setiap notifikasi disimpan mentah beserta hasil
+// verifikasinya; notifikasi dengan signature_key dan gross_amount yang cocok masuk inbox pembayaran
+// dan diterapkan sekali per transaction_id dan status.
 func WebhookHandler(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -116,136 +245,428 @@ func WebhookHandler(w http.ResponseWriter, r *http.Request) {
 	// Debug log
 	log.Printf("Received Webhook: %s", string(body))
 
-	// Decode JSON payload
-	var notificationPayload map[string]interface{}
-	if err := json.Unmarshal(body, &notificationPayload); err != nil {
-		log.Println("Invalid JSON payload:", err)
-		http.Error(w, "Invalid payload", http.StatusBadRequest)
+	notification, err := services.ParseMidtransNotification(body)
+	verified := notification
+	hasil, keterangan := services.NotificationInvalidPayload, ""
+	if err != nil {
+		keterangan = err.Error()
+	} else {
+		verified, hasil, keterangan, err = services.VerifyMidtransNotification(database.DB, notification, config.MidtransVerifyStatus)
+		if err != nil {
+			log.Printf("Error verifying notification for %s: %v", notification.OrderID, err)
+			http.Error(w, "Gagal memverifikasi notifikasi", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Midtrans mengirim ulang notifikasi yang sama; yang sudah diproses cukup dijawab 200
+	var entry services.InboxEntry
+	if hasil == services.NotificationVerified {
+		var duplicate bool
+		entry, duplicate, err = services.EnqueuePaymentNotification(database.DB, verified)
+		if err != nil {
+			log.Printf("Error queueing notification for %s: %v", notification.OrderID, err)
+			http.Error(w, "Gagal menyimpan notifikasi", http.StatusInternalServerError)
+			return
+		}
+		if duplicate {
+			hasil, keterangan = services.NotificationDuplicate, "notifikasi sudah pernah diproses"
+		}
+	}
+
+	notificationID, err := services.RecordMidtransNotification(database.DB, notification, body, services.NotificationSourceWebhook, hasil, keterangan)
+	if err != nil {
+		log.Printf("Error recording notification for %s: %v", notification.OrderID, err)
+		http.Error(w, "Gagal menyimpan notifikasi", http.StatusInternalServerError)
 		return
 	}
 
-	// Ambil Order ID
-	orderID, ok := notificationPayload["order_id"].(string)
-	if !ok {
-		log.Println("Order ID tidak valid")
-		http.Error(w, "Order ID tidak valid", http.StatusBadRequest)
+	switch hasil {
+	case services.NotificationVerified:
+	case services.NotificationDuplicate:
+		log.Printf("Notifikasi %s (%s) sudah pernah diproses", notification.OrderID, entry.TransactionStatus)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Notification already processed"))
+		return
+	default:
+		log.Printf("Notifikasi %s ditolak: %s %s", notification.OrderID, hasil, keterangan)
+		http.Error(w, "Notifikasi ditolak: "+hasil, notificationResponseStatus[hasil])
 		return
 	}
 
-	// Ambil Status Pembayaran
-	transactionStatus, ok := notificationPayload["transaction_status"].(string)
-	if !ok {
-		log.Println("Status transaksi tidak ditemukan")
-		http.Error(w, "Status transaksi tidak valid", http.StatusBadRequest)
+	message, err := processInboxEntry(entry.ID, notificationID)
+	if err != nil {
+		// Entri tetap received sehingga pengiriman ulang Midtrans memprosesnya kembali
+		log.Printf("Error processing notification %s (%s): %v", entry.OrderID, entry.TransactionStatus, err)
+		http.Error(w, "Gagal memproses notifikasi", http.StatusInternalServerError)
 		return
 	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(message))
+}
+
+// processInboxEntry menerapkan satu entri inbox dalam satu transaksi database. Baris payments
+// dikunci lebih dulu; status yang mundur atau bertentangan dengan status akhir diabaikan.
+// Nota diterbitkan setelah commit supaya kegagalan nota tidak membatalkan pembayaran.
+func processInboxEntry(entryID, notificationID int) (string, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	entry, err := services.LockInboxEntry(tx, entryID)
+	if err != nil {
+		return "", err
+	}
+	if entry.Status != services.InboxReceived {
+		// Pengiriman bersamaan sudah memproses entri ini
+		return "Notification already processed", nil
+	}
+
+	current, err := services.LockPaymentStatus(tx, entry.OrderID)
+	if err != nil {
+		return "", err
+	}
 
-	// Jika status "capture", cek fraud_status
-	if transactionStatus == "capture" {
-		fraudStatus, fraudOk := notificationPayload["fraud_status"].(string)
-		if fraudOk && fraudStatus == "accept" {
-			transactionStatus = "settlement"
-		} else {
-			transactionStatus = "failed"
+	message, paidOrderID := "Payment status unchanged", 0
+	if !services.PaymentStatusApplies(current, entry.TransactionStatus) {
+		log.Printf("Notifikasi %s diabaikan: status %s tidak menyusul %s", entry.OrderID, entry.TransactionStatus, current)
+		err = services.FinishInboxEntry(tx, entry.ID, services.InboxIgnored, "status tersimpan: "+current)
+	} else {
+		// Notifikasi tanpa transaction_id (misalnya kedaluwarsa hasil rekonsiliasi) memakai order ID di inbox
+		transactionID := entry.TransactionID
+		if transactionID == entry.OrderID {
+			transactionID = ""
+		}
+		message, paidOrderID, err = applyPaymentNotification(tx, entry.OrderID, transactionID, entry.TransactionStatus, entry.PaymentType)
+		if err == nil {
+			err = services.FinishInboxEntry(tx, entry.ID, services.InboxProcessed, "")
 		}
 	}
+	if err != nil {
+		return "", err
+	}
+	if err := services.MarkNotificationProcessed(tx, notificationID); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
 
-	// Perbarui status pembayaran di tabel payments
-	_, err = database.DB.Exec(`
+	// Nota terbit saat pesanan lunas dan dikirim ke pelanggan sebagai lampiran
+	if paidOrderID != 0 {
+		invoice, created, err := issueInvoice(paidOrderID, entry.OrderID, entry.PaymentType)
+		if err != nil {
+			// Nota bisa diterbitkan ulang admin; notifikasi Midtrans tidak perlu diulang
+			log.Printf("Error issuing invoice for order %d: %v", paidOrderID, err)
+		} else if created {
+			services.SendInvoiceEmail(invoice)
+		}
+	}
+	return message, nil
+}
+
+// applyPaymentNotification menerapkan status transaksi yang sudah diverifikasi ke payments,
+// setoran tabungan, jadwal cicilan dan status pesanan di dalam tx. paidOrderID berisi pesanan
+// yang menjadi lunas karena notifikasi ini.
+func applyPaymentNotification(tx *sql.Tx, orderID, transactionID, transactionStatus, paymentType string) (message string, paidOrderID int, err error) {
+	// Perbarui status, transaction_id dan metode pembayaran di tabel payments
+	_, err = tx.Exec(`
 		UPDATE payments
-		SET status = $1, updated_at = NOW()
+		SET status = $1, payment_type = COALESCE(NULLIF($3, ''), payment_type),
+			transaction_id = COALESCE(NULLIF($4, ''), transaction_id), updated_at = NOW()
 		WHERE order_id = $2`,
-		transactionStatus, orderID)
+		transactionStatus, orderID, paymentType, transactionID)
+	if err != nil {
+		return "", 0, fmt.Errorf("update payments: %w", err)
+	}
 
+	// Setoran tabungan emas tidak terkait pesanan
+	handled, err := services.SettleSavingsDeposit(tx, orderID, transactionStatus)
 	if err != nil {
-		log.Printf("Error updating payments: %v", err)
-		http.Error(w, "Gagal memperbarui status pembayaran", http.StatusInternalServerError)
-		return
+		return "", 0, fmt.Errorf("settle savings deposit: %w", err)
+	}
+	if handled {
+		log.Printf("Setoran tabungan emas diperbarui: %s -> %s", orderID, transactionStatus)
+		return "Savings deposit updated", 0, nil
 	}
 
-	// **Mapping status Midtrans ke status custom_orders**
-	var orderStatus string
-	switch transactionStatus {
-	case "settlement":
-		orderStatus = "paid"
-	case "pending":
-		orderStatus = "waiting_payment"
-	case "deny", "cancel", "expire":
-		orderStatus = "failed"
-	case "refund":
-		orderStatus = "refunded"
-	default:
-		orderStatus = "unknown"
+	// Cari pesanan dari tabel payments; pembayaran lama hanya tercatat di custom_orders.order_id
+	var customOrderID int
+	paymentKind := services.PaymentKindOrder
+	err = tx.QueryRow(`
+		SELECT p.custom_order_id, p.kind FROM payments p
+		WHERE p.order_id = $1 AND p.custom_order_id IS NOT NULL
+		UNION ALL
+		SELECT c.id, 'order' FROM custom_orders c
+		WHERE c.order_id = $1
+		LIMIT 1`, orderID).Scan(&customOrderID, &paymentKind)
+	if err == sql.ErrNoRows {
+		log.Printf("Pesanan untuk %s tidak ditemukan", orderID)
+		return "Payment status updated", 0, nil
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("fetch custom order: %w", err)
 	}
 
-	// **Update status di custom_orders**
-	_, err = database.DB.Exec(`
-		UPDATE custom_orders
-		SET status = $1, updated_at = NOW()
-		WHERE order_id = $2`,
-		orderStatus, orderID)
+	// Catat notifikasi pembayaran di timeline pesanan
+	keterangan := "Status pembayaran: " + transactionStatus
+	if paymentType != "" {
+		keterangan += " (" + paymentType + ")"
+	}
+	err = services.RecordOrderEvent(tx, model.OrderEvent{
+		OrderID:    customOrderID,
+		Tipe:       services.EventPayment,
+		Keterangan: keterangan,
+		Actor:      services.ActorMidtrans,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("record payment event: %w", err)
+	}
+
+	// DP dan cicilan hanya melunasi pesanan jika seluruh jadwal sudah terbayar
+	if paymentKind == services.PaymentKindInstallment {
+		settled, err := settleInstallment(tx, customOrderID, orderID, transactionStatus)
+		if err != nil {
+			return "", 0, fmt.Errorf("settle installment: %w", err)
+		}
+		if settled {
+			paidOrderID = customOrderID
+		}
+		return "Installment status updated", paidOrderID, nil
+	}
+
+	// Hanya pembayaran utama yang mengubah status pesanan
+	orderStatus, ok := services.OrderStatusForTransaction(transactionStatus)
+	if !ok || paymentKind != services.PaymentKindOrder {
+		log.Printf("Status transaksi %s untuk %s tidak mengubah pesanan", transactionStatus, orderID)
+		return "Payment status updated", 0, nil
+	}
+
+	// Refund yang dibuat lewat API refund sudah menerapkan status pesanan sendiri
+	if orderStatus == services.OrderRefunded {
+		initiated, err := services.HasRefunds(tx, orderID)
+		if err != nil {
+			return "", 0, fmt.Errorf("fetch refunds: %w", err)
+		}
+		if initiated {
+			return "Payment status updated", 0, nil
+		}
+	}
 
+	// **Update status di custom_orders melalui state machine**
+	err = services.TransitionOrder(tx, customOrderID, orderStatus, services.ActorMidtrans, "Midtrans: "+transactionStatus)
+	if errors.Is(err, services.ErrInvalidTransition) {
+		// Status pesanan sudah berubah di luar pembayaran ini (misalnya dibatalkan admin)
+		log.Printf("Transisi diabaikan untuk %s: %v", orderID, err)
+		if orderStatus == services.OrderPaid {
+			// Dana tetap tercatat settlement dan muncul di laporan rekonsiliasi sampai di-refund
+			err = services.RecordOrderEvent(tx, model.OrderEvent{
+				OrderID:    customOrderID,
+				Tipe:       services.EventPayment,
+				Keterangan: "Pembayaran " + orderID + " diterima saat pesanan tidak menunggu pembayaran; dana perlu dikembalikan",
+				Actor:      services.ActorMidtrans,
+			})
+			if err != nil {
+				return "", 0, fmt.Errorf("record refund due event: %w", err)
+			}
+		}
+		return "Payment status updated", 0, nil
+	}
 	if err != nil {
-		log.Printf("Error updating custom_orders: %v", err)
-		http.Error(w, "Gagal memperbarui status pesanan", http.StatusInternalServerError)
-		return
+		return "", 0, fmt.Errorf("update custom_orders: %w", err)
+	}
+
+	// Kuota voucher dan kredit tukar tambah dikonfirmasi saat lunas; voucher, kredit, tabungan
+	// emas dan stok dikembalikan saat pembayaran gagal
+	switch orderStatus {
+	case services.OrderPaid:
+		err = services.ConfirmRedemptions(tx, customOrderID)
+		if err == nil {
+			err = services.ConfirmTradeInCredits(tx, customOrderID)
+		}
+		paidOrderID = customOrderID
+	case services.OrderCancelled:
+		err = services.ReleaseRedemptions(tx, customOrderID)
+		if err == nil {
+			err = services.ReleaseTradeInCredits(tx, customOrderID)
+		}
+		if err == nil {
+			err = services.ReverseOrderSavings(tx, customOrderID, services.ActorMidtrans)
+		}
+		if err == nil {
+			err = services.RestockOrderItems(tx, customOrderID)
+		}
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("update voucher redemptions, trade-in credits, gold savings or stock: %w", err)
 	}
 
 	log.Printf("Status pembayaran dan pesanan diperbarui: %s -> %s", orderID, transactionStatus)
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Payment and order status updated"))
+	return "Payment and order status updated", paidOrderID, nil
 }
 
+// parsePaymentLedgerFilter membaca filter buku pembayaran dari query string
+func parsePaymentLedgerFilter(r *http.Request) (services.PaymentLedgerFilter, error) {
+	q := r.URL.Query()
+	f := services.PaymentLedgerFilter{
+		Status:      q.Get("status"),
+		Kind:        q.Get("kind"),
+		PaymentType: q.Get("method"),
+		Customer:    strings.TrimSpace(q.Get("customer")),
+	}
+	if f.Status != "" && !services.IsValidPaymentStatus(f.Status) {
+		return f, errors.New("Unknown payment status")
+	}
+	if from := q.Get("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return f, errors.New("Invalid from date, use YYYY-MM-DD")
+		}
+		f.From = t
+	}
+	if to := q.Get("to"); to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return f, errors.New("Invalid to date, use YYYY-MM-DD")
+		}
+		f.To = t.AddDate(0, 0, 1)
+	}
+	if customer := q.Get("user_id"); customer != "" {
+		customerID, err := strconv.Atoi(customer)
+		if err != nil {
+			return f, errors.New("Invalid user_id")
+		}
+		f.UserID = customerID
+	}
+	return f, nil
+}
 
+// GetAllPayments menampilkan buku pembayaran untuk admin: setiap pembayaran beserta pesanan dan
+// pelanggannya. Filter ?status=, ?kind=, ?method= (payment_type), ?from= dan ?to= (YYYY-MM-DD),
+// ?user_id= dan ?customer= (nama atau email); ?format=csv mengekspor semua baris yang cocok.
 func GetAllPayments(w http.ResponseWriter, r *http.Request) {
-    // Query untuk mengambil data yang diinginkan dari tabel payments
-    rows, err := database.DB.Query(`
-        SELECT id, jenis_perhiasan, jenis_emas, berat_emas, total_harga, status 
-        FROM payments
-    `)
-    if err != nil {
-        log.Printf("Error fetching payments: %v", err)
-        http.Error(w, "Failed to fetch payments", http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-
-    // Struct untuk menyimpan data pembayaran yang akan dikirim ke frontend
-    type Payment struct {
-        ID            int     `json:"id"`
-        JenisPerhiasan string  `json:"jenis_perhiasan"`
-        JenisEmas      string  `json:"jenis_emas"`
-        BeratEmas      float64 `json:"berat_emas"`
-        TotalHarga     float64 `json:"total_harga"`
-        Status         string  `json:"status"`
-    }
-
-    var payments []Payment
-
-    // Looping setiap hasil query
-    for rows.Next() {
-        var p Payment
-
-        // Scan data dari database ke dalam struct
-        err := rows.Scan(&p.ID, &p.JenisPerhiasan, &p.JenisEmas, &p.BeratEmas, &p.TotalHarga, &p.Status)
-        if err != nil {
-            log.Printf("Error scanning payment: %v", err)
-            http.Error(w, "Failed to parse payments", http.StatusInternalServerError)
-            return
-        }
-
-        payments = append(payments, p)
-    }
-
-    // Cek apakah ada error setelah iterasi
-    if err := rows.Err(); err != nil {
-        log.Printf("Error iterating payments: %v", err)
-        http.Error(w, "Failed to process payments", http.StatusInternalServerError)
-        return
-    }
-
-    // Kirim response dalam format JSON
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(payments)
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	filter, err := parsePaymentLedgerFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		entries, err := services.ListPaymentLedger(database.DB, filter, 0, 0)
+		if err != nil {
+			log.Printf("Error fetching payments: %v", err)
+			http.Error(w, "Failed to fetch payments", http.StatusInternalServerError)
+			return
+		}
+		writePaymentLedgerCSV(w, entries)
+		return
+	}
+
+	page, limit := parsePagination(r)
+	total, err := services.CountPaymentLedger(database.DB, filter)
+	if err != nil {
+		log.Printf("Error counting payments: %v", err)
+		http.Error(w, "Failed to fetch payments", http.StatusInternalServerError)
+		return
+	}
+	entries, err := services.ListPaymentLedger(database.DB, filter, limit, (page-1)*limit)
+	if err != nil {
+		log.Printf("Error fetching payments: %v", err)
+		http.Error(w, "Failed to fetch payments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data":  entries,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// writePaymentLedgerCSV menulis buku pembayaran sebagai lampiran CSV
+func writePaymentLedgerCSV(w http.ResponseWriter, entries []model.PaymentLedgerEntry) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="payments-%s.csv"`, time.Now().Format("20060102")))
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "order_id", "kind", "custom_order_id", "order_status", "user_id", "customer_name",
+		"customer_email", "payment_type", "transaction_id", "gross_amount", "refunded", "status", "created_at", "updated_at"})
+	optionalInt := func(v *int) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.Itoa(*v)
+	}
+	for _, e := range entries {
+		updatedAt := ""
+		if e.UpdatedAt != nil {
+			updatedAt = e.UpdatedAt.Format(time.RFC3339)
+		}
+		cw.Write([]string{strconv.Itoa(e.ID), e.OrderID, e.Kind, optionalInt(e.CustomOrderID), e.OrderStatus,
+			optionalInt(e.UserID), e.CustomerName, e.CustomerEmail, e.PaymentType, e.TransactionID,
+			e.GrossAmount.String(), e.Refunded.String(), e.Status, e.CreatedAt.Format(time.RFC3339), updatedAt})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Error writing payments CSV: %v", err)
+	}
+}
+
+// settleInstallment memproses notifikasi DP atau cicilan. settled bernilai true jika tagihan ini
+// melunasi jadwal sehingga pesanan menjadi paid.
+func settleInstallment(tx *sql.Tx, customOrderID int, paymentOrderID, transactionStatus string) (bool, error) {
+	_, settled, err := services.SettleInstallmentPayment(tx, paymentOrderID, transactionStatus)
+	if err != nil || !settled {
+		return false, err
+	}
+	var status string
+	if err := tx.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1 FOR UPDATE`, customOrderID).Scan(&status); err != nil {
+		return false, err
+	}
+	if err := markOrderPaid(tx, customOrderID, status, services.ActorMidtrans, "Jadwal pembayaran lunas"); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
+// markOrderPaid menandai pesanan lunas di luar pembayaran penuh Midtrans: seluruh tagihan ditutup
+// kredit tukar tambah atau tabungan emas, atau jadwal cicilan sudah lunas. Voucher dan kredit
+// yang dipesan ikut dikonfirmasi.
+func markOrderPaid(tx *sql.Tx, orderID int, status, actor, note string) error {
+	if status == services.OrderDraft {
+		if err := services.TransitionOrder(tx, orderID, services.OrderAwaitingPayment, actor, ""); err != nil {
+			return err
+		}
+	}
+	if err := services.TransitionOrder(tx, orderID, services.OrderPaid, actor, note); err != nil {
+		return err
+	}
+	if err := services.ConfirmRedemptions(tx, orderID); err != nil {
+		return err
+	}
+	return services.ConfirmTradeInCredits(tx, orderID)
+}
+
+// issueInvoice menerbitkan nota pesanan di dalam transaksi supaya nomor urut nota tidak terpakai
+// jika penyimpanan gagal. created bernilai false jika nota sudah pernah diterbitkan.
+func issueInvoice(customOrderID int, paymentOrderID, paymentType string) (model.Invoice, bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return model.Invoice{}, false, err
+	}
+	defer tx.Rollback()
+
+	invoice, created, err := services.IssueInvoice(tx, customOrderID, paymentOrderID, paymentType)
+	if err != nil || !created {
+		return invoice, false, err
+	}
+	return invoice, true, tx.Commit()
+}
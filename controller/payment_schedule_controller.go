@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"proyek3/config"
+	"proyek3/database"
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// scheduleErrorStatus memetakan error jadwal pembayaran ke status HTTP; 0 jika error tidak dikenal
+func scheduleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidSchedule):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrScheduleNotFound), errors.Is(err, services.ErrInstallmentNotFound),
+		errors.Is(err, services.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrScheduleLocked), errors.Is(err, services.ErrScheduleOrderStatus),
+		errors.Is(err, services.ErrInstallmentPaid), errors.Is(err, services.ErrInstallmentOrder),
+		errors.Is(err, services.ErrInvalidTransition):
+		return http.StatusConflict
+	}
+	return 0
+}
+
+// HandleCreatePaymentSchedule membuat jadwal DP dan cicilan untuk pesanan yang belum dibayar.
+// Tagihan penuh yang masih pending dibatalkan karena pesanan akan dibayar per tagihan.
+func HandleCreatePaymentSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	var req services.PaymentScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.CancelPendingPayments(database.DB, orderID); err != nil {
+		writeCancelPaymentsError(w, orderID, err)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating payment schedule", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	schedule, err := services.CreatePaymentSchedule(tx, orderID, req, services.ActorUser(userID))
+	if status := scheduleErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating payment schedule for order %d: %v", orderID, err)
+		http.Error(w, "Error creating payment schedule", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing payment schedule of order %d: %v", orderID, err)
+		http.Error(w, "Error creating payment schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// HandleGetPaymentSchedule menampilkan jadwal pembayaran pesanan beserta status setiap tagihan
+func HandleGetPaymentSchedule(w http.ResponseWriter, r *http.Request) {
+	_, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := services.GetPaymentSchedule(database.DB, orderID)
+	if status := scheduleErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching payment schedule of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching payment schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// HandleDeletePaymentSchedule membatalkan jadwal yang belum pernah dibayar sehingga pesanan
+// kembali dibayar penuh
+func HandleDeletePaymentSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	if err := services.CancelPendingPayments(database.DB, orderID); err != nil {
+		writeCancelPaymentsError(w, orderID, err)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error cancelling payment schedule", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	err = services.RemovePaymentSchedule(tx, orderID, services.ActorUser(userID))
+	if status := scheduleErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error cancelling payment schedule of order %d: %v", orderID, err)
+		http.Error(w, "Error cancelling payment schedule", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing payment schedule cancellation of order %d: %v", orderID, err)
+		http.Error(w, "Error cancelling payment schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlePayInstallment membuat transaksi Snap untuk satu tagihan (DP atau cicilan). Setiap percobaan
+// bayar mendapat order ID Midtrans sendiri dan percobaan sebelumnya yang masih pending dibatalkan.
+func HandlePayInstallment(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+	urutan, err := strconv.Atoi(mux.Vars(r)["urutan"])
+	if err != nil {
+		http.Error(w, "Invalid installment number", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		CustomerDetails CustomerDetails `json:"customer_details"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Pesanan dikunci selama transaksi supaya satu tagihan tidak dibuatkan dua pembayaran bersamaan
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	installment, err := services.PrepareInstallmentPayment(tx, orderID, urutan)
+	if status := scheduleErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error preparing installment %d of order %d: %v", urutan, orderID, err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+	if err := services.CancelPendingInstallmentPayments(tx, installment.ID); err != nil {
+		tx.Rollback()
+		writeCancelPaymentsError(w, orderID, err)
+		return
+	}
+
+	paymentOrderID := services.NewMidtransOrderID(fmt.Sprintf("inst-%d-%d", orderID, installment.Urutan))
+	snapResp, err := services.CreateCharge(paymentOrderID, installment.Jumlah.Int64(), services.PaymentCustomer{
+		Name:  req.CustomerDetails.Name,
+		Email: req.CustomerDetails.Email,
+		Phone: req.CustomerDetails.Phone,
+	})
+	if err != nil {
+		log.Printf("Error creating snap token for installment %s: %v", paymentOrderID, err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+
+	if err := services.AttachInstallmentPayment(tx, installment.ID, paymentOrderID); err != nil {
+		log.Printf("Error updating installment %d: %v", installment.ID, err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(`
+		INSERT INTO payments (
+			order_id, custom_order_id, installment_id, kind, gross_amount, customer_name, customer_email,
+			customer_phone, token, redirect_url, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, 'pending')`,
+		paymentOrderID, orderID, installment.ID, services.PaymentKindInstallment, installment.Jumlah,
+		req.CustomerDetails.Name, req.CustomerDetails.Email, req.CustomerDetails.Phone, snapResp.Token, snapResp.RedirectURL)
+	if err != nil {
+		log.Printf("Error saving payment %s: %v", paymentOrderID, err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+
+	var status string
+	if err := tx.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1`, orderID).Scan(&status); err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+	if status == services.OrderDraft {
+		if err := services.TransitionOrder(tx, orderID, services.OrderAwaitingPayment, services.ActorUser(userID), "Pembayaran dibuat: "+paymentOrderID); err != nil {
+			log.Printf("Error updating status of order %d: %v", orderID, err)
+			http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing installment payment %s: %v", paymentOrderID, err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Pembayaran %s dibuat untuk tagihan %d pesanan %d", paymentOrderID, installment.Urutan, orderID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":        snapResp.Token,
+		"redirect_url": snapResp.RedirectURL,
+		"gross_amount": installment.Jumlah,
+		"tagihan":      installment,
+	})
+}
+
+// HandleInstallmentReminders mengirim email pengingat tagihan yang akan jatuh tempo. Dipanggil
+// oleh cron dengan header Authorization: Bearer CRON_SECRET, atau manual oleh admin.
+func HandleInstallmentReminders(w http.ResponseWriter, r *http.Request) {
+	if !authorizeCron(w, r) {
+		return
+	}
+
+	sent, err := services.SendInstallmentReminders(database.DB, config.InstallmentReminderDays)
+	if err != nil {
+		log.Printf("Error sending installment reminders: %v", err)
+		http.Error(w, "Error sending reminders", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"terkirim": sent,
+	})
+}
@@ -0,0 +1,216 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// stageUpdateRequest adalah payload perubahan tahap produksi; field kosong tidak diubah
+type stageUpdateRequest struct {
+	Status          *string     `json:"status"`
+	Pengrajin       *string     `json:"pengrajin"`
+	EstimasiSelesai string      `json:"estimasi_selesai"` // YYYY-MM-DD
+	BeratMasuk      *model.Gram `json:"berat_masuk"`
+	BeratKeluar     *model.Gram `json:"berat_keluar"`
+	Catatan         *string     `json:"catatan"`
+}
+
+// HandleWorkshopDashboard menampilkan pekerjaan bengkel yang berjalan per tahap dan estimasi selesai.
+// Filter opsional ?tahap= dan ?pengrajin=.
+func HandleWorkshopDashboard(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	filter := services.WorkshopFilter{
+		Tahap:     r.URL.Query().Get("tahap"),
+		Pengrajin: r.URL.Query().Get("pengrajin"),
+	}
+	if filter.Tahap != "" && !services.IsProductionStage(filter.Tahap) {
+		http.Error(w, "Tahap produksi tidak dikenal", http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := services.WorkshopJobs(database.DB, filter)
+	if err != nil {
+		log.Printf("Error fetching workshop jobs: %v", err)
+		http.Error(w, "Error fetching workshop jobs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"urutan_tahap": services.ProductionStages,
+		"tahap":        jobs,
+	})
+}
+
+// HandleGetOrderWorkOrders mengembalikan work order milik satu pesanan (admin)
+func HandleGetOrderWorkOrders(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID format", http.StatusBadRequest)
+		return
+	}
+
+	workOrders, err := services.WorkOrdersForOrder(database.DB, orderID)
+	if err != nil {
+		log.Printf("Error fetching work orders of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching work orders", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workOrders)
+}
+
+// HandleGetWorkOrder mengembalikan detail work order beserta tahap dan susut emasnya
+func HandleGetWorkOrder(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+	workOrderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid work order ID", http.StatusBadRequest)
+		return
+	}
+
+	workOrder, err := services.GetWorkOrder(database.DB, workOrderID)
+	if errors.Is(err, services.ErrWorkOrderNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching work order %d: %v", workOrderID, err)
+		http.Error(w, "Error fetching work order", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workOrder)
+}
+
+// HandleUpdateWorkOrder mengubah estimasi selesai work order
+func HandleUpdateWorkOrder(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+	workOrderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid work order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		EstimasiSelesai string `json:"estimasi_selesai"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	estimasi, err := time.Parse("2006-01-02", req.EstimasiSelesai)
+	if err != nil {
+		http.Error(w, "Invalid estimasi_selesai, use YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	err = services.SetWorkOrderEstimate(database.DB, workOrderID, estimasi)
+	if errors.Is(err, services.ErrWorkOrderNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating work order %d: %v", workOrderID, err)
+		http.Error(w, "Error updating work order", http.StatusInternalServerError)
+		return
+	}
+
+	HandleGetWorkOrder(w, r)
+}
+
+// HandleUpdateWorkOrderStage mengubah satu tahap produksi: pengrajin, estimasi, berat masuk/keluar dan status
+func HandleUpdateWorkOrderStage(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireRole(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+	workOrderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid work order ID", http.StatusBadRequest)
+		return
+	}
+	tahap := mux.Vars(r)["tahap"]
+
+	var req stageUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	update := services.StageUpdate{
+		Status:      req.Status,
+		Pengrajin:   req.Pengrajin,
+		BeratMasuk:  req.BeratMasuk,
+		BeratKeluar: req.BeratKeluar,
+		Catatan:     req.Catatan,
+	}
+	if req.EstimasiSelesai != "" {
+		estimasi, err := time.Parse("2006-01-02", req.EstimasiSelesai)
+		if err != nil {
+			http.Error(w, "Invalid estimasi_selesai, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		update.EstimasiSelesai = &estimasi
+	}
+	if (req.BeratMasuk != nil && *req.BeratMasuk < 0) || (req.BeratKeluar != nil && *req.BeratKeluar < 0) {
+		http.Error(w, "Berat tidak boleh negatif", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error updating work order", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	workOrder, err := services.UpdateWorkOrderStage(tx, workOrderID, tahap, update, services.ActorUser(adminID))
+	switch {
+	case errors.Is(err, services.ErrWorkOrderNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrUnknownStage), errors.Is(err, services.ErrStageWeight):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrWorkOrderClosed), errors.Is(err, services.ErrStageOrder),
+		errors.Is(err, services.ErrStageTransition), errors.Is(err, services.ErrInvalidTransition),
+		errors.Is(err, services.ErrDesignNotApproved):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error updating stage %s of work order %d: %v", tahap, workOrderID, err)
+		http.Error(w, "Error updating work order", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing work order %d: %v", workOrderID, err)
+		http.Error(w, "Error updating work order", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workOrder)
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+)
+
+// CreateQuote menghitung rincian harga dan menyimpan quote yang harganya terkunci sementara
+func CreateQuote(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	var req model.OrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.ValidateOrderRequest(req); err != nil {
+		http.Error(w, orderRequestError(err), http.StatusBadRequest)
+		return
+	}
+
+	quote, err := services.NewQuote(database.DB, userID, req, time.Now())
+	if err != nil {
+		log.Printf("Error creating quote: %v", err)
+		if isVoucherError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Jenis emas atau batu tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	rincian, err := json.Marshal(quote.Rincian)
+	if err != nil {
+		http.Error(w, "Error encoding breakdown", http.StatusInternalServerError)
+		return
+	}
+
+	batu, err := json.Marshal(quote.Batu)
+	if err != nil {
+		http.Error(w, "Error encoding stones", http.StatusInternalServerError)
+		return
+	}
+
+	personalisasi, err := services.EncodePersonalisasi(quote.Personalisasi)
+	if err != nil {
+		http.Error(w, "Error encoding personalization", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO quotes (id, user_id, jenis_perhiasan, jenis_emas, berat_emas, campuran_tambahan,
+			persentase_emas, batu, personalisasi, kode_voucher, rincian, total_harga, price_sheet_version, expires_at, signature)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		quote.ID, quote.UserID, quote.JenisPerhiasan, quote.JenisEmas, quote.BeratEmas, quote.CampuranTambahan,
+		quote.PersentaseEmas, batu, personalisasi, quote.KodeVoucher, rincian, quote.TotalHarga, quote.PriceSheetVersion, quote.ExpiresAt, quote.Signature)
+	if err != nil {
+		log.Printf("Error saving quote: %v", err)
+		http.Error(w, "Error saving quote", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(quote)
+}
+
+// loadQuoteForUpdate mengambil quote yang belum dipakai dan mengunci barisnya di dalam transaksi
+func loadQuoteForUpdate(tx *sql.Tx, quoteID string) (model.Quote, error) {
+	var quote model.Quote
+	var batu, personalisasi, rincian []byte
+	err := tx.QueryRow(`
+		SELECT id, user_id, jenis_perhiasan, jenis_emas, berat_emas, campuran_tambahan,
+			persentase_emas, batu, personalisasi, kode_voucher, rincian, total_harga, price_sheet_version, expires_at, signature
+		FROM quotes
+		WHERE id = $1 AND custom_order_id IS NULL
+		FOR UPDATE`, quoteID).Scan(
+		&quote.ID, &quote.UserID, &quote.JenisPerhiasan, &quote.JenisEmas, &quote.BeratEmas, &quote.CampuranTambahan,
+		&quote.PersentaseEmas, &batu, &personalisasi, &quote.KodeVoucher, &rincian, &quote.TotalHarga, &quote.PriceSheetVersion, &quote.ExpiresAt, &quote.Signature)
+	if err != nil {
+		return quote, err
+	}
+	if len(batu) > 0 {
+		if err := json.Unmarshal(batu, &quote.Batu); err != nil {
+			return quote, err
+		}
+	}
+	if quote.Personalisasi, err = services.DecodePersonalisasi(personalisasi); err != nil {
+		return quote, err
+	}
+	if err := json.Unmarshal(rincian, &quote.Rincian); err != nil {
+		return quote, err
+	}
+	return quote, nil
+}
@@ -0,0 +1,267 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"proyek3/config"
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// reconcileBatchSize adalah jumlah maksimal pembayaran pending yang dicek per putaran
+const reconcileBatchSize = 100
+
+// authorizeCron menerima panggilan penjadwal dengan header Authorization: Bearer CRON_SECRET,
+// atau panggilan manual oleh admin
+func authorizeCron(w http.ResponseWriter, r *http.Request) bool {
+	if config.CronSecret != "" && r.Header.Get("Authorization") == "Bearer "+config.CronSecret {
+		return true
+	}
+	_, ok := requireRole(w, r, RoleAdmin)
+	return ok
+}
+
+// reconciliationResult adalah ringkasan satu putaran rekonsiliasi pembayaran pending
+type reconciliationResult struct {
+	Diperiksa   int `json:"diperiksa"`
+	Diperbarui  int `json:"diperbarui"`
+	Kedaluwarsa int `json:"kedaluwarsa"`
+	Pending     int `json:"pending"`
+	Selisih     int `json:"selisih"` // nominal di gateway berbeda dengan tagihan
+	Gagal       int `json:"gagal"`
+}
+
+// reconcilePayments mengecek pembayaran pending yang tidak kunjung mendapat notifikasi ke gateway.
+// Status dari gateway diproses lewat inbox seperti webhook; pembayaran yang melewati batas waktu
+// dibatalkan di gateway dan dianggap expire.
+func reconcilePayments() (reconciliationResult, error) {
+	var result reconciliationResult
+	stale, err := services.StalePendingPayments(database.DB, config.PaymentReconcileAfter, reconcileBatchSize)
+	if err != nil {
+		return result, err
+	}
+
+	gateway := services.NewPaymentGateway()
+	for _, p := range stale {
+		result.Diperiksa++
+		n, expired, err := gatewayPaymentStatus(gateway, p)
+		if err != nil {
+			log.Printf("Error reconciling payment %s: %v", p.OrderID, err)
+			result.Gagal++
+			continue
+		}
+		if !expired && n.EffectiveStatus() == "pending" {
+			result.Pending++
+			continue
+		}
+
+		keterangan := "status dibaca dari gateway"
+		if expired {
+			keterangan = "melewati batas waktu pembayaran"
+		} else if gross, err := model.NewRupiah(n.GrossAmount); err != nil || gross != p.GrossAmount {
+			log.Printf("Rekonsiliasi %s: gross_amount gateway %s, tagihan %s", p.OrderID, n.GrossAmount, p.GrossAmount)
+			body, _ := json.Marshal(n)
+			if _, err := services.RecordMidtransNotification(database.DB, n, body, services.NotificationSourceReconciliation,
+				services.NotificationAmountMismatch, "gross_amount gateway "+n.GrossAmount); err != nil {
+				log.Printf("Error recording reconciliation of %s: %v", p.OrderID, err)
+			}
+			result.Selisih++
+			continue
+		}
+
+		if err := applyGatewayStatus(n, keterangan); err != nil {
+			log.Printf("Error applying reconciled status of %s: %v", p.OrderID, err)
+			result.Gagal++
+			continue
+		}
+		if expired {
+			result.Kedaluwarsa++
+		} else {
+			result.Diperbarui++
+		}
+	}
+	return result, nil
+}
+
+// gatewayPaymentStatus membaca status pembayaran di gateway. Pembayaran yang masih pending atau belum
+// pernah dibuka pelanggan setelah batas waktu dibatalkan di gateway, lalu statusnya dibaca ulang
+// supaya pembayaran yang masuk bersamaan tidak ikut kedaluwarsa.
+func gatewayPaymentStatus(gateway services.PaymentGateway, p services.StalePayment) (services.MidtransNotification, bool, error) {
+	t, err := gateway.GetStatus(p.OrderID)
+	if err != nil && !errors.Is(err, services.ErrGatewayTransactionNotFound) {
+		return services.MidtransNotification{}, false, err
+	}
+	n := services.NotificationFromGateway(p.OrderID, t)
+	if err == nil && n.EffectiveStatus() != "pending" {
+		return n, false, nil
+	}
+	if time.Since(p.CreatedAt) < config.PaymentExpiry {
+		n.TransactionStatus = "pending"
+		return n, false, nil
+	}
+
+	if err := gateway.Cancel(p.OrderID); err != nil && !errors.Is(err, services.ErrGatewayTransactionFinal) {
+		return n, false, err
+	}
+	t, err = gateway.GetStatus(p.OrderID)
+	if err != nil && !errors.Is(err, services.ErrGatewayTransactionNotFound) {
+		return n, false, err
+	}
+	if err == nil && t.TransactionStatus != "pending" && t.TransactionStatus != "cancel" {
+		return services.NotificationFromGateway(p.OrderID, t), false, nil
+	}
+	n.TransactionStatus, n.FraudStatus = "expire", ""
+	return n, true, nil
+}
+
+// applyGatewayStatus mencatat status dari gateway di midtrans_notifications lalu memprosesnya
+// lewat inbox pembayaran, sama seperti notifikasi webhook yang terverifikasi
+func applyGatewayStatus(n services.MidtransNotification, keterangan string) error {
+	entry, duplicate, err := services.EnqueuePaymentNotification(database.DB, n)
+	if err != nil {
+		return err
+	}
+	hasil := services.NotificationVerified
+	if duplicate {
+		hasil = services.NotificationDuplicate
+	}
+	body, _ := json.Marshal(n)
+	notificationID, err := services.RecordMidtransNotification(database.DB, n, body, services.NotificationSourceReconciliation, hasil, keterangan)
+	if err != nil || duplicate {
+		return err
+	}
+	_, err = processInboxEntry(entry.ID, notificationID)
+	return err
+}
+
+// buildReconciliationReport menyusun dan menyimpan laporan rekonsiliasi satu tanggal
+func buildReconciliationReport(tanggal time.Time) (model.ReconciliationReport, error) {
+	report, err := services.BuildReconciliationReport(database.DB, services.NewPaymentGateway(), tanggal)
+	if err != nil {
+		return report, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+	if err := services.SaveReconciliationReport(tx, &report); err != nil {
+		return report, err
+	}
+	return report, tx.Commit()
+}
+
+// yesterday mengembalikan tanggal kemarin; laporan harian disusun setelah hari berganti
+func yesterday() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, now.Location())
+}
+
+// StartPaymentReconciler menjalankan rekonsiliasi pembayaran setiap interval dan menyusun laporan
+// hari sebelumnya jika belum ada. Dipakai server lokal; di Vercel keduanya dijalankan cron.
+func StartPaymentReconciler(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			result, err := reconcilePayments()
+			if err != nil {
+				log.Printf("Error reconciling payments: %v", err)
+			} else if result.Diperiksa > 0 {
+				log.Printf("Rekonsiliasi pembayaran: %+v", result)
+			}
+
+			tanggal := yesterday()
+			if _, exists, err := services.GetReconciliationReport(database.DB, tanggal); err != nil {
+				log.Printf("Error fetching reconciliation report: %v", err)
+			} else if !exists {
+				if _, err := buildReconciliationReport(tanggal); err != nil {
+					log.Printf("Error building reconciliation report for %s: %v", tanggal.Format("2006-01-02"), err)
+				}
+			}
+		}
+	}()
+}
+
+// HandleReconcilePayments menjalankan satu putaran rekonsiliasi pembayaran pending (cron atau admin)
+func HandleReconcilePayments(w http.ResponseWriter, r *http.Request) {
+	if !authorizeCron(w, r) {
+		return
+	}
+
+	result, err := reconcilePayments()
+	if err != nil {
+		log.Printf("Error reconciling payments: %v", err)
+		http.Error(w, "Error reconciling payments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleBuildReconciliationReport menyusun laporan rekonsiliasi harian (cron atau admin). Default
+// tanggal kemarin; ?tanggal=YYYY-MM-DD menyusun ulang tanggal tertentu.
+func HandleBuildReconciliationReport(w http.ResponseWriter, r *http.Request) {
+	if !authorizeCron(w, r) {
+		return
+	}
+
+	tanggal := yesterday()
+	if s := r.URL.Query().Get("tanggal"); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid tanggal, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		tanggal = t
+	}
+
+	report, err := buildReconciliationReport(tanggal)
+	if err != nil {
+		log.Printf("Error building reconciliation report for %s: %v", tanggal.Format("2006-01-02"), err)
+		http.Error(w, "Error building reconciliation report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// HandleGetReconciliationReport menampilkan laporan rekonsiliasi satu tanggal (admin)
+func HandleGetReconciliationReport(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	tanggal, err := time.ParseInLocation("2006-01-02", mux.Vars(r)["tanggal"], time.Local)
+	if err != nil {
+		http.Error(w, "Invalid tanggal, use YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	report, exists, err := services.GetReconciliationReport(database.DB, tanggal)
+	if err != nil {
+		log.Printf("Error fetching reconciliation report for %s: %v", tanggal.Format("2006-01-02"), err)
+		http.Error(w, "Error fetching reconciliation report", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Laporan rekonsiliasi tidak ditemukan", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+)
+
+// refundErrorStatus memetakan error refund ke status HTTP; 0 jika error tidak dikenal
+func refundErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidRefund):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrRefundInProgress), errors.Is(err, services.ErrNothingToRefund),
+		errors.Is(err, services.ErrRefundOrderStatus), errors.Is(err, services.ErrInvalidTransition):
+		return http.StatusConflict
+	}
+	return 0
+}
+
+// refundResponse adalah hasil pemrosesan refund beserta status pesanan setelahnya
+type refundResponse struct {
+	Refunds []model.Refund `json:"refunds"`
+	Status  string         `json:"status"`
+	Message string         `json:"message,omitempty"`
+}
+
+// refundResult adalah hasil processRefunds. GatewayErr adalah error gateway pertama; refund
+// tetap diterapkan ke database meskipun gateway gagal, jadi error ini bukan kegagalan proses.
+type refundResult struct {
+	Refunds    []model.Refund
+	Status     string
+	GatewayErr error
+}
+
+// processRefunds mengirim refund pending ke gateway satu per satu lalu menerapkan hasilnya ke payments
+// dan pesanan dalam satu transaksi; error gateway dicatat di refundResult, error database dikembalikan. Refund
+// yang pasti ditolak gateway ditandai gagal. Timeout atau 5xx bisa saja sudah diproses gateway, jadi
+// refund tersebut tetap pending untuk dikirim ulang dengan refund_key yang sama. Setelah satu refund
+// tidak berhasil, refund berikutnya tidak dikirim: ikut gagal jika ditolak, tetap pending jika belum pasti.
+func processRefunds(orderID int, refunds []model.Refund, restock *bool, actor string) (refundResult, error) {
+	gateway := services.NewPaymentGateway()
+	result := refundResult{Refunds: refunds}
+	var gatewayErr error
+	for i := range refunds {
+		refund := &refunds[i]
+		refund.Status, refund.Keterangan = services.RefundSucceeded, ""
+		if gatewayErr != nil {
+			refund.Status, refund.Keterangan = refundStatusForError(gatewayErr), "tidak dikirim karena refund sebelumnya tidak berhasil"
+			continue
+		}
+		if err := gateway.Refund(refund.PaymentOrderID, refund.RefundKey, refund.Jumlah.Int64(), refund.Alasan); err != nil {
+			log.Printf("Error refunding payment %s of order %d: %v", refund.PaymentOrderID, orderID, err)
+			gatewayErr = err
+			refund.Status, refund.Keterangan = refundStatusForError(err), err.Error()
+		}
+	}
+	result.GatewayErr = gatewayErr
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	for i := range refunds {
+		if err := services.CompleteRefund(tx, &refunds[i]); err != nil {
+			return result, err
+		}
+	}
+	result.Status, err = services.SettleRefunds(tx, orderID, refunds, restock, actor)
+	if err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+
+	services.SendRefundEmail(database.DB, orderID, refunds, result.Status)
+	return result, nil
+}
+
+// refundStatusForError menentukan status refund setelah gateway mengembalikan error: failed hanya
+// jika gateway pasti menolak, selain itu tetap pending
+func refundStatusForError(err error) string {
+	if errors.Is(err, services.ErrGatewayRejected) || errors.Is(err, services.ErrGatewayTransactionNotFound) {
+		return services.RefundFailed
+	}
+	return services.RefundPending
+}
+
+// writeRefundResult menulis hasil processRefunds; refund yang ditolak gateway dijawab 502 beserta
+// rincian refund supaya admin tahu bagian mana yang sudah berhasil
+func writeRefundResult(w http.ResponseWriter, orderID int, result refundResult, err error) {
+	if err != nil {
+		log.Printf("Error settling refunds of order %d: %v", orderID, err)
+		http.Error(w, "Error processing refund", http.StatusInternalServerError)
+		return
+	}
+
+	resp := refundResponse{Refunds: result.Refunds, Status: result.Status}
+	code := http.StatusCreated
+	if result.GatewayErr != nil {
+		resp.Message = "Refund ditolak gateway pembayaran: " + result.GatewayErr.Error()
+		if refundStatusForError(result.GatewayErr) == services.RefundPending {
+			resp.Message = "Hasil refund dari gateway belum pasti, kirim ulang lewat /refunds/retry: " + result.GatewayErr.Error()
+		}
+		code = http.StatusBadGateway
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleCreateRefund mengembalikan seluruh atau sebagian dana pesanan lewat gateway pembayaran (admin).
+// Jumlah kosong berarti seluruh dana yang belum di-refund.
+func HandleCreateRefund(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, isAdmin, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+	if !isAdmin {
+		http.Error(w, `{"message": "Forbidden"}`, http.StatusForbidden)
+		return
+	}
+
+	var req services.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating refund", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	actor := services.ActorAdmin(userID)
+	refunds, err := services.PrepareRefunds(tx, orderID, req, actor)
+	if status := refundErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error preparing refund for order %d: %v", orderID, err)
+		http.Error(w, "Error creating refund", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing refund of order %d: %v", orderID, err)
+		http.Error(w, "Error creating refund", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := processRefunds(orderID, refunds, req.Restock, actor)
+	writeRefundResult(w, orderID, result, err)
+}
+
+// HandleRetryRefunds mengirim ulang refund yang tertahan pending, misalnya karena proses sebelumnya
+// terhenti setelah gateway dipanggil. refund_key yang sama mencegah dana dikembalikan dua kali.
+func HandleRetryRefunds(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, isAdmin, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+	if !isAdmin {
+		http.Error(w, `{"message": "Forbidden"}`, http.StatusForbidden)
+		return
+	}
+
+	refunds, err := services.PendingRefunds(database.DB, orderID)
+	if err != nil {
+		log.Printf("Error fetching pending refunds of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching refunds", http.StatusInternalServerError)
+		return
+	}
+	if len(refunds) == 0 {
+		http.Error(w, "Tidak ada refund pending", http.StatusNotFound)
+		return
+	}
+
+	result, err := processRefunds(orderID, refunds, nil, services.ActorAdmin(userID))
+	writeRefundResult(w, orderID, result, err)
+}
+
+// HandleGetRefunds menampilkan riwayat refund pesanan
+func HandleGetRefunds(w http.ResponseWriter, r *http.Request) {
+	_, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	refunds, err := services.ListRefunds(database.DB, orderID)
+	if err != nil {
+		log.Printf("Error fetching refunds of order %d: %v", orderID, err)
+		http.Error(w, "Error fetching refunds", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refunds)
+}
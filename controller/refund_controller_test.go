@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+)
+
+func TestRefundStatusForError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"ditolak gateway", fmt.Errorf("midtrans: %w", services.ErrGatewayRejected), services.RefundFailed},
+		{"transaksi tidak ditemukan", services.ErrGatewayTransactionNotFound, services.RefundFailed},
+		{"timeout", errors.New("context deadline exceeded"), services.RefundPending},
+		{"5xx", errors.New("midtrans: status 503"), services.RefundPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refundStatusForError(tt.err); got != tt.want {
+				t.Fatalf("refundStatusForError(%v) = %s, ingin %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteRefundResult(t *testing.T) {
+	refunds := []model.Refund{{ID: 1, Jumlah: 500000, Status: services.RefundSucceeded}}
+	tests := []struct {
+		name    string
+		result  refundResult
+		err     error
+		code    int
+		message string
+	}{
+		{"berhasil", refundResult{Refunds: refunds, Status: services.OrderRefunded}, nil, http.StatusCreated, ""},
+		{"ditolak gateway", refundResult{Refunds: refunds, Status: services.OrderCompleted, GatewayErr: services.ErrGatewayRejected}, nil, http.StatusBadGateway, "ditolak"},
+		{"belum pasti", refundResult{Refunds: refunds, Status: services.OrderCompleted, GatewayErr: errors.New("timeout")}, nil, http.StatusBadGateway, "/refunds/retry"},
+		{"error database", refundResult{Refunds: refunds, GatewayErr: services.ErrGatewayRejected}, errors.New("db down"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeRefundResult(rec, 1, tt.result, tt.err)
+			if rec.Code != tt.code {
+				t.Fatalf("status = %d, ingin %d", rec.Code, tt.code)
+			}
+			if tt.err != nil {
+				return
+			}
+			var resp refundResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.result.Status || len(resp.Refunds) != len(refunds) || !strings.Contains(resp.Message, tt.message) {
+				t.Fatalf("respons = %+v", resp)
+			}
+		})
+	}
+}
+
+// refundTestOrder mengajukan refund seperti HandleCreateRefund lalu mengirimnya ke gateway fake
+func refundTestOrder(t *testing.T, orderID int, jumlah model.Rupiah) refundResult {
+	t.Helper()
+	tx, err := database.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	refunds, err := services.PrepareRefunds(tx, orderID, services.RefundRequest{Jumlah: jumlah, Alasan: "uji"}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := processRefunds(orderID, refunds, nil, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestFakeRefundPartialThenFull(t *testing.T) {
+	gateway := setupFakeCheckout(t)
+	order := createTestOrder(t, model.Rupiah(2000000))
+
+	paymentOrderID, _, err := startOrderPayment(order, CustomerDetails{Name: "Pelanggan Uji"}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gateway.Simulate(paymentOrderID, "settlement", "bank_transfer"); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		jumlah  model.Rupiah
+		status  string
+		payment string
+	}{
+		// Refund sebagian atas pesanan yang belum selesai tidak mengubah status pesanan
+		{500000, services.OrderPaid, "partial_refund"},
+		// Jumlah kosong berarti seluruh sisa dana
+		{0, services.OrderRefunded, "refund"},
+	}
+	for _, step := range steps {
+		result := refundTestOrder(t, order.ID, step.jumlah)
+		if result.GatewayErr != nil {
+			t.Fatalf("refund %s ditolak gateway: %v", step.jumlah, result.GatewayErr)
+		}
+		if result.Status != step.status || orderStatus(t, order.ID) != step.status {
+			t.Fatalf("status setelah refund %s = %s, ingin %s", step.jumlah, result.Status, step.status)
+		}
+		if status, _ := paymentStatus(t, paymentOrderID); status != step.payment {
+			t.Fatalf("payments setelah refund %s = %s, ingin %s", step.jumlah, status, step.payment)
+		}
+	}
+
+	transaction, err := gateway.GetStatus(paymentOrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transaction.TransactionStatus != "refund" {
+		t.Fatalf("transaksi di gateway = %s, ingin refund", transaction.TransactionStatus)
+	}
+
+	// Pesanan yang sudah di-refund penuh tidak bisa di-refund lagi
+	tx, err := database.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := services.PrepareRefunds(tx, order.ID, services.RefundRequest{Alasan: "uji"}, "test"); !errors.Is(err, services.ErrRefundOrderStatus) {
+		t.Fatalf("refund ulang = %v, ingin ErrRefundOrderStatus", err)
+	}
+}
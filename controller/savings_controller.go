@@ -0,0 +1,403 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// savingsErrorStatus memetakan error tabungan emas ke status HTTP; 0 jika error tidak dikenal
+func savingsErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidSavings), errors.Is(err, services.ErrUnknownJenisEmas):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrSavingsAccountNotFound), errors.Is(err, services.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrSavingsAccountExists), errors.Is(err, services.ErrInsufficientGold),
+		errors.Is(err, services.ErrSavingsLocked), errors.Is(err, services.ErrScheduleActive),
+		errors.Is(err, services.ErrInvalidTransition):
+		return http.StatusConflict
+	}
+	return 0
+}
+
+// authorizeSavingsAccess membaca rekening tabungan dari path {id}; hanya pemilik atau admin yang boleh mengakses
+func authorizeSavingsAccess(w http.ResponseWriter, r *http.Request) (userID int, account model.SavingsAccount, ok bool) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return 0, account, false
+	}
+
+	accountID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid savings account ID format", http.StatusBadRequest)
+		return 0, account, false
+	}
+
+	role, err := getUserRole(userID)
+	if err != nil {
+		log.Printf("Error fetching role for user %d: %v", userID, err)
+		http.Error(w, `{"message": "Forbidden"}`, http.StatusForbidden)
+		return 0, account, false
+	}
+
+	account, err = services.GetSavingsAccount(database.DB, accountID, false)
+	if errors.Is(err, services.ErrSavingsAccountNotFound) || (err == nil && account.UserID != userID && role != RoleAdmin) {
+		http.Error(w, services.ErrSavingsAccountNotFound.Error(), http.StatusNotFound)
+		return 0, account, false
+	}
+	if err != nil {
+		log.Printf("Error fetching savings account %d: %v", accountID, err)
+		http.Error(w, "Error fetching savings account", http.StatusInternalServerError)
+		return 0, account, false
+	}
+	return userID, account, true
+}
+
+// HandleOpenSavingsAccount membuka rekening tabungan emas untuk user yang login
+func HandleOpenSavingsAccount(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	var req struct {
+		JenisEmas string `json:"jenis_emas"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	account, err := services.OpenSavingsAccount(database.DB, userID, req.JenisEmas)
+	if status := savingsErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening savings account for user %d: %v", userID, err)
+		http.Error(w, "Error opening savings account", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(account)
+}
+
+// HandleGetSavingsAccounts menampilkan rekening tabungan emas milik user beserta taksiran
+// nilainya jika dijual kembali hari ini
+func HandleGetSavingsAccounts(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	accounts, err := services.ListSavingsAccounts(database.DB, userID)
+	if err != nil {
+		log.Printf("Error fetching savings accounts of user %d: %v", userID, err)
+		http.Error(w, "Error fetching savings accounts", http.StatusInternalServerError)
+		return
+	}
+
+	type savingsAccountResponse struct {
+		model.SavingsAccount
+		HargaJualKembali model.Rupiah `json:"harga_jual_kembali"`
+		NilaiJualKembali model.Rupiah `json:"nilai_jual_kembali"`
+	}
+	rules := services.CurrentPricingRules()
+	response := []savingsAccountResponse{}
+	for _, account := range accounts {
+		// Harga jual kembali hanya informasi; jenis emas yang tidak ada di daftar harga ditampilkan nol
+		harga, _ := services.SavingsSellbackPrice(account.JenisEmas, rules)
+		nilai, _ := harga.MulGram(account.Saldo)
+		response = append(response, savingsAccountResponse{
+			SavingsAccount:   account,
+			HargaJualKembali: harga,
+			NilaiJualKembali: nilai,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetSavingsStatement menampilkan mutasi rekening tabungan emas, opsional dibatasi
+// tanggal from dan to (YYYY-MM-DD)
+func HandleGetSavingsStatement(w http.ResponseWriter, r *http.Request) {
+	_, account, ok := authorizeSavingsAccess(w, r)
+	if !ok {
+		return
+	}
+
+	var from, to time.Time
+	q := r.URL.Query()
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "Invalid from date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "Invalid to date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+
+	saldoAwal, entries, err := services.SavingsStatement(database.DB, account.ID, from, to)
+	if err != nil {
+		log.Printf("Error fetching statement of savings account %d: %v", account.ID, err)
+		http.Error(w, "Error fetching savings statement", http.StatusInternalServerError)
+		return
+	}
+	saldoAkhir := saldoAwal
+	if len(entries) > 0 {
+		saldoAkhir = entries[len(entries)-1].Saldo
+	} else {
+		entries = []model.SavingsEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rekening":    account,
+		"saldo_awal":  saldoAwal,
+		"mutasi":      entries,
+		"saldo_akhir": saldoAkhir,
+	})
+}
+
+// HandleCreateSavingsDeposit membuat transaksi Snap untuk setoran tabungan emas. Gram dihitung
+// dengan harga saat ini dan baru dikreditkan setelah notifikasi Midtrans menyatakan lunas.
+func HandleCreateSavingsDeposit(w http.ResponseWriter, r *http.Request) {
+	userID, account, ok := authorizeSavingsAccess(w, r)
+	if !ok {
+		return
+	}
+	if account.UserID != userID {
+		http.Error(w, "Setoran hanya bisa dibuat oleh pemilik rekening", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Jumlah          model.Rupiah    `json:"jumlah"`
+		CustomerDetails CustomerDetails `json:"customer_details"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	deposit, err := services.NewSavingsDeposit(database.DB, account, req.Jumlah)
+	if status := savingsErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error pricing savings deposit for account %d: %v", account.ID, err)
+		http.Error(w, "Error creating deposit", http.StatusInternalServerError)
+		return
+	}
+
+	deposit.PaymentOrderID = services.NewMidtransOrderID("savings")
+	snapResp, err := services.CreateCharge(deposit.PaymentOrderID, deposit.Jumlah.Int64(), services.PaymentCustomer{
+		Name:  req.CustomerDetails.Name,
+		Email: req.CustomerDetails.Email,
+		Phone: req.CustomerDetails.Phone,
+	})
+	if err != nil {
+		log.Printf("Error creating snap token for savings deposit %s: %v", deposit.PaymentOrderID, err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating deposit", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := services.SaveSavingsDeposit(tx, &deposit); err != nil {
+		log.Printf("Error saving savings deposit %s: %v", deposit.PaymentOrderID, err)
+		http.Error(w, "Error creating deposit", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(`
+		INSERT INTO payments (
+			order_id, kind, gross_amount, customer_name, customer_email,
+			customer_phone, token, redirect_url, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 'pending')`,
+		deposit.PaymentOrderID, services.PaymentKindSavings, deposit.Jumlah, req.CustomerDetails.Name,
+		req.CustomerDetails.Email, req.CustomerDetails.Phone, snapResp.Token, snapResp.RedirectURL)
+	if err != nil {
+		log.Printf("Error saving payment %s: %v", deposit.PaymentOrderID, err)
+		http.Error(w, "Error creating deposit", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing savings deposit %s: %v", deposit.PaymentOrderID, err)
+		http.Error(w, "Error creating deposit", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Setoran tabungan emas %s dibuat untuk rekening %d", deposit.PaymentOrderID, account.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"setoran":      deposit,
+		"token":        snapResp.Token,
+		"redirect_url": snapResp.RedirectURL,
+	})
+}
+
+// HandleSellBackSavings menjual kembali gram tabungan ke toko dan mencatat pembayarannya (admin)
+func HandleSellBackSavings(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireRole(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+	accountID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid savings account ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Gram                model.Gram `json:"gram"`
+		MetodePembayaran    string     `json:"metode_pembayaran"`
+		ReferensiPembayaran string     `json:"referensi_pembayaran"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error selling back savings", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	entry, err := services.SellBackSavings(tx, accountID, req.Gram, req.MetodePembayaran, req.ReferensiPembayaran, services.ActorUser(adminID))
+	if status := savingsErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error selling back savings account %d: %v", accountID, err)
+		http.Error(w, "Error selling back savings", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing sell-back of savings account %d: %v", accountID, err)
+		http.Error(w, "Error selling back savings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// HandleSetOrderSavings menarik gram tabungan emas sebagai perhiasan untuk pesanan yang belum dibayar.
+// Tanpa gram tabungan dipakai semaksimal mungkin; gram 0 mengembalikan gram ke tabungan.
+// Pesanan yang lunas sepenuhnya dengan tabungan langsung berstatus paid tanpa Midtrans.
+func HandleSetOrderSavings(w http.ResponseWriter, r *http.Request) {
+	userID, orderID, _, ok := authorizeOrderAccess(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Gram *model.Gram `json:"gram"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	if err := database.DB.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1`, orderID).Scan(&status); err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		http.Error(w, "Error fetching order", http.StatusInternalServerError)
+		return
+	}
+	if status != services.OrderDraft && status != services.OrderAwaitingPayment {
+		http.Error(w, services.ErrSavingsLocked.Error(), http.StatusConflict)
+		return
+	}
+	if status == services.OrderAwaitingPayment {
+		if err := services.CancelPendingPayments(database.DB, orderID); err != nil {
+			writeCancelPaymentsError(w, orderID, err)
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error applying gold savings", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	actor := services.ActorUser(userID)
+	breakdown, err := services.SetOrderSavings(tx, orderID, req.Gram, actor)
+	if status := savingsErrorStatus(err); status != 0 {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error applying gold savings to order %d: %v", orderID, err)
+		http.Error(w, "Error applying gold savings", http.StatusInternalServerError)
+		return
+	}
+
+	// Total nol tidak bisa ditagih lewat Midtrans, jadi pesanan langsung dianggap lunas
+	paid := breakdown.Total == 0 && (breakdown.TukarTambah > 0 || breakdown.TabunganEmas > 0)
+	if paid {
+		if err := markOrderPaid(tx, orderID, status, actor, "Lunas dengan tabungan emas"); err != nil {
+			log.Printf("Error settling order %d with gold savings: %v", orderID, err)
+			http.Error(w, "Error applying gold savings", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing gold savings of order %d: %v", orderID, err)
+		http.Error(w, "Error applying gold savings", http.StatusInternalServerError)
+		return
+	}
+
+	if paid {
+		invoice, created, err := issueInvoice(orderID, "", services.PaymentKindSavings)
+		if err != nil {
+			log.Printf("Error issuing invoice for order %d: %v", orderID, err)
+		} else if created {
+			services.SendInvoiceEmail(invoice)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total_harga": breakdown.Total,
+		"rincian":     breakdown,
+		"lunas":       paid,
+	})
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"proyek3/database"
+	"proyek3/model"
+	"proyek3/services"
+
+	"github.com/gorilla/mux"
+)
+
+// GetVouchers mengembalikan semua voucher dan promosi otomatis (admin)
+func GetVouchers(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	vouchers, err := services.ListVouchers(database.DB)
+	if err != nil {
+		log.Printf("Error fetching vouchers: %v", err)
+		http.Error(w, "Failed to fetch vouchers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vouchers)
+}
+
+// CreateVoucher menambahkan voucher atau promosi otomatis baru (admin)
+func CreateVoucher(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	var voucher model.Voucher
+	if err := json.NewDecoder(r.Body).Decode(&voucher); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	voucher.ID = 0
+
+	if err := services.SaveVoucher(database.DB, &voucher); err != nil {
+		log.Printf("Error saving voucher: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(voucher)
+}
+
+// UpdateVoucher memperbarui voucher, misalnya untuk menonaktifkan promosi (admin)
+func UpdateVoucher(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid voucher ID format", http.StatusBadRequest)
+		return
+	}
+
+	var voucher model.Voucher
+	if err := json.NewDecoder(r.Body).Decode(&voucher); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	voucher.ID = id
+
+	err = services.SaveVoucher(database.DB, &voucher)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Voucher not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating voucher %d: %v", id, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(voucher)
+}
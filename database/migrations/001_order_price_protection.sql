@@ -0,0 +1,6 @@
+-- Harga pesanan dihitung ulang di server; simpan versi daftar harga yang dipakai
+ALTER TABLE custom_orders ADD COLUMN IF NOT EXISTS price_sheet_version VARCHAR(32);
+
+-- Hubungkan setiap pembayaran dengan pesanan yang dibayar
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS custom_order_id INTEGER REFERENCES custom_orders(id);
+CREATE INDEX IF NOT EXISTS idx_payments_custom_order_id ON payments(custom_order_id);
@@ -0,0 +1,19 @@
+-- Quote harga yang dikunci sementara sebelum pesanan dibuat
+CREATE TABLE IF NOT EXISTS quotes (
+    id                  VARCHAR(32) PRIMARY KEY,
+    user_id             INTEGER NOT NULL REFERENCES "user"(id),
+    jenis_perhiasan     VARCHAR(100) NOT NULL,
+    jenis_emas          VARCHAR(50) NOT NULL,
+    berat_emas          DOUBLE PRECISION NOT NULL,
+    campuran_tambahan   VARCHAR(50),
+    persentase_emas     DOUBLE PRECISION NOT NULL,
+    rincian             JSONB NOT NULL,
+    total_harga         DOUBLE PRECISION NOT NULL,
+    price_sheet_version VARCHAR(32) NOT NULL,
+    expires_at          TIMESTAMPTZ NOT NULL,
+    signature           VARCHAR(64) NOT NULL,
+    custom_order_id     INTEGER REFERENCES custom_orders(id),
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE custom_orders ADD COLUMN IF NOT EXISTS quote_id VARCHAR(32) REFERENCES quotes(id);
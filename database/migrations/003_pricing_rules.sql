@@ -0,0 +1,46 @@
+-- Ongkos pembuatan per jenis perhiasan; jenis_perhiasan '*' dipakai sebagai default
+CREATE TABLE IF NOT EXISTS labor_rates (
+    jenis_perhiasan VARCHAR(100) PRIMARY KEY,
+    mode            VARCHAR(16) NOT NULL CHECK (mode IN ('per_gram', 'flat')),
+    amount          DOUBLE PRECISION NOT NULL CHECK (amount >= 0)
+);
+
+INSERT INTO labor_rates (jenis_perhiasan, mode, amount) VALUES
+    ('*', 'per_gram', 50000),
+    ('Cincin', 'per_gram', 50000),
+    ('Kalung', 'per_gram', 40000),
+    ('Gelang', 'per_gram', 45000),
+    ('Anting', 'flat', 150000),
+    ('Liontin', 'flat', 100000)
+ON CONFLICT (jenis_perhiasan) DO NOTHING;
+
+-- Tarif pajak (persen) berdasarkan tanggal mulai berlaku
+CREATE TABLE IF NOT EXISTS tax_rates (
+    id             SERIAL PRIMARY KEY,
+    name           VARCHAR(50) NOT NULL,
+    rate           DOUBLE PRECISION NOT NULL CHECK (rate >= 0),
+    effective_from TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO tax_rates (name, rate, effective_from)
+SELECT 'PPN', 1.1, '2023-05-01'
+WHERE NOT EXISTS (SELECT 1 FROM tax_rates);
+
+-- Harga batu permata per butir
+CREATE TABLE IF NOT EXISTS stone_rates (
+    jenis VARCHAR(50) PRIMARY KEY,
+    harga DOUBLE PRECISION NOT NULL CHECK (harga >= 0)
+);
+
+INSERT INTO stone_rates (jenis, harga) VALUES
+    ('Zirkon', 25000),
+    ('Mutiara', 150000),
+    ('Ruby', 750000),
+    ('Safir', 850000),
+    ('Berlian', 2500000)
+ON CONFLICT (jenis) DO NOTHING;
+
+-- Rincian harga disimpan bersama pesanan dan quote
+ALTER TABLE custom_orders ADD COLUMN IF NOT EXISTS batu JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE custom_orders ADD COLUMN IF NOT EXISTS rincian_harga JSONB;
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS batu JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,27 @@
+-- Nominal rupiah disimpan sebagai bilangan bulat, berat dalam 3 desimal (miligram),
+-- persentase dalam 2 desimal. Nilai lama dibulatkan half-up sesuai aturan di model/money.go.
+ALTER TABLE custom_orders
+    ALTER COLUMN total_harga TYPE NUMERIC(15,0) USING ROUND(total_harga::NUMERIC, 0),
+    ALTER COLUMN berat_emas TYPE NUMERIC(10,3) USING ROUND(berat_emas::NUMERIC, 3),
+    ALTER COLUMN persentase_emas TYPE NUMERIC(5,2) USING ROUND(persentase_emas::NUMERIC, 2);
+
+ALTER TABLE quotes
+    ALTER COLUMN total_harga TYPE NUMERIC(15,0) USING ROUND(total_harga::NUMERIC, 0),
+    ALTER COLUMN berat_emas TYPE NUMERIC(10,3) USING ROUND(berat_emas::NUMERIC, 3),
+    ALTER COLUMN persentase_emas TYPE NUMERIC(5,2) USING ROUND(persentase_emas::NUMERIC, 2);
+
+ALTER TABLE emas
+    ALTER COLUMN harga TYPE NUMERIC(15,0) USING ROUND(harga::NUMERIC, 0),
+    ALTER COLUMN berat TYPE NUMERIC(10,3) USING ROUND(berat::NUMERIC, 3);
+
+ALTER TABLE payments
+    ALTER COLUMN gross_amount TYPE NUMERIC(15,0) USING ROUND(gross_amount::NUMERIC, 0);
+
+ALTER TABLE labor_rates
+    ALTER COLUMN amount TYPE NUMERIC(15,0) USING ROUND(amount::NUMERIC, 0);
+
+ALTER TABLE tax_rates
+    ALTER COLUMN rate TYPE NUMERIC(5,2) USING ROUND(rate::NUMERIC, 2);
+
+ALTER TABLE stone_rates
+    ALTER COLUMN harga TYPE NUMERIC(15,0) USING ROUND(harga::NUMERIC, 0);
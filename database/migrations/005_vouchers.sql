@@ -0,0 +1,47 @@
+-- Voucher berkode dan promosi otomatis (otomatis = true, kode boleh kosong)
+CREATE TABLE IF NOT EXISTS vouchers (
+    id              SERIAL PRIMARY KEY,
+    kode            VARCHAR(50) UNIQUE,
+    nama            VARCHAR(100) NOT NULL,
+    tipe            VARCHAR(10) NOT NULL CHECK (tipe IN ('persen', 'nominal')),
+    persen          NUMERIC(5,2) NOT NULL DEFAULT 0,
+    nominal         NUMERIC(15,0) NOT NULL DEFAULT 0,
+    maks_diskon     NUMERIC(15,0) NOT NULL DEFAULT 0,
+    min_pembelian   NUMERIC(15,0) NOT NULL DEFAULT 0,
+    batas_per_user  INTEGER NOT NULL DEFAULT 0,
+    batas_total     INTEGER NOT NULL DEFAULT 0,
+    berlaku_mulai   TIMESTAMPTZ NOT NULL,
+    berlaku_sampai  TIMESTAMPTZ NOT NULL,
+    jenis_perhiasan JSONB NOT NULL DEFAULT '[]',
+    jenis_emas      JSONB NOT NULL DEFAULT '[]',
+    otomatis        BOOLEAN NOT NULL DEFAULT FALSE,
+    aktif           BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (otomatis OR kode IS NOT NULL)
+);
+
+-- Potongan tidak boleh negatif dan persen voucher persen harus di (0, 100]
+ALTER TABLE vouchers DROP CONSTRAINT IF EXISTS vouchers_persen_check;
+ALTER TABLE vouchers ADD CONSTRAINT vouchers_persen_check CHECK (
+    persen >= 0 AND persen <= 100 AND (tipe <> 'persen' OR persen > 0)
+);
+ALTER TABLE vouchers DROP CONSTRAINT IF EXISTS vouchers_nominal_check;
+ALTER TABLE vouchers ADD CONSTRAINT vouchers_nominal_check CHECK (
+    nominal >= 0 AND maks_diskon >= 0 AND min_pembelian >= 0 AND batas_per_user >= 0 AND batas_total >= 0
+);
+
+-- Pemakaian voucher per pesanan; status reserved/redeemed dihitung ke kuota
+CREATE TABLE IF NOT EXISTS voucher_redemptions (
+    id              SERIAL PRIMARY KEY,
+    voucher_id      INTEGER NOT NULL REFERENCES vouchers(id),
+    user_id         INTEGER NOT NULL REFERENCES "user"(id),
+    custom_order_id INTEGER NOT NULL REFERENCES custom_orders(id),
+    diskon          NUMERIC(15,0) NOT NULL,
+    status          VARCHAR(10) NOT NULL CHECK (status IN ('reserved', 'redeemed', 'released')),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_voucher_redemptions_voucher ON voucher_redemptions(voucher_id, status);
+CREATE INDEX IF NOT EXISTS idx_voucher_redemptions_order ON voucher_redemptions(custom_order_id);
+
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS kode_voucher VARCHAR(50) NOT NULL DEFAULT '';
@@ -0,0 +1,23 @@
+-- Riwayat perubahan status pesanan; hanya ditulis oleh services.TransitionOrder
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id              SERIAL PRIMARY KEY,
+    custom_order_id INTEGER NOT NULL REFERENCES custom_orders(id),
+    from_status     VARCHAR(20),
+    to_status       VARCHAR(20) NOT NULL,
+    actor           VARCHAR(50) NOT NULL,
+    note            TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order ON order_status_history(custom_order_id, created_at);
+
+-- Ubah status lama dari WebhookHandler ke status baru
+UPDATE custom_orders SET status = 'awaiting_payment' WHERE status = 'waiting_payment';
+UPDATE custom_orders SET status = 'cancelled' WHERE status = 'failed';
+UPDATE custom_orders SET status = 'draft' WHERE status IS NULL OR status = 'unknown';
+
+ALTER TABLE custom_orders ALTER COLUMN status SET DEFAULT 'draft';
+ALTER TABLE custom_orders DROP CONSTRAINT IF EXISTS custom_orders_status_check;
+ALTER TABLE custom_orders ADD CONSTRAINT custom_orders_status_check CHECK (status IN (
+    'draft', 'awaiting_payment', 'paid', 'in_production', 'quality_check', 'ready',
+    'shipped', 'picked_up', 'completed', 'cancelled', 'refunded'
+));
@@ -0,0 +1,19 @@
+-- Timeline pesanan: perubahan status, notifikasi pembayaran, catatan admin dan foto produksi
+CREATE TABLE IF NOT EXISTS order_events (
+    id              SERIAL PRIMARY KEY,
+    custom_order_id INTEGER NOT NULL REFERENCES custom_orders(id),
+    tipe            VARCHAR(20) NOT NULL CHECK (tipe IN ('status_change', 'payment', 'note', 'photo')),
+    status          VARCHAR(20),
+    keterangan      TEXT NOT NULL DEFAULT '',
+    foto_url        TEXT,
+    actor           VARCHAR(50) NOT NULL,
+    internal        BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_order_events_order ON order_events(custom_order_id, created_at);
+
+-- Isi timeline dari riwayat status yang sudah ada
+INSERT INTO order_events (custom_order_id, tipe, status, keterangan, actor, created_at)
+SELECT h.custom_order_id, 'status_change', h.to_status, h.note, h.actor, h.created_at
+FROM order_status_history h
+WHERE NOT EXISTS (SELECT 1 FROM order_events e WHERE e.custom_order_id = h.custom_order_id);
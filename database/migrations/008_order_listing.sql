@@ -0,0 +1,7 @@
+-- Kolom waktu untuk filter tanggal dan urutan daftar pesanan/pembayaran
+ALTER TABLE custom_orders ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS transaction_id VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_custom_orders_user ON custom_orders(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_custom_orders_status ON custom_orders(status, created_at DESC);
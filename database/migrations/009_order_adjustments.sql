@@ -0,0 +1,20 @@
+-- Jenis pembayaran: pembayaran utama pesanan atau tagihan kekurangan setelah amandemen
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'order';
+
+-- Pembatalan dan amandemen pesanan beserta tindak lanjut keuangannya
+CREATE TABLE IF NOT EXISTS order_adjustments (
+    id               SERIAL PRIMARY KEY,
+    custom_order_id  INTEGER NOT NULL REFERENCES custom_orders(id),
+    jenis            VARCHAR(20) NOT NULL CHECK (jenis IN ('cancellation', 'amendment')),
+    sebelum          JSONB NOT NULL,
+    sesudah          JSONB NOT NULL,
+    total_lama       NUMERIC(15,0) NOT NULL,
+    total_baru       NUMERIC(15,0) NOT NULL,
+    selisih          NUMERIC(15,0) NOT NULL,
+    tindakan         VARCHAR(20) NOT NULL CHECK (tindakan IN ('none', 'payment_request', 'refund_due')),
+    payment_order_id VARCHAR(100),
+    alasan           TEXT NOT NULL DEFAULT '',
+    actor            VARCHAR(50) NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_order_adjustments_order ON order_adjustments(custom_order_id);
@@ -0,0 +1,40 @@
+-- Stok perhiasan jadi
+ALTER TABLE emas ADD COLUMN IF NOT EXISTS stok INTEGER NOT NULL DEFAULT 0 CHECK (stok >= 0);
+
+-- Header pesanan: custom (satu perhiasan custom) atau cart (beberapa item dari keranjang)
+ALTER TABLE custom_orders ADD COLUMN IF NOT EXISTS tipe VARCHAR(20) NOT NULL DEFAULT 'custom';
+
+-- Item pesanan multi-item; spesifikasi dan harga disalin saat checkout
+CREATE TABLE IF NOT EXISTS order_items (
+    id                SERIAL PRIMARY KEY,
+    custom_order_id   INTEGER NOT NULL REFERENCES custom_orders(id),
+    item_type         VARCHAR(10) NOT NULL CHECK (item_type IN ('emas', 'custom')),
+    emas_id           INTEGER REFERENCES emas(id),
+    nama              VARCHAR(255) NOT NULL DEFAULT '',
+    jenis_perhiasan   VARCHAR(50) NOT NULL DEFAULT '',
+    jenis_emas        VARCHAR(50) NOT NULL DEFAULT '',
+    berat_emas        NUMERIC(10,3) NOT NULL DEFAULT 0,
+    campuran_tambahan VARCHAR(50) NOT NULL DEFAULT '',
+    persentase_emas   NUMERIC(5,2) NOT NULL DEFAULT 0,
+    batu              JSONB NOT NULL DEFAULT '[]',
+    qty               INTEGER NOT NULL CHECK (qty > 0),
+    harga_satuan      NUMERIC(15,0) NOT NULL,
+    subtotal          NUMERIC(15,0) NOT NULL,
+    rincian           JSONB,
+    restocked         BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS idx_order_items_order ON order_items(custom_order_id);
+
+-- Keranjang per user
+CREATE TABLE IF NOT EXISTS cart_items (
+    id        SERIAL PRIMARY KEY,
+    user_id   INTEGER NOT NULL REFERENCES "user"(id),
+    item_type VARCHAR(10) NOT NULL CHECK (item_type IN ('emas', 'custom')),
+    emas_id   INTEGER REFERENCES emas(id) ON DELETE CASCADE,
+    custom    JSONB,
+    qty       INTEGER NOT NULL CHECK (qty > 0),
+    added_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((item_type = 'emas' AND emas_id IS NOT NULL) OR (item_type = 'custom' AND custom IS NOT NULL))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cart_items_emas ON cart_items(user_id, emas_id) WHERE item_type = 'emas';
+CREATE INDEX IF NOT EXISTS idx_cart_items_user ON cart_items(user_id);
@@ -0,0 +1,33 @@
+-- Work order produksi untuk setiap perhiasan custom yang sudah dibayar
+CREATE TABLE IF NOT EXISTS work_orders (
+    id               SERIAL PRIMARY KEY,
+    custom_order_id  INTEGER NOT NULL REFERENCES custom_orders(id),
+    order_item_id    INTEGER REFERENCES order_items(id),
+    deskripsi        VARCHAR(255) NOT NULL DEFAULT '',
+    berat_target     NUMERIC(10,3) NOT NULL DEFAULT 0,
+    status           VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'done', 'cancelled')),
+    tahap_saat_ini   VARCHAR(30) NOT NULL DEFAULT 'design_approval',
+    estimasi_selesai DATE,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at     TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_work_orders_piece ON work_orders(custom_order_id, COALESCE(order_item_id, 0));
+CREATE INDEX IF NOT EXISTS idx_work_orders_open ON work_orders(status, tahap_saat_ini, estimasi_selesai);
+
+-- Tahap produksi: design_approval, casting, setting, polishing, qc
+CREATE TABLE IF NOT EXISTS work_order_stages (
+    id               SERIAL PRIMARY KEY,
+    work_order_id    INTEGER NOT NULL REFERENCES work_orders(id),
+    tahap            VARCHAR(30) NOT NULL,
+    urutan           INTEGER NOT NULL,
+    status           VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'in_progress', 'done', 'skipped')),
+    pengrajin        VARCHAR(100) NOT NULL DEFAULT '',
+    estimasi_selesai DATE,
+    berat_masuk      NUMERIC(10,3),
+    berat_keluar     NUMERIC(10,3),
+    catatan          TEXT NOT NULL DEFAULT '',
+    started_at       TIMESTAMPTZ,
+    completed_at     TIMESTAMPTZ,
+    UNIQUE (work_order_id, tahap)
+);
+CREATE INDEX IF NOT EXISTS idx_work_order_stages_pengrajin ON work_order_stages(pengrajin) WHERE status = 'in_progress';
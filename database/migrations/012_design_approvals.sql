@@ -0,0 +1,27 @@
+-- Lampiran pesanan: foto referensi dari pelanggan, sketsa atau render 3D dari staf
+CREATE TABLE IF NOT EXISTS order_attachments (
+    id              SERIAL PRIMARY KEY,
+    custom_order_id INTEGER NOT NULL REFERENCES custom_orders(id),
+    uploader_id     INTEGER NOT NULL REFERENCES "user"(id),
+    jenis           VARCHAR(20) NOT NULL CHECK (jenis IN ('reference', 'sketch', 'render')),
+    nama_file       VARCHAR(255) NOT NULL,
+    content_type    VARCHAR(100) NOT NULL,
+    ukuran          BIGINT NOT NULL,
+    storage_key     VARCHAR(255) NOT NULL UNIQUE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_order_attachments_order ON order_attachments(custom_order_id);
+
+-- Permintaan persetujuan desain ke pelanggan
+CREATE TABLE IF NOT EXISTS design_approvals (
+    id              SERIAL PRIMARY KEY,
+    custom_order_id INTEGER NOT NULL REFERENCES custom_orders(id),
+    attachment_ids  INTEGER[] NOT NULL DEFAULT '{}',
+    pesan           TEXT NOT NULL DEFAULT '',
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'superseded')),
+    komentar        TEXT NOT NULL DEFAULT '',
+    requested_by    VARCHAR(50) NOT NULL,
+    requested_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    responded_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_design_approvals_order ON design_approvals(custom_order_id);
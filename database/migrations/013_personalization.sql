@@ -0,0 +1,21 @@
+-- Biaya tambahan personalisasi; kode "ukiran:<font>" atau "finishing:<jenis>"
+CREATE TABLE IF NOT EXISTS personalization_rates (
+    kode  VARCHAR(50) PRIMARY KEY,
+    harga NUMERIC(15,0) NOT NULL CHECK (harga >= 0)
+);
+
+INSERT INTO personalization_rates (kode, harga) VALUES
+    ('ukiran:Script', 75000),
+    ('ukiran:Serif', 50000),
+    ('ukiran:Sans', 50000),
+    ('ukiran:Block', 50000),
+    ('finishing:Doff', 75000),
+    ('finishing:Hammered', 150000),
+    ('finishing:Brushed', 75000),
+    ('finishing:Sandblast', 100000)
+ON CONFLICT (kode) DO NOTHING;
+
+-- Personalisasi (ukiran, ukuran cincin, finishing) yang dipilih pelanggan
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS personalisasi JSONB;
+ALTER TABLE custom_orders ADD COLUMN IF NOT EXISTS personalisasi JSONB;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS personalisasi JSONB;
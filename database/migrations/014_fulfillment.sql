@@ -0,0 +1,71 @@
+-- Cabang toko untuk pengambilan pesanan
+CREATE TABLE IF NOT EXISTS branches (
+    id      SERIAL PRIMARY KEY,
+    kode    VARCHAR(20) NOT NULL UNIQUE,
+    nama    VARCHAR(100) NOT NULL,
+    alamat  TEXT NOT NULL DEFAULT '',
+    kota    VARCHAR(100) NOT NULL DEFAULT '',
+    telepon VARCHAR(30) NOT NULL DEFAULT '',
+    aktif   BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+INSERT INTO branches (kode, nama, kota) VALUES ('PUSAT', 'Toko Pusat', 'Bandung')
+ON CONFLICT (kode) DO NOTHING;
+
+-- Tarif kurir per kilogram; tujuan '*' berlaku untuk semua kota
+CREATE TABLE IF NOT EXISTS shipping_rates (
+    kurir    VARCHAR(50) NOT NULL,
+    layanan  VARCHAR(50) NOT NULL,
+    tujuan   VARCHAR(100) NOT NULL DEFAULT '*',
+    per_kg   NUMERIC(15,0) NOT NULL CHECK (per_kg >= 0),
+    estimasi VARCHAR(50) NOT NULL DEFAULT '',
+    PRIMARY KEY (kurir, layanan, tujuan)
+);
+
+INSERT INTO shipping_rates (kurir, layanan, tujuan, per_kg, estimasi) VALUES
+    ('JNE', 'REG', '*', 12000, '2-3 hari'),
+    ('JNE', 'YES', '*', 22000, '1 hari'),
+    ('SiCepat', 'REG', '*', 11000, '2-3 hari'),
+    ('SiCepat', 'BEST', '*', 20000, '1 hari'),
+    ('JNE', 'REG', 'Bandung', 8000, '1-2 hari'),
+    ('SiCepat', 'REG', 'Bandung', 7000, '1-2 hari')
+ON CONFLICT (kurir, layanan, tujuan) DO NOTHING;
+
+-- Pilihan penyerahan pesanan: ambil di cabang dengan kode atau kirim kurir berasuransi
+CREATE TABLE IF NOT EXISTS order_fulfillments (
+    custom_order_id INTEGER PRIMARY KEY REFERENCES custom_orders(id),
+    metode          VARCHAR(20) NOT NULL CHECK (metode IN ('pickup', 'courier')),
+    branch_id       INTEGER REFERENCES branches(id),
+    kode_pickup     VARCHAR(10) NOT NULL DEFAULT '',
+    nama_penerima   VARCHAR(100) NOT NULL DEFAULT '',
+    telepon         VARCHAR(30) NOT NULL DEFAULT '',
+    alamat          TEXT NOT NULL DEFAULT '',
+    kota            VARCHAR(100) NOT NULL DEFAULT '',
+    kode_pos        VARCHAR(10) NOT NULL DEFAULT '',
+    kurir           VARCHAR(50) NOT NULL DEFAULT '',
+    layanan         VARCHAR(50) NOT NULL DEFAULT '',
+    estimasi        VARCHAR(50) NOT NULL DEFAULT '',
+    berat           NUMERIC(10,3) NOT NULL DEFAULT 0,
+    nilai_asuransi  NUMERIC(15,0) NOT NULL DEFAULT 0,
+    ongkir          NUMERIC(15,0) NOT NULL DEFAULT 0,
+    biaya_asuransi  NUMERIC(15,0) NOT NULL DEFAULT 0,
+    picked_up_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Paket yang diserahkan ke kurir
+CREATE TABLE IF NOT EXISTS shipments (
+    id              SERIAL PRIMARY KEY,
+    custom_order_id INTEGER NOT NULL REFERENCES custom_orders(id),
+    kurir           VARCHAR(50) NOT NULL,
+    layanan         VARCHAR(50) NOT NULL DEFAULT '',
+    no_resi         VARCHAR(100) NOT NULL,
+    nilai_asuransi  NUMERIC(15,0) NOT NULL DEFAULT 0,
+    status          VARCHAR(20) NOT NULL DEFAULT 'in_transit' CHECK (status IN ('in_transit', 'delivered', 'returned')),
+    catatan         TEXT NOT NULL DEFAULT '',
+    shipped_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at    TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_shipments_order ON shipments(custom_order_id);
@@ -0,0 +1,22 @@
+-- Metode pembayaran dari notifikasi Midtrans, dicetak di nota
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS payment_type VARCHAR(50);
+
+-- Nomor urut nota per tahun
+CREATE TABLE IF NOT EXISTS invoice_counters (
+    tahun          INTEGER PRIMARY KEY,
+    nomor_terakhir INTEGER NOT NULL DEFAULT 0
+);
+
+-- Nota pembayaran; pesanan disalin saat nota terbit supaya isi nota tidak ikut berubah
+CREATE TABLE IF NOT EXISTS invoices (
+    id                SERIAL PRIMARY KEY,
+    custom_order_id   INTEGER NOT NULL UNIQUE REFERENCES custom_orders(id),
+    nomor             VARCHAR(30) NOT NULL UNIQUE,
+    payment_order_id  VARCHAR(100) NOT NULL DEFAULT '',
+    metode_pembayaran VARCHAR(100) NOT NULL DEFAULT '',
+    nama_pelanggan    VARCHAR(255) NOT NULL DEFAULT '',
+    email_pelanggan   VARCHAR(255) NOT NULL DEFAULT '',
+    total             NUMERIC(15,0) NOT NULL,
+    pesanan           JSONB NOT NULL,
+    issued_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,22 @@
+-- Sertifikat keaslian per perhiasan; spesifikasi disalin saat terbit dan tidak menyimpan data pemilik
+CREATE TABLE IF NOT EXISTS certificates (
+    id                SERIAL PRIMARY KEY,
+    serial            VARCHAR(20) NOT NULL UNIQUE,
+    custom_order_id   INTEGER REFERENCES custom_orders(id),
+    order_item_id     INTEGER REFERENCES order_items(id),
+    emas_id           INTEGER REFERENCES emas(id),
+    nama              VARCHAR(255) NOT NULL DEFAULT '',
+    jenis_perhiasan   VARCHAR(50) NOT NULL DEFAULT '',
+    jenis_emas        VARCHAR(50) NOT NULL DEFAULT '',
+    karat             INTEGER NOT NULL,
+    kadar             NUMERIC(5,2) NOT NULL,
+    berat             NUMERIC(10,3) NOT NULL,
+    batu              JSONB NOT NULL DEFAULT '[]',
+    status            VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'revoked')),
+    alasan_pencabutan TEXT NOT NULL DEFAULT '',
+    issued_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at        TIMESTAMPTZ,
+    CHECK (custom_order_id IS NOT NULL OR emas_id IS NOT NULL)
+);
+CREATE INDEX IF NOT EXISTS idx_certificates_order ON certificates(custom_order_id) WHERE custom_order_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_certificates_emas ON certificates(emas_id) WHERE emas_id IS NOT NULL;
@@ -0,0 +1,60 @@
+-- Potongan harga buyback (persen dari nilai emas) per jenis emas; jenis_emas '*' dipakai sebagai default
+CREATE TABLE IF NOT EXISTS buyback_spreads (
+    jenis_emas VARCHAR(50) PRIMARY KEY,
+    spread     NUMERIC(5,2) NOT NULL CHECK (spread >= 0 AND spread < 100)
+);
+
+INSERT INTO buyback_spreads (jenis_emas, spread) VALUES
+    ('*', 5.00)
+ON CONFLICT (jenis_emas) DO NOTHING;
+
+-- Pembelian kembali emas dari pelanggan; harga disalin saat penawaran dibuat
+CREATE TABLE IF NOT EXISTS buybacks (
+    id                   SERIAL PRIMARY KEY,
+    user_id              INTEGER REFERENCES "user"(id),
+    nama_penjual         VARCHAR(255) NOT NULL,
+    telepon_penjual      VARCHAR(50) NOT NULL DEFAULT '',
+    serial               VARCHAR(20) REFERENCES certificates(serial),
+    deskripsi            VARCHAR(255) NOT NULL DEFAULT '',
+    jenis_emas           VARCHAR(50) NOT NULL,
+    berat                NUMERIC(10,3) NOT NULL CHECK (berat > 0),
+    kadar_uji            NUMERIC(5,2) NOT NULL CHECK (kadar_uji > 0 AND kadar_uji <= 100),
+    metode_uji           VARCHAR(100) NOT NULL DEFAULT '',
+    harga_per_gram       NUMERIC(15,0) NOT NULL,
+    nilai_emas           NUMERIC(15,0) NOT NULL,
+    penyesuaian_kadar    NUMERIC(15,0) NOT NULL,
+    spread               NUMERIC(5,2) NOT NULL,
+    potongan_spread      NUMERIC(15,0) NOT NULL,
+    total                NUMERIC(15,0) NOT NULL,
+    price_sheet_version  VARCHAR(32) NOT NULL,
+    status               VARCHAR(20) NOT NULL DEFAULT 'offered' CHECK (status IN ('offered', 'paid', 'credited', 'cancelled')),
+    metode_pembayaran    VARCHAR(20) NOT NULL DEFAULT '',
+    referensi_pembayaran VARCHAR(100) NOT NULL DEFAULT '',
+    catatan              TEXT NOT NULL DEFAULT '',
+    actor                VARCHAR(50) NOT NULL,
+    created_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    settled_at           TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_buybacks_status ON buybacks(status, created_at);
+
+-- Kredit tukar tambah dari buyback; sisa dihitung dari pemakaian yang belum dilepas
+CREATE TABLE IF NOT EXISTS trade_in_credits (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES "user"(id),
+    buyback_id INTEGER NOT NULL UNIQUE REFERENCES buybacks(id),
+    jumlah     NUMERIC(15,0) NOT NULL CHECK (jumlah >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_trade_in_credits_user ON trade_in_credits(user_id);
+
+CREATE TABLE IF NOT EXISTS trade_in_redemptions (
+    id              SERIAL PRIMARY KEY,
+    credit_id       INTEGER NOT NULL REFERENCES trade_in_credits(id),
+    custom_order_id INTEGER NOT NULL REFERENCES custom_orders(id),
+    jumlah          NUMERIC(15,0) NOT NULL CHECK (jumlah > 0),
+    status          VARCHAR(20) NOT NULL DEFAULT 'reserved' CHECK (status IN ('reserved', 'redeemed', 'released')),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_trade_in_redemptions_order ON trade_in_redemptions(custom_order_id);
+CREATE INDEX IF NOT EXISTS idx_trade_in_redemptions_credit ON trade_in_redemptions(credit_id) WHERE status <> 'released';
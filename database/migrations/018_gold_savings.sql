@@ -0,0 +1,44 @@
+-- Rekening tabungan emas; satu rekening per jenis emas untuk setiap user
+CREATE TABLE IF NOT EXISTS savings_accounts (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES "user"(id),
+    jenis_emas VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, jenis_emas)
+);
+
+-- Setoran rupiah lewat Midtrans; harga dan gram dikunci saat setoran dibuat
+CREATE TABLE IF NOT EXISTS savings_deposits (
+    id                  SERIAL PRIMARY KEY,
+    account_id          INTEGER NOT NULL REFERENCES savings_accounts(id),
+    payment_order_id    VARCHAR(100) NOT NULL UNIQUE,
+    jumlah              NUMERIC(15,0) NOT NULL CHECK (jumlah > 0),
+    harga_per_gram      NUMERIC(15,0) NOT NULL,
+    gram                NUMERIC(10,3) NOT NULL CHECK (gram > 0),
+    price_sheet_version VARCHAR(32) NOT NULL,
+    status              VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'settled', 'failed')),
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    settled_at          TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_savings_deposits_account ON savings_deposits(account_id);
+
+-- Buku besar gram; saldo adalah jumlah gram seluruh mutasi. Mutasi tidak pernah diubah,
+-- penarikan yang batal dikembalikan dengan mutasi order_reversal.
+CREATE TABLE IF NOT EXISTS savings_ledger (
+    id                   SERIAL PRIMARY KEY,
+    account_id           INTEGER NOT NULL REFERENCES savings_accounts(id),
+    tipe                 VARCHAR(20) NOT NULL CHECK (tipe IN ('deposit', 'order', 'order_reversal', 'sellback')),
+    gram                 NUMERIC(10,3) NOT NULL CHECK (gram <> 0),
+    harga_per_gram       NUMERIC(15,0) NOT NULL,
+    nilai                NUMERIC(15,0) NOT NULL,
+    price_sheet_version  VARCHAR(32) NOT NULL,
+    deposit_id           INTEGER UNIQUE REFERENCES savings_deposits(id),
+    custom_order_id      INTEGER REFERENCES custom_orders(id),
+    metode_pembayaran    VARCHAR(20) NOT NULL DEFAULT '',
+    referensi_pembayaran VARCHAR(100) NOT NULL DEFAULT '',
+    keterangan           TEXT NOT NULL DEFAULT '',
+    actor                VARCHAR(50) NOT NULL,
+    created_at           TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_savings_ledger_account ON savings_ledger(account_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_savings_ledger_order ON savings_ledger(custom_order_id) WHERE custom_order_id IS NOT NULL;
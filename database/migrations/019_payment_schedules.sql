@@ -0,0 +1,33 @@
+-- Jadwal pembayaran bertahap: DP lalu beberapa cicilan; pesanan menjadi paid setelah semua tagihan lunas
+CREATE TABLE IF NOT EXISTS payment_schedules (
+    id              SERIAL PRIMARY KEY,
+    custom_order_id INTEGER NOT NULL REFERENCES custom_orders(id),
+    dp_persen       NUMERIC(5,2) NOT NULL CHECK (dp_persen > 0 AND dp_persen < 100),
+    jumlah_cicilan  INTEGER NOT NULL CHECK (jumlah_cicilan > 0),
+    interval_hari   INTEGER NOT NULL CHECK (interval_hari > 0),
+    total           NUMERIC(15,0) NOT NULL,
+    status          VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'settled', 'cancelled')),
+    actor           VARCHAR(50) NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Satu jadwal aktif per pesanan
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_schedules_active ON payment_schedules(custom_order_id) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS payment_installments (
+    id               SERIAL PRIMARY KEY,
+    schedule_id      INTEGER NOT NULL REFERENCES payment_schedules(id),
+    urutan           INTEGER NOT NULL,
+    jenis            VARCHAR(20) NOT NULL CHECK (jenis IN ('dp', 'cicilan')),
+    jumlah           NUMERIC(15,0) NOT NULL CHECK (jumlah >= 0),
+    jatuh_tempo      DATE NOT NULL,
+    status           VARCHAR(20) NOT NULL DEFAULT 'unpaid' CHECK (status IN ('unpaid', 'paid')),
+    payment_order_id VARCHAR(100),
+    paid_at          TIMESTAMPTZ,
+    reminded_at      TIMESTAMPTZ,
+    UNIQUE (schedule_id, urutan)
+);
+CREATE INDEX IF NOT EXISTS idx_payment_installments_due ON payment_installments(jatuh_tempo) WHERE status = 'unpaid';
+
+-- Setiap percobaan bayar DP/cicilan adalah baris payments tersendiri dengan order ID Midtrans sendiri
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS installment_id INTEGER REFERENCES payment_installments(id);
+CREATE INDEX IF NOT EXISTS idx_payments_installment ON payments(installment_id) WHERE installment_id IS NOT NULL;
@@ -0,0 +1,17 @@
+-- Log semua notifikasi webhook Midtrans beserta hasil verifikasi signature dan nominal
+CREATE TABLE IF NOT EXISTS midtrans_notifications (
+    id                 SERIAL PRIMARY KEY,
+    order_id           VARCHAR(100) NOT NULL DEFAULT '',
+    transaction_id     VARCHAR(100) NOT NULL DEFAULT '',
+    transaction_status VARCHAR(30) NOT NULL DEFAULT '',
+    status_code        VARCHAR(10) NOT NULL DEFAULT '',
+    gross_amount       VARCHAR(30) NOT NULL DEFAULT '',
+    signature_key      TEXT NOT NULL DEFAULT '',
+    body               TEXT NOT NULL,
+    verifikasi         VARCHAR(30) NOT NULL CHECK (verifikasi IN ('verified', 'invalid_payload', 'invalid_signature',
+                           'amount_mismatch', 'unknown_payment', 'status_unverified', 'duplicate')),
+    keterangan         TEXT NOT NULL DEFAULT '',
+    received_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    processed_at       TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_midtrans_notifications_order ON midtrans_notifications(order_id, transaction_status);
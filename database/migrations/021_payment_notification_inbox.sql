@@ -0,0 +1,16 @@
+-- Inbox notifikasi pembayaran: satu entri per transaction_id dan status efektif, diproses sekali
+-- dalam satu transaksi. Entri ignored adalah status yang mundur atau bertentangan dengan status akhir.
+CREATE TABLE IF NOT EXISTS payment_notification_inbox (
+    id                 SERIAL PRIMARY KEY,
+    transaction_id     VARCHAR(100) NOT NULL,
+    order_id           VARCHAR(100) NOT NULL,
+    transaction_status VARCHAR(30) NOT NULL,
+    payment_type       VARCHAR(50) NOT NULL DEFAULT '',
+    status             VARCHAR(20) NOT NULL DEFAULT 'received' CHECK (status IN ('received', 'processed', 'ignored')),
+    keterangan         TEXT NOT NULL DEFAULT '',
+    pengiriman         INTEGER NOT NULL DEFAULT 1,
+    received_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    processed_at       TIMESTAMPTZ,
+    UNIQUE (transaction_id, transaction_status)
+);
+CREATE INDEX IF NOT EXISTS idx_payment_notification_inbox_order ON payment_notification_inbox(order_id);
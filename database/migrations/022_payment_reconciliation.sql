@@ -0,0 +1,28 @@
+-- Sumber status pembayaran: notifikasi webhook atau rekonsiliasi yang membaca status langsung dari gateway
+ALTER TABLE midtrans_notifications ADD COLUMN IF NOT EXISTS sumber VARCHAR(20) NOT NULL DEFAULT 'webhook'
+    CHECK (sumber IN ('webhook', 'reconciliation'));
+
+-- Laporan rekonsiliasi harian antara payments, custom_orders dan status transaksi di gateway
+CREATE TABLE IF NOT EXISTS payment_reconciliation_reports (
+    id         SERIAL PRIMARY KEY,
+    tanggal    DATE NOT NULL UNIQUE,
+    diperiksa  INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS payment_reconciliation_mismatches (
+    id                SERIAL PRIMARY KEY,
+    report_id         INTEGER NOT NULL REFERENCES payment_reconciliation_reports(id) ON DELETE CASCADE,
+    jenis             VARCHAR(30) NOT NULL CHECK (jenis IN ('order_unpaid', 'payment_missing', 'gateway_status',
+                          'gateway_amount', 'gateway_missing', 'gateway_unchecked')),
+    payment_order_id  VARCHAR(100),
+    custom_order_id   INTEGER REFERENCES custom_orders(id),
+    status_pembayaran VARCHAR(30) NOT NULL DEFAULT '',
+    status_pesanan    VARCHAR(30) NOT NULL DEFAULT '',
+    status_gateway    VARCHAR(30) NOT NULL DEFAULT '',
+    keterangan        TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_payment_reconciliation_mismatches_report ON payment_reconciliation_mismatches(report_id);
+
+-- Pencarian pembayaran pending yang belum mendapat notifikasi
+CREATE INDEX IF NOT EXISTS idx_payments_pending ON payments(created_at) WHERE status = 'pending';
@@ -0,0 +1,23 @@
+-- Refund pesanan yang dimulai admin; satu baris per pembayaran yang dananya dikembalikan
+CREATE TABLE IF NOT EXISTS refunds (
+    id              SERIAL PRIMARY KEY,
+    custom_order_id INTEGER NOT NULL REFERENCES custom_orders(id),
+    payment_id      INTEGER NOT NULL REFERENCES payments(id),
+    jumlah          NUMERIC(15,0) NOT NULL CHECK (jumlah > 0),
+    alasan          TEXT NOT NULL,
+    refund_key      VARCHAR(100) NOT NULL UNIQUE,
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    keterangan      TEXT NOT NULL DEFAULT '',
+    actor           VARCHAR(50) NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_order ON refunds(custom_order_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_refunds_payment ON refunds(payment_id) WHERE status IN ('pending', 'succeeded');
+
+-- Pesanan yang selesai atau batal bisa di-refund sebagian
+ALTER TABLE custom_orders DROP CONSTRAINT IF EXISTS custom_orders_status_check;
+ALTER TABLE custom_orders ADD CONSTRAINT custom_orders_status_check CHECK (status IN (
+    'draft', 'awaiting_payment', 'paid', 'in_production', 'quality_check', 'ready',
+    'shipped', 'picked_up', 'completed', 'cancelled', 'refunded', 'partially_refunded'
+));
@@ -0,0 +1,15 @@
+-- Filter dan urutan buku pembayaran admin
+CREATE INDEX IF NOT EXISTS idx_payments_created ON payments(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_payments_status ON payments(status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_payments_payment_type ON payments(payment_type, created_at DESC);
+
+-- Pembayaran lama dihubungkan ke pesanan lewat order_id Midtrans
+CREATE INDEX IF NOT EXISTS idx_custom_orders_order_id ON custom_orders(order_id);
+
+-- Order ID Midtrans memakai ULID sehingga tidak lagi bentrok pada detik yang sama. Order ID lama
+-- berbasis detik bisa kembar: baris pertama dipertahankan, sisanya diberi akhiran -dup-<id> supaya
+-- indeks unik bisa dibuat. Baris yang diganti perlu dicek manual ke dashboard Midtrans.
+UPDATE payments p SET order_id = p.order_id || '-dup-' || p.id, updated_at = NOW()
+WHERE EXISTS (SELECT 1 FROM payments d WHERE d.order_id = p.order_id AND d.id < p.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_order_id ON payments(order_id);
@@ -0,0 +1,7 @@
+-- Salinan daftar harga per versi. price_sheet_version pada pesanan, quote, buyback dan tabungan
+-- emas merujuk ke kolom version; versi lama berbentuk tanggal (misalnya 2024-12-01) tidak punya salinan.
+CREATE TABLE IF NOT EXISTS price_sheets (
+    version    VARCHAR(32) PRIMARY KEY,
+    snapshot   JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
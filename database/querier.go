@@ -0,0 +1,11 @@
+package database
+
+import "database/sql"
+
+// Querier dipenuhi oleh *sql.DB maupun *sql.Tx, sehingga service yang sama
+// bisa dipanggil di dalam atau di luar transaksi.
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
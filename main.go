@@ -3,6 +3,7 @@ import (
 	"log"
 	"net/http"
 	"proyek3/config"
+	"proyek3/controller"
 	"proyek3/database"
 	"proyek3/routes"
 
@@ -34,8 +35,12 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	config.InitConfig()
 	database.InitDB()
 
+	// Rekonsiliasi pembayaran pending berjalan di latar belakang pada server lokal
+	controller.StartPaymentReconciler(config.PaymentReconcileInterval)
+
 	http.HandleFunc("/", Handler)
 	log.Println("Starting server on :8081")
 	log.Fatal(http.ListenAndServe(":8081", nil))
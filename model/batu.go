@@ -0,0 +1,7 @@
+package model
+
+// Batu adalah batu permata yang dipasang pada perhiasan
+type Batu struct {
+    Jenis  string `json:"jenis"`
+    Jumlah int    `json:"jumlah"`
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// Buyback adalah transaksi pembelian kembali emas dari pelanggan, baik perhiasan bersertifikat
+// maupun perhiasan yang dibawa langsung ke toko (walk-in). Harga disalin saat penawaran dibuat.
+type Buyback struct {
+    ID                  int        `json:"id"`
+    UserID              int        `json:"user_id,omitempty"` // pelanggan terdaftar, wajib untuk tukar tambah
+    NamaPenjual         string     `json:"nama_penjual"`
+    TeleponPenjual      string     `json:"telepon_penjual"`
+    Serial              string     `json:"serial,omitempty"` // serial sertifikat keaslian jika ada
+    Deskripsi           string     `json:"deskripsi"`
+    JenisEmas           string     `json:"jenis_emas"`
+    Berat               Gram       `json:"berat"`
+    KadarUji            Persen     `json:"kadar_uji"` // hasil uji kemurnian
+    MetodeUji           string     `json:"metode_uji"`
+    HargaPerGram        Rupiah     `json:"harga_per_gram"`
+    NilaiEmas           Rupiah     `json:"nilai_emas"`        // harga per gram x berat
+    PenyesuaianKadar    Rupiah     `json:"penyesuaian_kadar"` // potongan karena kadar uji < 100%
+    Spread              Persen     `json:"spread"`
+    PotonganSpread      Rupiah     `json:"potongan_spread"`
+    Total               Rupiah     `json:"total"`
+    PriceSheetVersion   string     `json:"price_sheet_version"`
+    Status              string     `json:"status"`                      // offered, paid, credited, cancelled
+    MetodePembayaran    string     `json:"metode_pembayaran,omitempty"` // tunai atau transfer
+    ReferensiPembayaran string     `json:"referensi_pembayaran,omitempty"`
+    Catatan             string     `json:"catatan"`
+    Actor               string     `json:"actor"`
+    CreatedAt           time.Time  `json:"created_at"`
+    SettledAt           *time.Time `json:"settled_at,omitempty"`
+}
+
+// TradeInCredit adalah kredit tukar tambah dari buyback yang bisa dipakai untuk pesanan baru
+type TradeInCredit struct {
+    ID        int       `json:"id"`
+    UserID    int       `json:"user_id"`
+    BuybackID int       `json:"buyback_id"`
+    Jumlah    Rupiah    `json:"jumlah"`
+    Terpakai  Rupiah    `json:"terpakai"` // dipesan atau sudah dipakai pesanan
+    Sisa      Rupiah    `json:"sisa"`
+    CreatedAt time.Time `json:"created_at"`
+}
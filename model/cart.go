@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// Jenis item pada keranjang dan pesanan
+const (
+    ItemEmas   = "emas"   // perhiasan jadi dari tabel emas
+    ItemCustom = "custom" // perhiasan custom sesuai OrderRequest
+)
+
+// CartItem adalah satu item di keranjang user. Harga dan ketersediaan
+// selalu dihitung ulang dari harga dan stok terkini saat keranjang dibaca.
+type CartItem struct {
+    ID          int             `json:"id"`
+    ItemType    string          `json:"item_type"`
+    EmasID      int             `json:"emas_id,omitempty"`
+    Emas        *Emas           `json:"emas,omitempty"`
+    Custom      *OrderRequest   `json:"custom,omitempty"`
+    Qty         int             `json:"qty"`
+    HargaSatuan Rupiah          `json:"harga_satuan"`
+    Subtotal    Rupiah          `json:"subtotal"`
+    Rincian     *PriceBreakdown `json:"rincian,omitempty"`
+    Tersedia    bool            `json:"tersedia"`
+    Pesan       string          `json:"pesan,omitempty"`
+    AddedAt     time.Time       `json:"added_at"`
+}
+
+// OrderItem adalah satu baris item pada pesanan
+type OrderItem struct {
+    ID               int             `json:"id"`
+    ItemType         string          `json:"item_type"`
+    EmasID           int             `json:"emas_id,omitempty"`
+    Nama             string          `json:"nama"`
+    JenisPerhiasan   string          `json:"jenis_perhiasan"`
+    JenisEmas        string          `json:"jenis_emas"`
+    BeratEmas        Gram            `json:"berat_emas"`
+    CampuranTambahan string          `json:"campuran_tambahan"`
+    PersentaseEmas   Persen          `json:"persentase_emas"`
+    Batu             []Batu          `json:"batu"`
+    Personalisasi    *Personalisasi  `json:"personalisasi,omitempty"`
+    Qty              int             `json:"qty"`
+    HargaSatuan      Rupiah          `json:"harga_satuan"`
+    Subtotal         Rupiah          `json:"subtotal"`
+    Rincian          *PriceBreakdown `json:"rincian,omitempty"`
+}
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// Certificate adalah sertifikat keaslian untuk satu perhiasan. Spesifikasi disalin saat
+// sertifikat terbit; data pemilik tidak disimpan di sertifikat.
+type Certificate struct {
+    ID               int        `json:"id"`
+    Serial           string     `json:"serial"`
+    KodeVerifikasi   string     `json:"kode_verifikasi"` // HMAC dari serial dan spesifikasi, dicetak di sertifikat
+    OrderID          int        `json:"order_id,omitempty"`
+    OrderItemID      int        `json:"order_item_id,omitempty"`
+    EmasID           int        `json:"emas_id,omitempty"` // sertifikat untuk stok perhiasan jadi
+    Nama             string     `json:"nama"`
+    JenisPerhiasan   string     `json:"jenis_perhiasan"`
+    JenisEmas        string     `json:"jenis_emas"`
+    Karat            int        `json:"karat"`
+    Kadar            Persen     `json:"kadar"`
+    Berat            Gram       `json:"berat"`
+    Batu             []Batu     `json:"batu"`
+    Status           string     `json:"status"` // active, revoked
+    AlasanPencabutan string     `json:"alasan_pencabutan,omitempty"`
+    IssuedAt         time.Time  `json:"issued_at"`
+    RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CertificateVerification adalah hasil verifikasi publik sertifikat. Hanya berisi
+// spesifikasi perhiasan, tanpa data pemilik maupun nomor pesanan.
+type CertificateVerification struct {
+    Serial         string     `json:"serial"`
+    Asli           bool       `json:"asli"`
+    Pesan          string     `json:"pesan"`
+
+    // Detail hanya diisi jika kode verifikasi cocok
+    Status         string     `json:"status,omitempty"`
+    Nama           string     `json:"nama,omitempty"`
+    JenisPerhiasan string     `json:"jenis_perhiasan,omitempty"`
+    JenisEmas      string     `json:"jenis_emas,omitempty"`
+    Karat          int        `json:"karat,omitempty"`
+    Kadar          Persen     `json:"kadar,omitempty"`
+    Berat          Gram       `json:"berat,omitempty"`
+    Batu           []Batu     `json:"batu,omitempty"`
+    IssuedAt       *time.Time `json:"issued_at,omitempty"`
+    RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// OrderAttachment adalah file yang dilampirkan pada pesanan custom
+type OrderAttachment struct {
+    ID          int       `json:"id"`
+    OrderID     int       `json:"order_id"`
+    UploaderID  int       `json:"uploader_id"`
+    Jenis       string    `json:"jenis"` // reference (pelanggan), sketch atau render (staf)
+    NamaFile    string    `json:"nama_file"`
+    ContentType string    `json:"content_type"`
+    Ukuran      int64     `json:"ukuran"`
+    StorageKey  string    `json:"-"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// DesignApproval adalah permintaan persetujuan desain yang dijawab pelanggan
+type DesignApproval struct {
+    ID            int        `json:"id"`
+    OrderID       int        `json:"order_id"`
+    AttachmentIDs []int64    `json:"attachment_ids"`
+    Pesan         string     `json:"pesan"`
+    Status        string     `json:"status"` // pending, approved, rejected, superseded
+    Komentar      string     `json:"komentar"`
+    RequestedBy   string     `json:"requested_by"`
+    RequestedAt   time.Time  `json:"requested_at"`
+    RespondedAt   *time.Time `json:"responded_at,omitempty"`
+}
@@ -2,9 +2,10 @@ package model
 
 // Struktur barang emas
 type Emas struct {
-	ID      uint    `json:"id" gorm:"primaryKey"`
-	Nama    string  `json:"nama"`
-	Karatan int     `json:"karatan"`
-	Berat   float64 `json:"berat"`
-	Harga   float64 `json:"harga"`
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	Nama    string `json:"nama"`
+	Karatan int    `json:"karatan"`
+	Berat   Gram   `json:"berat"`
+	Harga   Rupiah `json:"harga"`
+	Stok    int    `json:"stok"`
 }
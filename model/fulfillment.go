@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// Branch adalah cabang toko tempat pelanggan bisa mengambil pesanan
+type Branch struct {
+    ID      int    `json:"id"`
+    Kode    string `json:"kode"`
+    Nama    string `json:"nama"`
+    Alamat  string `json:"alamat"`
+    Kota    string `json:"kota"`
+    Telepon string `json:"telepon"`
+}
+
+// AlamatPengiriman adalah alamat tujuan kurir
+type AlamatPengiriman struct {
+    NamaPenerima string `json:"nama_penerima"`
+    Telepon      string `json:"telepon"`
+    Alamat       string `json:"alamat"`
+    Kota         string `json:"kota"`
+    KodePos      string `json:"kode_pos"`
+}
+
+// Fulfillment adalah cara pesanan diserahkan ke pelanggan: ambil di cabang atau dikirim kurir berasuransi
+type Fulfillment struct {
+    OrderID       int               `json:"order_id"`
+    Metode        string            `json:"metode"` // pickup atau courier
+    BranchID      int               `json:"branch_id,omitempty"`
+    Branch        *Branch           `json:"branch,omitempty"`
+    KodePickup    string            `json:"kode_pickup,omitempty"` // hanya ditampilkan ke pemilik pesanan
+    Alamat        *AlamatPengiriman `json:"alamat,omitempty"`
+    Kurir         string            `json:"kurir,omitempty"`
+    Layanan       string            `json:"layanan,omitempty"`
+    Estimasi      string            `json:"estimasi,omitempty"`
+    Berat         Gram              `json:"berat"`
+    NilaiAsuransi Rupiah            `json:"nilai_asuransi"`
+    Ongkir        Rupiah            `json:"ongkir"`
+    BiayaAsuransi Rupiah            `json:"biaya_asuransi"`
+    PickedUpAt    *time.Time        `json:"picked_up_at,omitempty"`
+    Shipments     []Shipment        `json:"shipments,omitempty"`
+    UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// Shipment adalah satu pengiriman paket pesanan oleh kurir
+type Shipment struct {
+    ID            int        `json:"id"`
+    OrderID       int        `json:"order_id"`
+    Kurir         string     `json:"kurir"`
+    Layanan       string     `json:"layanan"`
+    NoResi        string     `json:"no_resi"`
+    NilaiAsuransi Rupiah     `json:"nilai_asuransi"`
+    Status        string     `json:"status"` // in_transit, delivered, returned
+    Catatan       string     `json:"catatan"`
+    ShippedAt     time.Time  `json:"shipped_at"`
+    DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+    UpdatedAt     time.Time  `json:"updated_at"`
+}
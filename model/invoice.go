@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Invoice adalah nota pembayaran pesanan dengan nomor berurutan per tahun.
+// Pesanan disimpan sebagai salinan saat nota terbit supaya isi nota tidak berubah.
+type Invoice struct {
+    ID               int       `json:"id"`
+    OrderID          int       `json:"order_id"`
+    Nomor            string    `json:"nomor"` // INV/<tahun>/<urutan>
+    PaymentOrderID   string    `json:"payment_order_id"`
+    MetodePembayaran string    `json:"metode_pembayaran"`
+    NamaPelanggan    string    `json:"nama_pelanggan"`
+    EmailPelanggan   string    `json:"email_pelanggan"`
+    Total            Rupiah    `json:"total"`
+    Pesanan          Order     `json:"pesanan"`
+    IssuedAt         time.Time `json:"issued_at"`
+}
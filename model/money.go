@@ -0,0 +1,238 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Aturan pembulatan yang dipakai di seluruh aplikasi:
+//   - Rupiah disimpan sebagai bilangan bulat rupiah, dibulatkan half-up (menjauhi nol).
+//   - Gram disimpan sebagai miligram (3 desimal), dibulatkan half-up.
+//   - Persen disimpan dalam seperseratus persen (2 desimal), dibulatkan half-up.
+// Semua perkalian dilakukan dengan bilangan bulat/rasional, tidak pernah float64.
+
+// Rupiah adalah nominal uang dalam rupiah utuh.
+// Di JSON ditulis sebagai integer, di database sebagai NUMERIC(15,0).
+type Rupiah int64
+
+// Gram adalah berat emas dengan presisi miligram.
+// Di JSON ditulis sebagai angka 3 desimal, di database sebagai NUMERIC(10,3).
+type Gram int64
+
+// Persen adalah persentase dengan presisi 2 desimal (misalnya kadar atau tarif pajak).
+// Di JSON ditulis sebagai angka 2 desimal, di database sebagai NUMERIC(5,2).
+type Persen int64
+
+const (
+	gramScale   = 3
+	persenScale = 2
+)
+
+// MilligramsPerGram dipakai saat mengalikan harga per gram dengan Gram
+const MilligramsPerGram = 1000
+
+// PersenDenominator adalah nilai Persen untuk 100%
+const PersenDenominator = 100 * 100
+
+// NewRupiah membuat Rupiah dari string desimal, misalnya gross_amount Midtrans "150000.00"
+func NewRupiah(s string) (Rupiah, error) {
+	v, err := parseFixed(s, 0)
+	return Rupiah(v), err
+}
+
+// NewGram membuat Gram dari string desimal, misalnya "5.125"
+func NewGram(s string) (Gram, error) {
+	v, err := parseFixed(s, gramScale)
+	return Gram(v), err
+}
+
+// NewPersen membuat Persen dari string desimal, misalnya "75.5"
+func NewPersen(s string) (Persen, error) {
+	v, err := parseFixed(s, persenScale)
+	return Persen(v), err
+}
+
+// MulRatio mengalikan r dengan num/den dan membulatkan half-up ke rupiah terdekat.
+// ErrOutOfRange jika hasilnya tidak muat di Rupiah.
+func (r Rupiah) MulRatio(num, den int64) (Rupiah, error) {
+	v, err := mulDivRound(int64(r), num, den)
+	return Rupiah(v), err
+}
+
+// MulGram mengalikan harga per gram dengan berat
+func (r Rupiah) MulGram(g Gram) (Rupiah, error) {
+	return r.MulRatio(int64(g), MilligramsPerGram)
+}
+
+// MulPersen mengambil p persen dari r
+func (r Rupiah) MulPersen(p Persen) (Rupiah, error) {
+	return r.MulRatio(int64(p), PersenDenominator)
+}
+
+// MulInt mengalikan r dengan bilangan bulat n, misalnya harga satuan dengan jumlah barang
+func (r Rupiah) MulInt(n int64) (Rupiah, error) {
+	return r.MulRatio(n, 1)
+}
+
+// Int64 mengembalikan nominal sebagai int64, misalnya untuk gross amount Midtrans
+func (r Rupiah) Int64() int64 { return int64(r) }
+
+func (r Rupiah) String() string { return strconv.FormatInt(int64(r), 10) }
+
+func (g Gram) String() string { return formatFixed(int64(g), gramScale) }
+
+func (p Persen) String() string { return formatFixed(int64(p), persenScale) }
+
+// Float64 hanya untuk tampilan (misalnya PDF), jangan dipakai untuk perhitungan
+func (g Gram) Float64() float64 { return float64(g) / MilligramsPerGram }
+
+// Float64 hanya untuk tampilan, jangan dipakai untuk perhitungan
+func (p Persen) Float64() float64 { return float64(p) / 100 }
+
+func (r Rupiah) MarshalJSON() ([]byte, error) { return []byte(r.String()), nil }
+
+func (r *Rupiah) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalFixed(data, 0)
+	if err != nil {
+		return fmt.Errorf("rupiah: %w", err)
+	}
+	*r = Rupiah(v)
+	return nil
+}
+
+func (g Gram) MarshalJSON() ([]byte, error) { return []byte(g.String()), nil }
+
+func (g *Gram) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalFixed(data, gramScale)
+	if err != nil {
+		return fmt.Errorf("gram: %w", err)
+	}
+	*g = Gram(v)
+	return nil
+}
+
+func (p Persen) MarshalJSON() ([]byte, error) { return []byte(p.String()), nil }
+
+func (p *Persen) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalFixed(data, persenScale)
+	if err != nil {
+		return fmt.Errorf("persen: %w", err)
+	}
+	*p = Persen(v)
+	return nil
+}
+
+func (r Rupiah) Value() (driver.Value, error) { return int64(r), nil }
+
+func (r *Rupiah) Scan(src interface{}) error {
+	v, err := scanFixed(src, 0)
+	*r = Rupiah(v)
+	return err
+}
+
+func (g Gram) Value() (driver.Value, error) { return g.String(), nil }
+
+func (g *Gram) Scan(src interface{}) error {
+	v, err := scanFixed(src, gramScale)
+	*g = Gram(v)
+	return err
+}
+
+func (p Persen) Value() (driver.Value, error) { return p.String(), nil }
+
+func (p *Persen) Scan(src interface{}) error {
+	v, err := scanFixed(src, persenScale)
+	*p = Persen(v)
+	return err
+}
+
+// ErrOutOfRange dikembalikan jika hasil perhitungan atau parsing tidak muat di int64
+var ErrOutOfRange = errors.New("value out of range")
+
+// mulDivRound menghitung a*b/c dengan pembulatan half-up tanpa overflow di tengah perhitungan.
+// Hasil yang tidak muat di int64 dikembalikan sebagai ErrOutOfRange, tidak diam-diam berputar.
+func mulDivRound(a, b, c int64) (int64, error) {
+	num := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	return roundRat(new(big.Rat).SetFrac(num, big.NewInt(c)))
+}
+
+// roundRat membulatkan bilangan rasional half-up (menjauhi nol).
+// Error jika hasilnya tidak muat di int64.
+func roundRat(x *big.Rat) (int64, error) {
+	num := new(big.Int).Abs(x.Num())
+	den := x.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if x.Sign() < 0 {
+		q.Neg(q)
+	}
+	if !q.IsInt64() {
+		return 0, ErrOutOfRange
+	}
+	return q.Int64(), nil
+}
+
+// parseFixed mengubah string desimal menjadi bilangan bulat dengan skala tertentu
+func parseFixed(s string, scale int) (int64, error) {
+	x, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return 0, fmt.Errorf("invalid decimal %q", s)
+	}
+	x.Mul(x, new(big.Rat).SetInt64(int64(math.Pow10(scale))))
+	v, err := roundRat(x)
+	if err != nil {
+		return 0, fmt.Errorf("invalid decimal %q: %w", s, err)
+	}
+	return v, nil
+}
+
+func formatFixed(v int64, scale int) string {
+	if scale == 0 {
+		return strconv.FormatInt(v, 10)
+	}
+	return new(big.Rat).SetFrac64(v, int64(math.Pow10(scale))).FloatString(scale)
+}
+
+// unmarshalFixed menerima angka JSON maupun string berisi angka
+func unmarshalFixed(data []byte, scale int) (int64, error) {
+	text := string(data)
+	if text == "null" {
+		return 0, nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return 0, err
+		}
+		if s == "" {
+			return 0, nil
+		}
+		text = s
+	}
+	return parseFixed(text, scale)
+}
+
+func scanFixed(src interface{}, scale int) (int64, error) {
+	switch v := src.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return mulDivRound(v, int64(math.Pow10(scale)), 1)
+	case float64:
+		return parseFixed(strconv.FormatFloat(v, 'f', -1, 64), scale)
+	case []byte:
+		return parseFixed(string(v), scale)
+	case string:
+		return parseFixed(v, scale)
+	default:
+		return 0, fmt.Errorf("cannot scan %T into fixed-point value", src)
+	}
+}
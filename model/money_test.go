@@ -0,0 +1,41 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseFixedRejectsOutOfRange(t *testing.T) {
+	for _, s := range []string{"18446744073709551.617", "-9223372036854775.809", "1e30"} {
+		if v, err := NewGram(s); err == nil {
+			t.Fatalf("NewGram(%q) = %d, ingin error", s, v)
+		}
+	}
+	var r Rupiah
+	if err := json.Unmarshal([]byte(`"99999999999999999999"`), &r); err == nil {
+		t.Fatalf("Rupiah di luar batas diterima: %d", r)
+	}
+
+	g, err := NewGram("9223372036854775.807")
+	if err != nil || int64(g) != 9223372036854775807 {
+		t.Fatalf("NewGram batas atas = %d, %v", g, err)
+	}
+}
+
+func TestMulRejectsOverflow(t *testing.T) {
+	harga := Rupiah(3121420)
+	if v, err := harga.MulGram(Gram(9000000000000 * MilligramsPerGram)); err != ErrOutOfRange {
+		t.Fatalf("MulGram overflow = %d, %v; ingin ErrOutOfRange", v, err)
+	}
+	if v, err := harga.MulInt(1 << 62); err != ErrOutOfRange {
+		t.Fatalf("MulInt overflow = %d, %v; ingin ErrOutOfRange", v, err)
+	}
+	if v, err := harga.MulGram(Gram(2500)); err != nil || v != 7803550 {
+		t.Fatalf("MulGram 2,5 gram = %d, %v", v, err)
+	}
+
+	var g Gram
+	if err := g.Scan(int64(1) << 60); err == nil {
+		t.Fatalf("Scan int64 di luar batas diterima: %d", g)
+	}
+}
@@ -1,13 +1,26 @@
 package model
 
+import "time"
+
 // Order merepresentasikan data pesanan
 type Order struct {
-    ID               int     `json:"id"`
-    JenisPerhiasan   string  `json:"jenis_perhiasan"`
-    JenisEmas        string  `json:"jenis_emas"`
-    BeratEmas        float64 `json:"berat_emas"`
-    CampuranTambahan string  `json:"campuran_tambahan"`
-    PersentaseEmas   float64 `json:"persentase_emas"`
-    TotalHarga       float64 `json:"total_harga"`
-    Status           string  `json:"status"`
+    ID                int             `json:"id"`
+    Tipe              string          `json:"tipe"` // custom atau cart
+    UserID            int             `json:"user_id"`
+    JenisPerhiasan    string          `json:"jenis_perhiasan"`
+    JenisEmas         string          `json:"jenis_emas"`
+    BeratEmas         Gram            `json:"berat_emas"`
+    CampuranTambahan  string          `json:"campuran_tambahan"`
+    PersentaseEmas    Persen          `json:"persentase_emas"`
+    TotalHarga        Rupiah          `json:"total_harga"`
+    Status            string          `json:"status"`
+    PriceSheetVersion string          `json:"price_sheet_version"`
+    Batu              []Batu          `json:"batu"`
+    Personalisasi     *Personalisasi  `json:"personalisasi,omitempty"`
+    Rincian           *PriceBreakdown `json:"rincian,omitempty"`
+    MidtransOrderID   string          `json:"midtrans_order_id,omitempty"`
+    CreatedAt         time.Time       `json:"created_at"`
+    Items             []OrderItem     `json:"items,omitempty"`
+    Payments          []Payment       `json:"payments,omitempty"`
+    Pengiriman        *Fulfillment    `json:"pengiriman,omitempty"`
 }
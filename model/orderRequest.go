@@ -2,10 +2,14 @@ package model
 
 // OrderRequest digunakan untuk menerima input data dari klien.
 type OrderRequest struct {
-    JenisPerhiasan   string  `json:"jenis_perhiasan"`
-    JenisEmas        string  `json:"jenis_emas"`
-    BeratEmas        float64 `json:"berat_emas"`
-    CampuranTambahan string  `json:"campuran_tambahan"`
-    PersentaseEmas   float64 `json:"persentase_emas"`
-    TotalHarga       float64 `json:"total_harga"`
+    JenisPerhiasan   string         `json:"jenis_perhiasan"`
+    JenisEmas        string         `json:"jenis_emas"`
+    BeratEmas        Gram           `json:"berat_emas"`
+    CampuranTambahan string         `json:"campuran_tambahan"`
+    PersentaseEmas   Persen         `json:"persentase_emas"`
+    TotalHarga       Rupiah         `json:"total_harga"`
+    Batu             []Batu         `json:"batu"`
+    Personalisasi    *Personalisasi `json:"personalisasi,omitempty"`
+    KodeVoucher      string         `json:"kode_voucher"`
+    QuoteID          string         `json:"quote_id"` // opsional, mengunci harga dari POST /api/quotes
 }
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// OrderAdjustment mencatat perubahan pesanan (pembatalan atau amandemen admin)
+// beserta tindak lanjut keuangannya
+type OrderAdjustment struct {
+    ID             int       `json:"id"`
+    OrderID        int       `json:"order_id"`
+    Jenis          string    `json:"jenis"` // cancellation atau amendment
+    Sebelum        Order     `json:"sebelum"`
+    Sesudah        Order     `json:"sesudah"`
+    TotalLama      Rupiah    `json:"total_lama"`
+    TotalBaru      Rupiah    `json:"total_baru"`
+    Selisih        Rupiah    `json:"selisih"`  // positif: pelanggan kurang bayar, negatif: kelebihan bayar
+    Tindakan       string    `json:"tindakan"` // none, payment_request atau refund_due
+    PaymentOrderID string    `json:"payment_order_id,omitempty"`
+    Alasan         string    `json:"alasan"`
+    Actor          string    `json:"actor"`
+    CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// OrderEvent adalah satu kejadian pada timeline pesanan
+type OrderEvent struct {
+    ID         int       `json:"id"`
+    OrderID    int       `json:"order_id"`
+    Tipe       string    `json:"tipe"` // status_change, payment, note, photo
+    Status     string    `json:"status,omitempty"`
+    Keterangan string    `json:"keterangan"`
+    FotoURL    string    `json:"foto_url,omitempty"`
+    Actor      string    `json:"actor"`
+    Internal   bool      `json:"internal"` // hanya terlihat oleh admin
+    CreatedAt  time.Time `json:"created_at"`
+}
@@ -1,9 +1,34 @@
 package model
 
+import "time"
+
 type Payment struct {
-    ID             uint   `gorm:"primaryKey"`
-    OrderID        string `gorm:"unique"`
-    TransactionID  string
-    Status         string
+    ID            uint      `json:"id" gorm:"primaryKey"`
+    OrderID       string    `json:"order_id" gorm:"unique"` // order ID Midtrans
+    CustomOrderID int       `json:"custom_order_id"`
+    TransactionID string    `json:"transaction_id"`
+    GrossAmount   Rupiah    `json:"gross_amount"`
+    Status        string    `json:"status"`
+    RedirectURL   string    `json:"redirect_url"`
+    CreatedAt     time.Time `json:"created_at"`
     // Tambahkan field lain yang diperlukan
 }
+
+// PaymentLedgerEntry adalah satu baris buku pembayaran admin: pembayaran beserta pesanan dan pelanggannya
+type PaymentLedgerEntry struct {
+    ID            int        `json:"id"`
+    OrderID       string     `json:"order_id"` // order ID Midtrans
+    Kind          string     `json:"kind"`
+    CustomOrderID *int       `json:"custom_order_id"`
+    OrderStatus   string     `json:"order_status"`
+    UserID        *int       `json:"user_id"`
+    CustomerName  string     `json:"customer_name"`
+    CustomerEmail string     `json:"customer_email"`
+    PaymentType   string     `json:"payment_type"`
+    TransactionID string     `json:"transaction_id"`
+    GrossAmount   Rupiah     `json:"gross_amount"`
+    Refunded      Rupiah     `json:"refunded"`
+    Status        string     `json:"status"`
+    CreatedAt     time.Time  `json:"created_at"`
+    UpdatedAt     *time.Time `json:"updated_at"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// PaymentSchedule adalah jadwal pembayaran bertahap satu pesanan: uang muka (DP) lalu beberapa cicilan.
+// Pesanan baru berstatus paid setelah semua tagihan pada jadwal lunas.
+type PaymentSchedule struct {
+    ID            int           `json:"id"`
+    OrderID       int           `json:"custom_order_id"`
+    DPPersen      Persen        `json:"dp_persen"`
+    JumlahCicilan int           `json:"jumlah_cicilan"` // cicilan setelah DP
+    IntervalHari  int           `json:"interval_hari"`
+    Total         Rupiah        `json:"total"`
+    Terbayar      Rupiah        `json:"terbayar"`
+    Sisa          Rupiah        `json:"sisa"`
+    Status        string        `json:"status"` // active, settled, cancelled
+    Actor         string        `json:"actor"`
+    CreatedAt     time.Time     `json:"created_at"`
+    Tagihan       []Installment `json:"tagihan"`
+}
+
+// Installment adalah satu tagihan pada jadwal pembayaran. Setiap percobaan bayar mendapat
+// order ID Midtrans sendiri; PaymentOrderID adalah percobaan terakhir.
+type Installment struct {
+    ID             int        `json:"id"`
+    ScheduleID     int        `json:"schedule_id"`
+    Urutan         int        `json:"urutan"` // 0 untuk DP
+    Jenis          string     `json:"jenis"`  // dp atau cicilan
+    Jumlah         Rupiah     `json:"jumlah"`
+    JatuhTempo     time.Time  `json:"jatuh_tempo"`
+    Status         string     `json:"status"` // unpaid atau paid
+    PaymentOrderID string     `json:"payment_order_id,omitempty"`
+    PaidAt         *time.Time `json:"paid_at,omitempty"`
+    RemindedAt     *time.Time `json:"reminded_at,omitempty"`
+}
@@ -0,0 +1,21 @@
+package model
+
+// Personalisasi adalah opsi ukiran, ukuran cincin dan finishing pada perhiasan custom
+type Personalisasi struct {
+    Ukiran       *Ukiran       `json:"ukiran,omitempty"`
+    UkuranCincin *UkuranCincin `json:"ukuran_cincin,omitempty"`
+    Finishing    string        `json:"finishing,omitempty"` // Polish, Doff, Hammered, Brushed, Sandblast
+}
+
+// Ukiran adalah teks yang diukir beserta jenis hurufnya
+type Ukiran struct {
+    Teks  string `json:"teks"`
+    Font  string `json:"font"`            // Script, Serif, Sans, Block
+    Letak string `json:"letak,omitempty"` // dalam atau luar, default dalam
+}
+
+// UkuranCincin adalah ukuran cincin menurut standar tertentu
+type UkuranCincin struct {
+    Standar string `json:"standar"` // ID, US, EU atau UK
+    Ukuran  string `json:"ukuran"`  // misalnya "16", "7.5", "54" atau "N"
+}
@@ -0,0 +1,29 @@
+package model
+
+// PriceLine adalah satu baris pada rincian harga (nota)
+type PriceLine struct {
+    Kode       string `json:"kode"`
+    Keterangan string `json:"keterangan"`
+    Jumlah     Rupiah `json:"jumlah"`
+    VoucherID  int    `json:"voucher_id,omitempty"` // hanya untuk baris diskon
+}
+
+// PriceBreakdown adalah rincian harga satu perhiasan
+type PriceBreakdown struct {
+    HargaPerGram       Rupiah      `json:"harga_per_gram,omitempty"`
+    NilaiEmas          Rupiah      `json:"nilai_emas"`        // harga per gram x berat
+    PenyesuaianKadar   Rupiah      `json:"penyesuaian_kadar"` // potongan karena persentase emas < 100%
+    BiayaCampuran      Rupiah      `json:"biaya_campuran"`
+    OngkosPembuatan    Rupiah      `json:"ongkos_pembuatan"`
+    BiayaBatu          Rupiah      `json:"biaya_batu"`
+    BiayaPersonalisasi Rupiah      `json:"biaya_personalisasi"` // ukiran dan finishing
+    Diskon             Rupiah      `json:"diskon"`
+    Subtotal           Rupiah      `json:"subtotal"`
+    TarifPajak         Persen      `json:"tarif_pajak"` // persen
+    Pajak              Rupiah      `json:"pajak"`
+    Ongkir             Rupiah      `json:"ongkir"`        // ongkos kirim dan asuransi, tidak dikenai pajak
+    TukarTambah        Rupiah      `json:"tukar_tambah"`  // kredit buyback yang dipakai, mengurangi total setelah pajak
+    TabunganEmas       Rupiah      `json:"tabungan_emas"` // nilai gram tabungan emas yang ditarik untuk pesanan
+    Total              Rupiah      `json:"total"`
+    Items              []PriceLine `json:"items"`
+}
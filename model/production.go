@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// WorkOrder adalah pekerjaan bengkel untuk satu perhiasan custom yang sudah dibayar
+type WorkOrder struct {
+    ID              int              `json:"id"`
+    OrderID         int              `json:"order_id"`
+    OrderItemID     int              `json:"order_item_id,omitempty"` // diisi untuk item custom dari pesanan keranjang
+    Deskripsi       string           `json:"deskripsi"`
+    BeratTarget     Gram             `json:"berat_target"`
+    Status          string           `json:"status"` // open, done, cancelled
+    TahapSaatIni    string           `json:"tahap_saat_ini"`
+    EstimasiSelesai *time.Time       `json:"estimasi_selesai,omitempty"`
+    Terlambat       bool             `json:"terlambat"`
+    Susut           Gram             `json:"susut"` // total selisih berat masuk dan keluar semua tahap
+    Personalisasi   *Personalisasi   `json:"personalisasi,omitempty"`
+    Stages          []WorkOrderStage `json:"stages,omitempty"`
+    CreatedAt       time.Time        `json:"created_at"`
+    CompletedAt     *time.Time       `json:"completed_at,omitempty"`
+}
+
+// WorkOrderStage adalah satu tahap produksi beserta pengrajin dan berat emas masuk/keluar
+type WorkOrderStage struct {
+    ID              int        `json:"id"`
+    Tahap           string     `json:"tahap"`
+    Urutan          int        `json:"urutan"`
+    Status          string     `json:"status"` // pending, in_progress, done, skipped
+    Pengrajin       string     `json:"pengrajin"`
+    EstimasiSelesai *time.Time `json:"estimasi_selesai,omitempty"`
+    BeratMasuk      *Gram      `json:"berat_masuk,omitempty"`
+    BeratKeluar     *Gram      `json:"berat_keluar,omitempty"`
+    Susut           *Gram      `json:"susut,omitempty"`
+    Catatan         string     `json:"catatan"`
+    StartedAt       *time.Time `json:"started_at,omitempty"`
+    CompletedAt     *time.Time `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Quote adalah penawaran harga yang dikunci untuk waktu tertentu
+type Quote struct {
+    ID                string         `json:"id"`
+    UserID            int            `json:"user_id"`
+    JenisPerhiasan    string         `json:"jenis_perhiasan"`
+    JenisEmas         string         `json:"jenis_emas"`
+    BeratEmas         Gram           `json:"berat_emas"`
+    CampuranTambahan  string         `json:"campuran_tambahan"`
+    PersentaseEmas    Persen         `json:"persentase_emas"`
+    Batu              []Batu         `json:"batu"`
+    Personalisasi     *Personalisasi `json:"personalisasi,omitempty"`
+    KodeVoucher       string         `json:"kode_voucher"`
+    Rincian           PriceBreakdown `json:"rincian"`
+    TotalHarga        Rupiah         `json:"total_harga"`
+    PriceSheetVersion string         `json:"price_sheet_version"`
+    ExpiresAt         time.Time      `json:"expires_at"`
+    Signature         string         `json:"signature"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// ReconciliationReport adalah laporan rekonsiliasi harian antara payments, custom_orders dan
+// status transaksi di payment gateway
+type ReconciliationReport struct {
+    ID        int                      `json:"id"`
+    Tanggal   time.Time                `json:"tanggal"`
+    Diperiksa int                      `json:"diperiksa"` // pembayaran yang dicocokkan ke gateway
+    CreatedAt time.Time                `json:"created_at"`
+    Selisih   []ReconciliationMismatch `json:"selisih"`
+}
+
+// ReconciliationMismatch adalah satu ketidaksesuaian pada laporan rekonsiliasi
+type ReconciliationMismatch struct {
+    Jenis            string `json:"jenis"`
+    PaymentOrderID   string `json:"payment_order_id,omitempty"`
+    CustomOrderID    *int   `json:"custom_order_id,omitempty"`
+    StatusPembayaran string `json:"status_pembayaran,omitempty"`
+    StatusPesanan    string `json:"status_pesanan,omitempty"`
+    StatusGateway    string `json:"status_gateway,omitempty"`
+    Keterangan       string `json:"keterangan"`
+}
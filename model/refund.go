@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Refund adalah pengembalian dana atas satu pembayaran. Satu permintaan refund admin bisa terbagi
+// ke beberapa pembayaran pesanan (pembayaran utama, kekurangan bayar, DP dan cicilan).
+type Refund struct {
+    ID             int        `json:"id"`
+    OrderID        int        `json:"custom_order_id"`
+    PaymentID      int        `json:"payment_id"`
+    PaymentOrderID string     `json:"payment_order_id"`
+    Jumlah         Rupiah     `json:"jumlah"`
+    Alasan         string     `json:"alasan"`
+    RefundKey      string     `json:"refund_key"`
+    Status         string     `json:"status"` // pending, succeeded atau failed
+    Keterangan     string     `json:"keterangan,omitempty"`
+    Actor          string     `json:"actor"`
+    CreatedAt      time.Time  `json:"created_at"`
+    CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
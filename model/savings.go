@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// SavingsAccount adalah rekening tabungan emas milik pelanggan untuk satu jenis emas.
+// Saldo dihitung dari jumlah seluruh mutasi pada buku besar.
+type SavingsAccount struct {
+    ID        int       `json:"id"`
+    UserID    int       `json:"user_id"`
+    JenisEmas string    `json:"jenis_emas"`
+    Saldo     Gram      `json:"saldo"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// SavingsDeposit adalah setoran rupiah lewat Midtrans. Harga dikunci saat setoran dibuat
+// dan gram baru masuk ke buku besar setelah pembayaran lunas.
+type SavingsDeposit struct {
+    ID                int        `json:"id"`
+    AccountID         int        `json:"account_id"`
+    PaymentOrderID    string     `json:"payment_order_id"`
+    Jumlah            Rupiah     `json:"jumlah"`
+    HargaPerGram      Rupiah     `json:"harga_per_gram"`
+    Gram              Gram       `json:"gram"`
+    PriceSheetVersion string     `json:"price_sheet_version"`
+    Status            string     `json:"status"` // pending, settled, failed
+    CreatedAt         time.Time  `json:"created_at"`
+    SettledAt         *time.Time `json:"settled_at,omitempty"`
+}
+
+// SavingsEntry adalah satu mutasi pada buku besar tabungan emas. Gram positif untuk setoran
+// dan pengembalian, negatif untuk penarikan; setiap konversi mencatat harga dan versi daftar harga.
+type SavingsEntry struct {
+    ID                  int       `json:"id"`
+    AccountID           int       `json:"account_id"`
+    Tipe                string    `json:"tipe"` // deposit, order, order_reversal, sellback
+    Gram                Gram      `json:"gram"`
+    HargaPerGram        Rupiah    `json:"harga_per_gram"`
+    Nilai               Rupiah    `json:"nilai"`
+    PriceSheetVersion   string    `json:"price_sheet_version"`
+    DepositID           int       `json:"deposit_id,omitempty"`
+    CustomOrderID       int       `json:"custom_order_id,omitempty"`
+    MetodePembayaran    string    `json:"metode_pembayaran,omitempty"` // jual kembali: tunai atau transfer
+    ReferensiPembayaran string    `json:"referensi_pembayaran,omitempty"`
+    Keterangan          string    `json:"keterangan"`
+    Actor               string    `json:"actor"`
+    Saldo               Gram      `json:"saldo"` // saldo setelah mutasi ini
+    CreatedAt           time.Time `json:"created_at"`
+}
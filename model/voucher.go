@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Tipe potongan voucher
+const (
+    VoucherPersen  = "persen"
+    VoucherNominal = "nominal"
+)
+
+// Voucher adalah potongan harga dengan kode, atau promosi otomatis jika Otomatis bernilai true
+type Voucher struct {
+    ID             int       `json:"id"`
+    Kode           string    `json:"kode"`
+    Nama           string    `json:"nama"`
+    Tipe           string    `json:"tipe"` // persen atau nominal
+    Persen         Persen    `json:"persen"`
+    Nominal        Rupiah    `json:"nominal"`
+    MaksDiskon     Rupiah    `json:"maks_diskon"` // 0 berarti tanpa batas
+    MinPembelian   Rupiah    `json:"min_pembelian"`
+    BatasPerUser   int       `json:"batas_per_user"` // 0 berarti tanpa batas
+    BatasTotal     int       `json:"batas_total"`    // 0 berarti tanpa batas
+    BerlakuMulai   time.Time `json:"berlaku_mulai"`
+    BerlakuSampai  time.Time `json:"berlaku_sampai"`
+    JenisPerhiasan []string  `json:"jenis_perhiasan"` // kosong berarti semua jenis
+    JenisEmas      []string  `json:"jenis_emas"`      // kosong berarti semua karat
+    Otomatis       bool      `json:"otomatis"`
+    Aktif          bool      `json:"aktif"`
+}
@@ -19,20 +19,101 @@ func InitRoutes() *mux.Router {
 	router.HandleFunc("/api/login", controller.Login).Methods("POST")
 	router.HandleFunc("/verify-email", controller.VerifyEmail).Methods("GET")
 
-	router.HandleFunc("/users", controller.GetUsers).Methods("GET")         // GET semua user
-	router.HandleFunc("/users/{id}", controller.GetUserByID).Methods("GET") // GET user by ID
-	router.HandleFunc("/users", controller.CreateUser).Methods("POST")      // POST user baru
-	router.HandleFunc("/users/{id}", controller.UpdateUser).Methods("PUT")  // PUT update user
+	router.HandleFunc("/users", controller.GetUsers).Methods("GET")           // GET semua user
+	router.HandleFunc("/users/{id}", controller.GetUserByID).Methods("GET")   // GET user by ID
+	router.HandleFunc("/users", controller.CreateUser).Methods("POST")        // POST user baru
+	router.HandleFunc("/users/{id}", controller.UpdateUser).Methods("PUT")    // PUT update user
 	router.HandleFunc("/users/{id}", controller.DeleteUser).Methods("DELETE") // DELETE user
 
-	router.HandleFunc("/orders", controller.HandleAddOrder).Methods("POST")         // Menambahkan order
-	router.HandleFunc("/orders", controller.HandleGetOrders).Methods("GET")         // Mendapatkan semua pesanan
-	router.HandleFunc("/orders/{id}", controller.HandleGetOrdersByUserId).Methods("GET") // Mendapatkan pesanan berdasarkan ID
-	
+	router.HandleFunc("/api/orders", controller.HandleAddOrder).Methods("POST")                           // Menambahkan order
+	router.HandleFunc("/api/orders", controller.HandleGetMyOrders).Methods("GET")                         // Pesanan milik user (paginasi)
+	router.HandleFunc("/api/orders/{id}", controller.HandleGetOrderByID).Methods("GET")                   // Detail pesanan milik user
+	router.HandleFunc("/api/admin/orders", controller.HandleAdminGetOrders).Methods("GET")                // Semua pesanan dengan filter (admin)
+	router.HandleFunc("/orders", controller.HandleAddOrder).Methods("POST")                               // Alias lama, gunakan /api/orders
+	router.HandleFunc("/api/admin/orders/{id}/status", controller.HandleUpdateOrderStatus).Methods("PUT") // Ubah status pesanan (admin)
+	router.HandleFunc("/api/admin/orders/{id}/events", controller.HandleAddOrderEvent).Methods("POST")    // Catatan/foto produksi (admin)
+	router.HandleFunc("/api/orders/{id}/timeline", controller.HandleGetOrderTimeline).Methods("GET")      // Timeline pesanan
+	router.HandleFunc("/api/orders/{id}/cancel", controller.HandleCancelOrder).Methods("POST")            // Pembatalan oleh pelanggan
+	router.HandleFunc("/api/admin/orders/{id}", controller.HandleAmendOrder).Methods("PUT")               // Ubah berat/karat/campuran (admin)
+
+	router.HandleFunc("/api/orders/{id}/attachments", controller.HandleUploadAttachment).Methods("POST")                                // Upload referensi/sketsa
+	router.HandleFunc("/api/orders/{id}/attachments", controller.HandleGetAttachments).Methods("GET")                                   // Daftar lampiran
+	router.HandleFunc("/api/orders/{id}/attachments/{attachmentId}", controller.HandleDownloadAttachment).Methods("GET")                // Unduh lampiran
+	router.HandleFunc("/api/orders/{id}/design-approvals", controller.HandleGetDesignApprovals).Methods("GET")                          // Riwayat persetujuan desain
+	router.HandleFunc("/api/orders/{id}/design-approvals/{approvalId}/respond", controller.HandleRespondDesignApproval).Methods("POST") // Setujui/minta revisi desain
+	router.HandleFunc("/api/admin/orders/{id}/design-approvals", controller.HandleRequestDesignApproval).Methods("POST")                // Kirim desain ke pelanggan (admin)
+	router.HandleFunc("/api/admin/orders/{id}/work-orders", controller.HandleGetOrderWorkOrders).Methods("GET")                         // Work order pesanan (admin)
+	router.HandleFunc("/api/admin/workshop", controller.HandleWorkshopDashboard).Methods("GET")                                         // Dashboard bengkel per tahap
+	router.HandleFunc("/api/admin/work-orders/{id}", controller.HandleGetWorkOrder).Methods("GET")                                      // Detail work order
+	router.HandleFunc("/api/admin/work-orders/{id}", controller.HandleUpdateWorkOrder).Methods("PUT")                                   // Ubah estimasi selesai
+	router.HandleFunc("/api/admin/work-orders/{id}/stages/{tahap}", controller.HandleUpdateWorkOrderStage).Methods("PUT")               // Update tahap produksi
+
+	router.HandleFunc("/api/orders/{id}/invoice", controller.HandleDownloadInvoice).Methods("GET")                        // Nota PDF pesanan
+	router.HandleFunc("/api/admin/orders/{id}/invoice", controller.HandleIssueInvoice).Methods("POST")                    // Terbitkan/kirim ulang nota (admin)
+	router.HandleFunc("/api/orders/{id}/certificates", controller.HandleGetOrderCertificates).Methods("GET")              // Sertifikat keaslian pesanan
+	router.HandleFunc("/api/orders/{id}/certificates/{serial}", controller.HandleDownloadOrderCertificate).Methods("GET") // PDF sertifikat
+	router.HandleFunc("/api/admin/orders/{id}/certificates", controller.HandleIssueOrderCertificates).Methods("POST")     // Terbitkan sertifikat pesanan (admin)
+	router.HandleFunc("/api/admin/emas/{id}/certificates", controller.HandleIssueInventoryCertificates).Methods("POST")   // Sertifikat stok perhiasan jadi (admin)
+	router.HandleFunc("/api/admin/certificates/{serial}", controller.HandleAdminDownloadCertificate).Methods("GET")       // PDF sertifikat mana pun (admin)
+	router.HandleFunc("/api/admin/certificates/{serial}/revoke", controller.HandleRevokeCertificate).Methods("POST")      // Cabut sertifikat (admin)
+	router.HandleFunc("/verify/{serial}", controller.HandleVerifyCertificate).Methods("GET")                              // Verifikasi publik dari QR code
+	router.HandleFunc("/api/branches", controller.HandleGetBranches).Methods("GET")                                       // Cabang untuk ambil pesanan
+	router.HandleFunc("/api/orders/{id}/shipping-rates", controller.HandleGetShippingRates).Methods("GET")                // Tarif kurir untuk pesanan
+	router.HandleFunc("/api/orders/{id}/fulfillment", controller.HandleGetFulfillment).Methods("GET")                     // Pengambilan/pengiriman pesanan
+	router.HandleFunc("/api/orders/{id}/fulfillment", controller.HandleSetFulfillment).Methods("PUT")                     // Pilih ambil di cabang atau kurir
+	router.HandleFunc("/api/admin/orders/{id}/shipments", controller.HandleCreateShipment).Methods("POST")                // Serahkan paket ke kurir (admin)
+	router.HandleFunc("/api/admin/shipments/{id}", controller.HandleUpdateShipment).Methods("PUT")                        // Paket diterima/dikembalikan (admin)
+	router.HandleFunc("/api/admin/orders/{id}/pickup", controller.HandleConfirmPickup).Methods("POST")                    // Konfirmasi kode pengambilan (admin)
+
+	router.HandleFunc("/api/admin/buybacks", controller.HandleCreateBuyback).Methods("POST")               // Penawaran buyback emas (admin)
+	router.HandleFunc("/api/admin/buybacks", controller.HandleGetBuybacks).Methods("GET")                  // Daftar buyback (admin)
+	router.HandleFunc("/api/admin/buybacks/{id}", controller.HandleGetBuyback).Methods("GET")              // Detail buyback (admin)
+	router.HandleFunc("/api/admin/buybacks/{id}/payout", controller.HandlePayBuyback).Methods("POST")      // Bayar tunai/transfer ke penjual (admin)
+	router.HandleFunc("/api/admin/buybacks/{id}/trade-in", controller.HandleCreditBuyback).Methods("POST") // Jadikan kredit tukar tambah (admin)
+	router.HandleFunc("/api/admin/buybacks/{id}/cancel", controller.HandleCancelBuyback).Methods("POST")   // Batalkan penawaran (admin)
+	router.HandleFunc("/api/trade-in-credits", controller.HandleGetTradeInCredits).Methods("GET")          // Kredit tukar tambah milik user
+	router.HandleFunc("/api/orders/{id}/trade-in", controller.HandleSetOrderTradeIn).Methods("PUT")        // Pakai kredit tukar tambah untuk pesanan
+
+	router.HandleFunc("/api/savings", controller.HandleOpenSavingsAccount).Methods("POST")                  // Buka rekening tabungan emas
+	router.HandleFunc("/api/savings", controller.HandleGetSavingsAccounts).Methods("GET")                   // Rekening tabungan emas milik user
+	router.HandleFunc("/api/savings/{id}/statement", controller.HandleGetSavingsStatement).Methods("GET")   // Mutasi tabungan emas
+	router.HandleFunc("/api/savings/{id}/deposits", controller.HandleCreateSavingsDeposit).Methods("POST")  // Setoran lewat Midtrans
+	router.HandleFunc("/api/admin/savings/{id}/sellback", controller.HandleSellBackSavings).Methods("POST") // Jual kembali tabungan emas (admin)
+	router.HandleFunc("/api/orders/{id}/savings", controller.HandleSetOrderSavings).Methods("PUT")          // Tarik tabungan emas sebagai perhiasan
+
+	router.HandleFunc("/api/orders/{id}/payment-schedule", controller.HandleCreatePaymentSchedule).Methods("POST")             // Jadwal DP dan cicilan
+	router.HandleFunc("/api/orders/{id}/payment-schedule", controller.HandleGetPaymentSchedule).Methods("GET")                 // Status jadwal dan tagihan
+	router.HandleFunc("/api/orders/{id}/payment-schedule", controller.HandleDeletePaymentSchedule).Methods("DELETE")           // Batalkan jadwal yang belum dibayar
+	router.HandleFunc("/api/orders/{id}/payment-schedule/{urutan}/pay", controller.HandlePayInstallment).Methods("POST")       // Bayar DP/cicilan lewat Midtrans
+	router.HandleFunc("/api/cron/installment-reminders", controller.HandleInstallmentReminders).Methods("GET")                 // Email pengingat jatuh tempo (cron)
+	router.HandleFunc("/api/orders/{id}/refunds", controller.HandleGetRefunds).Methods("GET")                                  // Riwayat refund pesanan
+	router.HandleFunc("/api/admin/orders/{id}/refunds", controller.HandleCreateRefund).Methods("POST")                         // Refund penuh/sebagian (admin)
+	router.HandleFunc("/api/admin/orders/{id}/refunds/retry", controller.HandleRetryRefunds).Methods("POST")                   // Kirim ulang refund pending (admin)
+	router.HandleFunc("/api/cron/payment-reconciliation", controller.HandleReconcilePayments).Methods("GET")                   // Cek pembayaran pending ke gateway (cron)
+	router.HandleFunc("/api/cron/payment-reconciliation-report", controller.HandleBuildReconciliationReport).Methods("GET")    // Laporan rekonsiliasi harian (cron)
+	router.HandleFunc("/api/admin/payments", controller.GetAllPayments).Methods("GET")                                         // Buku pembayaran dengan filter, paginasi dan ekspor CSV (admin)
+	router.HandleFunc("/api/admin/payments/reconciliation/{tanggal}", controller.HandleGetReconciliationReport).Methods("GET") // Laporan rekonsiliasi (admin)
+
+	router.HandleFunc("/api/cart", controller.HandleGetCart).Methods("GET")                      // Keranjang dengan harga terkini
+	router.HandleFunc("/api/cart/items", controller.HandleAddCartItem).Methods("POST")           // Tambah perhiasan jadi/custom
+	router.HandleFunc("/api/cart/items/{id}", controller.HandleUpdateCartItem).Methods("PUT")    // Ubah jumlah item
+	router.HandleFunc("/api/cart/items/{id}", controller.HandleDeleteCartItem).Methods("DELETE") // Hapus item
+	router.HandleFunc("/api/cart/checkout", controller.HandleCheckoutCart).Methods("POST")       // Checkout menjadi satu pesanan
+
+	router.HandleFunc("/api/quotes", controller.CreateQuote).Methods("POST") // Quote harga dengan kunci harga sementara
+
+	router.HandleFunc("/api/admin/vouchers", controller.GetVouchers).Methods("GET")
+	router.HandleFunc("/api/admin/vouchers", controller.CreateVoucher).Methods("POST")
+	router.HandleFunc("/api/admin/vouchers/{id}", controller.UpdateVoucher).Methods("PUT")
+
 	router.HandleFunc("/payment", controller.CreatePayment).Methods("POST")
-	router.HandleFunc("/payment/status", controller.GetAllPayments).Methods("GET") // Mendapatkan status pembayaran
+	router.HandleFunc("/payment/status", controller.GetAllPayments).Methods("GET") // Buku pembayaran (admin), alias lama /api/admin/payments
 	router.HandleFunc("/webhook/midtrans", controller.WebhookHandler).Methods("POST")
 
+	// Simulasi pembayaran, hanya aktif jika PAYMENT_GATEWAY=fake
+	router.HandleFunc("/api/dev/payments/{order_id}", controller.HandleGetFakePayment).Methods("GET")
+	router.HandleFunc("/api/dev/payments/{order_id}", controller.HandleSimulateFakePayment).Methods("POST")
+
 	// Subrouter untuk endpoint yang memerlukan autentikasi JWT
 	protected := router.PathPrefix("/api/protected").Subrouter()
 	protected.Use(middleware.AuthMiddleware) // Middleware autentikasi JWT
@@ -47,6 +128,5 @@ func InitRoutes() *mux.Router {
 	// protected.HandleFunc("/orders", controller.HandleGetOrders).Methods("GET")         // Mendapatkan semua pesanan
 	// protected.HandleFunc("/orders/{id}", controller.HandleGetOrdersByUserId).Methods("GET") // Mendapatkan pesanan berdasarkan ID
 
-
 	return router
 }
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Status buyback
+const (
+	BuybackOffered   = "offered"   // harga sudah ditawarkan, uang belum dibayarkan
+	BuybackPaid      = "paid"      // uang dibayarkan ke penjual
+	BuybackCredited  = "credited"  // nilai buyback dijadikan kredit tukar tambah
+	BuybackCancelled = "cancelled" // penjual tidak jadi menjual
+)
+
+// Cara pembayaran buyback ke penjual
+const (
+	PayoutCash     = "tunai"
+	PayoutTransfer = "transfer"
+)
+
+var (
+	ErrInvalidBuyback  = errors.New("data buyback tidak valid")
+	ErrBuybackNotFound = errors.New("buyback tidak ditemukan")
+	ErrBuybackStatus   = errors.New("buyback sudah diselesaikan atau dibatalkan")
+	ErrTradeInLocked   = errors.New("kredit tukar tambah hanya bisa diubah sebelum pesanan dibayar")
+	ErrNoTradeInCredit = errors.New("tidak ada kredit tukar tambah yang tersisa")
+)
+
+// BuybackRequest adalah data perhiasan yang dijual kembali ke toko. Untuk perhiasan
+// bersertifikat, field yang kosong diambil dari sertifikat.
+type BuybackRequest struct {
+	UserID         int          `json:"user_id"`
+	NamaPenjual    string       `json:"nama_penjual"`
+	TeleponPenjual string       `json:"telepon_penjual"`
+	Serial         string       `json:"serial"`
+	Deskripsi      string       `json:"deskripsi"`
+	JenisEmas      string       `json:"jenis_emas"`
+	Berat          model.Gram   `json:"berat"`
+	KadarUji       model.Persen `json:"kadar_uji"`
+	MetodeUji      string       `json:"metode_uji"`
+	Catatan        string       `json:"catatan"`
+}
+
+// PriceBuyback menghitung harga beli kembali: harga emas per gram dari daftar harga saat ini
+// dikali berat dan kadar hasil uji, lalu dipotong spread toko untuk jenis emas tersebut
+func PriceBuyback(b *model.Buyback, rules PricingRules) error {
+	harga, ok := GoldPricePerGram(b.JenisEmas)
+	if !ok {
+		return ErrUnknownJenisEmas
+	}
+	b.HargaPerGram = harga
+	nilaiEmas, err := harga.MulGram(b.Berat)
+	if err != nil {
+		return err
+	}
+	nilaiKadar, err := nilaiEmas.MulPersen(b.KadarUji)
+	if err != nil {
+		return err
+	}
+	b.NilaiEmas = nilaiEmas
+	b.PenyesuaianKadar = nilaiKadar - nilaiEmas
+	b.Spread = rules.BuybackSpreadFor(b.JenisEmas)
+	if b.PotonganSpread, err = nilaiKadar.MulPersen(b.Spread); err != nil {
+		return err
+	}
+	b.Total = b.NilaiEmas + b.PenyesuaianKadar - b.PotonganSpread
+	b.PriceSheetVersion = NewPriceSheet(rules).Version()
+	return nil
+}
+
+// CreateBuyback mencatat penawaran buyback dengan harga dari daftar harga saat ini.
+// Uang belum dibayarkan sampai PayBuyback atau CreditBuyback dipanggil.
+func CreateBuyback(q database.Querier, req BuybackRequest, actor string) (model.Buyback, error) {
+	b := model.Buyback{
+		UserID:         req.UserID,
+		NamaPenjual:    strings.TrimSpace(req.NamaPenjual),
+		TeleponPenjual: strings.TrimSpace(req.TeleponPenjual),
+		Deskripsi:      strings.TrimSpace(req.Deskripsi),
+		JenisEmas:      strings.TrimSpace(req.JenisEmas),
+		Berat:          req.Berat,
+		KadarUji:       req.KadarUji,
+		MetodeUji:      strings.TrimSpace(req.MetodeUji),
+		Catatan:        strings.TrimSpace(req.Catatan),
+		Status:         BuybackOffered,
+		Actor:          actor,
+	}
+
+	// Perhiasan bersertifikat: spesifikasi terdaftar dipakai jika tidak diisi saat penimbangan
+	if serial := strings.TrimSpace(req.Serial); serial != "" {
+		certificate, err := GetCertificate(q, serial)
+		if err != nil {
+			return b, err
+		}
+		if certificate.Status == CertificateRevoked {
+			return b, ErrCertificateRevoked
+		}
+		b.Serial = certificate.Serial
+		if b.Deskripsi == "" {
+			b.Deskripsi = certificate.Nama
+		}
+		if b.JenisEmas == "" {
+			b.JenisEmas = certificate.JenisEmas
+		}
+		if b.Berat == 0 {
+			b.Berat = certificate.Berat
+		}
+		if b.KadarUji == 0 {
+			b.KadarUji = certificate.Kadar
+			b.MetodeUji = "Sertifikat " + certificate.Serial
+		}
+	}
+
+	if b.Berat <= 0 {
+		return b, fmt.Errorf("%w: berat wajib diisi", ErrInvalidBuyback)
+	}
+	if b.KadarUji <= 0 || b.KadarUji > model.PersenDenominator {
+		return b, fmt.Errorf("%w: kadar_uji harus antara 0 dan 100", ErrInvalidBuyback)
+	}
+	if b.JenisEmas == "" {
+		b.JenisEmas = fmt.Sprintf("Emas %dK", karatFromKadar(b.KadarUji))
+	}
+
+	if b.UserID != 0 {
+		var nama string
+		err := q.QueryRow(`SELECT name FROM "user" WHERE id = $1`, b.UserID).Scan(&nama)
+		if err == sql.ErrNoRows {
+			return b, fmt.Errorf("%w: pelanggan tidak ditemukan", ErrInvalidBuyback)
+		}
+		if err != nil {
+			return b, err
+		}
+		if b.NamaPenjual == "" {
+			b.NamaPenjual = nama
+		}
+	} else if b.NamaPenjual == "" || b.TeleponPenjual == "" {
+		return b, fmt.Errorf("%w: nama dan telepon penjual wajib diisi", ErrInvalidBuyback)
+	}
+
+	rules := CurrentPricingRules()
+	if err := PriceBuyback(&b, rules); err != nil {
+		return b, err
+	}
+	if _, err := RecordPriceSheet(q, rules); err != nil {
+		return b, err
+	}
+
+	err := q.QueryRow(`
+		INSERT INTO buybacks (user_id, nama_penjual, telepon_penjual, serial, deskripsi, jenis_emas, berat,
+			kadar_uji, metode_uji, harga_per_gram, nilai_emas, penyesuaian_kadar, spread, potongan_spread,
+			total, price_sheet_version, status, catatan, actor)
+		VALUES (NULLIF($1, 0), $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+		RETURNING id, created_at`,
+		b.UserID, b.NamaPenjual, b.TeleponPenjual, b.Serial, b.Deskripsi, b.JenisEmas, b.Berat,
+		b.KadarUji, b.MetodeUji, b.HargaPerGram, b.NilaiEmas, b.PenyesuaianKadar, b.Spread, b.PotonganSpread,
+		b.Total, b.PriceSheetVersion, b.Status, b.Catatan, b.Actor).Scan(&b.ID, &b.CreatedAt)
+	return b, err
+}
+
+const buybackColumns = `id, COALESCE(user_id, 0), nama_penjual, telepon_penjual, COALESCE(serial, ''), deskripsi,
+	jenis_emas, berat, kadar_uji, metode_uji, harga_per_gram, nilai_emas, penyesuaian_kadar, spread,
+	potongan_spread, total, price_sheet_version, status, metode_pembayaran, referensi_pembayaran, catatan,
+	actor, created_at, settled_at`
+
+func scanBuyback(row rowScanner) (model.Buyback, error) {
+	var b model.Buyback
+	err := row.Scan(&b.ID, &b.UserID, &b.NamaPenjual, &b.TeleponPenjual, &b.Serial, &b.Deskripsi,
+		&b.JenisEmas, &b.Berat, &b.KadarUji, &b.MetodeUji, &b.HargaPerGram, &b.NilaiEmas, &b.PenyesuaianKadar, &b.Spread,
+		&b.PotonganSpread, &b.Total, &b.PriceSheetVersion, &b.Status, &b.MetodePembayaran, &b.ReferensiPembayaran, &b.Catatan,
+		&b.Actor, &b.CreatedAt, &b.SettledAt)
+	return b, err
+}
+
+// GetBuyback membaca satu transaksi buyback
+func GetBuyback(q database.Querier, id int, forUpdate bool) (model.Buyback, error) {
+	query := `SELECT ` + buybackColumns + ` FROM buybacks WHERE id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	b, err := scanBuyback(q.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return b, ErrBuybackNotFound
+	}
+	return b, err
+}
+
+// ListBuybacks membaca transaksi buyback terbaru, opsional difilter status
+func ListBuybacks(q database.Querier, status string) ([]model.Buyback, error) {
+	rows, err := q.Query(`
+		SELECT `+buybackColumns+` FROM buybacks
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC LIMIT 200`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buybacks []model.Buyback
+	for rows.Next() {
+		b, err := scanBuyback(rows)
+		if err != nil {
+			return nil, err
+		}
+		buybacks = append(buybacks, b)
+	}
+	return buybacks, rows.Err()
+}
+
+// settleBuyback menutup penawaran buyback dan mencabut sertifikat perhiasannya
+// karena perhiasan sudah menjadi milik toko
+func settleBuyback(q database.Querier, b *model.Buyback, status, metode, referensi, actor string) error {
+	err := q.QueryRow(`
+		UPDATE buybacks SET status = $1, metode_pembayaran = $2, referensi_pembayaran = $3, settled_at = NOW()
+		WHERE id = $4 RETURNING settled_at`, status, metode, referensi, b.ID).Scan(&b.SettledAt)
+	if err != nil {
+		return err
+	}
+	b.Status, b.MetodePembayaran, b.ReferensiPembayaran = status, metode, referensi
+
+	if b.Serial == "" {
+		return nil
+	}
+	_, err = RevokeCertificate(q, b.Serial, fmt.Sprintf("Dibeli kembali oleh toko (buyback #%d)", b.ID), actor)
+	if errors.Is(err, ErrCertificateRevoked) {
+		return nil
+	}
+	return err
+}
+
+// PayBuyback mencatat pembayaran tunai atau transfer ke penjual
+func PayBuyback(q database.Querier, id int, metode, referensi, actor string) (model.Buyback, error) {
+	b, err := GetBuyback(q, id, true)
+	if err != nil {
+		return b, err
+	}
+	if b.Status != BuybackOffered {
+		return b, ErrBuybackStatus
+	}
+	if metode != PayoutCash && metode != PayoutTransfer {
+		return b, fmt.Errorf("%w: metode pembayaran harus tunai atau transfer", ErrInvalidBuyback)
+	}
+	referensi = strings.TrimSpace(referensi)
+	if metode == PayoutTransfer && referensi == "" {
+		return b, fmt.Errorf("%w: referensi transfer wajib diisi", ErrInvalidBuyback)
+	}
+	return b, settleBuyback(q, &b, BuybackPaid, metode, referensi, actor)
+}
+
+// CreditBuyback menjadikan nilai buyback kredit tukar tambah untuk pesanan berikutnya
+func CreditBuyback(q database.Querier, id int, actor string) (model.Buyback, model.TradeInCredit, error) {
+	var credit model.TradeInCredit
+	b, err := GetBuyback(q, id, true)
+	if err != nil {
+		return b, credit, err
+	}
+	if b.Status != BuybackOffered {
+		return b, credit, ErrBuybackStatus
+	}
+	if b.UserID == 0 {
+		return b, credit, fmt.Errorf("%w: tukar tambah hanya untuk pelanggan terdaftar", ErrInvalidBuyback)
+	}
+	if err := settleBuyback(q, &b, BuybackCredited, "", "", actor); err != nil {
+		return b, credit, err
+	}
+
+	credit = model.TradeInCredit{UserID: b.UserID, BuybackID: b.ID, Jumlah: b.Total, Sisa: b.Total}
+	err = q.QueryRow(`
+		INSERT INTO trade_in_credits (user_id, buyback_id, jumlah) VALUES ($1, $2, $3)
+		RETURNING id, created_at`, credit.UserID, credit.BuybackID, credit.Jumlah).Scan(&credit.ID, &credit.CreatedAt)
+	return b, credit, err
+}
+
+// CancelBuyback membatalkan penawaran yang belum dibayar
+func CancelBuyback(q database.Querier, id int) (model.Buyback, error) {
+	b, err := GetBuyback(q, id, true)
+	if err != nil {
+		return b, err
+	}
+	if b.Status != BuybackOffered {
+		return b, ErrBuybackStatus
+	}
+	if _, err := q.Exec(`UPDATE buybacks SET status = $1, settled_at = NOW() WHERE id = $2`, BuybackCancelled, id); err != nil {
+		return b, err
+	}
+	b.Status = BuybackCancelled
+	return b, nil
+}
+
+// TradeInCredits membaca kredit tukar tambah milik user beserta sisanya, terlama lebih dulu.
+// Dengan forUpdate baris kredit dikunci supaya tidak dipakai dua pesanan bersamaan.
+func TradeInCredits(q database.Querier, userID int, forUpdate bool) ([]model.TradeInCredit, error) {
+	if forUpdate {
+		if _, err := q.Exec(`SELECT id FROM trade_in_credits WHERE user_id = $1 FOR UPDATE`, userID); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := q.Query(`
+		SELECT c.id, c.user_id, c.buyback_id, c.jumlah,
+			COALESCE((SELECT SUM(r.jumlah) FROM trade_in_redemptions r
+				WHERE r.credit_id = c.id AND r.status <> $2), 0),
+			c.created_at
+		FROM trade_in_credits c
+		WHERE c.user_id = $1
+		ORDER BY c.created_at, c.id`, userID, RedemptionReleased)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credits []model.TradeInCredit
+	for rows.Next() {
+		var c model.TradeInCredit
+		if err := rows.Scan(&c.ID, &c.UserID, &c.BuybackID, &c.Jumlah, &c.Terpakai, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.Sisa = c.Jumlah - c.Terpakai
+		credits = append(credits, c)
+	}
+	return credits, rows.Err()
+}
+
+// ApplyTradeIn mengganti baris tukar tambah pada rincian harga. Kredit dipotong dari total
+// setelah pajak dan tidak boleh membuat total negatif.
+func ApplyTradeIn(breakdown model.PriceBreakdown, lines []model.PriceLine) model.PriceBreakdown {
+	items := make([]model.PriceLine, 0, len(breakdown.Items)+len(lines))
+	for _, item := range breakdown.Items {
+		if item.Kode != "tukar_tambah" {
+			items = append(items, item)
+		}
+	}
+	breakdown.Total += breakdown.TukarTambah
+	breakdown.TukarTambah = 0
+	for _, line := range lines {
+		if line.Jumlah > 0 {
+			line.Jumlah = -line.Jumlah
+		}
+		if -line.Jumlah > breakdown.Total {
+			line.Jumlah = -breakdown.Total
+		}
+		if line.Jumlah == 0 {
+			continue
+		}
+		breakdown.TukarTambah -= line.Jumlah
+		breakdown.Total += line.Jumlah
+		items = append(items, line)
+	}
+	breakdown.Items = items
+	return breakdown
+}
+
+// SetOrderTradeIn memakai kredit tukar tambah pemilik pesanan untuk pesanan yang belum dibayar.
+// jumlah nil berarti kredit dipakai semaksimal mungkin; nol melepas kredit dari pesanan.
+// Transaksi pembayaran yang masih pending harus dibatalkan pemanggil karena totalnya berubah.
+func SetOrderTradeIn(q database.Querier, orderID int, jumlah *model.Rupiah, actor string) (model.PriceBreakdown, error) {
+	breakdown, status, err := orderBreakdown(q, orderID, true)
+	if err != nil {
+		return breakdown, err
+	}
+	if status != OrderDraft && status != OrderAwaitingPayment {
+		return breakdown, ErrTradeInLocked
+	}
+	// Jadwal cicilan dihitung dari total saat dibuat sehingga total tidak boleh berubah lagi
+	if active, err := HasActivePaymentSchedule(q, orderID); err != nil {
+		return breakdown, err
+	} else if active {
+		return breakdown, ErrScheduleActive
+	}
+	if jumlah != nil && *jumlah < 0 {
+		return breakdown, fmt.Errorf("%w: jumlah tidak boleh negatif", ErrInvalidBuyback)
+	}
+
+	var userID int
+	if err := q.QueryRow(`SELECT user_id FROM custom_orders WHERE id = $1`, orderID).Scan(&userID); err != nil {
+		return breakdown, err
+	}
+
+	// Kredit yang sudah dipesan untuk pesanan ini dilepas dulu lalu dipesan ulang
+	if _, err := q.Exec(`
+		UPDATE trade_in_redemptions SET status = $1, updated_at = NOW()
+		WHERE custom_order_id = $2 AND status = $3`, RedemptionReleased, orderID, RedemptionReserved); err != nil {
+		return breakdown, err
+	}
+	credits, err := TradeInCredits(q, userID, true)
+	if err != nil {
+		return breakdown, err
+	}
+
+	target := breakdown.Total + breakdown.TukarTambah
+	if jumlah != nil && *jumlah < target {
+		target = *jumlah
+	}
+	var lines []model.PriceLine
+	for _, credit := range credits {
+		if target <= 0 {
+			break
+		}
+		if credit.Sisa <= 0 {
+			continue
+		}
+		use := credit.Sisa
+		if use > target {
+			use = target
+		}
+		if _, err := q.Exec(`
+			INSERT INTO trade_in_redemptions (credit_id, custom_order_id, jumlah, status) VALUES ($1, $2, $3, $4)`,
+			credit.ID, orderID, use, RedemptionReserved); err != nil {
+			return breakdown, err
+		}
+		lines = append(lines, model.PriceLine{
+			Kode:       "tukar_tambah",
+			Keterangan: fmt.Sprintf("Tukar tambah (buyback #%d)", credit.BuybackID),
+			Jumlah:     -use,
+		})
+		target -= use
+	}
+	if len(lines) == 0 && (jumlah == nil || *jumlah > 0) {
+		return breakdown, ErrNoTradeInCredit
+	}
+
+	breakdown = ApplyTradeIn(breakdown, lines)
+	rincian, err := json.Marshal(breakdown)
+	if err != nil {
+		return breakdown, err
+	}
+	if _, err := q.Exec(`UPDATE custom_orders SET total_harga = $1, rincian_harga = $2, updated_at = NOW() WHERE id = $3`,
+		breakdown.Total, rincian, orderID); err != nil {
+		return breakdown, err
+	}
+
+	keterangan := "Kredit tukar tambah dilepas dari pesanan"
+	if breakdown.TukarTambah > 0 {
+		keterangan = "Kredit tukar tambah dipakai sebesar " + FormatRupiah(breakdown.TukarTambah)
+	}
+	return breakdown, RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    orderID,
+		Tipe:       EventNote,
+		Keterangan: keterangan,
+		Actor:      actor,
+	})
+}
+
+// ConfirmTradeInCredits menandai kredit tukar tambah pesanan sebagai terpakai setelah lunas
+func ConfirmTradeInCredits(q database.Querier, orderID int) error {
+	_, err := q.Exec(`
+		UPDATE trade_in_redemptions SET status = $1, updated_at = NOW()
+		WHERE custom_order_id = $2 AND status = $3`,
+		RedemptionRedeemed, orderID, RedemptionReserved)
+	return err
+}
+
+// ReleaseTradeInCredits mengembalikan kredit tukar tambah jika pesanan batal,
+// termasuk kredit dari pesanan yang sudah lunas lalu dibatalkan
+func ReleaseTradeInCredits(q database.Querier, orderID int) error {
+	_, err := q.Exec(`
+		UPDATE trade_in_redemptions SET status = $1, updated_at = NOW()
+		WHERE custom_order_id = $2 AND status IN ($3, $4)`,
+		RedemptionReleased, orderID, RedemptionReserved, RedemptionRedeemed)
+	return err
+}
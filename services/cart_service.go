@@ -0,0 +1,400 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Tipe header pesanan
+const (
+	OrderTypeCustom = "custom" // satu perhiasan custom dari HandleAddOrder
+	OrderTypeCart   = "cart"   // beberapa item dari checkout keranjang
+)
+
+// Batas atas input pesanan supaya perkalian harga tetap jauh dari batas Rupiah
+const (
+	MaxBeratEmas  model.Gram = 1000 * model.MilligramsPerGram // 1 kg per perhiasan
+	MaxJumlahBatu            = 500                            // butir per jenis batu
+	MaxCartQty               = 100                            // jumlah per item keranjang
+)
+
+var (
+	ErrCartEmpty          = errors.New("keranjang kosong")
+	ErrCartItemInvalid    = errors.New("ada item keranjang yang tidak tersedia atau harganya tidak valid")
+	ErrInvalidCartItem    = errors.New("item keranjang tidak valid")
+	ErrInvalidOrderInput  = errors.New("data perhiasan custom tidak lengkap")
+	ErrOrderInputTooLarge = fmt.Errorf("berat emas maksimal %s gram dan jumlah batu maksimal %d butir per jenis", MaxBeratEmas, MaxJumlahBatu)
+)
+
+// ValidateOrderRequest memeriksa field wajib, batas berat dan jumlah batu, serta personalisasi perhiasan custom
+func ValidateOrderRequest(req model.OrderRequest) error {
+	if req.JenisPerhiasan == "" || req.JenisEmas == "" || req.BeratEmas <= 0 ||
+		req.PersentaseEmas <= 0 || req.PersentaseEmas > model.PersenDenominator {
+		return ErrInvalidOrderInput
+	}
+	if req.BeratEmas > MaxBeratEmas {
+		return ErrOrderInputTooLarge
+	}
+	for _, batu := range req.Batu {
+		if batu.Jumlah > MaxJumlahBatu {
+			return ErrOrderInputTooLarge
+		}
+	}
+	return ValidatePersonalisasi(req.JenisPerhiasan, req.Personalisasi)
+}
+
+// orderFromRequest mengubah OrderRequest menjadi spesifikasi pesanan untuk perhitungan harga
+func orderFromRequest(req model.OrderRequest) model.Order {
+	return model.Order{
+		JenisPerhiasan:   req.JenisPerhiasan,
+		JenisEmas:        req.JenisEmas,
+		BeratEmas:        req.BeratEmas,
+		CampuranTambahan: req.CampuranTambahan,
+		PersentaseEmas:   req.PersentaseEmas,
+		Batu:             req.Batu,
+		Personalisasi:    req.Personalisasi,
+	}
+}
+
+// LoadCart membaca keranjang user lalu memvalidasi ulang setiap item terhadap harga dan stok terkini
+func LoadCart(q database.Querier, userID int) ([]model.CartItem, error) {
+	return loadCart(q, userID, CurrentPricingRules(), "")
+}
+
+// loadCart membaca keranjang dengan rules. lock diisi "FOR UPDATE OF ci" saat checkout
+// agar dua checkout bersamaan tidak membuat dua pesanan dari keranjang yang sama.
+func loadCart(q database.Querier, userID int, rules PricingRules, lock string) ([]model.CartItem, error) {
+	rows, err := q.Query(`
+		SELECT ci.id, ci.item_type, COALESCE(ci.emas_id, 0), ci.custom, ci.qty, ci.added_at,
+			e.id, e.nama, e.karatan, e.berat, e.harga, e.stok
+		FROM cart_items ci
+		LEFT JOIN emas e ON e.id = ci.emas_id
+		WHERE ci.user_id = $1
+		ORDER BY ci.added_at, ci.id `+lock, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []model.CartItem{}
+	for rows.Next() {
+		var item model.CartItem
+		var custom []byte
+		var emasID sql.NullInt64
+		var emas model.Emas
+		var nama sql.NullString
+		var karatan, stok sql.NullInt64
+		var berat model.Gram
+		var harga model.Rupiah
+		if err := rows.Scan(&item.ID, &item.ItemType, &item.EmasID, &custom, &item.Qty, &item.AddedAt,
+			&emasID, &nama, &karatan, &berat, &harga, &stok); err != nil {
+			return nil, err
+		}
+		if emasID.Valid {
+			emas = model.Emas{ID: uint(emasID.Int64), Nama: nama.String, Karatan: int(karatan.Int64), Berat: berat, Harga: harga, Stok: int(stok.Int64)}
+			item.Emas = &emas
+		}
+		if len(custom) > 0 && string(custom) != "null" {
+			item.Custom = &model.OrderRequest{}
+			if err := json.Unmarshal(custom, item.Custom); err != nil {
+				return nil, err
+			}
+		}
+		PriceCartItem(&item, rules)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// PriceCartItem menghitung harga satuan dan subtotal item keranjang dengan rules.
+// Harga satuan selalu sebelum pajak; pajak dihitung sekali untuk seluruh keranjang oleh CartBreakdown.
+// Item yang stoknya kurang atau spesifikasinya tidak valid ditandai Tersedia = false.
+func PriceCartItem(item *model.CartItem, rules PricingRules) {
+	item.Tersedia = false
+	item.HargaSatuan, item.Subtotal, item.Rincian = 0, 0, nil
+
+	switch item.ItemType {
+	case model.ItemEmas:
+		if item.Emas == nil {
+			item.Pesan = "Produk sudah tidak dijual"
+			return
+		}
+		if item.Qty > MaxCartQty {
+			item.Pesan = fmt.Sprintf("Jumlah maksimal %d", MaxCartQty)
+			return
+		}
+		if item.Emas.Stok < item.Qty {
+			item.Pesan = fmt.Sprintf("Stok tersisa %d", item.Emas.Stok)
+			return
+		}
+		item.HargaSatuan = item.Emas.Harga
+	case model.ItemCustom:
+		if item.Qty > MaxCartQty {
+			item.Pesan = fmt.Sprintf("Jumlah maksimal %d", MaxCartQty)
+			return
+		}
+		if item.Custom == nil || ValidateOrderRequest(*item.Custom) != nil {
+			item.Pesan = "Data perhiasan custom tidak lengkap"
+			return
+		}
+		breakdown, err := CalculateServerBreakdown(orderFromRequest(*item.Custom), rules)
+		if err != nil {
+			item.Pesan = "Jenis emas atau batu tidak valid"
+			return
+		}
+		item.Rincian = &breakdown
+		item.HargaSatuan = breakdown.Subtotal
+	default:
+		item.Pesan = "Jenis item tidak dikenal"
+		return
+	}
+
+	subtotal, err := item.HargaSatuan.MulInt(int64(item.Qty))
+	if err != nil {
+		item.Pesan = "Harga item melebihi batas"
+		return
+	}
+	item.Subtotal = subtotal
+	item.Tersedia = true
+	item.Pesan = ""
+}
+
+// CartBreakdown menggabungkan item keranjang menjadi satu rincian harga pesanan.
+// Pajak dihitung dari subtotal semua item dengan tarif tax, sehingga diskon keranjang
+// mengurangi dasar pajak seperti pada pesanan tunggal.
+func CartBreakdown(items []model.CartItem, tax TaxRate) (model.PriceBreakdown, error) {
+	var breakdown model.PriceBreakdown
+	for _, item := range items {
+		keterangan := "Perhiasan custom"
+		if item.Emas != nil {
+			keterangan = item.Emas.Nama
+		} else if item.Custom != nil {
+			keterangan = fmt.Sprintf("%s custom %s %s gram", item.Custom.JenisPerhiasan, item.Custom.JenisEmas, item.Custom.BeratEmas)
+		}
+		breakdown.Items = append(breakdown.Items, model.PriceLine{
+			Kode:       "item",
+			Keterangan: fmt.Sprintf("%s x%d", keterangan, item.Qty),
+			Jumlah:     item.Subtotal,
+		})
+		breakdown.Subtotal += item.Subtotal
+	}
+
+	var err error
+	breakdown.TarifPajak = tax.Rate
+	if breakdown.Pajak, err = breakdown.Subtotal.MulPersen(tax.Rate); err != nil {
+		return model.PriceBreakdown{}, err
+	}
+	if breakdown.Pajak > 0 {
+		breakdown.Items = append(breakdown.Items, model.PriceLine{Kode: "pajak", Keterangan: fmt.Sprintf("%s %s%%", tax.Name, tax.Rate), Jumlah: breakdown.Pajak})
+	}
+	breakdown.Total = breakdown.Subtotal + breakdown.Pajak
+	return breakdown, nil
+}
+
+// CheckoutCart mengubah keranjang user menjadi satu pesanan dengan beberapa item di dalam transaksi.
+// Stok perhiasan jadi dikunci dan dikurangi, voucher dipesan, lalu keranjang dikosongkan.
+func CheckoutCart(tx *sql.Tx, userID int, kodeVoucher string, at time.Time) (model.Order, error) {
+	// Harga item dan price_sheet_version memakai satu salinan aturan harga yang sama
+	rules := CurrentPricingRules()
+	items, err := loadCart(tx, userID, rules, "FOR UPDATE OF ci")
+	if err != nil {
+		return model.Order{}, err
+	}
+	if len(items) == 0 {
+		return model.Order{}, ErrCartEmpty
+	}
+
+	// Kunci stok supaya dua checkout bersamaan tidak menjual barang yang sama
+	for i := range items {
+		if items[i].ItemType != model.ItemEmas || items[i].Emas == nil {
+			continue
+		}
+		if err := tx.QueryRow(`SELECT stok FROM emas WHERE id = $1 FOR UPDATE`, items[i].EmasID).Scan(&items[i].Emas.Stok); err != nil {
+			return model.Order{}, err
+		}
+		PriceCartItem(&items[i], rules)
+	}
+	for _, item := range items {
+		if !item.Tersedia {
+			return model.Order{}, ErrCartItemInvalid
+		}
+	}
+
+	breakdown, err := CartBreakdown(items, rules.TaxRateAt(at))
+	if err != nil {
+		return model.Order{}, err
+	}
+	breakdown, err = ApplyCartVouchers(tx, userID, items, breakdown, kodeVoucher, at)
+	if err != nil {
+		return model.Order{}, err
+	}
+	rincian, err := json.Marshal(breakdown)
+	if err != nil {
+		return model.Order{}, err
+	}
+	priceSheetVersion, err := RecordPriceSheet(tx, rules)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order := model.Order{
+		Tipe:              OrderTypeCart,
+		UserID:            userID,
+		TotalHarga:        breakdown.Total,
+		PriceSheetVersion: priceSheetVersion,
+		Rincian:           &breakdown,
+		Status:            OrderDraft,
+	}
+	err = tx.QueryRow(`
+		INSERT INTO custom_orders (user_id, tipe, jenis_perhiasan, jenis_emas, berat_emas, campuran_tambahan,
+			persentase_emas, total_harga, rincian_harga, price_sheet_version)
+		VALUES ($1, $2, '', '', 0, '', 0, $3, $4, $5)
+		RETURNING id, created_at`,
+		userID, OrderTypeCart, order.TotalHarga, rincian, order.PriceSheetVersion).Scan(&order.ID, &order.CreatedAt)
+	if err != nil {
+		return model.Order{}, err
+	}
+	if err := InitOrderStatus(tx, order.ID, ActorUser(userID)); err != nil {
+		return model.Order{}, err
+	}
+
+	for _, item := range items {
+		orderItem, err := insertOrderItem(tx, order.ID, item)
+		if err != nil {
+			return model.Order{}, err
+		}
+		order.Items = append(order.Items, orderItem)
+
+		if item.ItemType == model.ItemEmas {
+			if _, err := tx.Exec(`UPDATE emas SET stok = stok - $1 WHERE id = $2`, item.Qty, item.EmasID); err != nil {
+				return model.Order{}, err
+			}
+		}
+	}
+
+	if err := ReserveRedemptions(tx, order.ID, userID, breakdown, at); err != nil {
+		return model.Order{}, err
+	}
+	if _, err := tx.Exec(`DELETE FROM cart_items WHERE user_id = $1`, userID); err != nil {
+		return model.Order{}, err
+	}
+	return order, nil
+}
+
+func insertOrderItem(tx *sql.Tx, orderID int, item model.CartItem) (model.OrderItem, error) {
+	orderItem := model.OrderItem{
+		ItemType:    item.ItemType,
+		EmasID:      item.EmasID,
+		Qty:         item.Qty,
+		HargaSatuan: item.HargaSatuan,
+		Subtotal:    item.Subtotal,
+		Rincian:     item.Rincian,
+	}
+	var emasID interface{}
+	if item.Emas != nil {
+		orderItem.Nama = item.Emas.Nama
+		orderItem.JenisEmas = fmt.Sprintf("Emas %dK", item.Emas.Karatan)
+		orderItem.BeratEmas = item.Emas.Berat
+		emasID = item.EmasID
+	}
+	if item.Custom != nil {
+		orderItem.Nama = item.Custom.JenisPerhiasan + " custom"
+		orderItem.JenisPerhiasan = item.Custom.JenisPerhiasan
+		orderItem.JenisEmas = item.Custom.JenisEmas
+		orderItem.BeratEmas = item.Custom.BeratEmas
+		orderItem.CampuranTambahan = item.Custom.CampuranTambahan
+		orderItem.PersentaseEmas = item.Custom.PersentaseEmas
+		orderItem.Batu = item.Custom.Batu
+		orderItem.Personalisasi = item.Custom.Personalisasi
+	}
+
+	batu, err := json.Marshal(nonNilBatu(orderItem.Batu))
+	if err != nil {
+		return orderItem, err
+	}
+	personalisasi, err := EncodePersonalisasi(orderItem.Personalisasi)
+	if err != nil {
+		return orderItem, err
+	}
+	var rincian []byte
+	if item.Rincian != nil {
+		if rincian, err = json.Marshal(item.Rincian); err != nil {
+			return orderItem, err
+		}
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO order_items (custom_order_id, item_type, emas_id, nama, jenis_perhiasan, jenis_emas, berat_emas,
+			campuran_tambahan, persentase_emas, batu, personalisasi, qty, harga_satuan, subtotal, rincian)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id`,
+		orderID, orderItem.ItemType, emasID, orderItem.Nama, orderItem.JenisPerhiasan, orderItem.JenisEmas, orderItem.BeratEmas,
+		orderItem.CampuranTambahan, orderItem.PersentaseEmas, batu, personalisasi, orderItem.Qty, orderItem.HargaSatuan, orderItem.Subtotal, rincian).Scan(&orderItem.ID)
+	return orderItem, err
+}
+
+// OrderItems membaca item pesanan multi-item
+func OrderItems(q database.Querier, orderID int) ([]model.OrderItem, error) {
+	rows, err := q.Query(`
+		SELECT id, item_type, COALESCE(emas_id, 0), nama, jenis_perhiasan, jenis_emas, berat_emas,
+			campuran_tambahan, persentase_emas, batu, personalisasi, qty, harga_satuan, subtotal, rincian
+		FROM order_items
+		WHERE custom_order_id = $1
+		ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []model.OrderItem
+	for rows.Next() {
+		var item model.OrderItem
+		var batu, personalisasi, rincian []byte
+		if err := rows.Scan(&item.ID, &item.ItemType, &item.EmasID, &item.Nama, &item.JenisPerhiasan, &item.JenisEmas, &item.BeratEmas,
+			&item.CampuranTambahan, &item.PersentaseEmas, &batu, &personalisasi, &item.Qty, &item.HargaSatuan, &item.Subtotal, &rincian); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(batu, &item.Batu); err != nil {
+			return nil, err
+		}
+		if item.Personalisasi, err = DecodePersonalisasi(personalisasi); err != nil {
+			return nil, err
+		}
+		if len(rincian) > 0 {
+			item.Rincian = &model.PriceBreakdown{}
+			if err := json.Unmarshal(rincian, item.Rincian); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// RestockOrderItems mengembalikan stok perhiasan jadi dari pesanan yang batal.
+// Aman dipanggil berulang kali karena setiap item hanya dikembalikan sekali.
+func RestockOrderItems(q database.Querier, orderID int) error {
+	_, err := q.Exec(`
+		WITH restocked AS (
+			UPDATE order_items SET restocked = TRUE
+			WHERE custom_order_id = $1 AND item_type = 'emas' AND emas_id IS NOT NULL AND NOT restocked
+			RETURNING emas_id, qty
+		)
+		UPDATE emas e SET stok = e.stok + r.qty
+		FROM (SELECT emas_id, SUM(qty) AS qty FROM restocked GROUP BY emas_id) r
+		WHERE e.id = r.emas_id`, orderID)
+	return err
+}
+
+func nonNilBatu(batu []model.Batu) []model.Batu {
+	if batu == nil {
+		return []model.Batu{}
+	}
+	return batu
+}
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"proyek3/config"
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Status sertifikat keaslian
+const (
+	CertificateActive  = "active"
+	CertificateRevoked = "revoked"
+)
+
+var (
+	ErrCertificateNotFound    = errors.New("sertifikat tidak ditemukan")
+	ErrCertificateRevoked     = errors.New("sertifikat sudah dicabut")
+	ErrCertificateOrderStatus = errors.New("sertifikat hanya diterbitkan untuk perhiasan yang sudah selesai diproduksi")
+	ErrEmasNotFound           = errors.New("produk tidak ditemukan")
+	ErrCertificateQuantity    = errors.New("jumlah sertifikat harus antara 1 dan stok produk")
+)
+
+// certifiableStatuses adalah status pesanan yang perhiasannya sudah jadi
+var certifiableStatuses = map[string]bool{
+	OrderReady:     true,
+	OrderShipped:   true,
+	OrderPickedUp:  true,
+	OrderCompleted: true,
+}
+
+// serialChars adalah alfabet Crockford base32 tanpa I, L, O dan U supaya serial mudah dibaca
+const serialChars = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newCertificateSerial membuat serial acak, misalnya AU25-7K3M9QX2
+func newCertificateSerial(issuedAt time.Time) (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	serial := make([]byte, len(random))
+	for i, b := range random {
+		serial[i] = serialChars[int(b)%len(serialChars)]
+	}
+	return fmt.Sprintf("AU%02d-%s", issuedAt.Year()%100, serial), nil
+}
+
+// certificateCode menandatangani serial dan spesifikasi sertifikat dengan HMAC. Kode tidak
+// disimpan; perubahan spesifikasi di database membuat kode yang tercetak tidak cocok lagi.
+func certificateCode(c model.Certificate) string {
+	batu, _ := json.Marshal(c.Batu)
+	payload := fmt.Sprintf("certificate|%s|%s|%s|%s|%d|%s|%s|%s|%d",
+		c.Serial, c.Nama, c.JenisPerhiasan, c.JenisEmas, c.Karat, c.Kadar, c.Berat, batu, c.IssuedAt.Unix())
+
+	mac := hmac.New(sha256.New, []byte(config.CertificateSecret))
+	mac.Write([]byte(payload))
+	code := base32.StdEncoding.EncodeToString(mac.Sum(nil)[:10])
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+}
+
+// normalizeCertificateCode menyeragamkan kode yang diketik pengguna (huruf kecil, tanpa tanda hubung)
+func normalizeCertificateCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	if len(code) != 16 {
+		return code
+	}
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+}
+
+// CertificateVerifyURL adalah tautan verifikasi publik yang dicetak sebagai QR code
+func CertificateVerifyURL(c model.Certificate) string {
+	return strings.TrimRight(config.PublicBaseURL, "/") + "/verify/" + url.PathEscape(c.Serial) +
+		"?kode=" + strings.ReplaceAll(c.KodeVerifikasi, "-", "")
+}
+
+// karatFromKadar mengubah kadar emas menjadi karat terdekat (100% = 24K)
+func karatFromKadar(kadar model.Persen) int {
+	return int((int64(kadar)*24 + model.PersenDenominator/2) / model.PersenDenominator)
+}
+
+// kadarFromKarat mengubah karat menjadi kadar emas, misalnya 18K = 75%
+func kadarFromKarat(karat int) model.Persen {
+	return model.Persen((int64(karat)*model.PersenDenominator + 12) / 24)
+}
+
+// finishedWeight mengambil berat akhir perhiasan dari tahap produksi terakhir yang ditimbang.
+// Jika belum ada penimbangan, berat pesanan yang dipakai.
+func finishedWeight(q database.Querier, orderID, itemID int, ordered model.Gram) (model.Gram, error) {
+	var berat model.Gram
+	err := q.QueryRow(`
+		SELECT s.berat_keluar FROM work_order_stages s
+		JOIN work_orders wo ON wo.id = s.work_order_id
+		WHERE wo.custom_order_id = $1 AND COALESCE(wo.order_item_id, 0) = $2 AND s.berat_keluar IS NOT NULL
+		ORDER BY s.urutan DESC LIMIT 1`, orderID, itemID).Scan(&berat)
+	if err == sql.ErrNoRows {
+		return ordered, nil
+	}
+	return berat, err
+}
+
+// insertCertificate menyimpan sertifikat baru dengan serial unik
+func insertCertificate(q database.Querier, c *model.Certificate) error {
+	if c.Batu == nil {
+		c.Batu = []model.Batu{}
+	}
+	batu, err := json.Marshal(c.Batu)
+	if err != nil {
+		return err
+	}
+	c.Status = CertificateActive
+	c.IssuedAt = time.Now()
+
+	// Serial acak hampir tidak mungkin bentrok; jika terjadi, buat ulang
+	for attempt := 0; attempt < 5; attempt++ {
+		if c.Serial, err = newCertificateSerial(c.IssuedAt); err != nil {
+			return err
+		}
+		err = q.QueryRow(`
+			INSERT INTO certificates (serial, custom_order_id, order_item_id, emas_id, nama, jenis_perhiasan,
+				jenis_emas, karat, kadar, berat, batu, status, issued_at)
+			VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), NULLIF($4, 0), $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			ON CONFLICT (serial) DO NOTHING
+			RETURNING id, issued_at`,
+			c.Serial, c.OrderID, c.OrderItemID, c.EmasID, c.Nama, c.JenisPerhiasan,
+			c.JenisEmas, c.Karat, c.Kadar, c.Berat, batu, c.Status, c.IssuedAt).Scan(&c.ID, &c.IssuedAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		c.KodeVerifikasi = certificateCode(*c)
+		return nil
+	}
+	return errors.New("gagal membuat serial sertifikat yang unik")
+}
+
+// IssueOrderCertificates menerbitkan satu sertifikat untuk setiap perhiasan pada pesanan yang
+// sudah jadi; item keranjang dengan qty lebih dari satu mendapat sertifikat per buah.
+// Pemanggilan berulang mengembalikan sertifikat yang sudah ada (created false).
+func IssueOrderCertificates(q database.Querier, orderID int, actor string) (certificates []model.Certificate, created bool, err error) {
+	var status string
+	err = q.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil, false, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !certifiableStatuses[status] {
+		return nil, false, ErrCertificateOrderStatus
+	}
+
+	existing, err := ListOrderCertificates(q, orderID)
+	if err != nil || len(existing) > 0 {
+		return existing, false, err
+	}
+
+	order, err := loadOrderSnapshot(q, orderID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var pieces []model.Certificate
+	if order.Tipe == OrderTypeCart {
+		for _, item := range order.Items {
+			piece := model.Certificate{
+				OrderID:        orderID,
+				OrderItemID:    item.ID,
+				Nama:           item.Nama,
+				JenisPerhiasan: item.JenisPerhiasan,
+				JenisEmas:      item.JenisEmas,
+				Kadar:          item.PersentaseEmas,
+				Berat:          item.BeratEmas,
+				Batu:           item.Batu,
+			}
+			if item.ItemType == model.ItemEmas {
+				// Kadar perhiasan jadi diturunkan dari karat di katalog
+				var karat int
+				if err := q.QueryRow(`SELECT karatan FROM emas WHERE id = $1`, item.EmasID).Scan(&karat); err != nil {
+					return nil, false, err
+				}
+				piece.Karat, piece.Kadar = karat, kadarFromKarat(karat)
+			} else {
+				piece.Karat = karatFromKadar(item.PersentaseEmas)
+				if piece.Berat, err = finishedWeight(q, orderID, item.ID, item.BeratEmas); err != nil {
+					return nil, false, err
+				}
+			}
+			for i := 0; i < item.Qty; i++ {
+				pieces = append(pieces, piece)
+			}
+		}
+	} else {
+		piece := model.Certificate{
+			OrderID:        orderID,
+			Nama:           order.JenisPerhiasan + " custom",
+			JenisPerhiasan: order.JenisPerhiasan,
+			JenisEmas:      order.JenisEmas,
+			Karat:          karatFromKadar(order.PersentaseEmas),
+			Kadar:          order.PersentaseEmas,
+			Batu:           order.Batu,
+		}
+		if piece.Berat, err = finishedWeight(q, orderID, 0, order.BeratEmas); err != nil {
+			return nil, false, err
+		}
+		pieces = append(pieces, piece)
+	}
+
+	serials := make([]string, 0, len(pieces))
+	for _, piece := range pieces {
+		if err := insertCertificate(q, &piece); err != nil {
+			return nil, false, err
+		}
+		certificates = append(certificates, piece)
+		serials = append(serials, piece.Serial)
+	}
+
+	return certificates, true, RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    orderID,
+		Tipe:       EventNote,
+		Keterangan: "Sertifikat keaslian diterbitkan: " + strings.Join(serials, ", "),
+		Actor:      actor,
+	})
+}
+
+// IssueInventoryCertificates menerbitkan sertifikat untuk perhiasan jadi di stok toko,
+// misalnya untuk dipajang atau dijual langsung di toko
+func IssueInventoryCertificates(q database.Querier, emasID, jumlah int) ([]model.Certificate, error) {
+	var emas model.Emas
+	err := q.QueryRow(`SELECT id, nama, karatan, berat, stok FROM emas WHERE id = $1`, emasID).Scan(
+		&emas.ID, &emas.Nama, &emas.Karatan, &emas.Berat, &emas.Stok)
+	if err == sql.ErrNoRows {
+		return nil, ErrEmasNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if jumlah < 1 || jumlah > emas.Stok {
+		return nil, ErrCertificateQuantity
+	}
+
+	var certificates []model.Certificate
+	for i := 0; i < jumlah; i++ {
+		c := model.Certificate{
+			EmasID:    emasID,
+			Nama:      emas.Nama,
+			JenisEmas: fmt.Sprintf("Emas %dK", emas.Karatan),
+			Karat:     emas.Karatan,
+			Kadar:     kadarFromKarat(emas.Karatan),
+			Berat:     emas.Berat,
+		}
+		if err := insertCertificate(q, &c); err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, c)
+	}
+	return certificates, nil
+}
+
+const certificateColumns = `id, serial, COALESCE(custom_order_id, 0), COALESCE(order_item_id, 0), COALESCE(emas_id, 0),
+	nama, jenis_perhiasan, jenis_emas, karat, kadar, berat, batu, status, alasan_pencabutan, issued_at, revoked_at`
+
+func scanCertificate(row rowScanner) (model.Certificate, error) {
+	var c model.Certificate
+	var batu []byte
+	err := row.Scan(&c.ID, &c.Serial, &c.OrderID, &c.OrderItemID, &c.EmasID,
+		&c.Nama, &c.JenisPerhiasan, &c.JenisEmas, &c.Karat, &c.Kadar, &c.Berat, &batu, &c.Status,
+		&c.AlasanPencabutan, &c.IssuedAt, &c.RevokedAt)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(batu, &c.Batu); err != nil {
+		return c, err
+	}
+	c.KodeVerifikasi = certificateCode(c)
+	return c, nil
+}
+
+// ListOrderCertificates membaca sertifikat milik pesanan
+func ListOrderCertificates(q database.Querier, orderID int) ([]model.Certificate, error) {
+	rows, err := q.Query(`SELECT `+certificateColumns+` FROM certificates WHERE custom_order_id = $1 ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var certificates []model.Certificate
+	for rows.Next() {
+		c, err := scanCertificate(rows)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, c)
+	}
+	return certificates, rows.Err()
+}
+
+// GetCertificate membaca sertifikat berdasarkan serial
+func GetCertificate(q database.Querier, serial string) (model.Certificate, error) {
+	c, err := scanCertificate(q.QueryRow(`SELECT `+certificateColumns+` FROM certificates WHERE serial = $1`,
+		strings.ToUpper(strings.TrimSpace(serial))))
+	if err == sql.ErrNoRows {
+		return c, ErrCertificateNotFound
+	}
+	return c, err
+}
+
+// RevokeCertificate mencabut sertifikat, misalnya karena perhiasan dilebur, hilang atau dijual kembali ke toko
+func RevokeCertificate(q database.Querier, serial, alasan, actor string) (model.Certificate, error) {
+	c, err := GetCertificate(q, serial)
+	if err != nil {
+		return c, err
+	}
+	if c.Status == CertificateRevoked {
+		return c, ErrCertificateRevoked
+	}
+
+	err = q.QueryRow(`
+		UPDATE certificates SET status = $1, alasan_pencabutan = $2, revoked_at = NOW()
+		WHERE id = $3 RETURNING revoked_at`, CertificateRevoked, alasan, c.ID).Scan(&c.RevokedAt)
+	if err != nil {
+		return c, err
+	}
+	c.Status, c.AlasanPencabutan = CertificateRevoked, alasan
+
+	if c.OrderID == 0 {
+		return c, nil
+	}
+	return c, RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    c.OrderID,
+		Tipe:       EventNote,
+		Keterangan: fmt.Sprintf("Sertifikat %s dicabut: %s", c.Serial, alasan),
+		Actor:      actor,
+	})
+}
+
+// VerifyCertificate memeriksa serial dan kode verifikasi yang tercetak pada sertifikat.
+// Tanpa kode yang cocok hasilnya hanya berisi serial dan pesan, sehingga serial yang ditebak
+// tidak membuka data perhiasan. Data pemilik tidak pernah dikirim.
+func VerifyCertificate(q database.Querier, serial, kode string) (model.CertificateVerification, error) {
+	c, err := GetCertificate(q, serial)
+	if err != nil {
+		return model.CertificateVerification{}, err
+	}
+
+	v := model.CertificateVerification{Serial: c.Serial}
+	switch {
+	case kode == "":
+		v.Pesan = "Serial terdaftar. Masukkan kode verifikasi yang tercetak pada sertifikat untuk memastikan keasliannya."
+		return v, nil
+	case !hmac.Equal([]byte(normalizeCertificateCode(kode)), []byte(c.KodeVerifikasi)):
+		log.Printf("Certificate %s verified with wrong code", c.Serial)
+		v.Pesan = "Kode verifikasi tidak cocok. Sertifikat kemungkinan palsu atau datanya telah diubah."
+		return v, nil
+	}
+
+	issuedAt := c.IssuedAt
+	v.Status = c.Status
+	v.Nama = c.Nama
+	v.JenisPerhiasan = c.JenisPerhiasan
+	v.JenisEmas = c.JenisEmas
+	v.Karat = c.Karat
+	v.Kadar = c.Kadar
+	v.Berat = c.Berat
+	v.Batu = c.Batu
+	v.IssuedAt = &issuedAt
+	v.RevokedAt = c.RevokedAt
+	switch {
+	case c.Status == CertificateRevoked:
+		v.Pesan = "Sertifikat ini sudah dicabut dan tidak berlaku lagi."
+	default:
+		v.Asli = true
+		v.Pesan = "Sertifikat asli dan terdaftar di " + config.StoreName + "."
+	}
+	return v, nil
+}
+
+// CertificateFilename adalah nama file PDF sertifikat, misalnya SERTIFIKAT-AU25-7K3M9QX2.pdf
+func CertificateFilename(c model.Certificate) string {
+	return "SERTIFIKAT-" + c.Serial + ".pdf"
+}
+
+// RenderCertificatePDF membuat PDF sertifikat keaslian dengan spesifikasi perhiasan dan
+// QR code tautan verifikasi. Data pemilik sengaja tidak dicetak karena sertifikat ikut
+// berpindah tangan bersama perhiasannya.
+func RenderCertificatePDF(c model.Certificate) ([]byte, error) {
+	const left, right, center = 50.0, 545.0, 297.5
+	qr, err := encodeQR(CertificateVerifyURL(c))
+	if err != nil {
+		return nil, err
+	}
+
+	pdf := newPDF()
+	// Bingkai ganda
+	for _, inset := range []float64{30, 36} {
+		width := 2.0
+		if inset > 30 {
+			width = 0.5
+		}
+		pdf.Line(inset, inset, pdfPageWidth-inset, inset, width)
+		pdf.Line(inset, pdfPageHeight-inset, pdfPageWidth-inset, pdfPageHeight-inset, width)
+		pdf.Line(inset, inset, inset, pdfPageHeight-inset, width)
+		pdf.Line(pdfPageWidth-inset, inset, pdfPageWidth-inset, pdfPageHeight-inset, width)
+	}
+
+	pdf.TextCenter(center, 90, 14, true, config.StoreName)
+	if config.StoreAddress != "" {
+		pdf.TextCenter(center, 106, 9, false, config.StoreAddress)
+	}
+	pdf.TextCenter(center, 150, 24, true, "SERTIFIKAT KEASLIAN")
+	pdf.TextCenter(center, 170, 11, false, "Certificate of Authenticity")
+	pdf.Line(center-120, 184, center+120, 184, 1)
+	pdf.TextCenter(center, 210, 10, false, "Dengan ini kami menyatakan bahwa perhiasan dengan spesifikasi berikut")
+	pdf.TextCenter(center, 224, 10, false, "adalah asli dan diproduksi atau dijual oleh "+config.StoreName+".")
+
+	y := 270.0
+	spec := func(label, value string) {
+		pdf.Text(left+40, y, 11, false, label)
+		pdf.Text(left+190, y, 11, true, value)
+		y += 22
+	}
+	spec("Nomor Seri", c.Serial)
+	spec("Perhiasan", c.Nama)
+	if c.JenisPerhiasan != "" {
+		spec("Jenis Perhiasan", c.JenisPerhiasan)
+	}
+	spec("Jenis Emas", c.JenisEmas)
+	spec("Karat", fmt.Sprintf("%dK", c.Karat))
+	spec("Kadar Emas", strings.Replace(c.Kadar.String(), ".", ",", 1)+"%")
+	spec("Berat", formatGram(c.Berat))
+	if len(c.Batu) > 0 {
+		batu := make([]string, len(c.Batu))
+		for i, b := range c.Batu {
+			batu[i] = fmt.Sprintf("%s x%d", b.Jenis, b.Jumlah)
+		}
+		spec("Batu", strings.Join(batu, ", "))
+	}
+	spec("Tanggal Terbit", c.IssuedAt.Format("02-01-2006"))
+
+	// QR code verifikasi
+	const qrSize = 150.0
+	qrTop := 560.0
+	pdf.QRCode(center-qrSize/2, qrTop, qrSize, qr)
+	pdf.TextCenter(center, qrTop+qrSize+14, 9, true, "Pindai untuk memeriksa keaslian")
+	pdf.TextCenter(center, qrTop+qrSize+28, 9, false, "Kode verifikasi: "+c.KodeVerifikasi)
+	pdf.TextCenter(center, qrTop+qrSize+42, 8, false, strings.TrimRight(config.PublicBaseURL, "/")+"/verify/"+c.Serial)
+
+	pdf.Text(left, 790, 7, false, "Sertifikat ini berlaku untuk perhiasan dengan nomor seri di atas dan dapat diverifikasi kapan saja.")
+	pdf.TextRight(right, 790, 7, false, "Dicetak "+time.Now().Format("02-01-2006"))
+	return pdf.Bytes(), nil
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+
+	"github.com/lib/pq"
+)
+
+// Jenis lampiran pesanan
+const (
+	AttachmentReference = "reference" // foto referensi dari pelanggan
+	AttachmentSketch    = "sketch"    // sketsa dari staf
+	AttachmentRender    = "render"    // render 3D dari staf
+)
+
+// Status permintaan persetujuan desain
+const (
+	ApprovalPending    = "pending"
+	ApprovalApproved   = "approved"
+	ApprovalRejected   = "rejected"
+	ApprovalSuperseded = "superseded"
+)
+
+// MaxAttachmentSize adalah ukuran maksimal satu lampiran (10 MB)
+const MaxAttachmentSize = 10 << 20
+
+// attachmentTypes adalah ekstensi file yang boleh dilampirkan beserta content type-nya
+var attachmentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+	".pdf":  "application/pdf",
+	".glb":  "model/gltf-binary",
+	".stl":  "model/stl",
+}
+
+var (
+	ErrAttachmentType     = errors.New("jenis file tidak didukung, gunakan jpg, png, webp, pdf, glb atau stl")
+	ErrAttachmentNotFound = errors.New("lampiran tidak ditemukan")
+	ErrApprovalNotFound   = errors.New("permintaan persetujuan desain tidak ditemukan")
+	ErrApprovalAnswered   = errors.New("permintaan persetujuan desain sudah dijawab")
+	ErrApprovalAttachment = errors.New("persetujuan desain harus berisi sketsa atau render milik pesanan ini")
+	ErrDesignNotApproved  = errors.New("desain belum disetujui pelanggan")
+)
+
+// AttachmentContentType mengembalikan content type untuk nama file yang diizinkan
+func AttachmentContentType(filename string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	contentType, ok := attachmentTypes[ext]
+	if !ok {
+		return "", ErrAttachmentType
+	}
+	return contentType, nil
+}
+
+// SaveAttachment menyimpan file ke storage lalu mencatatnya pada pesanan
+func SaveAttachment(q database.Querier, storage Storage, att *model.OrderAttachment, r io.Reader) error {
+	contentType, err := AttachmentContentType(att.NamaFile)
+	if err != nil {
+		return err
+	}
+	att.ContentType = contentType
+
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	att.StorageKey = fmt.Sprintf("orders/%d/%s%s", att.OrderID, hex.EncodeToString(random), strings.ToLower(filepath.Ext(att.NamaFile)))
+
+	if err := storage.Put(att.StorageKey, att.ContentType, r); err != nil {
+		return err
+	}
+
+	return q.QueryRow(`
+		INSERT INTO order_attachments (custom_order_id, uploader_id, jenis, nama_file, content_type, ukuran, storage_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		att.OrderID, att.UploaderID, att.Jenis, att.NamaFile, att.ContentType, att.Ukuran, att.StorageKey).Scan(&att.ID, &att.CreatedAt)
+}
+
+const attachmentColumns = `id, custom_order_id, uploader_id, jenis, nama_file, content_type, ukuran, storage_key, created_at`
+
+func scanAttachment(row rowScanner) (model.OrderAttachment, error) {
+	var a model.OrderAttachment
+	err := row.Scan(&a.ID, &a.OrderID, &a.UploaderID, &a.Jenis, &a.NamaFile, &a.ContentType, &a.Ukuran, &a.StorageKey, &a.CreatedAt)
+	return a, err
+}
+
+// ListAttachments mengembalikan lampiran pesanan dari yang paling lama
+func ListAttachments(q database.Querier, orderID int) ([]model.OrderAttachment, error) {
+	rows, err := q.Query(`SELECT `+attachmentColumns+` FROM order_attachments WHERE custom_order_id = $1 ORDER BY created_at, id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []model.OrderAttachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// GetAttachment membaca satu lampiran milik pesanan
+func GetAttachment(q database.Querier, orderID, attachmentID int) (model.OrderAttachment, error) {
+	a, err := scanAttachment(q.QueryRow(`SELECT `+attachmentColumns+` FROM order_attachments WHERE id = $1 AND custom_order_id = $2`, attachmentID, orderID))
+	if err == sql.ErrNoRows {
+		return a, ErrAttachmentNotFound
+	}
+	return a, err
+}
+
+// RequestDesignApproval mengirim sketsa/render ke pelanggan untuk disetujui.
+// Permintaan lama yang belum dijawab diganti oleh permintaan baru.
+func RequestDesignApproval(q database.Querier, orderID int, attachmentIDs []int64, pesan, actor string) (model.DesignApproval, error) {
+	if len(attachmentIDs) == 0 {
+		return model.DesignApproval{}, ErrApprovalAttachment
+	}
+	var valid int
+	err := q.QueryRow(`
+		SELECT COUNT(*) FROM order_attachments
+		WHERE custom_order_id = $1 AND id = ANY($2) AND jenis IN ('sketch', 'render')`,
+		orderID, pq.Array(attachmentIDs)).Scan(&valid)
+	if err != nil {
+		return model.DesignApproval{}, err
+	}
+	if valid != len(attachmentIDs) {
+		return model.DesignApproval{}, ErrApprovalAttachment
+	}
+
+	if _, err := q.Exec(`
+		UPDATE design_approvals SET status = $1, responded_at = NOW()
+		WHERE custom_order_id = $2 AND status = $3`,
+		ApprovalSuperseded, orderID, ApprovalPending); err != nil {
+		return model.DesignApproval{}, err
+	}
+
+	approval := model.DesignApproval{
+		OrderID:       orderID,
+		AttachmentIDs: attachmentIDs,
+		Pesan:         pesan,
+		Status:        ApprovalPending,
+		RequestedBy:   actor,
+	}
+	err = q.QueryRow(`
+		INSERT INTO design_approvals (custom_order_id, attachment_ids, pesan, requested_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, requested_at`,
+		orderID, pq.Array(attachmentIDs), pesan, actor).Scan(&approval.ID, &approval.RequestedAt)
+	if err != nil {
+		return approval, err
+	}
+
+	return approval, RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    orderID,
+		Tipe:       EventNote,
+		Keterangan: "Desain dikirim untuk persetujuan pelanggan",
+		Actor:      actor,
+	})
+}
+
+// RespondDesignApproval mencatat jawaban pelanggan. Desain yang disetujui menyelesaikan
+// tahap persetujuan desain pada work order sehingga produksi bisa dimulai.
+func RespondDesignApproval(q database.Querier, orderID, approvalID int, approve bool, komentar, actor string) (model.DesignApproval, error) {
+	approval, err := scanApproval(q.QueryRow(`SELECT `+approvalColumns+` FROM design_approvals WHERE id = $1 AND custom_order_id = $2 FOR UPDATE`, approvalID, orderID))
+	if err == sql.ErrNoRows {
+		return approval, ErrApprovalNotFound
+	}
+	if err != nil {
+		return approval, err
+	}
+	if approval.Status != ApprovalPending {
+		return approval, ErrApprovalAnswered
+	}
+
+	now := time.Now()
+	approval.Status = ApprovalRejected
+	keterangan := "Pelanggan meminta revisi desain"
+	if approve {
+		approval.Status = ApprovalApproved
+		keterangan = "Pelanggan menyetujui desain"
+	}
+	approval.Komentar = komentar
+	approval.RespondedAt = &now
+	if komentar != "" {
+		keterangan += ": " + komentar
+	}
+
+	if _, err := q.Exec(`
+		UPDATE design_approvals SET status = $1, komentar = $2, responded_at = $3 WHERE id = $4`,
+		approval.Status, approval.Komentar, now, approval.ID); err != nil {
+		return approval, err
+	}
+	if err := RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    orderID,
+		Tipe:       EventNote,
+		Keterangan: keterangan,
+		Actor:      actor,
+	}); err != nil {
+		return approval, err
+	}
+
+	if !approve {
+		return approval, nil
+	}
+
+	// Selesaikan tahap persetujuan desain pada work order yang masih berjalan
+	rows, err := q.Query(`
+		SELECT wo.id FROM work_orders wo
+		JOIN work_order_stages s ON s.work_order_id = wo.id AND s.tahap = $1
+		WHERE wo.custom_order_id = $2 AND wo.status = $3 AND s.status IN ('pending', 'in_progress')`,
+		StageDesignApproval, orderID, WorkOrderOpen)
+	if err != nil {
+		return approval, err
+	}
+	var workOrderIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return approval, err
+		}
+		workOrderIDs = append(workOrderIDs, id)
+	}
+	rows.Close()
+
+	done := StageDone
+	for _, id := range workOrderIDs {
+		if _, err := UpdateWorkOrderStage(q, id, StageDesignApproval, StageUpdate{Status: &done}, actor); err != nil {
+			return approval, err
+		}
+	}
+	return approval, nil
+}
+
+const approvalColumns = `id, custom_order_id, attachment_ids, pesan, status, komentar, requested_by, requested_at, responded_at`
+
+func scanApproval(row rowScanner) (model.DesignApproval, error) {
+	var a model.DesignApproval
+	err := row.Scan(&a.ID, &a.OrderID, pq.Array(&a.AttachmentIDs), &a.Pesan, &a.Status, &a.Komentar, &a.RequestedBy, &a.RequestedAt, &a.RespondedAt)
+	return a, err
+}
+
+// ListDesignApprovals mengembalikan riwayat persetujuan desain pesanan
+func ListDesignApprovals(q database.Querier, orderID int) ([]model.DesignApproval, error) {
+	rows, err := q.Query(`SELECT `+approvalColumns+` FROM design_approvals WHERE custom_order_id = $1 ORDER BY requested_at, id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	approvals := []model.DesignApproval{}
+	for rows.Next() {
+		a, err := scanApproval(rows)
+		if err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, a)
+	}
+	return approvals, rows.Err()
+}
+
+// CheckDesignApproved mengembalikan ErrDesignNotApproved jika pesanan memiliki perhiasan
+// custom untuk diproduksi tetapi belum ada desain yang disetujui pelanggan
+func CheckDesignApproved(q database.Querier, orderID int) error {
+	var needsApproval, approved bool
+	err := q.QueryRow(`
+		SELECT
+			EXISTS (SELECT 1 FROM work_orders WHERE custom_order_id = $1 AND status <> 'cancelled'),
+			EXISTS (SELECT 1 FROM design_approvals WHERE custom_order_id = $1 AND status = 'approved')`,
+		orderID).Scan(&needsApproval, &approved)
+	if err != nil {
+		return err
+	}
+	if needsApproval && !approved {
+		return ErrDesignNotApproved
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+
+	"proyek3/config"
+	"proyek3/database"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// EmailAttachment adalah file yang dilampirkan pada email, misalnya nota PDF
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// SendEmail mengirim email HTML melalui SendGrid, dengan lampiran opsional
+func SendEmail(toEmail, subject, htmlContent string, attachments ...EmailAttachment) error {
+	from := mail.NewEmail("Your App", "fathir080604@gmail.com")
+	to := mail.NewEmail("", toEmail)
+
+	message := mail.NewSingleEmail(from, subject, to, "", htmlContent)
+	for _, a := range attachments {
+		attachment := mail.NewAttachment()
+		attachment.SetContent(base64.StdEncoding.EncodeToString(a.Content))
+		attachment.SetType(a.ContentType)
+		attachment.SetFilename(a.Filename)
+		attachment.SetDisposition("attachment")
+		message.AddAttachment(attachment)
+	}
+	client := sendgrid.NewSendClient(config.SendGridAPIKey)
+	resp, err := client.Send(message)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sendgrid status %d: %s", resp.StatusCode, resp.Body)
+	}
+	return nil
+}
+
+// NotifyOrderOwner mengirim email ke pemilik pesanan. Kegagalan hanya dicatat
+// supaya proses utama tidak ikut gagal.
+func NotifyOrderOwner(q database.Querier, orderID int, subject, htmlContent string) {
+	var email string
+	err := q.QueryRow(`
+		SELECT u.email FROM custom_orders o JOIN "user" u ON u.id = o.user_id
+		WHERE o.id = $1`, orderID).Scan(&email)
+	if err != nil {
+		log.Printf("Error finding owner email of order %d: %v", orderID, err)
+		return
+	}
+	if err := SendEmail(email, subject, htmlContent); err != nil {
+		log.Printf("Error sending email to owner of order %d: %v", orderID, err)
+	}
+}
+
+// NotifyAdmins mengirim email ke semua admin. Kegagalan hanya dicatat.
+func NotifyAdmins(q database.Querier, subject, htmlContent string) {
+	rows, err := q.Query(`SELECT email FROM "user" WHERE role = 'admin'`)
+	if err != nil {
+		log.Printf("Error finding admin emails: %v", err)
+		return
+	}
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err == nil {
+			emails = append(emails, email)
+		}
+	}
+	rows.Close()
+
+	for _, email := range emails {
+		if err := SendEmail(email, subject, htmlContent); err != nil {
+			log.Printf("Error sending email to admin %s: %v", email, err)
+		}
+	}
+}
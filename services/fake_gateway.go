@@ -0,0 +1,186 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FakeGateway adalah PaymentGateway di memori untuk pengujian checkout tanpa jaringan. Status
+// transaksi diubah lewat Simulate, yang mengirim webhook bertanda tangan seperti Midtrans.
+type FakeGateway struct {
+	BaseURL    string // alamat API, dipakai untuk RedirectURL simulasi
+	WebhookURL string
+	Client     *http.Client
+	// Notify mengirim body webhook; jika nil body di-POST ke WebhookURL
+	Notify func(body []byte) error
+
+	mu           sync.Mutex
+	seq          int
+	transactions map[string]*fakeTransaction
+}
+
+type fakeTransaction struct {
+	GatewayTransaction
+	grossAmount int64
+	refunded    int64
+	refundKeys  map[string]bool
+}
+
+// fakeStatusCode meniru status_code notifikasi Midtrans untuk setiap status transaksi
+func fakeStatusCode(transactionStatus string) string {
+	switch transactionStatus {
+	case "settlement", "capture", "refund", "partial_refund":
+		return "200"
+	case "pending":
+		return "201"
+	}
+	return "202"
+}
+
+// configure mengatur alamat API dan webhook; dipanggil setiap kali gateway fake dipilih
+func (g *FakeGateway) configure(baseURL, webhookURL string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.BaseURL, g.WebhookURL = baseURL, webhookURL
+}
+
+func (g *FakeGateway) CreateCharge(orderID string, grossAmount int64, customer PaymentCustomer) (PaymentCharge, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.transactions == nil {
+		g.transactions = make(map[string]*fakeTransaction)
+	}
+	if _, exists := g.transactions[orderID]; exists {
+		return PaymentCharge{}, fmt.Errorf("fake gateway: order_id %s sudah dipakai", orderID)
+	}
+	g.seq++
+	g.transactions[orderID] = &fakeTransaction{
+		GatewayTransaction: GatewayTransaction{
+			OrderID:           orderID,
+			TransactionID:     fmt.Sprintf("fake-%d", g.seq),
+			TransactionStatus: "pending",
+			GrossAmount:       strconv.FormatInt(grossAmount, 10) + ".00",
+		},
+		grossAmount: grossAmount,
+		refundKeys:  make(map[string]bool),
+	}
+	return PaymentCharge{
+		Token:       "fake-token-" + orderID,
+		RedirectURL: g.BaseURL + "/api/dev/payments/" + orderID,
+	}, nil
+}
+
+func (g *FakeGateway) GetStatus(orderID string) (GatewayTransaction, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	t, ok := g.transactions[orderID]
+	if !ok {
+		return GatewayTransaction{}, ErrGatewayTransactionNotFound
+	}
+	return t.GatewayTransaction, nil
+}
+
+// Cancel hanya mengubah transaksi pending; seperti Midtrans (412), transaksi yang sudah final ditolak
+func (g *FakeGateway) Cancel(orderID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	t, ok := g.transactions[orderID]
+	if !ok {
+		return nil
+	}
+	if t.TransactionStatus != "pending" {
+		return ErrGatewayTransactionFinal
+	}
+	t.TransactionStatus = "cancel"
+	return nil
+}
+
+func (g *FakeGateway) Refund(orderID, refundKey string, amount int64, reason string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	t, ok := g.transactions[orderID]
+	if !ok {
+		return ErrGatewayTransactionNotFound
+	}
+	if t.refundKeys[refundKey] {
+		return nil
+	}
+	if t.TransactionStatus != "settlement" && t.TransactionStatus != "partial_refund" {
+		return fmt.Errorf("%w: fake gateway: transaksi %s berstatus %s tidak bisa di-refund", ErrGatewayRejected, orderID, t.TransactionStatus)
+	}
+	if amount <= 0 || t.refunded+amount > t.grossAmount {
+		return fmt.Errorf("%w: fake gateway: refund %d melebihi sisa dana transaksi %s", ErrGatewayRejected, amount, orderID)
+	}
+	t.refundKeys[refundKey] = true
+	t.refunded += amount
+	t.TransactionStatus = "partial_refund"
+	if t.refunded == t.grossAmount {
+		t.TransactionStatus = "refund"
+	}
+	return nil
+}
+
+// Simulate mengubah status transaksi seolah-olah pelanggan membayar (settlement), gagal bayar
+// (deny, expire, cancel) atau dana dikembalikan, lalu mengirim notifikasi webhook yang
+// ditandatangani dengan server key. Body notifikasi dikembalikan untuk diperiksa.
+func (g *FakeGateway) Simulate(orderID, transactionStatus, paymentType string) ([]byte, error) {
+	g.mu.Lock()
+	t, ok := g.transactions[orderID]
+	if !ok {
+		g.mu.Unlock()
+		return nil, ErrGatewayTransactionNotFound
+	}
+	t.TransactionStatus = transactionStatus
+	t.FraudStatus = ""
+	if transactionStatus == "capture" {
+		t.FraudStatus = "accept"
+	}
+	if paymentType != "" {
+		t.PaymentType = paymentType
+	}
+	statusCode := fakeStatusCode(transactionStatus)
+	body, err := json.Marshal(map[string]string{
+		"transaction_time":   time.Now().Format("2006-01-02 15:04:05"),
+		"transaction_id":     t.TransactionID,
+		"order_id":           t.OrderID,
+		"transaction_status": t.TransactionStatus,
+		"fraud_status":       t.FraudStatus,
+		"status_code":        statusCode,
+		"gross_amount":       t.GrossAmount,
+		"payment_type":       t.PaymentType,
+		"signature_key":      MidtransSignature(t.OrderID, statusCode, t.GrossAmount),
+	})
+	webhookURL := g.WebhookURL
+	g.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return body, g.send(webhookURL, body)
+}
+
+// send mengirim webhook simulasi dan menganggap respons non-2xx sebagai kegagalan
+func (g *FakeGateway) send(webhookURL string, body []byte) error {
+	if g.Notify != nil {
+		return g.Notify(body)
+	}
+	resp, err := g.Client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook %s: %s %s", webhookURL, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"proyek3/config"
+)
+
+// newTestFakeGateway membuat gateway fake yang menampung body webhook simulasi
+func newTestFakeGateway(t *testing.T) (*FakeGateway, *[][]byte) {
+	t.Helper()
+	config.MidtransServerKey = "test-server-key"
+	var sent [][]byte
+	g := &FakeGateway{Notify: func(body []byte) error {
+		sent = append(sent, body)
+		return nil
+	}}
+	return g, &sent
+}
+
+func TestFakeGatewaySignedSettlement(t *testing.T) {
+	g, sent := newTestFakeGateway(t)
+	if _, err := g.CreateCharge("order-1", 150000, PaymentCustomer{Name: "Uji"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Simulate("order-1", "settlement", "bank_transfer"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("webhook terkirim %d kali, ingin 1", len(*sent))
+	}
+
+	n, err := ParseMidtransNotification((*sent)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.EffectiveStatus() != "settlement" || n.GrossAmount != "150000.00" || n.StatusCode != "200" {
+		t.Fatalf("notifikasi = %+v", n)
+	}
+	if n.SignatureKey != MidtransSignature(n.OrderID, n.StatusCode, n.GrossAmount) {
+		t.Fatal("signature_key tidak cocok dengan server key")
+	}
+}
+
+func TestFakeGatewayCancelSettledTransaction(t *testing.T) {
+	g, _ := newTestFakeGateway(t)
+	if _, err := g.CreateCharge("order-2", 100000, PaymentCustomer{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Simulate("order-2", "settlement", "qris"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Cancel("order-2"); !errors.Is(err, ErrGatewayTransactionFinal) {
+		t.Fatalf("Cancel transaksi settlement = %v, ingin ErrGatewayTransactionFinal", err)
+	}
+	if err := g.Cancel("order-tidak-ada"); err != nil {
+		t.Fatalf("Cancel transaksi yang belum dibuat = %v, ingin nil", err)
+	}
+}
+
+func TestFakeGatewayRefund(t *testing.T) {
+	g, _ := newTestFakeGateway(t)
+	if _, err := g.CreateCharge("order-3", 100000, PaymentCustomer{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Refund("order-3", "rf-1", 40000, "uji"); !errors.Is(err, ErrGatewayRejected) {
+		t.Fatalf("refund transaksi pending = %v, ingin ErrGatewayRejected", err)
+	}
+	if _, err := g.Simulate("order-3", "settlement", "qris"); err != nil {
+		t.Fatal(err)
+	}
+
+	// refund_key yang sama tidak me-refund dua kali
+	for i := 0; i < 2; i++ {
+		if err := g.Refund("order-3", "rf-1", 40000, "uji"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Refund("order-3", "rf-2", 70000, "uji"); !errors.Is(err, ErrGatewayRejected) {
+		t.Fatalf("refund melebihi sisa dana = %v, ingin ErrGatewayRejected", err)
+	}
+	if err := g.Refund("order-3", "rf-3", 60000, "uji"); err != nil {
+		t.Fatal(err)
+	}
+	transaction, err := g.GetStatus("order-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transaction.TransactionStatus != "refund" {
+		t.Fatalf("status transaksi = %s, ingin refund", transaction.TransactionStatus)
+	}
+}
@@ -0,0 +1,512 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"proyek3/config"
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Metode penyerahan pesanan
+const (
+	FulfillmentPickup  = "pickup"  // diambil di cabang dengan kode pengambilan
+	FulfillmentCourier = "courier" // dikirim kurir dengan asuransi
+)
+
+// Status pengiriman kurir
+const (
+	ShipmentInTransit = "in_transit"
+	ShipmentDelivered = "delivered"
+	ShipmentReturned  = "returned"
+)
+
+// PackagingWeight adalah berat kotak perhiasan dan kemasan yang ditambahkan ke berat paket
+const PackagingWeight model.Gram = 250 * model.MilligramsPerGram
+
+// pickupCodeChars tidak memuat karakter yang mudah tertukar seperti 0/O dan 1/I
+const pickupCodeChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var (
+	ErrInvalidFulfillment  = errors.New("data pengambilan atau pengiriman tidak valid")
+	ErrBranchNotFound      = errors.New("cabang tidak ditemukan")
+	ErrFulfillmentNotFound = errors.New("metode pengambilan pesanan belum dipilih")
+	ErrFulfillmentLocked   = errors.New("metode pengambilan hanya bisa diubah sebelum pesanan dibayar")
+	ErrFulfillmentMethod   = errors.New("metode pengambilan pesanan tidak sesuai")
+	ErrPickupCode          = errors.New("kode pengambilan salah")
+	ErrShipmentNotFound    = errors.New("pengiriman tidak ditemukan")
+	ErrShipmentStatus      = errors.New("status pengiriman tidak valid")
+)
+
+// FulfillmentRequest adalah pilihan pelanggan: ambil di cabang atau kirim dengan kurir
+type FulfillmentRequest struct {
+	Metode   string                  `json:"metode"`
+	BranchID int                     `json:"branch_id"`
+	Alamat   *model.AlamatPengiriman `json:"alamat"`
+	Kurir    string                  `json:"kurir"`
+	Layanan  string                  `json:"layanan"`
+}
+
+// ListBranches mengembalikan cabang aktif untuk pengambilan pesanan
+func ListBranches(q database.Querier) ([]model.Branch, error) {
+	rows, err := q.Query(`SELECT id, kode, nama, alamat, kota, telepon FROM branches WHERE aktif ORDER BY nama`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	branches := []model.Branch{}
+	for rows.Next() {
+		var b model.Branch
+		if err := rows.Scan(&b.ID, &b.Kode, &b.Nama, &b.Alamat, &b.Kota, &b.Telepon); err != nil {
+			return nil, err
+		}
+		branches = append(branches, b)
+	}
+	return branches, rows.Err()
+}
+
+func getBranch(q database.Querier, branchID int) (model.Branch, error) {
+	var b model.Branch
+	err := q.QueryRow(`SELECT id, kode, nama, alamat, kota, telepon FROM branches WHERE id = $1 AND aktif`, branchID).
+		Scan(&b.ID, &b.Kode, &b.Nama, &b.Alamat, &b.Kota, &b.Telepon)
+	if err == sql.ErrNoRows {
+		return b, ErrBranchNotFound
+	}
+	return b, err
+}
+
+// ShippingWeight menghitung berat paket pesanan: berat emas semua perhiasan ditambah kemasan
+func ShippingWeight(q database.Querier, orderID int) (model.Gram, error) {
+	var berat model.Gram
+	err := q.QueryRow(`
+		SELECT CASE WHEN COALESCE(o.tipe, 'custom') = 'cart'
+			THEN COALESCE((SELECT SUM(i.berat_emas * i.qty) FROM order_items i WHERE i.custom_order_id = o.id), 0)
+			ELSE COALESCE(o.berat_emas, 0) END
+		FROM custom_orders o WHERE o.id = $1`, orderID).Scan(&berat)
+	if err == sql.ErrNoRows {
+		return 0, ErrOrderNotFound
+	}
+	return berat + PackagingWeight, err
+}
+
+// orderShippingRequest menyiapkan permintaan tarif untuk paket pesanan.
+// Nilai asuransi adalah total pesanan tanpa ongkos kirim.
+func orderShippingRequest(q database.Querier, orderID int, alamat model.AlamatPengiriman, kurir string) (ShippingRateRequest, error) {
+	breakdown, _, err := orderBreakdown(q, orderID, false)
+	if err != nil {
+		return ShippingRateRequest{}, err
+	}
+	berat, err := ShippingWeight(q, orderID)
+	if err != nil {
+		return ShippingRateRequest{}, err
+	}
+	return ShippingRateRequest{
+		Asal:          config.ShippingOrigin,
+		Tujuan:        strings.TrimSpace(alamat.Kota),
+		KodePos:       strings.TrimSpace(alamat.KodePos),
+		Berat:         berat,
+		NilaiAsuransi: breakdown.Total - breakdown.Ongkir,
+		Kurir:         strings.TrimSpace(kurir),
+	}, nil
+}
+
+// ShippingRatesForOrder mengembalikan tarif kurir yang tersedia untuk paket pesanan ke alamat tujuan
+func ShippingRatesForOrder(q database.Querier, provider ShippingRateProvider, orderID int, alamat model.AlamatPengiriman, kurir string) ([]ShippingRate, error) {
+	if strings.TrimSpace(alamat.Kota) == "" {
+		return nil, fmt.Errorf("%w: kota tujuan wajib diisi", ErrInvalidFulfillment)
+	}
+	req, err := orderShippingRequest(q, orderID, alamat, kurir)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Rates(req)
+}
+
+// orderBreakdown membaca rincian harga pesanan beserta statusnya. Pesanan lama tanpa
+// rincian dianggap satu baris subtotal sebesar total harga.
+func orderBreakdown(q database.Querier, orderID int, forUpdate bool) (model.PriceBreakdown, string, error) {
+	query := `SELECT COALESCE(status, ''), total_harga, rincian_harga FROM custom_orders WHERE id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	var breakdown model.PriceBreakdown
+	var status string
+	var total model.Rupiah
+	var rincian []byte
+	err := q.QueryRow(query, orderID).Scan(&status, &total, &rincian)
+	if err == sql.ErrNoRows {
+		return breakdown, "", ErrOrderNotFound
+	}
+	if err != nil {
+		return breakdown, "", err
+	}
+	if len(rincian) > 0 {
+		if err := json.Unmarshal(rincian, &breakdown); err != nil {
+			return breakdown, "", err
+		}
+	} else {
+		breakdown = model.PriceBreakdown{Subtotal: total, Total: total}
+	}
+	return breakdown, status, nil
+}
+
+// ApplyShipping mengganti baris ongkos kirim pada rincian harga. Ongkos kirim tidak
+// dikenai pajak sehingga cukup ditambahkan ke total.
+func ApplyShipping(breakdown model.PriceBreakdown, lines []model.PriceLine) model.PriceBreakdown {
+	items := make([]model.PriceLine, 0, len(breakdown.Items)+len(lines))
+	for _, item := range breakdown.Items {
+		if item.Kode != "ongkir" {
+			items = append(items, item)
+		}
+	}
+	breakdown.Total -= breakdown.Ongkir
+	breakdown.Ongkir = 0
+	for _, line := range lines {
+		breakdown.Ongkir += line.Jumlah
+		items = append(items, line)
+	}
+	breakdown.Total += breakdown.Ongkir
+	breakdown.Items = items
+	return breakdown
+}
+
+func newPickupCode() (string, error) {
+	random := make([]byte, 6)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	code := make([]byte, len(random))
+	for i, b := range random {
+		code[i] = pickupCodeChars[int(b)%len(pickupCodeChars)]
+	}
+	return string(code), nil
+}
+
+// SetFulfillment menyimpan pilihan pengambilan atau pengiriman pesanan yang belum dibayar,
+// lalu memperbarui rincian dan total harga dengan ongkos kirim serta premi asuransi.
+// Transaksi pembayaran yang masih pending harus dibatalkan pemanggil karena totalnya berubah.
+func SetFulfillment(q database.Querier, provider ShippingRateProvider, orderID int, req FulfillmentRequest, actor string) (model.Fulfillment, model.PriceBreakdown, error) {
+	breakdown, status, err := orderBreakdown(q, orderID, true)
+	if err != nil {
+		return model.Fulfillment{}, breakdown, err
+	}
+	if status != OrderDraft && status != OrderAwaitingPayment {
+		return model.Fulfillment{}, breakdown, ErrFulfillmentLocked
+	}
+	// Jadwal cicilan dihitung dari total saat dibuat sehingga total tidak boleh berubah lagi
+	if active, err := HasActivePaymentSchedule(q, orderID); err != nil {
+		return model.Fulfillment{}, breakdown, err
+	} else if active {
+		return model.Fulfillment{}, breakdown, ErrScheduleActive
+	}
+
+	f := model.Fulfillment{OrderID: orderID, Metode: req.Metode}
+	var lines []model.PriceLine
+	var keterangan string
+	switch req.Metode {
+	case FulfillmentPickup:
+		branch, err := getBranch(q, req.BranchID)
+		if err != nil {
+			return f, breakdown, err
+		}
+		f.BranchID = branch.ID
+		f.Branch = &branch
+		if f.KodePickup, err = newPickupCode(); err != nil {
+			return f, breakdown, err
+		}
+		keterangan = "Pesanan akan diambil di cabang " + branch.Nama
+
+	case FulfillmentCourier:
+		if req.Alamat == nil {
+			return f, breakdown, fmt.Errorf("%w: alamat pengiriman wajib diisi", ErrInvalidFulfillment)
+		}
+		alamat := *req.Alamat
+		alamat.NamaPenerima = strings.TrimSpace(alamat.NamaPenerima)
+		alamat.Telepon = strings.TrimSpace(alamat.Telepon)
+		alamat.Alamat = strings.TrimSpace(alamat.Alamat)
+		alamat.Kota = strings.TrimSpace(alamat.Kota)
+		alamat.KodePos = strings.TrimSpace(alamat.KodePos)
+		if alamat.NamaPenerima == "" || alamat.Telepon == "" || alamat.Alamat == "" || alamat.Kota == "" {
+			return f, breakdown, fmt.Errorf("%w: nama penerima, telepon, alamat dan kota wajib diisi", ErrInvalidFulfillment)
+		}
+		if strings.TrimSpace(req.Kurir) == "" || strings.TrimSpace(req.Layanan) == "" {
+			return f, breakdown, fmt.Errorf("%w: kurir dan layanan wajib dipilih", ErrInvalidFulfillment)
+		}
+
+		rateReq := ShippingRateRequest{
+			Asal:          config.ShippingOrigin,
+			Tujuan:        alamat.Kota,
+			KodePos:       alamat.KodePos,
+			NilaiAsuransi: breakdown.Total - breakdown.Ongkir + breakdown.TukarTambah + breakdown.TabunganEmas,
+			Kurir:         strings.TrimSpace(req.Kurir),
+		}
+		if rateReq.Berat, err = ShippingWeight(q, orderID); err != nil {
+			return f, breakdown, err
+		}
+		rate, err := FindShippingRate(provider, rateReq, strings.TrimSpace(req.Layanan))
+		if err != nil {
+			return f, breakdown, err
+		}
+
+		f.Alamat = &alamat
+		f.Kurir = rate.Kurir
+		f.Layanan = rate.Layanan
+		f.Estimasi = rate.Estimasi
+		f.Berat = rateReq.Berat
+		f.NilaiAsuransi = rateReq.NilaiAsuransi
+		f.Ongkir = rate.Ongkir
+		f.BiayaAsuransi = rate.Asuransi
+		lines = append(lines, model.PriceLine{
+			Kode:       "ongkir",
+			Keterangan: fmt.Sprintf("Ongkos kirim %s %s ke %s (%s kg)", rate.Kurir, rate.Layanan, alamat.Kota, f.Berat),
+			Jumlah:     rate.Ongkir,
+		})
+		if rate.Asuransi > 0 {
+			lines = append(lines, model.PriceLine{
+				Kode:       "ongkir",
+				Keterangan: fmt.Sprintf("Asuransi pengiriman (nilai barang %s)", f.NilaiAsuransi),
+				Jumlah:     rate.Asuransi,
+			})
+		}
+		keterangan = fmt.Sprintf("Pesanan akan dikirim dengan %s %s ke %s", rate.Kurir, rate.Layanan, alamat.Kota)
+
+	default:
+		return f, breakdown, fmt.Errorf("%w: metode harus pickup atau courier", ErrInvalidFulfillment)
+	}
+
+	breakdown = ApplyShipping(breakdown, lines)
+	rincian, err := json.Marshal(breakdown)
+	if err != nil {
+		return f, breakdown, err
+	}
+	if _, err := q.Exec(`UPDATE custom_orders SET total_harga = $1, rincian_harga = $2, updated_at = NOW() WHERE id = $3`,
+		breakdown.Total, rincian, orderID); err != nil {
+		return f, breakdown, err
+	}
+
+	var alamat model.AlamatPengiriman
+	if f.Alamat != nil {
+		alamat = *f.Alamat
+	}
+	err = q.QueryRow(`
+		INSERT INTO order_fulfillments (custom_order_id, metode, branch_id, kode_pickup, nama_penerima, telepon, alamat,
+			kota, kode_pos, kurir, layanan, estimasi, berat, nilai_asuransi, ongkir, biaya_asuransi)
+		VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (custom_order_id) DO UPDATE SET
+			metode = EXCLUDED.metode, branch_id = EXCLUDED.branch_id, kode_pickup = EXCLUDED.kode_pickup,
+			nama_penerima = EXCLUDED.nama_penerima, telepon = EXCLUDED.telepon, alamat = EXCLUDED.alamat,
+			kota = EXCLUDED.kota, kode_pos = EXCLUDED.kode_pos, kurir = EXCLUDED.kurir, layanan = EXCLUDED.layanan,
+			estimasi = EXCLUDED.estimasi, berat = EXCLUDED.berat, nilai_asuransi = EXCLUDED.nilai_asuransi,
+			ongkir = EXCLUDED.ongkir, biaya_asuransi = EXCLUDED.biaya_asuransi, updated_at = NOW()
+		RETURNING updated_at`,
+		orderID, f.Metode, f.BranchID, f.KodePickup, alamat.NamaPenerima, alamat.Telepon, alamat.Alamat,
+		alamat.Kota, alamat.KodePos, f.Kurir, f.Layanan, f.Estimasi, f.Berat, f.NilaiAsuransi, f.Ongkir, f.BiayaAsuransi).Scan(&f.UpdatedAt)
+	if err != nil {
+		return f, breakdown, err
+	}
+
+	return f, breakdown, RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    orderID,
+		Tipe:       EventNote,
+		Keterangan: keterangan,
+		Actor:      actor,
+	})
+}
+
+const fulfillmentColumns = `custom_order_id, metode, COALESCE(branch_id, 0), kode_pickup, nama_penerima, telepon, alamat,
+	kota, kode_pos, kurir, layanan, estimasi, berat, nilai_asuransi, ongkir, biaya_asuransi, picked_up_at, updated_at`
+
+func scanFulfillment(row rowScanner) (model.Fulfillment, error) {
+	var f model.Fulfillment
+	var alamat model.AlamatPengiriman
+	err := row.Scan(&f.OrderID, &f.Metode, &f.BranchID, &f.KodePickup, &alamat.NamaPenerima, &alamat.Telepon, &alamat.Alamat,
+		&alamat.Kota, &alamat.KodePos, &f.Kurir, &f.Layanan, &f.Estimasi, &f.Berat, &f.NilaiAsuransi, &f.Ongkir, &f.BiayaAsuransi,
+		&f.PickedUpAt, &f.UpdatedAt)
+	if f.Metode == FulfillmentCourier {
+		f.Alamat = &alamat
+	}
+	return f, err
+}
+
+// GetFulfillment membaca pilihan pengambilan pesanan beserta cabang dan riwayat pengirimannya
+func GetFulfillment(q database.Querier, orderID int) (model.Fulfillment, error) {
+	f, err := scanFulfillment(q.QueryRow(`SELECT `+fulfillmentColumns+` FROM order_fulfillments WHERE custom_order_id = $1`, orderID))
+	if err == sql.ErrNoRows {
+		return f, ErrFulfillmentNotFound
+	}
+	if err != nil {
+		return f, err
+	}
+
+	if f.BranchID != 0 {
+		var branch model.Branch
+		err := q.QueryRow(`SELECT id, kode, nama, alamat, kota, telepon FROM branches WHERE id = $1`, f.BranchID).
+			Scan(&branch.ID, &branch.Kode, &branch.Nama, &branch.Alamat, &branch.Kota, &branch.Telepon)
+		if err != nil {
+			return f, err
+		}
+		f.Branch = &branch
+	}
+
+	f.Shipments, err = ListShipments(q, orderID)
+	return f, err
+}
+
+// ConfirmPickup mencocokkan kode pengambilan dari pelanggan lalu menandai pesanan sudah diambil.
+// Seperti paket yang diterima kurir, pesanan yang sudah diambil langsung selesai.
+func ConfirmPickup(q database.Querier, orderID int, kode, actor string) (model.Fulfillment, error) {
+	f, err := scanFulfillment(q.QueryRow(`SELECT `+fulfillmentColumns+` FROM order_fulfillments WHERE custom_order_id = $1 FOR UPDATE`, orderID))
+	if err == sql.ErrNoRows {
+		return f, ErrFulfillmentNotFound
+	}
+	if err != nil {
+		return f, err
+	}
+	if f.Metode != FulfillmentPickup {
+		return f, ErrFulfillmentMethod
+	}
+	kode = strings.ToUpper(strings.TrimSpace(kode))
+	if subtle.ConstantTimeCompare([]byte(kode), []byte(f.KodePickup)) != 1 {
+		return f, ErrPickupCode
+	}
+
+	if err := TransitionOrder(q, orderID, OrderPickedUp, actor, "Pesanan diambil pelanggan di cabang"); err != nil {
+		return f, err
+	}
+	if err := TransitionOrder(q, orderID, OrderCompleted, actor, "Pesanan selesai"); err != nil {
+		return f, err
+	}
+	now := time.Now()
+	f.PickedUpAt = &now
+	_, err = q.Exec(`UPDATE order_fulfillments SET picked_up_at = $1, updated_at = $1 WHERE custom_order_id = $2`, now, orderID)
+	return f, err
+}
+
+const shipmentColumns = `id, custom_order_id, kurir, layanan, no_resi, nilai_asuransi, status, catatan, shipped_at, delivered_at, updated_at`
+
+func scanShipment(row rowScanner) (model.Shipment, error) {
+	var s model.Shipment
+	err := row.Scan(&s.ID, &s.OrderID, &s.Kurir, &s.Layanan, &s.NoResi, &s.NilaiAsuransi, &s.Status, &s.Catatan,
+		&s.ShippedAt, &s.DeliveredAt, &s.UpdatedAt)
+	return s, err
+}
+
+// ListShipments mengembalikan riwayat pengiriman pesanan
+func ListShipments(q database.Querier, orderID int) ([]model.Shipment, error) {
+	rows, err := q.Query(`SELECT `+shipmentColumns+` FROM shipments WHERE custom_order_id = $1 ORDER BY shipped_at, id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shipments := []model.Shipment{}
+	for rows.Next() {
+		s, err := scanShipment(rows)
+		if err != nil {
+			return nil, err
+		}
+		shipments = append(shipments, s)
+	}
+	return shipments, rows.Err()
+}
+
+// CreateShipment mencatat paket yang diserahkan ke kurir dan mengubah pesanan menjadi shipped.
+// Kurir dan layanan kosong diambil dari pilihan pelanggan; nilai asuransi mengikuti nilai barang.
+func CreateShipment(q database.Querier, orderID int, kurir, layanan, noResi, actor string) (model.Shipment, error) {
+	s := model.Shipment{
+		OrderID: orderID,
+		Kurir:   strings.TrimSpace(kurir),
+		Layanan: strings.TrimSpace(layanan),
+		NoResi:  strings.TrimSpace(noResi),
+		Status:  ShipmentInTransit,
+	}
+	if s.NoResi == "" {
+		return s, fmt.Errorf("%w: nomor resi wajib diisi", ErrInvalidFulfillment)
+	}
+
+	f, err := GetFulfillment(q, orderID)
+	switch {
+	case errors.Is(err, ErrFulfillmentNotFound):
+		// Pesanan lama tanpa pilihan pengiriman diasuransikan sebesar total harga
+		breakdown, _, err := orderBreakdown(q, orderID, false)
+		if err != nil {
+			return s, err
+		}
+		s.NilaiAsuransi = breakdown.Total - breakdown.Ongkir
+	case err != nil:
+		return s, err
+	case f.Metode != FulfillmentCourier:
+		return s, ErrFulfillmentMethod
+	default:
+		if s.Kurir == "" {
+			s.Kurir = f.Kurir
+		}
+		if s.Layanan == "" {
+			s.Layanan = f.Layanan
+		}
+		s.NilaiAsuransi = f.NilaiAsuransi
+	}
+	if s.Kurir == "" {
+		return s, fmt.Errorf("%w: kurir wajib diisi", ErrInvalidFulfillment)
+	}
+
+	if err := TransitionOrder(q, orderID, OrderShipped, actor, fmt.Sprintf("Dikirim dengan %s %s, resi %s", s.Kurir, s.Layanan, s.NoResi)); err != nil {
+		return s, err
+	}
+	err = q.QueryRow(`
+		INSERT INTO shipments (custom_order_id, kurir, layanan, no_resi, nilai_asuransi, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, shipped_at, updated_at`,
+		orderID, s.Kurir, s.Layanan, s.NoResi, s.NilaiAsuransi, s.Status).Scan(&s.ID, &s.ShippedAt, &s.UpdatedAt)
+	return s, err
+}
+
+// UpdateShipmentStatus mencatat paket diterima atau dikembalikan kurir. Paket yang diterima
+// menyelesaikan pesanan; paket yang kembali mengembalikan pesanan ke status ready untuk dikirim ulang.
+func UpdateShipmentStatus(q database.Querier, shipmentID int, status, catatan, actor string) (model.Shipment, error) {
+	s, err := scanShipment(q.QueryRow(`SELECT `+shipmentColumns+` FROM shipments WHERE id = $1 FOR UPDATE`, shipmentID))
+	if err == sql.ErrNoRows {
+		return s, ErrShipmentNotFound
+	}
+	if err != nil {
+		return s, err
+	}
+	if s.Status != ShipmentInTransit {
+		return s, fmt.Errorf("%w: pengiriman sudah %s", ErrShipmentStatus, s.Status)
+	}
+
+	var orderStatus, note string
+	switch status {
+	case ShipmentDelivered:
+		orderStatus, note = OrderCompleted, "Paket diterima pelanggan, resi "+s.NoResi
+	case ShipmentReturned:
+		orderStatus, note = OrderReady, "Paket dikembalikan kurir, resi "+s.NoResi
+	default:
+		return s, fmt.Errorf("%w: status harus delivered atau returned", ErrShipmentStatus)
+	}
+	if catatan != "" {
+		note += ": " + catatan
+	}
+	if err := TransitionOrder(q, s.OrderID, orderStatus, actor, note); err != nil {
+		return s, err
+	}
+
+	now := time.Now()
+	s.Status = status
+	s.Catatan = catatan
+	s.UpdatedAt = now
+	if status == ShipmentDelivered {
+		s.DeliveredAt = &now
+	}
+	_, err = q.Exec(`UPDATE shipments SET status = $1, catatan = $2, delivered_at = $3, updated_at = $4 WHERE id = $5`,
+		s.Status, s.Catatan, s.DeliveredAt, now, s.ID)
+	return s, err
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"proyek3/config"
+	"proyek3/database"
+	"proyek3/model"
+)
+
+var ErrInvoiceNotFound = errors.New("nota belum diterbitkan untuk pesanan ini")
+
+// paymentTypeLabels adalah nama metode pembayaran Midtrans yang dicetak di nota
+var paymentTypeLabels = map[string]string{
+	"bank_transfer": "Transfer Bank (Virtual Account)",
+	"echannel":      "Mandiri Bill Payment",
+	"permata":       "Permata Virtual Account",
+	"credit_card":   "Kartu Kredit",
+	"gopay":         "GoPay",
+	"shopeepay":     "ShopeePay",
+	"qris":          "QRIS",
+	"cstore":        "Gerai Retail",
+	"akulaku":       "Akulaku",
+	"trade_in":      "Kredit Tukar Tambah",
+	"savings":       "Tabungan Emas",
+}
+
+// PaymentTypeLabel mengembalikan nama metode pembayaran untuk payment_type Midtrans
+func PaymentTypeLabel(paymentType string) string {
+	if label, ok := paymentTypeLabels[paymentType]; ok {
+		return label
+	}
+	if paymentType == "" {
+		return "-"
+	}
+	return paymentType
+}
+
+// loadOrderSnapshot membaca pesanan lengkap dengan item dan rincian harganya
+func loadOrderSnapshot(q database.Querier, orderID int) (model.Order, error) {
+	var order model.Order
+	var batu, personalisasi, rincian []byte
+	err := q.QueryRow(`
+		SELECT id, COALESCE(tipe, 'custom'), user_id, COALESCE(jenis_perhiasan, ''), COALESCE(jenis_emas, ''),
+			COALESCE(berat_emas, 0), COALESCE(campuran_tambahan, ''), COALESCE(persentase_emas, 0), total_harga,
+			COALESCE(status, ''), COALESCE(price_sheet_version, ''), batu, personalisasi, rincian_harga,
+			COALESCE(order_id, ''), created_at
+		FROM custom_orders WHERE id = $1`, orderID).Scan(
+		&order.ID, &order.Tipe, &order.UserID, &order.JenisPerhiasan, &order.JenisEmas,
+		&order.BeratEmas, &order.CampuranTambahan, &order.PersentaseEmas, &order.TotalHarga,
+		&order.Status, &order.PriceSheetVersion, &batu, &personalisasi, &rincian,
+		&order.MidtransOrderID, &order.CreatedAt)
+	if err == sql.ErrNoRows {
+		return order, ErrOrderNotFound
+	}
+	if err != nil {
+		return order, err
+	}
+	if len(batu) > 0 {
+		if err := json.Unmarshal(batu, &order.Batu); err != nil {
+			return order, err
+		}
+	}
+	if order.Personalisasi, err = DecodePersonalisasi(personalisasi); err != nil {
+		return order, err
+	}
+	if len(rincian) > 0 {
+		order.Rincian = &model.PriceBreakdown{}
+		if err := json.Unmarshal(rincian, order.Rincian); err != nil {
+			return order, err
+		}
+	}
+	if order.Tipe == OrderTypeCart {
+		if order.Items, err = OrderItems(q, orderID); err != nil {
+			return order, err
+		}
+	}
+	return order, nil
+}
+
+// nextInvoiceNumber mengambil nomor nota berikutnya untuk tahun tertentu. Baris penghitung
+// terkunci sampai transaksi selesai sehingga nomor tidak dobel dan tidak bolong.
+func nextInvoiceNumber(q database.Querier, year int) (string, error) {
+	var seq int
+	err := q.QueryRow(`
+		INSERT INTO invoice_counters (tahun, nomor_terakhir) VALUES ($1, 1)
+		ON CONFLICT (tahun) DO UPDATE SET nomor_terakhir = invoice_counters.nomor_terakhir + 1
+		RETURNING nomor_terakhir`, year).Scan(&seq)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("INV/%d/%06d", year, seq), nil
+}
+
+// IssueInvoice menerbitkan nota untuk pesanan yang sudah lunas. Pemanggilan berulang
+// mengembalikan nota yang sudah ada (created false) sehingga aman dipanggil dari webhook.
+func IssueInvoice(q database.Querier, orderID int, paymentOrderID, paymentType string) (invoice model.Invoice, created bool, err error) {
+	invoice, err = GetInvoice(q, orderID)
+	if !errors.Is(err, ErrInvoiceNotFound) {
+		return invoice, false, err
+	}
+
+	order, err := loadOrderSnapshot(q, orderID)
+	if err != nil {
+		return invoice, false, err
+	}
+	invoice = model.Invoice{
+		OrderID:          orderID,
+		PaymentOrderID:   paymentOrderID,
+		MetodePembayaran: PaymentTypeLabel(paymentType),
+		Total:            order.TotalHarga,
+		Pesanan:          order,
+		IssuedAt:         time.Now(),
+	}
+	if invoice.PaymentOrderID == "" {
+		invoice.PaymentOrderID = order.MidtransOrderID
+	}
+	err = q.QueryRow(`SELECT name, email FROM "user" WHERE id = $1`, order.UserID).Scan(&invoice.NamaPelanggan, &invoice.EmailPelanggan)
+	if err != nil {
+		return invoice, false, err
+	}
+
+	if invoice.Nomor, err = nextInvoiceNumber(q, invoice.IssuedAt.Year()); err != nil {
+		return invoice, false, err
+	}
+	data, err := json.Marshal(invoice.Pesanan)
+	if err != nil {
+		return invoice, false, err
+	}
+	err = q.QueryRow(`
+		INSERT INTO invoices (custom_order_id, nomor, payment_order_id, metode_pembayaran, nama_pelanggan,
+			email_pelanggan, total, pesanan, issued_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`,
+		orderID, invoice.Nomor, invoice.PaymentOrderID, invoice.MetodePembayaran, invoice.NamaPelanggan,
+		invoice.EmailPelanggan, invoice.Total, data, invoice.IssuedAt).Scan(&invoice.ID)
+	if err != nil {
+		return invoice, false, err
+	}
+
+	return invoice, true, RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    orderID,
+		Tipe:       EventNote,
+		Keterangan: "Nota " + invoice.Nomor + " diterbitkan",
+		Actor:      ActorSystem,
+	})
+}
+
+// GetInvoice membaca nota pesanan
+func GetInvoice(q database.Querier, orderID int) (model.Invoice, error) {
+	var invoice model.Invoice
+	var data []byte
+	err := q.QueryRow(`
+		SELECT id, custom_order_id, nomor, payment_order_id, metode_pembayaran, nama_pelanggan, email_pelanggan,
+			total, pesanan, issued_at
+		FROM invoices WHERE custom_order_id = $1`, orderID).Scan(
+		&invoice.ID, &invoice.OrderID, &invoice.Nomor, &invoice.PaymentOrderID, &invoice.MetodePembayaran,
+		&invoice.NamaPelanggan, &invoice.EmailPelanggan, &invoice.Total, &data, &invoice.IssuedAt)
+	if err == sql.ErrNoRows {
+		return invoice, ErrInvoiceNotFound
+	}
+	if err != nil {
+		return invoice, err
+	}
+	return invoice, json.Unmarshal(data, &invoice.Pesanan)
+}
+
+// InvoiceFilename adalah nama file PDF nota, misalnya INV-2025-000012.pdf
+func InvoiceFilename(invoice model.Invoice) string {
+	return strings.ReplaceAll(invoice.Nomor, "/", "-") + ".pdf"
+}
+
+// FormatRupiah menulis nominal dengan pemisah ribuan titik, misalnya "Rp 1.250.000"
+func FormatRupiah(r model.Rupiah) string {
+	digits := r.String()
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	var b strings.Builder
+	for i, c := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(c)
+	}
+	return sign + "Rp " + b.String()
+}
+
+// formatGram menulis berat dengan koma desimal, misalnya "5,125 g"
+func formatGram(g model.Gram) string {
+	return strings.Replace(g.String(), ".", ",", 1) + " g"
+}
+
+// RenderInvoicePDF membuat PDF nota dengan kop toko, rincian emas per item dan rincian harga
+func RenderInvoicePDF(invoice model.Invoice) []byte {
+	const left, right = 50.0, 545.0
+	pdf := newPDF()
+	order := invoice.Pesanan
+
+	// Kop toko
+	pdf.Text(left, 60, 18, true, config.StoreName)
+	y := 76.0
+	for _, line := range []string{config.StoreAddress, config.StorePhone} {
+		if line != "" {
+			pdf.Text(left, y, 9, false, line)
+			y += 12
+		}
+	}
+	if config.StoreNPWP != "" {
+		pdf.Text(left, y, 9, false, "NPWP: "+config.StoreNPWP)
+	}
+	pdf.TextRight(right, 60, 16, true, "NOTA PEMBELIAN")
+	pdf.TextRight(right, 76, 9, false, "No. "+invoice.Nomor)
+	pdf.TextRight(right, 88, 9, false, "Tanggal "+invoice.IssuedAt.Format("02-01-2006 15:04"))
+	pdf.TextRight(right, 100, 9, true, "LUNAS")
+	pdf.Line(left, 112, right, 112, 1)
+
+	// Pelanggan dan pembayaran
+	pdf.Text(left, 130, 9, true, "Kepada")
+	pdf.Text(left, 143, 9, false, invoice.NamaPelanggan)
+	pdf.Text(left, 155, 9, false, invoice.EmailPelanggan)
+	pdf.Text(320, 130, 9, true, "Pembayaran")
+	pdf.Text(320, 143, 9, false, "Pesanan #"+fmt.Sprint(order.ID))
+	pdf.Text(320, 155, 9, false, "Metode: "+invoice.MetodePembayaran)
+	pdf.Text(320, 167, 9, false, "Ref: "+invoice.PaymentOrderID)
+
+	// Detail emas per perhiasan
+	y = 192
+	pdf.FillRect(left, y-11, right-left, 16, 0.9)
+	columns := []struct {
+		title string
+		x     float64
+		right bool
+	}{
+		{"Perhiasan", left + 4, false},
+		{"Kadar", 250, false},
+		{"Berat", 350, true},
+		{"Harga/gram", 430, true},
+		{"Qty", 460, true},
+		{"Jumlah", right - 4, true},
+	}
+	for _, c := range columns {
+		if c.right {
+			pdf.TextRight(c.x, y, 9, true, c.title)
+		} else {
+			pdf.Text(c.x, y, 9, true, c.title)
+		}
+	}
+	y += 18
+
+	row := func(nama, kadar string, berat model.Gram, perGram model.Rupiah, qty int, jumlah model.Rupiah) {
+		pdf.Text(left+4, y, 9, false, nama)
+		pdf.Text(250, y, 9, false, kadar)
+		pdf.TextRight(350, y, 9, false, formatGram(berat))
+		if perGram > 0 {
+			pdf.TextRight(430, y, 9, false, FormatRupiah(perGram))
+		}
+		pdf.TextRight(460, y, 9, false, fmt.Sprint(qty))
+		pdf.TextRight(right-4, y, 9, false, FormatRupiah(jumlah))
+		y += 14
+	}
+	detail := func(text string) {
+		pdf.Text(left+14, y, 8, false, text)
+		y += 12
+	}
+
+	if order.Tipe == OrderTypeCart {
+		for _, item := range order.Items {
+			var perGram model.Rupiah
+			if item.Rincian != nil {
+				perGram = item.Rincian.HargaPerGram
+			}
+			kadar := item.JenisEmas
+			if item.PersentaseEmas > 0 {
+				kadar += " (" + item.PersentaseEmas.String() + "%)"
+			}
+			row(item.Nama, kadar, item.BeratEmas, perGram, item.Qty, item.Subtotal)
+		}
+	} else {
+		var perGram, jumlah model.Rupiah
+		if order.Rincian != nil {
+			perGram = order.Rincian.HargaPerGram
+			jumlah = order.Rincian.NilaiEmas + order.Rincian.PenyesuaianKadar
+			if perGram == 0 && order.BeratEmas > 0 {
+				perGram, _ = order.Rincian.NilaiEmas.MulRatio(model.MilligramsPerGram, int64(order.BeratEmas)) // hanya tampilan
+			}
+		}
+		row(order.JenisPerhiasan+" custom", order.JenisEmas+" ("+order.PersentaseEmas.String()+"%)", order.BeratEmas, perGram, 1, jumlah)
+		if order.CampuranTambahan != "" {
+			detail("Campuran: " + order.CampuranTambahan)
+		}
+		for _, b := range order.Batu {
+			detail(fmt.Sprintf("Batu %s x%d", b.Jenis, b.Jumlah))
+		}
+		if p := order.Personalisasi; p != nil {
+			if p.Ukiran != nil {
+				detail(fmt.Sprintf("Ukiran %s (%s): \"%s\"", p.Ukiran.Font, p.Ukiran.Letak, p.Ukiran.Teks))
+			}
+			if p.UkuranCincin != nil {
+				detail(fmt.Sprintf("Ukuran cincin %s %s", p.UkuranCincin.Standar, p.UkuranCincin.Ukuran))
+			}
+			if p.Finishing != "" {
+				detail("Finishing " + p.Finishing)
+			}
+		}
+	}
+	pdf.Line(left, y-6, right, y-6, 0.5)
+
+	// Rincian harga: ongkos pembuatan, batu, diskon, pajak dan ongkos kirim
+	y += 10
+	pdf.Text(left, y, 10, true, "Rincian Harga")
+	y += 16
+	if order.Rincian != nil {
+		for _, line := range order.Rincian.Items {
+			for i, text := range pdf.WrapText(line.Keterangan, 9, false, 330) {
+				if y > 770 {
+					pdf.AddPage()
+					y = 60
+				}
+				pdf.Text(left+4, y, 9, false, text)
+				if i == 0 {
+					pdf.TextRight(right-4, y, 9, false, FormatRupiah(line.Jumlah))
+				}
+				y += 13
+			}
+		}
+	}
+	pdf.Line(330, y-4, right, y-4, 0.5)
+	y += 10
+	pdf.Text(330, y, 11, true, "TOTAL")
+	pdf.TextRight(right-4, y, 11, true, FormatRupiah(invoice.Total))
+
+	// Catatan kaki
+	y += 40
+	if y > 780 {
+		pdf.AddPage()
+		y = 60
+	}
+	if order.PriceSheetVersion != "" {
+		pdf.Text(left, y, 8, false, "Harga emas mengikuti daftar harga versi "+order.PriceSheetVersion+".")
+		y += 11
+	}
+	pdf.Text(left, y, 8, false, "Nota ini dicetak oleh sistem dan sah tanpa tanda tangan. Simpan nota ini untuk penjualan kembali atau tukar tambah.")
+	return pdf.Bytes()
+}
+
+// SendInvoiceEmail mengirim konfirmasi pembayaran dengan nota PDF terlampir.
+// Kegagalan hanya dicatat supaya webhook tetap berhasil.
+func SendInvoiceEmail(invoice model.Invoice) {
+	html := fmt.Sprintf("<p>Terima kasih, pembayaran pesanan #%d sebesar %s sudah kami terima.</p><p>Nota %s terlampir dalam email ini.</p>",
+		invoice.OrderID, FormatRupiah(invoice.Total), invoice.Nomor)
+	err := SendEmail(invoice.EmailPelanggan, "Pembayaran diterima - "+invoice.Nomor, html, EmailAttachment{
+		Filename:    InvoiceFilename(invoice),
+		ContentType: "application/pdf",
+		Content:     RenderInvoicePDF(invoice),
+	})
+	if err != nil {
+		log.Printf("Error sending invoice %s: %v", invoice.Nomor, err)
+	}
+}
@@ -1,19 +1,128 @@
 package services
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/veritrans/go-midtrans"
 )
 
-var (
-	serverKey = "SB-Mid-server-Et1YEh9uv5uulLqDOyNVI6xJ" // Ganti dengan Server Key Sandbox Anda
-	clientKey = "SB-Mid-client-5PeEj9gpVGmvsFD2"         // Ganti dengan Client Key Sandbox Anda
-)
+// MidtransGateway adalah PaymentGateway Midtrans: Snap untuk tagihan, Core API untuk status,
+// pembatalan dan refund
+type MidtransGateway struct {
+	ServerKey  string
+	ClientKey  string
+	Production bool
+}
 
-// MidtransClient menginisialisasi client Midtrans
-func MidtransClient() *midtrans.Client {
+// client menginisialisasi client Midtrans sesuai environment sandbox atau production
+func (g *MidtransGateway) client() midtrans.Client {
 	c := midtrans.NewClient()
-	c.ServerKey = serverKey
-	c.ClientKey = clientKey
-	c.APIEnvType = midtrans.Sandbox // Gunakan Sandbox untuk testing, ubah ke Production untuk live
-	return &c                       // Mengembalikan pointer ke client
+	c.ServerKey = g.ServerKey
+	c.ClientKey = g.ClientKey
+	c.APIEnvType = midtrans.Sandbox
+	if g.Production {
+		c.APIEnvType = midtrans.Production
+	}
+	return c
+}
+
+// Jenis pembayaran pada tabel payments
+const (
+	PaymentKindOrder       = "order"       // pembayaran utama pesanan
+	PaymentKindAdjustment  = "adjustment"  // kekurangan bayar setelah pesanan diubah admin
+	PaymentKindSavings     = "savings"     // setoran tabungan emas, tidak terkait pesanan
+	PaymentKindInstallment = "installment" // DP atau cicilan pada jadwal pembayaran
+)
+
+// NewMidtransOrderID membuat order ID Midtrans dengan prefix tertentu. Bagian ULID membuat order ID
+// tetap unik walaupun beberapa tagihan dibuat pada detik yang sama.
+func NewMidtransOrderID(prefix string) string {
+	return prefix + "-" + NewULID()
+}
+
+// CreateCharge meminta token Snap untuk tagihan sebesar grossAmount
+func (g *MidtransGateway) CreateCharge(orderID string, grossAmount int64, customer PaymentCustomer) (PaymentCharge, error) {
+	snapGateway := midtrans.SnapGateway{Client: g.client()}
+	resp, err := snapGateway.GetToken(&midtrans.SnapReq{
+		TransactionDetails: midtrans.TransactionDetails{
+			OrderID:  orderID,
+			GrossAmt: grossAmount,
+		},
+		CustomerDetail: &midtrans.CustDetail{
+			FName: customer.Name,
+			Email: customer.Email,
+			Phone: customer.Phone,
+		},
+	})
+	if err != nil {
+		return PaymentCharge{}, err
+	}
+	if resp.Token == "" {
+		return PaymentCharge{}, fmt.Errorf("midtrans snap %s: %s %v", orderID, resp.StatusCode, resp.ErrorMessages)
+	}
+	return PaymentCharge{Token: resp.Token, RedirectURL: resp.RedirectURL}, nil
+}
+
+// GetStatus meminta status transaksi terbaru dari Core API
+func (g *MidtransGateway) GetStatus(orderID string) (GatewayTransaction, error) {
+	coreGateway := midtrans.CoreGateway{Client: g.client()}
+	resp, err := coreGateway.Status(orderID)
+	if err != nil {
+		return GatewayTransaction{}, err
+	}
+	if resp.StatusCode == "404" {
+		return GatewayTransaction{}, ErrGatewayTransactionNotFound
+	}
+	if resp.TransactionStatus == "" {
+		return GatewayTransaction{}, fmt.Errorf("midtrans status %s: %s %s", orderID, resp.StatusCode, resp.StatusMessage)
+	}
+	return GatewayTransaction{
+		OrderID:           resp.OrderID,
+		TransactionID:     resp.TransactionID,
+		TransactionStatus: resp.TransactionStatus,
+		FraudStatus:       resp.FraudStatus,
+		PaymentType:       resp.PaymentType,
+		GrossAmount:       resp.GrossAmount,
+	}, nil
+}
+
+// Cancel membatalkan transaksi Midtrans yang masih pending.
+// Transaksi yang belum pernah dibuat di Midtrans (pelanggan belum memilih metode bayar) dianggap sudah batal.
+// 412 berarti status transaksi sudah tidak bisa diubah, termasuk yang sudah settlement.
+func (g *MidtransGateway) Cancel(orderID string) error {
+	coreGateway := midtrans.CoreGateway{Client: g.client()}
+	resp, err := coreGateway.Cancel(orderID)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case "200", "404":
+		return nil
+	case "412":
+		return ErrGatewayTransactionFinal
+	}
+	return fmt.Errorf("midtrans cancel %s: %s %s", orderID, resp.StatusCode, resp.StatusMessage)
+}
+
+// Refund mengirim refund ke Midtrans; refund_key yang sama tidak diproses dua kali oleh Midtrans
+func (g *MidtransGateway) Refund(orderID, refundKey string, amount int64, reason string) error {
+	coreGateway := midtrans.CoreGateway{Client: g.client()}
+	resp, err := coreGateway.Refund(orderID, &midtrans.RefundReq{
+		RefundKey: refundKey,
+		Amount:    amount,
+		Reason:    reason,
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == "200":
+		return nil
+	case resp.StatusCode == "404":
+		return ErrGatewayTransactionNotFound
+	case strings.HasPrefix(resp.StatusCode, "4"):
+		return fmt.Errorf("%w: midtrans refund %s: %s %s", ErrGatewayRejected, orderID, resp.StatusCode, resp.StatusMessage)
+	}
+	return fmt.Errorf("midtrans refund %s: %s %s", orderID, resp.StatusCode, resp.StatusMessage)
 }
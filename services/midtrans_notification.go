@@ -0,0 +1,154 @@
+package services
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"proyek3/config"
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Hasil verifikasi notifikasi Midtrans yang disimpan di midtrans_notifications
+const (
+	NotificationVerified         = "verified"
+	NotificationInvalidPayload   = "invalid_payload"
+	NotificationInvalidSignature = "invalid_signature"
+	NotificationAmountMismatch   = "amount_mismatch"
+	NotificationUnknownPayment   = "unknown_payment"
+	NotificationStatusUnverified = "status_unverified" // status tidak bisa dikonfirmasi ke Midtrans
+	NotificationDuplicate        = "duplicate"         // sudah diproses menurut inbox pembayaran
+)
+
+// MidtransNotification adalah isi notifikasi HTTP dari Midtrans yang dipakai aplikasi
+type MidtransNotification struct {
+	OrderID           string `json:"order_id"`
+	TransactionID     string `json:"transaction_id"`
+	TransactionStatus string `json:"transaction_status"`
+	FraudStatus       string `json:"fraud_status"`
+	StatusCode        string `json:"status_code"`
+	GrossAmount       string `json:"gross_amount"`
+	SignatureKey      string `json:"signature_key"`
+	PaymentType       string `json:"payment_type"`
+}
+
+// ParseMidtransNotification membaca body notifikasi; order_id dan transaction_status wajib ada
+func ParseMidtransNotification(body []byte) (MidtransNotification, error) {
+	var n MidtransNotification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return n, err
+	}
+	if n.OrderID == "" {
+		return n, fmt.Errorf("order_id tidak ada")
+	}
+	if n.TransactionStatus == "" {
+		return n, fmt.Errorf("transaction_status tidak ada")
+	}
+	return n, nil
+}
+
+// EffectiveStatus mengembalikan status transaksi yang dipakai aplikasi: capture kartu kredit
+// hanya dianggap settlement jika fraud_status accept
+func (n MidtransNotification) EffectiveStatus() string {
+	if n.TransactionStatus != "capture" {
+		return n.TransactionStatus
+	}
+	if n.FraudStatus == "accept" {
+		return "settlement"
+	}
+	return "failed"
+}
+
+// MidtransSignature menghitung signature_key notifikasi:
+// SHA512(order_id + status_code + gross_amount + server key) dalam hex
+func MidtransSignature(orderID, statusCode, grossAmount string) string {
+	sum := sha512.Sum512([]byte(orderID + statusCode + grossAmount + config.MidtransServerKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// expectedPaymentAmount membaca nominal tagihan yang tersimpan untuk order ID Midtrans.
+// Pembayaran lama hanya tercatat di custom_orders.order_id.
+func expectedPaymentAmount(q database.Querier, orderID string) (model.Rupiah, bool, error) {
+	var amount model.Rupiah
+	err := q.QueryRow(`
+		SELECT gross_amount FROM payments WHERE order_id = $1
+		UNION ALL
+		SELECT total_harga FROM custom_orders WHERE order_id = $1
+		LIMIT 1`, orderID).Scan(&amount)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return amount, err == nil, err
+}
+
+// VerifyMidtransNotification memeriksa signature_key dan mencocokkan gross_amount dengan tagihan
+// yang tersimpan; notifikasi ganda disaring oleh inbox pembayaran. Jika requery aktif,
+// status transaksi dikonfirmasi ke payment gateway dan verified berisi status dari API.
+// keterangan menjelaskan hasil verifikasi untuk disimpan bersama notifikasi.
+func VerifyMidtransNotification(q database.Querier, n MidtransNotification, requery bool) (verified MidtransNotification, hasil, keterangan string, err error) {
+	verified = n
+	expected := MidtransSignature(n.OrderID, n.StatusCode, n.GrossAmount)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(n.SignatureKey)) != 1 {
+		return verified, NotificationInvalidSignature, "signature_key tidak cocok", nil
+	}
+
+	amount, found, err := expectedPaymentAmount(q, n.OrderID)
+	if err != nil {
+		return verified, "", "", err
+	}
+	if !found {
+		return verified, NotificationUnknownPayment, "order_id tidak dikenal", nil
+	}
+	notified, err := model.NewRupiah(n.GrossAmount)
+	if err != nil || notified != amount {
+		return verified, NotificationAmountMismatch, fmt.Sprintf("gross_amount %s, tagihan %s", n.GrossAmount, amount), nil
+	}
+
+	if !requery {
+		return verified, NotificationVerified, "", nil
+	}
+	status, err := FetchTransactionStatus(n.OrderID)
+	if err != nil {
+		return verified, NotificationStatusUnverified, err.Error(), nil
+	}
+	if gross, err := model.NewRupiah(status.GrossAmount); err != nil || gross != amount {
+		return verified, NotificationAmountMismatch, fmt.Sprintf("gross_amount API %s, tagihan %s", status.GrossAmount, amount), nil
+	}
+	if status.TransactionStatus != n.TransactionStatus || status.FraudStatus != n.FraudStatus {
+		keterangan = fmt.Sprintf("status notifikasi %s diganti status API %s", n.TransactionStatus, status.TransactionStatus)
+		verified.TransactionStatus, verified.FraudStatus = status.TransactionStatus, status.FraudStatus
+	}
+	if status.PaymentType != "" {
+		verified.PaymentType = status.PaymentType
+	}
+	return verified, NotificationVerified, keterangan, nil
+}
+
+// Sumber status pembayaran yang disimpan di midtrans_notifications
+const (
+	NotificationSourceWebhook        = "webhook"
+	NotificationSourceReconciliation = "reconciliation" // status dibaca langsung dari gateway
+)
+
+// RecordMidtransNotification menyimpan body mentah notifikasi beserta sumber dan hasil verifikasinya
+func RecordMidtransNotification(q database.Querier, n MidtransNotification, body []byte, sumber, hasil, keterangan string) (int, error) {
+	var id int
+	err := q.QueryRow(`
+		INSERT INTO midtrans_notifications (order_id, transaction_id, transaction_status, status_code,
+			gross_amount, signature_key, body, sumber, verifikasi, keterangan)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		n.OrderID, n.TransactionID, n.TransactionStatus, n.StatusCode,
+		n.GrossAmount, n.SignatureKey, string(body), sumber, hasil, keterangan).Scan(&id)
+	return id, err
+}
+
+// MarkNotificationProcessed menandai notifikasi sudah selesai ditangani inbox pembayaran
+func MarkNotificationProcessed(q database.Querier, id int) error {
+	_, err := q.Exec(`UPDATE midtrans_notifications SET processed_at = NOW() WHERE id = $1`, id)
+	return err
+}
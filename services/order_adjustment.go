@@ -0,0 +1,122 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Jenis dan tindak lanjut perubahan pesanan
+const (
+	AdjustmentCancellation = "cancellation"
+	AdjustmentAmendment    = "amendment"
+
+	AdjustmentActionNone           = "none"
+	AdjustmentActionPaymentRequest = "payment_request"
+	AdjustmentActionRefundDue      = "refund_due"
+)
+
+// RecordAdjustment menyimpan perubahan pesanan beserta tindak lanjut keuangannya
+func RecordAdjustment(q database.Querier, adj *model.OrderAdjustment) error {
+	sebelum, err := json.Marshal(adj.Sebelum)
+	if err != nil {
+		return err
+	}
+	sesudah, err := json.Marshal(adj.Sesudah)
+	if err != nil {
+		return err
+	}
+	return q.QueryRow(`
+		INSERT INTO order_adjustments (custom_order_id, jenis, sebelum, sesudah, total_lama, total_baru,
+			selisih, tindakan, payment_order_id, alasan, actor)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11)
+		RETURNING id, created_at`,
+		adj.OrderID, adj.Jenis, sebelum, sesudah, adj.TotalLama, adj.TotalBaru,
+		adj.Selisih, adj.Tindakan, adj.PaymentOrderID, adj.Alasan, adj.Actor).Scan(&adj.ID, &adj.CreatedAt)
+}
+
+// PaidAmount menjumlahkan pembayaran pesanan yang sudah lunas dikurangi refund yang berhasil
+func PaidAmount(q database.Querier, orderID int) (model.Rupiah, error) {
+	var paid model.Rupiah
+	err := q.QueryRow(`
+		SELECT COALESCE(SUM(p.gross_amount - COALESCE((
+			SELECT SUM(r.jumlah) FROM refunds r WHERE r.payment_id = p.id AND r.status = 'succeeded'
+		), 0)), 0)
+		FROM payments p
+		LEFT JOIN custom_orders c ON c.order_id = p.order_id
+		WHERE (p.custom_order_id = $1 OR (p.custom_order_id IS NULL AND c.id = $1))
+			AND p.status IN ('settlement', 'partial_refund')`, orderID).Scan(&paid)
+	return paid, err
+}
+
+// CancelPendingPayments membatalkan semua transaksi Midtrans pesanan yang masih pending
+func CancelPendingPayments(q database.Querier, orderID int) error {
+	rows, err := q.Query(`
+		SELECT p.order_id
+		FROM payments p
+		LEFT JOIN custom_orders c ON c.order_id = p.order_id
+		WHERE (p.custom_order_id = $1 OR (p.custom_order_id IS NULL AND c.id = $1))
+			AND p.status = 'pending'`, orderID)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for rows.Next() {
+		var paymentOrderID string
+		if err := rows.Scan(&paymentOrderID); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, paymentOrderID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return cancelPaymentOrders(q, pending)
+}
+
+// PaymentCompletedError berarti transaksi yang akan dibatalkan ternyata sudah dibayar di gateway.
+// Notification berisi status dari gateway yang harus diterapkan lewat inbox pembayaran.
+type PaymentCompletedError struct {
+	Notification MidtransNotification
+}
+
+func (e *PaymentCompletedError) Error() string {
+	return fmt.Sprintf("transaksi %s sudah %s di payment gateway", e.Notification.OrderID, e.Notification.EffectiveStatus())
+}
+
+// cancelPaymentOrders membatalkan transaksi Midtrans lalu menandai baris payments-nya. Transaksi yang
+// sudah final dibaca ulang statusnya: yang gagal atau kedaluwarsa dicatat apa adanya, sedangkan yang
+// sudah dibayar tidak ditandai cancel dan dikembalikan sebagai PaymentCompletedError.
+func cancelPaymentOrders(q database.Querier, paymentOrderIDs []string) error {
+	for _, paymentOrderID := range paymentOrderIDs {
+		status := "cancel"
+		err := CancelTransaction(paymentOrderID)
+		if errors.Is(err, ErrGatewayTransactionFinal) {
+			t, err := FetchTransactionStatus(paymentOrderID)
+			if err != nil {
+				return err
+			}
+			n := NotificationFromGateway(paymentOrderID, t)
+			switch n.EffectiveStatus() {
+			case "cancel", "expire", "deny", "failure", "failed":
+				status = n.EffectiveStatus()
+			default:
+				return &PaymentCompletedError{Notification: n}
+			}
+		} else if err != nil {
+			return err
+		}
+		if _, err := q.Exec(`UPDATE payments SET status = $2, updated_at = NOW() WHERE order_id = $1`, paymentOrderID, status); err != nil {
+			return err
+		}
+		log.Printf("Transaksi pending %s dibatalkan (%s)", paymentOrderID, status)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Tipe kejadian pada timeline pesanan
+const (
+	EventStatusChange = "status_change"
+	EventPayment      = "payment"
+	EventNote         = "note"
+	EventPhoto        = "photo"
+)
+
+// RecordOrderEvent menambahkan kejadian ke timeline pesanan
+func RecordOrderEvent(q database.Querier, event model.OrderEvent) error {
+	_, err := q.Exec(`
+		INSERT INTO order_events (custom_order_id, tipe, status, keterangan, foto_url, actor, internal)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6, $7)`,
+		event.OrderID, event.Tipe, event.Status, event.Keterangan, event.FotoURL, event.Actor, event.Internal)
+	return err
+}
+
+// OrderTimeline mengembalikan kejadian pesanan secara kronologis.
+// Catatan internal hanya disertakan jika includeInternal bernilai true (admin).
+func OrderTimeline(q database.Querier, orderID int, includeInternal bool) ([]model.OrderEvent, error) {
+	rows, err := q.Query(`
+		SELECT id, custom_order_id, tipe, COALESCE(status, ''), keterangan, COALESCE(foto_url, ''), actor, internal, created_at
+		FROM order_events
+		WHERE custom_order_id = $1 AND (NOT internal OR $2)
+		ORDER BY created_at, id`, orderID, includeInternal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.OrderEvent{}
+	for rows.Next() {
+		var e model.OrderEvent
+		if err := rows.Scan(&e.ID, &e.OrderID, &e.Tipe, &e.Status, &e.Keterangan, &e.FotoURL, &e.Actor, &e.Internal, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
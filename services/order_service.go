@@ -1,29 +1,172 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"proyek3/model"
+	"time"
 )
 
-func CalculatePrice(order model.Order) float64 {
-	var hargaEmas, hargaCampuran float64
+// GoldPrices adalah harga emas per gram berdasarkan jenis emas
+var GoldPrices = map[string]model.Rupiah{
+	"Emas 18K": 1485700,
+	"Emas 22K": 3121420,
+	"Emas 20K": 1485700,
+}
+
+// MixPrices adalah biaya campuran tambahan per pesanan
+var MixPrices = map[string]model.Rupiah{
+	"Perak":     500000,
+	"Palladium": 600000,
+	"Platinum":  700000,
+}
+
+// PriceTolerance adalah selisih maksimal (dalam rupiah) antara total dari klien
+// dan total hasil hitungan server sebelum pesanan ditolak.
+const PriceTolerance model.Rupiah = 1000
+
+var (
+	ErrUnknownJenisEmas = errors.New("jenis emas tidak dikenal")
+	ErrUnknownBatu      = errors.New("jenis atau jumlah batu tidak valid")
+	ErrPriceMismatch    = errors.New("total harga tidak sesuai dengan harga server")
+)
+
+// GoldPricePerGram mengembalikan harga emas per gram dari GoldPrices.
+// Nilai false berarti jenis emas tidak ada di daftar harga.
+func GoldPricePerGram(jenisEmas string) (model.Rupiah, bool) {
+	harga, ok := GoldPrices[jenisEmas]
+	return harga, ok
+}
+
+func CalculatePrice(order model.Order) (model.Rupiah, error) {
+	breakdown, err := CalculateBreakdown(order)
+	return breakdown.Total, err
+}
+
+// CalculateBreakdown menghitung rincian harga pesanan memakai aturan harga saat ini.
+// Total selalu sama dengan nilai yang dikembalikan CalculatePrice.
+func CalculateBreakdown(order model.Order) (model.PriceBreakdown, error) {
+	return CalculateBreakdownWithRules(order, CurrentPricingRules(), time.Now())
+}
+
+// CalculateBreakdownWithRules menghitung rincian harga dengan aturan harga tertentu.
+// Setiap baris dibulatkan half-up ke rupiah terdekat dan total adalah jumlah baris-barisnya.
+// Perkalian yang tidak muat di Rupiah mengembalikan model.ErrOutOfRange.
+func CalculateBreakdownWithRules(order model.Order, rules PricingRules, at time.Time) (model.PriceBreakdown, error) {
+	hargaEmas, _ := GoldPricePerGram(order.JenisEmas)
+	hargaCampuran := MixPrices[order.CampuranTambahan]
+
+	nilaiEmas, err := hargaEmas.MulGram(order.BeratEmas)
+	if err != nil {
+		return model.PriceBreakdown{}, err
+	}
+	nilaiKadar, err := nilaiEmas.MulPersen(order.PersentaseEmas)
+	if err != nil {
+		return model.PriceBreakdown{}, err
+	}
+	breakdown := model.PriceBreakdown{
+		HargaPerGram:     hargaEmas,
+		NilaiEmas:        nilaiEmas,
+		PenyesuaianKadar: nilaiKadar - nilaiEmas,
+		BiayaCampuran:    hargaCampuran,
+	}
+	breakdown.Items = append(breakdown.Items,
+		model.PriceLine{Kode: "emas", Keterangan: fmt.Sprintf("%s %s gram", order.JenisEmas, order.BeratEmas), Jumlah: breakdown.NilaiEmas},
+		model.PriceLine{Kode: "kadar", Keterangan: fmt.Sprintf("Penyesuaian kadar %s%%", order.PersentaseEmas), Jumlah: breakdown.PenyesuaianKadar},
+	)
+	if hargaCampuran > 0 {
+		breakdown.Items = append(breakdown.Items, model.PriceLine{Kode: "campuran", Keterangan: "Campuran " + order.CampuranTambahan, Jumlah: hargaCampuran})
+	}
+
+	// Ongkos pembuatan berdasarkan jenis perhiasan
+	labor := rules.LaborRateFor(order.JenisPerhiasan)
+	switch labor.Mode {
+	case LaborFlat:
+		breakdown.OngkosPembuatan = labor.Amount
+	default:
+		if breakdown.OngkosPembuatan, err = labor.Amount.MulGram(order.BeratEmas); err != nil {
+			return model.PriceBreakdown{}, err
+		}
+	}
+	if breakdown.OngkosPembuatan > 0 {
+		breakdown.Items = append(breakdown.Items, model.PriceLine{Kode: "ongkos", Keterangan: "Ongkos pembuatan " + order.JenisPerhiasan, Jumlah: breakdown.OngkosPembuatan})
+	}
+
+	// Batu permata, satu baris per jenis batu
+	for _, batu := range order.Batu {
+		jumlah, err := rules.StoneRates[batu.Jenis].MulInt(int64(batu.Jumlah))
+		if err != nil {
+			return model.PriceBreakdown{}, err
+		}
+		breakdown.BiayaBatu += jumlah
+		breakdown.Items = append(breakdown.Items, model.PriceLine{Kode: "batu", Keterangan: fmt.Sprintf("Batu %s x%d", batu.Jenis, batu.Jumlah), Jumlah: jumlah})
+	}
+
+	// Ukiran dan finishing, satu baris per opsi berbayar
+	for _, line := range personalizationLines(order.Personalisasi, rules) {
+		breakdown.BiayaPersonalisasi += line.Jumlah
+		breakdown.Items = append(breakdown.Items, line)
+	}
+
+	breakdown.Subtotal = breakdown.NilaiEmas + breakdown.PenyesuaianKadar + breakdown.BiayaCampuran +
+		breakdown.OngkosPembuatan + breakdown.BiayaBatu + breakdown.BiayaPersonalisasi
+
+	// Pajak dihitung dari subtotal dengan tarif yang berlaku pada waktu perhitungan
+	tax := rules.TaxRateAt(at)
+	breakdown.TarifPajak = tax.Rate
+	if breakdown.Pajak, err = breakdown.Subtotal.MulPersen(tax.Rate); err != nil {
+		return model.PriceBreakdown{}, err
+	}
+	if breakdown.Pajak > 0 {
+		breakdown.Items = append(breakdown.Items, model.PriceLine{Kode: "pajak", Keterangan: fmt.Sprintf("%s %s%%", tax.Name, tax.Rate), Jumlah: breakdown.Pajak})
+	}
+
+	breakdown.Total = breakdown.Subtotal + breakdown.Pajak
+	return breakdown, nil
+}
+
+// CalculateServerBreakdown menghitung ulang rincian harga pesanan di server dengan rules.
+// Pemanggil mencatat rules yang sama lewat RecordPriceSheet agar price_sheet_version cocok
+// dengan harga yang dihitung. Jenis emas atau batu yang tidak ada di daftar harga ditolak
+// agar tidak menghasilkan harga nol.
+func CalculateServerBreakdown(order model.Order, rules PricingRules) (model.PriceBreakdown, error) {
+	if _, ok := GoldPricePerGram(order.JenisEmas); !ok {
+		return model.PriceBreakdown{}, ErrUnknownJenisEmas
+	}
+
+	if err := ValidatePersonalisasi(order.JenisPerhiasan, order.Personalisasi); err != nil {
+		return model.PriceBreakdown{}, err
+	}
 
-	switch order.JenisEmas {
-	case "Emas 18K":
-		hargaEmas = 1485700
-	case "Emas 22K":
-		hargaEmas = 3121420
-	case "Emas 20K":
-		hargaEmas = 1485700
+	for _, batu := range order.Batu {
+		if _, ok := rules.StoneRates[batu.Jenis]; !ok || batu.Jumlah <= 0 {
+			return model.PriceBreakdown{}, ErrUnknownBatu
+		}
 	}
+	return CalculateBreakdownWithRules(order, rules, time.Now())
+}
 
-	switch order.CampuranTambahan {
-	case "Perak":
-		hargaCampuran = 500000
-	case "Palladium":
-		hargaCampuran = 600000
-	case "Platinum":
-		hargaCampuran = 700000
+// CalculateServerPrice menghitung ulang total pesanan di server.
+func CalculateServerPrice(order model.Order, rules PricingRules) (model.Rupiah, error) {
+	breakdown, err := CalculateServerBreakdown(order, rules)
+	if err != nil {
+		return 0, err
 	}
+	return breakdown.Total, nil
+}
 
-	return (hargaEmas * order.BeratEmas * order.PersentaseEmas / 100) + hargaCampuran
+// VerifyClientTotal membandingkan total dari klien dengan total server.
+// Total klien nol dianggap tidak dikirim sehingga selalu lolos.
+func VerifyClientTotal(clientTotal, serverTotal model.Rupiah) error {
+	if clientTotal == 0 {
+		return nil
+	}
+	diff := clientTotal - serverTotal
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > PriceTolerance {
+		return ErrPriceMismatch
+	}
+	return nil
 }
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"proyek3/model"
+)
+
+func TestOversizedOrderIsRejectedWithoutPanic(t *testing.T) {
+	var req model.OrderRequest
+	body := `{"jenis_perhiasan": "Cincin", "jenis_emas": "Emas 22K", "berat_emas": "9000000000000", "persentase_emas": 75}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateOrderRequest(req); !errors.Is(err, ErrOrderInputTooLarge) {
+		t.Fatalf("ValidateOrderRequest = %v, ingin ErrOrderInputTooLarge", err)
+	}
+	if _, err := CalculateBreakdownWithRules(orderFromRequest(req), DefaultPricingRules, time.Now()); !errors.Is(err, model.ErrOutOfRange) {
+		t.Fatalf("CalculateBreakdownWithRules = %v, ingin ErrOutOfRange", err)
+	}
+
+	req.BeratEmas = 5 * model.MilligramsPerGram
+	req.Batu = []model.Batu{{Jenis: "Zirkon", Jumlah: MaxJumlahBatu + 1}}
+	if err := ValidateOrderRequest(req); !errors.Is(err, ErrOrderInputTooLarge) {
+		t.Fatalf("jumlah batu berlebih: %v", err)
+	}
+}
+
+func TestPriceCartItemCapsQty(t *testing.T) {
+	item := model.CartItem{ItemType: model.ItemEmas, Qty: MaxCartQty + 1, Emas: &model.Emas{Harga: 1000000, Stok: 1000}}
+	PriceCartItem(&item, DefaultPricingRules)
+	if item.Tersedia || item.Subtotal != 0 {
+		t.Fatalf("item dengan qty %d dianggap tersedia: %+v", item.Qty, item)
+	}
+	item.Qty = 3
+	PriceCartItem(&item, DefaultPricingRules)
+	if !item.Tersedia || item.Subtotal != 3000000 {
+		t.Fatalf("item qty 3 = %+v", item)
+	}
+}
+
+func TestCartDiscountIsTakenBeforeTax(t *testing.T) {
+	tax := TaxRate{Name: "PPN", Rate: 1100}
+	items := []model.CartItem{
+		{ItemType: model.ItemEmas, Qty: 1, Emas: &model.Emas{Nama: "Cincin", Harga: 1000000, Stok: 1}},
+		{ItemType: model.ItemEmas, Qty: 2, Emas: &model.Emas{Nama: "Anting", Harga: 1000000, Stok: 2}},
+	}
+	for i := range items {
+		PriceCartItem(&items[i], DefaultPricingRules)
+	}
+
+	breakdown, err := CartBreakdown(items, tax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breakdown.Subtotal != 3000000 || breakdown.Pajak != 330000 || breakdown.Total != 3330000 {
+		t.Fatalf("rincian keranjang = %+v", breakdown)
+	}
+
+	breakdown = ApplyDiscount(breakdown, model.PriceLine{Kode: "diskon", Keterangan: "Promo", Jumlah: 300000})
+	if breakdown.Pajak != 297000 || breakdown.Total != 2997000 {
+		t.Fatalf("pajak %s total %s setelah diskon, ingin 297000 dan 2997000", breakdown.Pajak, breakdown.Total)
+	}
+	last := breakdown.Items[len(breakdown.Items)-1]
+	if last.Kode != "pajak" || last.Jumlah != breakdown.Pajak {
+		t.Fatalf("baris terakhir = %+v, ingin baris pajak", last)
+	}
+}
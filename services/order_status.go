@@ -0,0 +1,180 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Status pesanan custom_orders
+const (
+	OrderDraft             = "draft"
+	OrderAwaitingPayment   = "awaiting_payment"
+	OrderPaid              = "paid"
+	OrderInProduction      = "in_production"
+	OrderQualityCheck      = "quality_check"
+	OrderReady             = "ready"
+	OrderShipped           = "shipped"
+	OrderPickedUp          = "picked_up"
+	OrderCompleted         = "completed"
+	OrderCancelled         = "cancelled"
+	OrderRefunded          = "refunded"
+	OrderPartiallyRefunded = "partially_refunded" // pesanan selesai atau batal yang dananya dikembalikan sebagian
+)
+
+// Actor yang dicatat pada riwayat status selain user
+const (
+	ActorMidtrans = "system:midtrans"
+	ActorSystem   = "system"
+)
+
+var (
+	ErrInvalidTransition = errors.New("perubahan status pesanan tidak diizinkan")
+	ErrOrderNotFound     = errors.New("pesanan tidak ditemukan")
+)
+
+// orderTransitions adalah daftar perubahan status yang diizinkan
+var orderTransitions = map[string][]string{
+	OrderDraft:           {OrderAwaitingPayment, OrderCancelled},
+	OrderAwaitingPayment: {OrderPaid, OrderCancelled},
+	OrderPaid:            {OrderInProduction, OrderCancelled, OrderRefunded},
+	OrderInProduction:    {OrderQualityCheck, OrderRefunded},
+	OrderQualityCheck:    {OrderReady, OrderInProduction, OrderRefunded},
+	OrderReady:           {OrderShipped, OrderPickedUp, OrderRefunded},
+	OrderShipped:         {OrderCompleted, OrderReady, OrderRefunded}, // ready jika paket dikembalikan kurir
+	OrderPickedUp:        {OrderCompleted, OrderRefunded},
+	OrderCompleted:       {OrderRefunded, OrderPartiallyRefunded},
+	// Refund atas pesanan yang batal setelah dibayar
+	OrderCancelled:         {OrderRefunded, OrderPartiallyRefunded},
+	OrderPartiallyRefunded: {OrderRefunded},
+}
+
+// productionStatuses adalah status yang boleh diatur admin secara manual. Status lain punya efek
+// samping (pembayaran, stok, voucher, refund, pengiriman) dan hanya diubah lewat endpoint masing-masing.
+var productionStatuses = map[string]bool{
+	OrderInProduction: true,
+	OrderQualityCheck: true,
+	OrderReady:        true,
+}
+
+// IsProductionStatus bernilai true jika status boleh diatur lewat endpoint status pesanan admin
+func IsProductionStatus(status string) bool {
+	return productionStatuses[status]
+}
+
+// ActorUser membuat nama actor untuk user yang login
+func ActorUser(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// ActorAdmin membuat nama actor untuk admin yang bertindak atas pesanan milik user lain
+func ActorAdmin(userID int) string {
+	return fmt.Sprintf("admin:%d", userID)
+}
+
+// IsValidOrderStatus bernilai true jika status dikenal
+func IsValidOrderStatus(status string) bool {
+	if _, ok := orderTransitions[status]; ok {
+		return true
+	}
+	return status == OrderRefunded
+}
+
+// CanTransition bernilai true jika status from boleh berubah menjadi to
+func CanTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// InitOrderStatus memberi status awal draft pada pesanan yang baru dibuat
+func InitOrderStatus(q database.Querier, orderID int, actor string) error {
+	if _, err := q.Exec(`UPDATE custom_orders SET status = $1, updated_at = NOW() WHERE id = $2`, OrderDraft, orderID); err != nil {
+		return err
+	}
+	return recordStatusChange(q, orderID, "", OrderDraft, actor, "Pesanan dibuat")
+}
+
+// TransitionOrder adalah satu-satunya cara mengubah status pesanan.
+// Perubahan divalidasi terhadap orderTransitions lalu dicatat beserta actor dan waktunya.
+// Transisi ke status yang sama dianggap sudah terjadi dan tidak dicatat ulang.
+func TransitionOrder(q database.Querier, orderID int, to, actor, note string) error {
+	var from sql.NullString
+	err := q.QueryRow(`SELECT status FROM custom_orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&from)
+	if err == sql.ErrNoRows {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if from.String == to {
+		return nil
+	}
+	if !CanTransition(from.String, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from.String, to)
+	}
+	if from.String == OrderPaid && to == OrderInProduction {
+		// Perhiasan custom baru boleh diproduksi setelah desainnya disetujui pelanggan
+		if err := CheckDesignApproved(q, orderID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := q.Exec(`UPDATE custom_orders SET status = $1, updated_at = NOW() WHERE id = $2`, to, orderID); err != nil {
+		return err
+	}
+	if err := recordStatusChange(q, orderID, from.String, to, actor, note); err != nil {
+		return err
+	}
+
+	// Pesanan yang dibayar masuk antrean bengkel; yang batal dihentikan produksinya
+	switch to {
+	case OrderPaid:
+		return CreateWorkOrders(q, orderID)
+	case OrderCancelled, OrderRefunded:
+		return CancelWorkOrders(q, orderID)
+	}
+	return nil
+}
+
+// recordStatusChange mencatat riwayat status sekaligus kejadian di timeline pesanan
+func recordStatusChange(q database.Querier, orderID int, from, to, actor, note string) error {
+	_, err := q.Exec(`
+		INSERT INTO order_status_history (custom_order_id, from_status, to_status, actor, note)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)`,
+		orderID, from, to, actor, note)
+	if err != nil {
+		return err
+	}
+
+	return RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    orderID,
+		Tipe:       EventStatusChange,
+		Status:     to,
+		Keterangan: note,
+		Actor:      actor,
+	})
+}
+
+// OrderStatusForTransaction memetakan status transaksi Midtrans ke status pesanan.
+// ok bernilai false untuk status yang tidak mengubah pesanan.
+func OrderStatusForTransaction(transactionStatus string) (status string, ok bool) {
+	switch transactionStatus {
+	case "settlement":
+		return OrderPaid, true
+	case "pending":
+		return OrderAwaitingPayment, true
+	case "deny", "cancel", "expire", "failed":
+		return OrderCancelled, true
+	case "refund":
+		return OrderRefunded, true
+	}
+	return "", false
+}
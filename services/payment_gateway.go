@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"proyek3/config"
+)
+
+var (
+	ErrGatewayTransactionNotFound = errors.New("transaksi tidak ditemukan di payment gateway")
+	// ErrGatewayTransactionFinal berarti transaksi sudah tidak bisa diubah, misalnya sudah settlement
+	ErrGatewayTransactionFinal = errors.New("transaksi di payment gateway sudah final")
+	// ErrGatewayRejected berarti gateway pasti menolak permintaan (respons 4xx). Error lain, misalnya
+	// timeout atau 5xx, tidak memastikan apakah permintaan sudah diproses.
+	ErrGatewayRejected = errors.New("permintaan ditolak payment gateway")
+)
+
+// PaymentCustomer adalah data pelanggan yang dikirim ke payment gateway
+type PaymentCustomer struct {
+	Name  string
+	Email string
+	Phone string
+}
+
+// PaymentCharge adalah tagihan yang dibuat payment gateway; pelanggan membayar melalui
+// Token (Snap) atau RedirectURL
+type PaymentCharge struct {
+	Token       string
+	RedirectURL string
+}
+
+// GatewayTransaction adalah status transaksi menurut payment gateway, dengan format nilai Midtrans
+type GatewayTransaction struct {
+	OrderID           string `json:"order_id"`
+	TransactionID     string `json:"transaction_id"`
+	TransactionStatus string `json:"transaction_status"`
+	FraudStatus       string `json:"fraud_status"`
+	PaymentType       string `json:"payment_type"`
+	GrossAmount       string `json:"gross_amount"`
+}
+
+// PaymentGateway membuat, memeriksa, membatalkan dan me-refund transaksi pembayaran
+type PaymentGateway interface {
+	CreateCharge(orderID string, grossAmount int64, customer PaymentCustomer) (PaymentCharge, error)
+	GetStatus(orderID string) (GatewayTransaction, error)
+	// Cancel membatalkan transaksi pending; transaksi yang belum pernah dibuat dianggap sudah batal.
+	// Transaksi yang sudah final (dibayar, kedaluwarsa, dll.) menghasilkan ErrGatewayTransactionFinal.
+	Cancel(orderID string) error
+	// Refund mengembalikan sebagian atau seluruh dana transaksi yang sudah settlement.
+	// refundKey unik per refund supaya permintaan ulang tidak me-refund dua kali.
+	Refund(orderID, refundKey string, amount int64, reason string) error
+}
+
+// NewPaymentGateway memilih implementasi sesuai config.PaymentGateway. Gateway fake memakai satu
+// instance bersama supaya transaksinya bertahan antar request dan tidak pernah dipakai di production.
+func NewPaymentGateway() PaymentGateway {
+	if config.PaymentGateway == "fake" && config.MidtransEnv != "production" {
+		fakeGateway.configure(strings.TrimRight(config.PublicBaseURL, "/"), config.PaymentWebhookURL)
+		return fakeGateway
+	}
+	return &MidtransGateway{
+		ServerKey:  config.MidtransServerKey,
+		ClientKey:  config.MidtransClientKey,
+		Production: config.MidtransEnv == "production",
+	}
+}
+
+var fakeGateway = &FakeGateway{Client: &http.Client{Timeout: 10 * time.Second}}
+
+// CreateCharge membuat tagihan sebesar grossAmount di payment gateway aktif
+func CreateCharge(orderID string, grossAmount int64, customer PaymentCustomer) (PaymentCharge, error) {
+	return NewPaymentGateway().CreateCharge(orderID, grossAmount, customer)
+}
+
+// CancelTransaction membatalkan transaksi pending di payment gateway aktif
+func CancelTransaction(orderID string) error {
+	return NewPaymentGateway().Cancel(orderID)
+}
+
+// FetchTransactionStatus meminta status transaksi terbaru dari payment gateway aktif
+func FetchTransactionStatus(orderID string) (GatewayTransaction, error) {
+	return NewPaymentGateway().GetStatus(orderID)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"database/sql"
+
+	"proyek3/database"
+)
+
+// Status entri inbox notifikasi pembayaran
+const (
+	InboxReceived  = "received"
+	InboxProcessed = "processed"
+	InboxIgnored   = "ignored" // status mundur, bertentangan dengan status akhir, atau tidak dikenal
+)
+
+// paymentStatusRank mengurutkan status transaksi Midtrans. Status gagal (deny, cancel, expire,
+// failed) berperingkat sama sehingga tidak saling menimpa. Settlement berperingkat di atasnya karena
+// cancel dan expire juga ditulis lokal (pembatalan tagihan, rekonsiliasi); dana yang ternyata masuk
+// tidak boleh hilang. Refund hanya menyusul settlement.
+var paymentStatusRank = map[string]int{
+	"pending":            1,
+	"authorize":          1,
+	"deny":               2,
+	"cancel":             2,
+	"expire":             2,
+	"failure":            2,
+	"failed":             2,
+	"settlement":         3,
+	"partial_refund":     4,
+	"partial_chargeback": 4,
+	"refund":             5,
+	"chargeback":         5,
+}
+
+// PaymentStatusApplies menentukan apakah status transaksi to boleh menggantikan status pembayaran
+// from yang tersimpan. Notifikasi yang datang terlambat (misalnya pending setelah settlement)
+// tidak boleh mengubah pembayaran. Pembayaran dibuat dengan status pending sehingga notifikasi
+// pending pertama tetap diterapkan; pembatalan lokal (cancel) tidak diterapkan ulang.
+func PaymentStatusApplies(from, to string) bool {
+	toRank, ok := paymentStatusRank[to]
+	if !ok {
+		return false
+	}
+	return toRank > paymentStatusRank[from] || (from == "pending" && to == "pending")
+}
+
+// InboxEntry adalah satu notifikasi terverifikasi di inbox, unik per transaction_id dan status
+type InboxEntry struct {
+	ID                int
+	TransactionID     string
+	OrderID           string
+	TransactionStatus string
+	PaymentType       string
+	Status            string
+}
+
+// EnqueuePaymentNotification memasukkan notifikasi terverifikasi ke inbox dengan status efektifnya.
+// Pengiriman ulang dengan transaction_id dan status yang sama hanya menambah hitungan pengiriman;
+// duplicate bernilai true jika entri tersebut sudah selesai diproses. Entri yang pemrosesannya
+// gagal sebelumnya tetap received sehingga diproses ulang.
+func EnqueuePaymentNotification(q database.Querier, n MidtransNotification) (InboxEntry, bool, error) {
+	e := InboxEntry{
+		TransactionID:     n.TransactionID,
+		OrderID:           n.OrderID,
+		TransactionStatus: n.EffectiveStatus(),
+		PaymentType:       n.PaymentType,
+	}
+	// Notifikasi lama tanpa transaction_id memakai order_id sebagai kunci
+	if e.TransactionID == "" {
+		e.TransactionID = n.OrderID
+	}
+
+	err := q.QueryRow(`
+		INSERT INTO payment_notification_inbox (transaction_id, order_id, transaction_status, payment_type)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (transaction_id, transaction_status)
+		DO UPDATE SET pengiriman = payment_notification_inbox.pengiriman + 1
+		RETURNING id, status`,
+		e.TransactionID, e.OrderID, e.TransactionStatus, e.PaymentType).Scan(&e.ID, &e.Status)
+	if err != nil {
+		return e, false, err
+	}
+	return e, e.Status != InboxReceived, nil
+}
+
+// LockInboxEntry membaca entri inbox dengan FOR UPDATE supaya pengiriman bersamaan diproses satu per satu
+func LockInboxEntry(q database.Querier, id int) (InboxEntry, error) {
+	var e InboxEntry
+	err := q.QueryRow(`
+		SELECT id, transaction_id, order_id, transaction_status, payment_type, status
+		FROM payment_notification_inbox WHERE id = $1 FOR UPDATE`, id).Scan(
+		&e.ID, &e.TransactionID, &e.OrderID, &e.TransactionStatus, &e.PaymentType, &e.Status)
+	return e, err
+}
+
+// LockPaymentStatus mengunci baris payments dan mengembalikan statusnya. Pembayaran lama yang hanya
+// tercatat di custom_orders.order_id tidak punya baris payments sehingga statusnya kosong.
+func LockPaymentStatus(q database.Querier, paymentOrderID string) (string, error) {
+	var status string
+	err := q.QueryRow(`SELECT COALESCE(status, '') FROM payments WHERE order_id = $1 FOR UPDATE`, paymentOrderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return status, err
+}
+
+// FinishInboxEntry menutup entri inbox sebagai processed atau ignored
+func FinishInboxEntry(q database.Querier, id int, status, keterangan string) error {
+	_, err := q.Exec(`
+		UPDATE payment_notification_inbox SET status = $1, keterangan = $2, processed_at = NOW()
+		WHERE id = $3`, status, keterangan, id)
+	return err
+}
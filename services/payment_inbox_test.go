@@ -0,0 +1,39 @@
+package services
+
+import "testing"
+
+func TestPaymentStatusApplies(t *testing.T) {
+	tests := []struct {
+		from, to string
+		applies  bool
+	}{
+		{"pending", "pending", true},
+		{"pending", "settlement", true},
+		{"pending", "expire", true},
+		{"pending", "deny", true},
+		{"settlement", "pending", false},
+		{"settlement", "settlement", false},
+		{"settlement", "expire", false},
+		{"settlement", "cancel", false},
+		// Pembatalan lokal ditimpa settlement dari gateway supaya dana yang masuk tidak hilang
+		{"cancel", "settlement", true},
+		{"expire", "settlement", true},
+		{"cancel", "cancel", false},
+		{"cancel", "expire", false},
+		{"expire", "pending", false},
+		{"settlement", "partial_refund", true},
+		{"partial_refund", "refund", true},
+		{"partial_refund", "settlement", false},
+		{"refund", "settlement", false},
+		{"refund", "chargeback", false},
+		{"", "pending", true},
+		{"pending", "unknown", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := PaymentStatusApplies(tt.from, tt.to); got != tt.applies {
+				t.Fatalf("PaymentStatusApplies(%q, %q) = %v, ingin %v", tt.from, tt.to, got, tt.applies)
+			}
+		})
+	}
+}
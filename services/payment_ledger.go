@@ -0,0 +1,117 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// PaymentLedgerFilter adalah filter buku pembayaran admin; nilai kosong berarti tidak difilter
+type PaymentLedgerFilter struct {
+	Status      string
+	Kind        string
+	PaymentType string
+	From        time.Time // inklusif
+	To          time.Time // eksklusif
+	UserID      int
+	Customer    string // sebagian nama atau email pelanggan
+}
+
+// IsValidPaymentStatus memeriksa status transaksi Midtrans yang dikenal
+func IsValidPaymentStatus(status string) bool {
+	_, ok := paymentStatusRank[status]
+	return ok
+}
+
+// paymentLedgerFrom menggabungkan payments dengan pesanannya (lewat custom_order_id, atau order_id
+// untuk pembayaran lama) dan pemiliknya; setoran tabungan emas dihubungkan lewat rekening tabungan
+const paymentLedgerFrom = `
+	FROM payments p
+	LEFT JOIN custom_orders c ON c.id = p.custom_order_id OR (p.custom_order_id IS NULL AND c.order_id = p.order_id)
+	LEFT JOIN savings_deposits sd ON sd.payment_order_id = p.order_id
+	LEFT JOIN savings_accounts sa ON sa.id = sd.account_id
+	LEFT JOIN "user" u ON u.id = COALESCE(c.user_id, sa.user_id)`
+
+const paymentLedgerColumns = `p.id, p.order_id, COALESCE(p.kind, ''), c.id, COALESCE(c.status, ''), u.id,
+	COALESCE(u.name, p.customer_name, ''), COALESCE(u.email, p.customer_email, ''), COALESCE(p.payment_type, ''),
+	COALESCE(p.transaction_id, ''), COALESCE(p.gross_amount, 0),
+	COALESCE((SELECT SUM(r.jumlah) FROM refunds r WHERE r.payment_id = p.id AND r.status = 'succeeded'), 0),
+	COALESCE(p.status, ''), p.created_at, p.updated_at`
+
+// where menyusun klausa WHERE beserta argumennya
+func (f PaymentLedgerFilter) where() (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	addFilter := func(clause string, value interface{}) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+
+	if f.Status != "" {
+		addFilter("p.status = $%d", f.Status)
+	}
+	if f.Kind != "" {
+		addFilter("p.kind = $%d", f.Kind)
+	}
+	if f.PaymentType != "" {
+		addFilter("p.payment_type = $%d", f.PaymentType)
+	}
+	if !f.From.IsZero() {
+		addFilter("p.created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		addFilter("p.created_at < $%d", f.To)
+	}
+	if f.UserID != 0 {
+		addFilter("u.id = $%d", f.UserID)
+	}
+	if f.Customer != "" {
+		addFilter("(u.name ILIKE $%[1]d OR u.email ILIKE $%[1]d OR p.customer_name ILIKE $%[1]d OR p.customer_email ILIKE $%[1]d)",
+			"%"+f.Customer+"%")
+	}
+
+	if len(where) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// CountPaymentLedger menghitung pembayaran yang cocok dengan filter
+func CountPaymentLedger(q database.Querier, f PaymentLedgerFilter) (int, error) {
+	whereSQL, args := f.where()
+	var total int
+	err := q.QueryRow(`SELECT COUNT(*)`+paymentLedgerFrom+whereSQL, args...).Scan(&total)
+	return total, err
+}
+
+// ListPaymentLedger mengambil pembayaran yang cocok dengan filter, yang terbaru lebih dulu.
+// limit 0 mengambil semua baris, dipakai untuk ekspor CSV.
+func ListPaymentLedger(q database.Querier, f PaymentLedgerFilter, limit, offset int) ([]model.PaymentLedgerEntry, error) {
+	whereSQL, args := f.where()
+	query := `SELECT ` + paymentLedgerColumns + paymentLedgerFrom + whereSQL + ` ORDER BY p.created_at DESC, p.id DESC`
+	if limit > 0 {
+		args = append(args, limit, offset)
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+	}
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []model.PaymentLedgerEntry{}
+	for rows.Next() {
+		var e model.PaymentLedgerEntry
+		err := rows.Scan(&e.ID, &e.OrderID, &e.Kind, &e.CustomOrderID, &e.OrderStatus, &e.UserID,
+			&e.CustomerName, &e.CustomerEmail, &e.PaymentType, &e.TransactionID, &e.GrossAmount,
+			&e.Refunded, &e.Status, &e.CreatedAt, &e.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
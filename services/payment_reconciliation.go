@@ -0,0 +1,282 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Jenis ketidaksesuaian pada laporan rekonsiliasi
+const (
+	MismatchOrderUnpaid      = "order_unpaid"      // pembayaran settlement tetapi pesanan belum lunas atau batal (perlu refund)
+	MismatchPaymentMissing   = "payment_missing"   // pesanan paid tanpa pembayaran settlement
+	MismatchDuplicatePayment = "duplicate_payment" // pembayaran utama pesanan masuk lebih dari sekali (perlu refund)
+	MismatchGatewayStatus    = "gateway_status"    // status payments berbeda dengan gateway
+	MismatchGatewayAmount    = "gateway_amount"    // gross_amount berbeda dengan gateway
+	MismatchGatewayMissing   = "gateway_missing"   // pembayaran settlement tidak ada di gateway
+	MismatchGatewayUnchecked = "gateway_unchecked" // status gateway gagal dibaca
+)
+
+// StalePayment adalah pembayaran pending yang belum mendapat notifikasi dari gateway
+type StalePayment struct {
+	OrderID     string
+	GrossAmount model.Rupiah
+	CreatedAt   time.Time
+}
+
+// StalePendingPayments mengambil pembayaran yang masih pending lebih lama dari staleAfter,
+// yang terlama lebih dulu
+func StalePendingPayments(q database.Querier, staleAfter time.Duration, limit int) ([]StalePayment, error) {
+	rows, err := q.Query(`
+		SELECT order_id, gross_amount, created_at FROM payments
+		WHERE status = 'pending' AND created_at < NOW() - $1 * INTERVAL '1 second'
+		ORDER BY created_at
+		LIMIT $2`, int64(staleAfter.Seconds()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []StalePayment
+	for rows.Next() {
+		var p StalePayment
+		if err := rows.Scan(&p.OrderID, &p.GrossAmount, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
+
+// NotificationFromGateway menyusun notifikasi dari status transaksi yang dibaca langsung dari
+// gateway supaya diproses dengan pemetaan status yang sama seperti webhook
+func NotificationFromGateway(orderID string, t GatewayTransaction) MidtransNotification {
+	return MidtransNotification{
+		OrderID:           orderID,
+		TransactionID:     t.TransactionID,
+		TransactionStatus: t.TransactionStatus,
+		FraudStatus:       t.FraudStatus,
+		GrossAmount:       t.GrossAmount,
+		PaymentType:       t.PaymentType,
+	}
+}
+
+// GetReconciliationReport membaca laporan rekonsiliasi satu tanggal beserta ketidaksesuaiannya
+func GetReconciliationReport(q database.Querier, tanggal time.Time) (model.ReconciliationReport, bool, error) {
+	var r model.ReconciliationReport
+	err := q.QueryRow(`
+		SELECT id, tanggal, diperiksa, created_at FROM payment_reconciliation_reports WHERE tanggal = $1`,
+		tanggal.Format("2006-01-02")).Scan(&r.ID, &r.Tanggal, &r.Diperiksa, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return r, false, nil
+	}
+	if err != nil {
+		return r, false, err
+	}
+
+	rows, err := q.Query(`
+		SELECT jenis, COALESCE(payment_order_id, ''), custom_order_id, status_pembayaran, status_pesanan,
+			status_gateway, keterangan
+		FROM payment_reconciliation_mismatches WHERE report_id = $1 ORDER BY id`, r.ID)
+	if err != nil {
+		return r, false, err
+	}
+	defer rows.Close()
+
+	r.Selisih = []model.ReconciliationMismatch{}
+	for rows.Next() {
+		var m model.ReconciliationMismatch
+		var customOrderID sql.NullInt64
+		if err := rows.Scan(&m.Jenis, &m.PaymentOrderID, &customOrderID, &m.StatusPembayaran, &m.StatusPesanan,
+			&m.StatusGateway, &m.Keterangan); err != nil {
+			return r, false, err
+		}
+		if customOrderID.Valid {
+			id := int(customOrderID.Int64)
+			m.CustomOrderID = &id
+		}
+		r.Selisih = append(r.Selisih, m)
+	}
+	return r, true, rows.Err()
+}
+
+// BuildReconciliationReport menyusun laporan rekonsiliasi untuk tanggal tertentu. Pencocokan payments
+// dengan custom_orders memakai kondisi saat ini, sedangkan pembayaran yang dibuat atau berubah pada
+// tanggal tersebut dicocokkan ke gateway.
+func BuildReconciliationReport(q database.Querier, gateway PaymentGateway, tanggal time.Time) (model.ReconciliationReport, error) {
+	report := model.ReconciliationReport{Tanggal: tanggal, Selisih: []model.ReconciliationMismatch{}}
+
+	orderMismatches, err := orderPaymentMismatches(q)
+	if err != nil {
+		return report, err
+	}
+	report.Selisih = append(report.Selisih, orderMismatches...)
+
+	gatewayMismatches, checked, err := gatewayMismatches(q, gateway, tanggal)
+	if err != nil {
+		return report, err
+	}
+	report.Selisih = append(report.Selisih, gatewayMismatches...)
+	report.Diperiksa = checked
+	return report, nil
+}
+
+// SaveReconciliationReport menyimpan laporan rekonsiliasi; laporan tanggal yang sama diganti
+func SaveReconciliationReport(q database.Querier, report *model.ReconciliationReport) error {
+	err := q.QueryRow(`
+		INSERT INTO payment_reconciliation_reports (tanggal, diperiksa)
+		VALUES ($1, $2)
+		ON CONFLICT (tanggal) DO UPDATE SET diperiksa = EXCLUDED.diperiksa, created_at = NOW()
+		RETURNING id, created_at`,
+		report.Tanggal.Format("2006-01-02"), report.Diperiksa).Scan(&report.ID, &report.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if _, err := q.Exec(`DELETE FROM payment_reconciliation_mismatches WHERE report_id = $1`, report.ID); err != nil {
+		return err
+	}
+	for _, m := range report.Selisih {
+		_, err := q.Exec(`
+			INSERT INTO payment_reconciliation_mismatches (report_id, jenis, payment_order_id, custom_order_id,
+				status_pembayaran, status_pesanan, status_gateway, keterangan)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8)`,
+			report.ID, m.Jenis, m.PaymentOrderID, m.CustomOrderID, m.StatusPembayaran, m.StatusPesanan,
+			m.StatusGateway, m.Keterangan)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderPaymentMismatches mencari pembayaran utama yang settlement padahal pesanannya belum lunas,
+// pembayaran apa pun yang settlement pada pesanan batal (dana perlu dikembalikan), pembayaran utama
+// kedua dan seterusnya pada pesanan yang sama, dan pesanan paid yang tidak punya satu pun pembayaran
+// settlement
+func orderPaymentMismatches(q database.Querier) ([]model.ReconciliationMismatch, error) {
+	rows, err := q.Query(`
+		SELECT $1::text, p.order_id, c.id, p.status, COALESCE(c.status, ''),
+			'pembayaran settlement, pesanan ' || COALESCE(c.status, '-') ||
+				CASE WHEN c.status = $6 THEN ': dana perlu dikembalikan' ELSE '' END
+		FROM payments p
+		JOIN custom_orders c ON c.id = p.custom_order_id
+		WHERE p.status = 'settlement'
+			AND ((p.kind = $3 AND COALESCE(c.status, '') IN ($4, $5)) OR c.status = $6)
+		UNION ALL
+		SELECT $2::text, COALESCE(c.order_id, ''), c.id, '', c.status, 'pesanan paid tanpa pembayaran settlement'
+		FROM custom_orders c
+		WHERE c.status = $7 AND c.total_harga > 0
+			AND NOT EXISTS (
+				SELECT 1 FROM payments p
+				WHERE (p.custom_order_id = c.id OR p.order_id = c.order_id)
+					AND p.status IN ('settlement', 'partial_refund')
+			)
+		UNION ALL
+		SELECT $8::text, p.order_id, c.id, p.status, COALESCE(c.status, ''), 'pembayaran utama ganda: dana perlu dikembalikan'
+		FROM payments p
+		JOIN custom_orders c ON c.id = p.custom_order_id
+		WHERE p.kind = $3 AND p.status = 'settlement' AND COALESCE(c.status, '') <> $6
+			AND EXISTS (
+				SELECT 1 FROM payments p2
+				WHERE p2.custom_order_id = c.id AND p2.kind = $3 AND p2.id < p.id
+					AND p2.status IN ('settlement', 'partial_refund', 'refund')
+			)
+		ORDER BY 3`,
+		MismatchOrderUnpaid, MismatchPaymentMissing, PaymentKindOrder,
+		OrderDraft, OrderAwaitingPayment, OrderCancelled, OrderPaid, MismatchDuplicatePayment)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mismatches []model.ReconciliationMismatch
+	for rows.Next() {
+		var m model.ReconciliationMismatch
+		var customOrderID int
+		if err := rows.Scan(&m.Jenis, &m.PaymentOrderID, &customOrderID, &m.StatusPembayaran, &m.StatusPesanan, &m.Keterangan); err != nil {
+			return nil, err
+		}
+		m.CustomOrderID = &customOrderID
+		mismatches = append(mismatches, m)
+	}
+	return mismatches, rows.Err()
+}
+
+// gatewayMismatches mencocokkan status dan nominal pembayaran yang dibuat atau berubah pada tanggal
+// tersebut dengan data transaksi di gateway
+func gatewayMismatches(q database.Querier, gateway PaymentGateway, tanggal time.Time) ([]model.ReconciliationMismatch, int, error) {
+	rows, err := q.Query(`
+		SELECT order_id, custom_order_id, COALESCE(status, ''), COALESCE(gross_amount, 0) FROM payments
+		WHERE created_at::date = $1 OR updated_at::date = $1
+		ORDER BY created_at`, tanggal.Format("2006-01-02"))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	type localPayment struct {
+		orderID       string
+		customOrderID *int
+		status        string
+		grossAmount   model.Rupiah
+	}
+	var payments []localPayment
+	for rows.Next() {
+		var p localPayment
+		var customOrderID sql.NullInt64
+		if err := rows.Scan(&p.orderID, &customOrderID, &p.status, &p.grossAmount); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		if customOrderID.Valid {
+			id := int(customOrderID.Int64)
+			p.customOrderID = &id
+		}
+		payments = append(payments, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var mismatches []model.ReconciliationMismatch
+	for _, p := range payments {
+		m := model.ReconciliationMismatch{
+			PaymentOrderID:   p.orderID,
+			CustomOrderID:    p.customOrderID,
+			StatusPembayaran: p.status,
+		}
+		t, err := gateway.GetStatus(p.orderID)
+		if errors.Is(err, ErrGatewayTransactionNotFound) {
+			// Transaksi yang tidak pernah dibayar pelanggan memang tidak tercatat di gateway
+			switch p.status {
+			case "settlement", "partial_refund", "refund":
+				m.Jenis, m.Keterangan = MismatchGatewayMissing, "transaksi tidak ditemukan di gateway"
+				mismatches = append(mismatches, m)
+			}
+			continue
+		}
+		if err != nil {
+			m.Jenis, m.Keterangan = MismatchGatewayUnchecked, err.Error()
+			mismatches = append(mismatches, m)
+			continue
+		}
+
+		n := NotificationFromGateway(p.orderID, t)
+		m.StatusGateway = n.EffectiveStatus()
+		if m.StatusGateway != p.status {
+			m.Jenis = MismatchGatewayStatus
+			m.Keterangan = fmt.Sprintf("payments %s, gateway %s", p.status, m.StatusGateway)
+			mismatches = append(mismatches, m)
+		}
+		if gross, err := model.NewRupiah(t.GrossAmount); err != nil || gross != p.grossAmount {
+			m.Jenis = MismatchGatewayAmount
+			m.Keterangan = fmt.Sprintf("payments %s, gateway %s", p.grossAmount, t.GrossAmount)
+			mismatches = append(mismatches, m)
+		}
+	}
+	return mismatches, len(payments), nil
+}
@@ -0,0 +1,452 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Status jadwal pembayaran
+const (
+	ScheduleActive    = "active"
+	ScheduleSettled   = "settled"
+	ScheduleCancelled = "cancelled"
+)
+
+// Jenis dan status tagihan pada jadwal pembayaran
+const (
+	InstallmentDP      = "dp"
+	InstallmentCicilan = "cicilan"
+
+	InstallmentUnpaid = "unpaid"
+	InstallmentPaid   = "paid"
+)
+
+// Batas jadwal pembayaran
+const (
+	MinDownPayment             model.Persen = 1000 // 10%
+	MaxInstallments                         = 12
+	DefaultInstallmentInterval              = 30 // hari
+)
+
+var (
+	ErrInvalidSchedule     = errors.New("jadwal pembayaran tidak valid")
+	ErrScheduleNotFound    = errors.New("jadwal pembayaran tidak ditemukan")
+	ErrScheduleActive      = errors.New("pesanan memakai jadwal cicilan, bayar per tagihan")
+	ErrScheduleLocked      = errors.New("jadwal pembayaran tidak dapat diubah setelah ada pembayaran")
+	ErrScheduleOrderStatus = errors.New("jadwal pembayaran hanya untuk pesanan yang belum dibayar")
+	ErrInstallmentNotFound = errors.New("tagihan tidak ditemukan")
+	ErrInstallmentPaid     = errors.New("tagihan sudah lunas")
+	ErrInstallmentOrder    = errors.New("tagihan sebelumnya belum lunas")
+)
+
+// PaymentScheduleRequest adalah permintaan jadwal DP dan cicilan untuk sebuah pesanan
+type PaymentScheduleRequest struct {
+	DPPersen      model.Persen `json:"dp_persen"`
+	JumlahCicilan int          `json:"jumlah_cicilan"`
+	IntervalHari  int          `json:"interval_hari"`
+}
+
+// SplitInstallments membagi total menjadi DP yang jatuh tempo pada tanggal mulai dan cicilan
+// yang sama besar setiap interval hari. Sisa pembulatan ditambahkan ke cicilan terakhir.
+func SplitInstallments(total model.Rupiah, req PaymentScheduleRequest, start time.Time) ([]model.Installment, error) {
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	dp, err := total.MulPersen(req.DPPersen)
+	if err != nil {
+		return nil, err
+	}
+	installments := []model.Installment{{
+		Urutan:     0,
+		Jenis:      InstallmentDP,
+		Jumlah:     dp,
+		JatuhTempo: start,
+		Status:     InstallmentUnpaid,
+	}}
+
+	sisa := total - dp
+	per, err := sisa.MulRatio(1, int64(req.JumlahCicilan))
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= req.JumlahCicilan; i++ {
+		jumlah := per
+		if i == req.JumlahCicilan {
+			jumlah = sisa - per*model.Rupiah(req.JumlahCicilan-1)
+		}
+		installments = append(installments, model.Installment{
+			Urutan:     i,
+			Jenis:      InstallmentCicilan,
+			Jumlah:     jumlah,
+			JatuhTempo: start.AddDate(0, 0, i*req.IntervalHari),
+			Status:     InstallmentUnpaid,
+		})
+	}
+	return installments, nil
+}
+
+// CreatePaymentSchedule membuat jadwal DP dan cicilan untuk pesanan yang belum dibayar.
+// Jadwal lama yang belum pernah dibayar diganti.
+func CreatePaymentSchedule(q database.Querier, orderID int, req PaymentScheduleRequest, actor string) (model.PaymentSchedule, error) {
+	if req.IntervalHari == 0 {
+		req.IntervalHari = DefaultInstallmentInterval
+	}
+	s := model.PaymentSchedule{
+		OrderID:       orderID,
+		DPPersen:      req.DPPersen,
+		JumlahCicilan: req.JumlahCicilan,
+		IntervalHari:  req.IntervalHari,
+		Status:        ScheduleActive,
+		Actor:         actor,
+	}
+	if req.DPPersen < MinDownPayment || req.DPPersen >= model.PersenDenominator {
+		return s, fmt.Errorf("%w: dp_persen minimal %s%% dan kurang dari 100%%", ErrInvalidSchedule, MinDownPayment)
+	}
+	if req.JumlahCicilan < 1 || req.JumlahCicilan > MaxInstallments {
+		return s, fmt.Errorf("%w: jumlah_cicilan harus antara 1 dan %d", ErrInvalidSchedule, MaxInstallments)
+	}
+	if req.IntervalHari < 1 {
+		return s, fmt.Errorf("%w: interval_hari harus lebih dari 0", ErrInvalidSchedule)
+	}
+
+	var status string
+	err := q.QueryRow(`SELECT COALESCE(status, ''), total_harga FROM custom_orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&status, &s.Total)
+	if err == sql.ErrNoRows {
+		return s, ErrOrderNotFound
+	}
+	if err != nil {
+		return s, err
+	}
+	if status != OrderDraft && status != OrderAwaitingPayment {
+		return s, ErrScheduleOrderStatus
+	}
+	if s.Total <= 0 {
+		return s, fmt.Errorf("%w: total pesanan sudah lunas", ErrInvalidSchedule)
+	}
+	paid, err := PaidAmount(q, orderID)
+	if err != nil {
+		return s, err
+	}
+	if paid > 0 {
+		return s, ErrScheduleLocked
+	}
+	if _, err := q.Exec(`UPDATE payment_schedules SET status = $1 WHERE custom_order_id = $2 AND status = $3`,
+		ScheduleCancelled, orderID, ScheduleActive); err != nil {
+		return s, err
+	}
+
+	err = q.QueryRow(`
+		INSERT INTO payment_schedules (custom_order_id, dp_persen, jumlah_cicilan, interval_hari, total, status, actor)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		s.OrderID, s.DPPersen, s.JumlahCicilan, s.IntervalHari, s.Total, s.Status, s.Actor).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return s, err
+	}
+	installments, err := SplitInstallments(s.Total, req, s.CreatedAt)
+	if err != nil {
+		return s, err
+	}
+	for _, inst := range installments {
+		inst.ScheduleID = s.ID
+		err := q.QueryRow(`
+			INSERT INTO payment_installments (schedule_id, urutan, jenis, jumlah, jatuh_tempo, status)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+			inst.ScheduleID, inst.Urutan, inst.Jenis, inst.Jumlah, inst.JatuhTempo, inst.Status).Scan(&inst.ID)
+		if err != nil {
+			return s, err
+		}
+		s.Tagihan = append(s.Tagihan, inst)
+	}
+	s.Sisa = s.Total
+
+	return s, RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    orderID,
+		Tipe:       EventNote,
+		Keterangan: fmt.Sprintf("Jadwal pembayaran dibuat: DP %s%% dan %d cicilan", s.DPPersen, s.JumlahCicilan),
+		Actor:      actor,
+	})
+}
+
+const installmentColumns = `id, schedule_id, urutan, jenis, jumlah, jatuh_tempo, status,
+	COALESCE(payment_order_id, ''), paid_at, reminded_at`
+
+func scanInstallment(row rowScanner) (model.Installment, error) {
+	var i model.Installment
+	err := row.Scan(&i.ID, &i.ScheduleID, &i.Urutan, &i.Jenis, &i.Jumlah, &i.JatuhTempo, &i.Status,
+		&i.PaymentOrderID, &i.PaidAt, &i.RemindedAt)
+	return i, err
+}
+
+// GetPaymentSchedule membaca jadwal pembayaran pesanan yang masih berlaku (aktif atau lunas)
+// beserta semua tagihannya
+func GetPaymentSchedule(q database.Querier, orderID int) (model.PaymentSchedule, error) {
+	var s model.PaymentSchedule
+	err := q.QueryRow(`
+		SELECT id, custom_order_id, dp_persen, jumlah_cicilan, interval_hari, total, status, actor, created_at
+		FROM payment_schedules
+		WHERE custom_order_id = $1 AND status <> $2
+		ORDER BY id DESC LIMIT 1`, orderID, ScheduleCancelled).Scan(
+		&s.ID, &s.OrderID, &s.DPPersen, &s.JumlahCicilan, &s.IntervalHari, &s.Total, &s.Status, &s.Actor, &s.CreatedAt)
+	if err == sql.ErrNoRows {
+		return s, ErrScheduleNotFound
+	}
+	if err != nil {
+		return s, err
+	}
+
+	rows, err := q.Query(`SELECT `+installmentColumns+` FROM payment_installments WHERE schedule_id = $1 ORDER BY urutan`, s.ID)
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		inst, err := scanInstallment(rows)
+		if err != nil {
+			return s, err
+		}
+		if inst.Status == InstallmentPaid {
+			s.Terbayar += inst.Jumlah
+		}
+		s.Tagihan = append(s.Tagihan, inst)
+	}
+	s.Sisa = s.Total - s.Terbayar
+	return s, rows.Err()
+}
+
+// HasActivePaymentSchedule bernilai true jika pesanan dibayar lewat jadwal cicilan yang belum lunas
+func HasActivePaymentSchedule(q database.Querier, orderID int) (bool, error) {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM payment_schedules WHERE custom_order_id = $1 AND status = $2)`,
+		orderID, ScheduleActive).Scan(&exists)
+	return exists, err
+}
+
+// RemovePaymentSchedule membatalkan jadwal yang belum pernah dibayar sehingga pesanan
+// kembali dibayar penuh lewat CreatePayment
+func RemovePaymentSchedule(q database.Querier, orderID int, actor string) error {
+	s, err := GetPaymentSchedule(q, orderID)
+	if err != nil {
+		return err
+	}
+	if s.Status != ScheduleActive || s.Terbayar > 0 {
+		return ErrScheduleLocked
+	}
+	if _, err := q.Exec(`UPDATE payment_schedules SET status = $1 WHERE id = $2`, ScheduleCancelled, s.ID); err != nil {
+		return err
+	}
+	return RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    orderID,
+		Tipe:       EventNote,
+		Keterangan: "Jadwal pembayaran dibatalkan",
+		Actor:      actor,
+	})
+}
+
+// CancelPaymentSchedule menghentikan jadwal aktif karena pesanan dibatalkan. Pembayaran yang
+// sudah masuk dihitung sebagai kelebihan bayar oleh proses pembatalan.
+func CancelPaymentSchedule(q database.Querier, orderID int) error {
+	_, err := q.Exec(`UPDATE payment_schedules SET status = $1 WHERE custom_order_id = $2 AND status = $3`,
+		ScheduleCancelled, orderID, ScheduleActive)
+	return err
+}
+
+// PrepareInstallmentPayment mengunci tagihan ke-urutan yang akan dibayar. Tagihan harus dibayar
+// berurutan dan pesanan harus belum lunas.
+func PrepareInstallmentPayment(q database.Querier, orderID, urutan int) (model.Installment, error) {
+	var status string
+	err := q.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return model.Installment{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return model.Installment{}, err
+	}
+	if status != OrderDraft && status != OrderAwaitingPayment {
+		return model.Installment{}, ErrScheduleOrderStatus
+	}
+
+	inst, err := scanInstallment(q.QueryRow(`
+		SELECT `+installmentColumns+` FROM payment_installments
+		WHERE urutan = $2 AND schedule_id = (
+			SELECT id FROM payment_schedules WHERE custom_order_id = $1 AND status = $3
+		)
+		FOR UPDATE`, orderID, urutan, ScheduleActive))
+	if err == sql.ErrNoRows {
+		return inst, ErrInstallmentNotFound
+	}
+	if err != nil {
+		return inst, err
+	}
+	if inst.Status == InstallmentPaid {
+		return inst, ErrInstallmentPaid
+	}
+
+	var unpaidBefore int
+	err = q.QueryRow(`SELECT COUNT(*) FROM payment_installments WHERE schedule_id = $1 AND urutan < $2 AND status <> $3`,
+		inst.ScheduleID, inst.Urutan, InstallmentPaid).Scan(&unpaidBefore)
+	if err != nil {
+		return inst, err
+	}
+	if unpaidBefore > 0 {
+		return inst, ErrInstallmentOrder
+	}
+	return inst, nil
+}
+
+// AttachInstallmentPayment mencatat order ID Midtrans percobaan bayar terakhir pada tagihan
+func AttachInstallmentPayment(q database.Querier, installmentID int, paymentOrderID string) error {
+	_, err := q.Exec(`UPDATE payment_installments SET payment_order_id = $1 WHERE id = $2`, paymentOrderID, installmentID)
+	return err
+}
+
+// CancelPendingInstallmentPayments membatalkan percobaan bayar tagihan yang masih pending
+// supaya satu tagihan tidak terbayar dua kali
+func CancelPendingInstallmentPayments(q database.Querier, installmentID int) error {
+	rows, err := q.Query(`SELECT order_id FROM payments WHERE installment_id = $1 AND status = 'pending'`, installmentID)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for rows.Next() {
+		var paymentOrderID string
+		if err := rows.Scan(&paymentOrderID); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, paymentOrderID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return cancelPaymentOrders(q, pending)
+}
+
+// SettleInstallmentPayment memproses notifikasi Midtrans untuk DP atau cicilan. settled bernilai
+// true jika tagihan ini melunasi seluruh jadwal sehingga pesanan boleh menjadi paid.
+func SettleInstallmentPayment(q database.Querier, paymentOrderID, transactionStatus string) (model.Installment, bool, error) {
+	inst, err := scanInstallment(q.QueryRow(`
+		SELECT `+installmentColumns+` FROM payment_installments
+		WHERE id = (SELECT installment_id FROM payments WHERE order_id = $1)
+		FOR UPDATE`, paymentOrderID))
+	if err == sql.ErrNoRows {
+		return inst, false, ErrInstallmentNotFound
+	}
+	if err != nil {
+		return inst, false, err
+	}
+	if status, _ := OrderStatusForTransaction(transactionStatus); status != OrderPaid || inst.Status == InstallmentPaid {
+		return inst, false, nil
+	}
+
+	err = q.QueryRow(`
+		UPDATE payment_installments SET status = $1, payment_order_id = $2, paid_at = NOW()
+		WHERE id = $3 RETURNING paid_at`, InstallmentPaid, paymentOrderID, inst.ID).Scan(&inst.PaidAt)
+	if err != nil {
+		return inst, false, err
+	}
+	inst.Status, inst.PaymentOrderID = InstallmentPaid, paymentOrderID
+
+	var unpaid int
+	if err := q.QueryRow(`SELECT COUNT(*) FROM payment_installments WHERE schedule_id = $1 AND status <> $2`,
+		inst.ScheduleID, InstallmentPaid).Scan(&unpaid); err != nil {
+		return inst, false, err
+	}
+	if unpaid > 0 {
+		return inst, false, nil
+	}
+	_, err = q.Exec(`UPDATE payment_schedules SET status = $1 WHERE id = $2 AND status = $3`, ScheduleSettled, inst.ScheduleID, ScheduleActive)
+	return inst, err == nil, err
+}
+
+// ResizePaymentSchedule menyesuaikan tagihan yang belum dibayar setelah total pesanan berubah.
+// Sisa tagihan dibagi rata ke tagihan yang belum lunas dengan jatuh tempo yang sama.
+// handled bernilai false jika pesanan tidak memakai jadwal aktif.
+func ResizePaymentSchedule(q database.Querier, orderID int, total model.Rupiah) (bool, error) {
+	s, err := GetPaymentSchedule(q, orderID)
+	if errors.Is(err, ErrScheduleNotFound) || (err == nil && s.Status != ScheduleActive) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var unpaid []model.Installment
+	for _, inst := range s.Tagihan {
+		if inst.Status != InstallmentPaid {
+			unpaid = append(unpaid, inst)
+		}
+	}
+	sisa := total - s.Terbayar
+	if len(unpaid) == 0 || sisa <= 0 {
+		return true, fmt.Errorf("%w: total baru tidak menyisakan tagihan", ErrScheduleLocked)
+	}
+
+	per, err := sisa.MulRatio(1, int64(len(unpaid)))
+	if err != nil {
+		return true, err
+	}
+	for i, inst := range unpaid {
+		jumlah := per
+		if i == len(unpaid)-1 {
+			jumlah = sisa - per*model.Rupiah(len(unpaid)-1)
+		}
+		if _, err := q.Exec(`UPDATE payment_installments SET jumlah = $1 WHERE id = $2`, jumlah, inst.ID); err != nil {
+			return true, err
+		}
+	}
+	_, err = q.Exec(`UPDATE payment_schedules SET total = $1 WHERE id = $2`, total, s.ID)
+	return true, err
+}
+
+// SendInstallmentReminders mengirim email pengingat untuk tagihan yang jatuh tempo dalam
+// beberapa hari ke depan (termasuk yang sudah lewat). Setiap tagihan hanya diingatkan sekali.
+func SendInstallmentReminders(q database.Querier, withinDays int) (int, error) {
+	rows, err := q.Query(`
+		SELECT i.id, i.urutan, i.jenis, i.jumlah, i.jatuh_tempo, s.custom_order_id
+		FROM payment_installments i
+		JOIN payment_schedules s ON s.id = i.schedule_id
+		WHERE s.status = $1 AND i.status = $2 AND i.reminded_at IS NULL
+			AND i.jatuh_tempo <= CURRENT_DATE + $3::int
+		ORDER BY i.jatuh_tempo, i.id`, ScheduleActive, InstallmentUnpaid, withinDays)
+	if err != nil {
+		return 0, err
+	}
+	type reminder struct {
+		inst    model.Installment
+		orderID int
+	}
+	var due []reminder
+	for rows.Next() {
+		var r reminder
+		if err := rows.Scan(&r.inst.ID, &r.inst.Urutan, &r.inst.Jenis, &r.inst.Jumlah, &r.inst.JatuhTempo, &r.orderID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for n, r := range due {
+		tagihan := "DP"
+		if r.inst.Jenis == InstallmentCicilan {
+			tagihan = fmt.Sprintf("Cicilan ke-%d", r.inst.Urutan)
+		}
+		html := fmt.Sprintf("<p>%s pesanan #%d sebesar %s jatuh tempo pada %s.</p><p>Silakan lakukan pembayaran melalui halaman pesanan Anda.</p>",
+			tagihan, r.orderID, FormatRupiah(r.inst.Jumlah), r.inst.JatuhTempo.Format("02-01-2006"))
+		NotifyOrderOwner(q, r.orderID, fmt.Sprintf("Pengingat pembayaran pesanan #%d", r.orderID), html)
+		if _, err := q.Exec(`UPDATE payment_installments SET reminded_at = NOW() WHERE id = $1`, r.inst.ID); err != nil {
+			return n, err
+		}
+		log.Printf("Pengingat %s pesanan %d dikirim", tagihan, r.orderID)
+	}
+	return len(due), nil
+}
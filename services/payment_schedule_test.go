@@ -0,0 +1,57 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"proyek3/model"
+)
+
+func TestSplitInstallments(t *testing.T) {
+	start := time.Date(2024, 1, 15, 22, 30, 0, 0, time.FixedZone("WIB", 7*3600))
+
+	tests := []struct {
+		name   string
+		total  model.Rupiah
+		req    PaymentScheduleRequest
+		jumlah []model.Rupiah // DP lalu cicilan
+	}{
+		{"sisa pembulatan di cicilan terakhir", 1000000, PaymentScheduleRequest{DPPersen: 3000, JumlahCicilan: 3, IntervalHari: 30}, []model.Rupiah{300000, 233333, 233333, 233334}},
+		{"satu cicilan", 1000001, PaymentScheduleRequest{DPPersen: 2500, JumlahCicilan: 1, IntervalHari: 14}, []model.Rupiah{250000, 750001}},
+		{"nominal kecil", 100, PaymentScheduleRequest{DPPersen: 5000, JumlahCicilan: 6, IntervalHari: 7}, []model.Rupiah{50, 8, 8, 8, 8, 8, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installments, err := SplitInstallments(tt.total, tt.req, start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(installments) != len(tt.jumlah) {
+				t.Fatalf("%d tagihan, ingin %d", len(installments), len(tt.jumlah))
+			}
+
+			var sum model.Rupiah
+			for i, inst := range installments {
+				sum += inst.Jumlah
+				if inst.Urutan != i || inst.Jumlah != tt.jumlah[i] || inst.Status != InstallmentUnpaid {
+					t.Fatalf("tagihan %d = %+v, ingin jumlah %s", i, inst, tt.jumlah[i])
+				}
+				jenis := InstallmentCicilan
+				if i == 0 {
+					jenis = InstallmentDP
+				}
+				if inst.Jenis != jenis {
+					t.Fatalf("tagihan %d berjenis %s, ingin %s", i, inst.Jenis, jenis)
+				}
+				// Jatuh tempo dihitung dari tanggal mulai, bukan jamnya
+				want := time.Date(2024, 1, 15+i*tt.req.IntervalHari, 0, 0, 0, 0, time.UTC)
+				if !inst.JatuhTempo.Equal(want) {
+					t.Fatalf("tagihan %d jatuh tempo %s, ingin %s", i, inst.JatuhTempo, want)
+				}
+			}
+			if sum != tt.total {
+				t.Fatalf("jumlah tagihan %s, ingin %s", sum, tt.total)
+			}
+		})
+	}
+}
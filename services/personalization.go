@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"proyek3/model"
+)
+
+var ErrInvalidPersonalisasi = errors.New("personalisasi tidak valid")
+
+// personalizationOptions adalah opsi personalisasi yang tersedia per jenis perhiasan.
+// MaxUkiran membatasi panjang ukiran selain batas per font; 0 berarti tidak bisa diukir.
+type personalizationOptions struct {
+	MaxUkiran    int
+	UkuranCincin bool
+}
+
+var personalizationByJenis = map[string]personalizationOptions{
+	"Cincin":  {MaxUkiran: 20, UkuranCincin: true},
+	"Gelang":  {MaxUkiran: 30},
+	"Liontin": {MaxUkiran: 12},
+	"Kalung":  {},
+	"Anting":  {},
+}
+
+// EngravingFonts adalah jumlah karakter maksimal per font ukiran
+var EngravingFonts = map[string]int{
+	"Script": 12,
+	"Serif":  18,
+	"Sans":   20,
+	"Block":  15,
+}
+
+// Finishes adalah pilihan finishing permukaan; Polish adalah bawaan tanpa biaya
+var Finishes = []string{"Polish", "Doff", "Hammered", "Brushed", "Sandblast"}
+
+// ValidatePersonalisasi memeriksa personalisasi terhadap aturan jenis perhiasan.
+// Teks ukiran dirapikan (spasi ganda dihapus) di tempat.
+func ValidatePersonalisasi(jenisPerhiasan string, p *model.Personalisasi) error {
+	if p == nil {
+		return nil
+	}
+	options := personalizationByJenis[jenisPerhiasan]
+
+	if p.Ukiran != nil {
+		if options.MaxUkiran == 0 {
+			return fmt.Errorf("%w: %s tidak bisa diukir", ErrInvalidPersonalisasi, jenisPerhiasan)
+		}
+		p.Ukiran.Teks = strings.Join(strings.Fields(p.Ukiran.Teks), " ")
+		if p.Ukiran.Teks == "" {
+			return fmt.Errorf("%w: teks ukiran kosong", ErrInvalidPersonalisasi)
+		}
+		fontLimit, ok := EngravingFonts[p.Ukiran.Font]
+		if !ok {
+			return fmt.Errorf("%w: font ukiran %q tidak tersedia", ErrInvalidPersonalisasi, p.Ukiran.Font)
+		}
+		limit := fontLimit
+		if options.MaxUkiran < limit {
+			limit = options.MaxUkiran
+		}
+		if n := utf8.RuneCountInString(p.Ukiran.Teks); n > limit {
+			return fmt.Errorf("%w: ukiran maksimal %d karakter untuk font %s pada %s", ErrInvalidPersonalisasi, limit, p.Ukiran.Font, jenisPerhiasan)
+		}
+		for _, r := range p.Ukiran.Teks {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(" .,&'-♥", r) {
+				return fmt.Errorf("%w: karakter %q tidak bisa diukir", ErrInvalidPersonalisasi, r)
+			}
+		}
+		switch p.Ukiran.Letak {
+		case "":
+			p.Ukiran.Letak = "dalam"
+		case "dalam", "luar":
+		default:
+			return fmt.Errorf("%w: letak ukiran harus dalam atau luar", ErrInvalidPersonalisasi)
+		}
+	}
+
+	if p.UkuranCincin != nil {
+		if !options.UkuranCincin {
+			return fmt.Errorf("%w: ukuran cincin hanya untuk Cincin", ErrInvalidPersonalisasi)
+		}
+		if err := validateRingSize(p.UkuranCincin); err != nil {
+			return err
+		}
+	}
+
+	if p.Finishing != "" && !matchesAny(Finishes, p.Finishing) {
+		return fmt.Errorf("%w: finishing %q tidak tersedia", ErrInvalidPersonalisasi, p.Finishing)
+	}
+	return nil
+}
+
+// validateRingSize memeriksa ukuran cincin sesuai rentang tiap standar:
+// ID 1-30, US 3-13.5 (kelipatan 0.5), EU 44-70 (keliling dalam mm), UK A-Z
+func validateRingSize(size *model.UkuranCincin) error {
+	size.Ukuran = strings.TrimSpace(size.Ukuran)
+	invalid := fmt.Errorf("%w: ukuran cincin %s %q di luar rentang", ErrInvalidPersonalisasi, size.Standar, size.Ukuran)
+
+	switch size.Standar {
+	case "ID", "EU":
+		n, err := strconv.Atoi(size.Ukuran)
+		if err != nil {
+			return invalid
+		}
+		if (size.Standar == "ID" && (n < 1 || n > 30)) || (size.Standar == "EU" && (n < 44 || n > 70)) {
+			return invalid
+		}
+	case "US":
+		v, err := strconv.ParseFloat(size.Ukuran, 64)
+		if err != nil || v < 3 || v > 13.5 || v*2 != float64(int(v*2)) {
+			return invalid
+		}
+	case "UK":
+		size.Ukuran = strings.ToUpper(size.Ukuran)
+		if len(size.Ukuran) != 1 || size.Ukuran[0] < 'A' || size.Ukuran[0] > 'Z' {
+			return invalid
+		}
+	default:
+		return fmt.Errorf("%w: standar ukuran cincin harus ID, US, EU atau UK", ErrInvalidPersonalisasi)
+	}
+	return nil
+}
+
+// personalizationLines menghitung biaya tambahan ukiran dan finishing
+func personalizationLines(p *model.Personalisasi, rules PricingRules) []model.PriceLine {
+	if p == nil {
+		return nil
+	}
+	var lines []model.PriceLine
+	if p.Ukiran != nil {
+		if harga := rules.PersonalizationRates["ukiran:"+p.Ukiran.Font]; harga > 0 {
+			lines = append(lines, model.PriceLine{
+				Kode:       "personalisasi",
+				Keterangan: fmt.Sprintf("Ukiran %s \"%s\"", p.Ukiran.Font, p.Ukiran.Teks),
+				Jumlah:     harga,
+			})
+		}
+	}
+	if p.Finishing != "" {
+		if harga := rules.PersonalizationRates["finishing:"+p.Finishing]; harga > 0 {
+			lines = append(lines, model.PriceLine{
+				Kode:       "personalisasi",
+				Keterangan: "Finishing " + p.Finishing,
+				Jumlah:     harga,
+			})
+		}
+	}
+	return lines
+}
+
+// EncodePersonalisasi mengubah personalisasi menjadi nilai kolom JSONB (NULL jika kosong)
+func EncodePersonalisasi(p *model.Personalisasi) (interface{}, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return json.Marshal(p)
+}
+
+// DecodePersonalisasi membaca kolom JSONB personalisasi
+func DecodePersonalisasi(data []byte) (*model.Personalisasi, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var p model.Personalisasi
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// PriceSheet adalah salinan lengkap daftar harga: harga emas, biaya campuran dan aturan harga dari
+// database. Versinya diturunkan dari isinya, jadi perubahan tarif ongkos, pajak, batu, personalisasi
+// atau spread buyback otomatis menghasilkan versi baru.
+type PriceSheet struct {
+	GoldPrices map[string]model.Rupiah `json:"gold_prices"`
+	MixPrices  map[string]model.Rupiah `json:"mix_prices"`
+	Rules      PricingRules            `json:"rules"`
+}
+
+// NewPriceSheet menggabungkan harga emas dan campuran saat ini dengan aturan harga tertentu
+func NewPriceSheet(rules PricingRules) PriceSheet {
+	// Waktu berlaku pajak disamakan ke UTC supaya zona waktu koneksi database tidak mengubah versi
+	taxes := make([]TaxRate, len(rules.TaxRates))
+	for i, tax := range rules.TaxRates {
+		tax.EffectiveFrom = tax.EffectiveFrom.UTC()
+		taxes[i] = tax
+	}
+	rules.TaxRates = taxes
+	return PriceSheet{GoldPrices: GoldPrices, MixPrices: MixPrices, Rules: rules}
+}
+
+// Version adalah "ps-" diikuti 16 digit awal hash SHA-256 isi daftar harga
+func (s PriceSheet) Version() string {
+	data, _ := json.Marshal(s) // kunci map diurutkan sehingga hasilnya stabil
+	sum := sha256.Sum256(data)
+	return "ps-" + hex.EncodeToString(sum[:8])
+}
+
+// RecordPriceSheet menyimpan salinan daftar harga ke price_sheets sekali per versi lalu
+// mengembalikan versinya, sehingga harga di balik setiap price_sheet_version bisa ditelusuri.
+func RecordPriceSheet(q database.Querier, rules PricingRules) (string, error) {
+	sheet := NewPriceSheet(rules)
+	snapshot, err := json.Marshal(sheet)
+	if err != nil {
+		return "", err
+	}
+	version := sheet.Version()
+	_, err = q.Exec(`INSERT INTO price_sheets (version, snapshot) VALUES ($1, $2) ON CONFLICT (version) DO NOTHING`,
+		version, snapshot)
+	if err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// CurrentPriceSheetVersion mencatat daftar harga yang berlaku saat ini dan mengembalikan versinya
+func CurrentPriceSheetVersion(q database.Querier) (string, error) {
+	return RecordPriceSheet(q, CurrentPricingRules())
+}
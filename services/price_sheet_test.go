@@ -0,0 +1,37 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"proyek3/model"
+)
+
+func TestPriceSheetVersionFollowsRules(t *testing.T) {
+	base := NewPriceSheet(DefaultPricingRules).Version()
+	if !strings.HasPrefix(base, "ps-") || len(base) > 32 {
+		t.Fatalf("versi %q tidak muat di price_sheet_version", base)
+	}
+	if again := NewPriceSheet(DefaultPricingRules).Version(); again != base {
+		t.Fatalf("versi berubah tanpa perubahan aturan: %s != %s", again, base)
+	}
+
+	// Zona waktu koneksi database tidak boleh mengubah versi
+	jakarta := DefaultPricingRules
+	jakarta.TaxRates = []TaxRate{{Name: "PPN", Rate: 110, EffectiveFrom: time.Date(2023, 5, 1, 7, 0, 0, 0, time.FixedZone("WIB", 7*3600))}}
+	if v := NewPriceSheet(jakarta).Version(); v != base {
+		t.Fatalf("versi berbeda hanya karena zona waktu: %s != %s", v, base)
+	}
+
+	changed := DefaultPricingRules
+	changed.StoneRates = map[string]model.Rupiah{"Zirkon": 30000}
+	if v := NewPriceSheet(changed).Version(); v == base {
+		t.Fatal("perubahan tarif batu tidak menghasilkan versi baru")
+	}
+	spread := DefaultPricingRules
+	spread.BuybackSpreads = map[string]model.Persen{"*": 600}
+	if v := NewPriceSheet(spread).Version(); v == base {
+		t.Fatal("perubahan spread buyback tidak menghasilkan versi baru")
+	}
+}
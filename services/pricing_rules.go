@@ -0,0 +1,245 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Mode perhitungan ongkos pembuatan
+const (
+	LaborPerGram = "per_gram"
+	LaborFlat    = "flat"
+)
+
+// LaborRate adalah ongkos pembuatan untuk satu jenis perhiasan
+type LaborRate struct {
+	JenisPerhiasan string       `json:"jenis_perhiasan"`
+	Mode           string       `json:"mode"`   // per_gram atau flat
+	Amount         model.Rupiah `json:"amount"` // rupiah per gram atau rupiah per buah
+}
+
+// TaxRate adalah tarif pajak (persen) yang berlaku mulai EffectiveFrom
+type TaxRate struct {
+	Name          string       `json:"name"`
+	Rate          model.Persen `json:"rate"`
+	EffectiveFrom time.Time    `json:"effective_from"`
+}
+
+// PricingRules berisi semua aturan harga di luar harga emas dan campuran
+type PricingRules struct {
+	LaborRates   map[string]LaborRate    `json:"labor_rates"`
+	DefaultLabor LaborRate               `json:"default_labor"`
+	TaxRates     []TaxRate               `json:"tax_rates"`   // diurutkan berdasarkan EffectiveFrom
+	StoneRates   map[string]model.Rupiah `json:"stone_rates"` // harga per butir berdasarkan jenis batu
+
+	// PersonalizationRates adalah biaya tambahan per opsi, dengan kode "ukiran:<font>" atau "finishing:<jenis>"
+	PersonalizationRates map[string]model.Rupiah `json:"personalization_rates"`
+
+	// BuybackSpreads adalah potongan harga beli kembali (persen) per jenis emas; "*" untuk jenis lain
+	BuybackSpreads map[string]model.Persen `json:"buyback_spreads"`
+}
+
+// DefaultPricingRules dipakai jika tabel aturan harga kosong atau tidak bisa dibaca
+var DefaultPricingRules = PricingRules{
+	LaborRates: map[string]LaborRate{
+		"Cincin":  {JenisPerhiasan: "Cincin", Mode: LaborPerGram, Amount: 50000},
+		"Kalung":  {JenisPerhiasan: "Kalung", Mode: LaborPerGram, Amount: 40000},
+		"Gelang":  {JenisPerhiasan: "Gelang", Mode: LaborPerGram, Amount: 45000},
+		"Anting":  {JenisPerhiasan: "Anting", Mode: LaborFlat, Amount: 150000},
+		"Liontin": {JenisPerhiasan: "Liontin", Mode: LaborFlat, Amount: 100000},
+	},
+	DefaultLabor: LaborRate{Mode: LaborPerGram, Amount: 50000},
+	TaxRates: []TaxRate{
+		{Name: "PPN", Rate: 110, EffectiveFrom: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)},
+	},
+	StoneRates: map[string]model.Rupiah{
+		"Zirkon":  25000,
+		"Mutiara": 150000,
+		"Ruby":    750000,
+		"Safir":   850000,
+		"Berlian": 2500000,
+	},
+	PersonalizationRates: map[string]model.Rupiah{
+		"ukiran:Script":       75000,
+		"ukiran:Serif":        50000,
+		"ukiran:Sans":         50000,
+		"ukiran:Block":        50000,
+		"finishing:Doff":      75000,
+		"finishing:Hammered":  150000,
+		"finishing:Brushed":   75000,
+		"finishing:Sandblast": 100000,
+	},
+	BuybackSpreads: map[string]model.Persen{
+		"*": 500,
+	},
+}
+
+// LaborRateFor mengembalikan ongkos pembuatan untuk jenis perhiasan
+func (rules PricingRules) LaborRateFor(jenisPerhiasan string) LaborRate {
+	if rate, ok := rules.LaborRates[jenisPerhiasan]; ok {
+		return rate
+	}
+	return rules.DefaultLabor
+}
+
+// BuybackSpreadFor mengembalikan potongan harga buyback untuk jenis emas
+func (rules PricingRules) BuybackSpreadFor(jenisEmas string) model.Persen {
+	if spread, ok := rules.BuybackSpreads[jenisEmas]; ok {
+		return spread
+	}
+	return rules.BuybackSpreads["*"]
+}
+
+// TaxRateAt mengembalikan tarif pajak terbaru yang sudah berlaku pada waktu at
+func (rules PricingRules) TaxRateAt(at time.Time) TaxRate {
+	var current TaxRate
+	for _, rate := range rules.TaxRates {
+		if rate.EffectiveFrom.After(at) {
+			break
+		}
+		current = rate
+	}
+	return current
+}
+
+// CurrentPricingRules membaca aturan harga dari database.
+// Tabel yang kosong atau gagal dibaca diganti dengan DefaultPricingRules.
+func CurrentPricingRules() PricingRules {
+	rules := DefaultPricingRules
+	if database.DB == nil {
+		return rules
+	}
+
+	if labor, err := loadLaborRates(); err != nil {
+		log.Printf("Error loading labor rates, using defaults: %v", err)
+	} else if len(labor) > 0 {
+		rules.LaborRates = labor
+		if def, ok := labor["*"]; ok {
+			rules.DefaultLabor = def
+		}
+	}
+
+	if taxes, err := loadTaxRates(); err != nil {
+		log.Printf("Error loading tax rates, using defaults: %v", err)
+	} else if len(taxes) > 0 {
+		rules.TaxRates = taxes
+	}
+
+	if stones, err := loadStoneRates(); err != nil {
+		log.Printf("Error loading stone rates, using defaults: %v", err)
+	} else if len(stones) > 0 {
+		rules.StoneRates = stones
+	}
+
+	if personalization, err := loadPersonalizationRates(); err != nil {
+		log.Printf("Error loading personalization rates, using defaults: %v", err)
+	} else if len(personalization) > 0 {
+		rules.PersonalizationRates = personalization
+	}
+
+	if spreads, err := loadBuybackSpreads(); err != nil {
+		log.Printf("Error loading buyback spreads, using defaults: %v", err)
+	} else if len(spreads) > 0 {
+		rules.BuybackSpreads = spreads
+	}
+
+	return rules
+}
+
+func loadLaborRates() (map[string]LaborRate, error) {
+	rows, err := database.DB.Query(`SELECT jenis_perhiasan, mode, amount FROM labor_rates`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := map[string]LaborRate{}
+	for rows.Next() {
+		var rate LaborRate
+		if err := rows.Scan(&rate.JenisPerhiasan, &rate.Mode, &rate.Amount); err != nil {
+			return nil, err
+		}
+		rates[rate.JenisPerhiasan] = rate
+	}
+	return rates, rows.Err()
+}
+
+func loadTaxRates() ([]TaxRate, error) {
+	rows, err := database.DB.Query(`SELECT name, rate, effective_from FROM tax_rates`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []TaxRate
+	for rows.Next() {
+		var rate TaxRate
+		if err := rows.Scan(&rate.Name, &rate.Rate, &rate.EffectiveFrom); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].EffectiveFrom.Before(rates[j].EffectiveFrom) })
+	return rates, rows.Err()
+}
+
+func loadStoneRates() (map[string]model.Rupiah, error) {
+	rows, err := database.DB.Query(`SELECT jenis, harga FROM stone_rates`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := map[string]model.Rupiah{}
+	for rows.Next() {
+		var jenis string
+		var harga model.Rupiah
+		if err := rows.Scan(&jenis, &harga); err != nil {
+			return nil, err
+		}
+		rates[jenis] = harga
+	}
+	return rates, rows.Err()
+}
+
+func loadPersonalizationRates() (map[string]model.Rupiah, error) {
+	rows, err := database.DB.Query(`SELECT kode, harga FROM personalization_rates`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := map[string]model.Rupiah{}
+	for rows.Next() {
+		var kode string
+		var harga model.Rupiah
+		if err := rows.Scan(&kode, &harga); err != nil {
+			return nil, err
+		}
+		rates[kode] = harga
+	}
+	return rates, rows.Err()
+}
+
+func loadBuybackSpreads() (map[string]model.Persen, error) {
+	rows, err := database.DB.Query(`SELECT jenis_emas, spread FROM buyback_spreads`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spreads := map[string]model.Persen{}
+	for rows.Next() {
+		var jenis string
+		var spread model.Persen
+		if err := rows.Scan(&jenis, &spread); err != nil {
+			return nil, err
+		}
+		spreads[jenis] = spread
+	}
+	return spreads, rows.Err()
+}
@@ -0,0 +1,506 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Tahap produksi perhiasan custom secara berurutan
+const (
+	StageDesignApproval = "design_approval"
+	StageCasting        = "casting"
+	StageSetting        = "setting"
+	StagePolishing      = "polishing"
+	StageQC             = "qc"
+)
+
+// ProductionStages adalah urutan tahap produksi
+var ProductionStages = []string{StageDesignApproval, StageCasting, StageSetting, StagePolishing, StageQC}
+
+// Status work order dan tahapnya
+const (
+	WorkOrderOpen      = "open"
+	WorkOrderDone      = "done"
+	WorkOrderCancelled = "cancelled"
+
+	StagePending    = "pending"
+	StageInProgress = "in_progress"
+	StageDone       = "done"
+	StageSkipped    = "skipped"
+)
+
+// DefaultProductionDays adalah estimasi awal lama produksi sejak pesanan dibayar
+const DefaultProductionDays = 14
+
+var (
+	ErrWorkOrderNotFound = errors.New("work order tidak ditemukan")
+	ErrWorkOrderClosed   = errors.New("work order sudah selesai atau dibatalkan")
+	ErrUnknownStage      = errors.New("tahap produksi tidak dikenal")
+	ErrStageOrder        = errors.New("tahap sebelumnya belum selesai")
+	ErrStageTransition   = errors.New("perubahan status tahap tidak diizinkan")
+	ErrStageWeight       = errors.New("berat keluar tidak boleh lebih besar dari berat masuk")
+)
+
+// StageUpdate berisi perubahan pada satu tahap; field nil tidak diubah
+type StageUpdate struct {
+	Status          *string
+	Pengrajin       *string
+	EstimasiSelesai *time.Time
+	BeratMasuk      *model.Gram
+	BeratKeluar     *model.Gram
+	Catatan         *string
+}
+
+// WorkshopFilter menyaring daftar pekerjaan di dashboard bengkel
+type WorkshopFilter struct {
+	Tahap     string
+	Pengrajin string
+}
+
+// IsProductionStage bernilai true jika tahap dikenal
+func IsProductionStage(tahap string) bool {
+	for _, s := range ProductionStages {
+		if s == tahap {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateWorkOrders membuat work order untuk setiap perhiasan custom pada pesanan yang baru dibayar.
+// Pesanan keranjang mendapat satu work order per item custom; perhiasan jadi tidak diproduksi.
+// Aman dipanggil berulang kali.
+func CreateWorkOrders(q database.Querier, orderID int) error {
+	var tipe, jenisPerhiasan, jenisEmas string
+	var berat model.Gram
+	err := q.QueryRow(`
+		SELECT COALESCE(tipe, 'custom'), jenis_perhiasan, jenis_emas, berat_emas
+		FROM custom_orders WHERE id = $1`, orderID).Scan(&tipe, &jenisPerhiasan, &jenisEmas, &berat)
+	if err == sql.ErrNoRows {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	estimasi := time.Now().AddDate(0, 0, DefaultProductionDays)
+	if tipe != OrderTypeCart {
+		return createWorkOrder(q, orderID, nil, fmt.Sprintf("%s %s %s gram", jenisPerhiasan, jenisEmas, berat), berat, estimasi)
+	}
+
+	items, err := OrderItems(q, orderID)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item.ItemType != model.ItemCustom {
+			continue
+		}
+		itemID := item.ID
+		deskripsi := fmt.Sprintf("%s %s %s gram x%d", item.JenisPerhiasan, item.JenisEmas, item.BeratEmas, item.Qty)
+		if err := createWorkOrder(q, orderID, &itemID, deskripsi, item.BeratEmas, estimasi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createWorkOrder(q database.Querier, orderID int, itemID *int, deskripsi string, berat model.Gram, estimasi time.Time) error {
+	var workOrderID int
+	err := q.QueryRow(`
+		INSERT INTO work_orders (custom_order_id, order_item_id, deskripsi, berat_target, tahap_saat_ini, estimasi_selesai)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (custom_order_id, COALESCE(order_item_id, 0)) DO NOTHING
+		RETURNING id`,
+		orderID, itemID, deskripsi, berat, ProductionStages[0], estimasi).Scan(&workOrderID)
+	if err == sql.ErrNoRows {
+		// Work order sudah dibuat sebelumnya
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, tahap := range ProductionStages {
+		if _, err := q.Exec(`
+			INSERT INTO work_order_stages (work_order_id, tahap, urutan) VALUES ($1, $2, $3)`,
+			workOrderID, tahap, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelWorkOrders menghentikan work order yang masih berjalan saat pesanan dibatalkan atau direfund
+func CancelWorkOrders(q database.Querier, orderID int) error {
+	_, err := q.Exec(`
+		UPDATE work_orders SET status = $1, completed_at = NOW()
+		WHERE custom_order_id = $2 AND status = $3`,
+		WorkOrderCancelled, orderID, WorkOrderOpen)
+	return err
+}
+
+// UpdateWorkOrderStage mengubah pengrajin, estimasi, berat atau status satu tahap.
+// Tahap hanya boleh dimulai setelah tahap sebelumnya selesai atau dilewati, dan status
+// pesanan diselaraskan dengan kemajuan produksi.
+func UpdateWorkOrderStage(q database.Querier, workOrderID int, tahap string, update StageUpdate, actor string) (model.WorkOrder, error) {
+	if !IsProductionStage(tahap) {
+		return model.WorkOrder{}, ErrUnknownStage
+	}
+
+	var orderID int
+	var status string
+	err := q.QueryRow(`SELECT custom_order_id, status FROM work_orders WHERE id = $1 FOR UPDATE`, workOrderID).Scan(&orderID, &status)
+	if err == sql.ErrNoRows {
+		return model.WorkOrder{}, ErrWorkOrderNotFound
+	}
+	if err != nil {
+		return model.WorkOrder{}, err
+	}
+	if status != WorkOrderOpen {
+		return model.WorkOrder{}, ErrWorkOrderClosed
+	}
+
+	workOrder, err := GetWorkOrder(q, workOrderID)
+	if err != nil {
+		return model.WorkOrder{}, err
+	}
+	var stage *model.WorkOrderStage
+	for i := range workOrder.Stages {
+		if workOrder.Stages[i].Tahap == tahap {
+			stage = &workOrder.Stages[i]
+		}
+	}
+	if stage == nil {
+		return model.WorkOrder{}, ErrUnknownStage
+	}
+
+	if update.Pengrajin != nil {
+		stage.Pengrajin = *update.Pengrajin
+	}
+	if update.EstimasiSelesai != nil {
+		stage.EstimasiSelesai = update.EstimasiSelesai
+	}
+	if update.BeratMasuk != nil {
+		stage.BeratMasuk = update.BeratMasuk
+	}
+	if update.BeratKeluar != nil {
+		stage.BeratKeluar = update.BeratKeluar
+	}
+	if update.Catatan != nil {
+		stage.Catatan = *update.Catatan
+	}
+	if stage.BeratMasuk != nil && stage.BeratKeluar != nil && *stage.BeratKeluar > *stage.BeratMasuk {
+		return model.WorkOrder{}, ErrStageWeight
+	}
+
+	note := ""
+	if update.Status != nil && *update.Status != stage.Status {
+		if err := checkStageTransition(workOrder.Stages, *stage, *update.Status); err != nil {
+			return model.WorkOrder{}, err
+		}
+		if tahap == StageDesignApproval && *update.Status == StageDone {
+			if err := CheckDesignApproved(q, orderID); err != nil {
+				return model.WorkOrder{}, err
+			}
+		}
+		now := time.Now()
+		switch *update.Status {
+		case StageInProgress:
+			stage.StartedAt = &now
+			note = fmt.Sprintf("Tahap %s dimulai", tahap)
+		case StageDone:
+			if stage.StartedAt == nil {
+				stage.StartedAt = &now
+			}
+			stage.CompletedAt = &now
+			note = fmt.Sprintf("Tahap %s selesai", tahap)
+		case StageSkipped:
+			stage.CompletedAt = &now
+			note = fmt.Sprintf("Tahap %s dilewati", tahap)
+		}
+		if stage.Pengrajin != "" {
+			note += " (pengrajin: " + stage.Pengrajin + ")"
+		}
+		stage.Status = *update.Status
+	}
+
+	_, err = q.Exec(`
+		UPDATE work_order_stages
+		SET status = $1, pengrajin = $2, estimasi_selesai = $3, berat_masuk = $4, berat_keluar = $5,
+			catatan = $6, started_at = $7, completed_at = $8
+		WHERE id = $9`,
+		stage.Status, stage.Pengrajin, stage.EstimasiSelesai, stage.BeratMasuk, stage.BeratKeluar,
+		stage.Catatan, stage.StartedAt, stage.CompletedAt, stage.ID)
+	if err != nil {
+		return model.WorkOrder{}, err
+	}
+
+	// Tahap saat ini adalah tahap pertama yang belum selesai atau dilewati
+	current, woStatus := StageQC, WorkOrderDone
+	for _, s := range workOrder.Stages {
+		if s.Status != StageDone && s.Status != StageSkipped {
+			current, woStatus = s.Tahap, WorkOrderOpen
+			break
+		}
+	}
+	var completedAt *time.Time
+	if woStatus == WorkOrderDone {
+		now := time.Now()
+		completedAt = &now
+	}
+	_, err = q.Exec(`
+		UPDATE work_orders SET tahap_saat_ini = $1, status = $2, completed_at = $3 WHERE id = $4`,
+		current, woStatus, completedAt, workOrderID)
+	if err != nil {
+		return model.WorkOrder{}, err
+	}
+
+	if note != "" {
+		err = RecordOrderEvent(q, model.OrderEvent{
+			OrderID:    orderID,
+			Tipe:       EventNote,
+			Keterangan: note,
+			Actor:      actor,
+			Internal:   true,
+		})
+		if err != nil {
+			return model.WorkOrder{}, err
+		}
+		if err := syncOrderProduction(q, orderID, actor); err != nil {
+			return model.WorkOrder{}, err
+		}
+	}
+
+	return GetWorkOrder(q, workOrderID)
+}
+
+// checkStageTransition memvalidasi perubahan status satu tahap.
+// Persetujuan desain dan QC tidak boleh dilewati.
+func checkStageTransition(stages []model.WorkOrderStage, stage model.WorkOrderStage, to string) error {
+	switch {
+	case stage.Status == StagePending && to == StageInProgress:
+	case stage.Status == StagePending && to == StageSkipped && stage.Tahap != StageDesignApproval && stage.Tahap != StageQC:
+	case stage.Status == StageInProgress && to == StageDone:
+	case stage.Status == StagePending && to == StageDone:
+	default:
+		return fmt.Errorf("%w: %s -> %s", ErrStageTransition, stage.Status, to)
+	}
+
+	for _, s := range stages {
+		if s.Urutan < stage.Urutan && s.Status != StageDone && s.Status != StageSkipped {
+			return fmt.Errorf("%w: %s", ErrStageOrder, s.Tahap)
+		}
+	}
+	return nil
+}
+
+// syncOrderProduction menyelaraskan status pesanan dengan work order: in_production setelah
+// desain disetujui, quality_check saat semua work order berada di QC, dan ready
+// setelah semua work order selesai
+func syncOrderProduction(q database.Querier, orderID int, actor string) error {
+	var total, done, atQC, started int
+	err := q.QueryRow(`
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE wo.status = 'done'),
+			COUNT(*) FILTER (WHERE wo.status = 'done' OR wo.tahap_saat_ini = 'qc'),
+			COUNT(*) FILTER (WHERE wo.status = 'done' OR wo.tahap_saat_ini <> 'design_approval')
+		FROM work_orders wo
+		WHERE wo.custom_order_id = $1 AND wo.status <> 'cancelled'`, orderID).Scan(&total, &done, &atQC, &started)
+	if err != nil || total == 0 {
+		return err
+	}
+
+	target := ""
+	switch {
+	case done == total:
+		target = OrderReady
+	case atQC == total:
+		target = OrderQualityCheck
+	case started > 0:
+		target = OrderInProduction
+	default:
+		return nil
+	}
+
+	var current string
+	if err := q.QueryRow(`SELECT status FROM custom_orders WHERE id = $1`, orderID).Scan(&current); err != nil {
+		return err
+	}
+
+	// Jalankan transisi satu per satu supaya riwayat status tetap lengkap
+	path := []string{OrderPaid, OrderInProduction, OrderQualityCheck, OrderReady}
+	from, to := indexOf(path, current), indexOf(path, target)
+	if from < 0 {
+		return nil
+	}
+	for i := from + 1; i <= to; i++ {
+		if err := TransitionOrder(q, orderID, path[i], actor, "Produksi: "+path[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func indexOf(list []string, value string) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// SetWorkOrderEstimate mengubah estimasi selesai work order
+func SetWorkOrderEstimate(q database.Querier, workOrderID int, estimasi time.Time) error {
+	res, err := q.Exec(`UPDATE work_orders SET estimasi_selesai = $1 WHERE id = $2`, estimasi, workOrderID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrWorkOrderNotFound
+	}
+	return nil
+}
+
+const workOrderColumns = `wo.id, wo.custom_order_id, COALESCE(wo.order_item_id, 0), wo.deskripsi, wo.berat_target, wo.status,
+	wo.tahap_saat_ini, wo.estimasi_selesai, wo.created_at, wo.completed_at,
+	COALESCE((SELECT SUM(s.berat_masuk - s.berat_keluar) FROM work_order_stages s
+		WHERE s.work_order_id = wo.id AND s.berat_masuk IS NOT NULL AND s.berat_keluar IS NOT NULL), 0),
+	(SELECT COALESCE(oi.personalisasi, o.personalisasi) FROM custom_orders o
+		LEFT JOIN order_items oi ON oi.id = wo.order_item_id WHERE o.id = wo.custom_order_id)`
+
+func scanWorkOrder(row rowScanner) (model.WorkOrder, error) {
+	var wo model.WorkOrder
+	var personalisasi []byte
+	err := row.Scan(&wo.ID, &wo.OrderID, &wo.OrderItemID, &wo.Deskripsi, &wo.BeratTarget, &wo.Status,
+		&wo.TahapSaatIni, &wo.EstimasiSelesai, &wo.CreatedAt, &wo.CompletedAt, &wo.Susut, &personalisasi)
+	if err != nil {
+		return wo, err
+	}
+	if wo.Personalisasi, err = DecodePersonalisasi(personalisasi); err != nil {
+		return wo, err
+	}
+	if wo.Status == WorkOrderOpen && wo.EstimasiSelesai != nil {
+		wo.Terlambat = time.Now().After(wo.EstimasiSelesai.AddDate(0, 0, 1))
+	}
+	return wo, nil
+}
+
+// GetWorkOrder membaca satu work order beserta tahapnya
+func GetWorkOrder(q database.Querier, workOrderID int) (model.WorkOrder, error) {
+	wo, err := scanWorkOrder(q.QueryRow(`SELECT `+workOrderColumns+` FROM work_orders wo WHERE wo.id = $1`, workOrderID))
+	if err == sql.ErrNoRows {
+		return wo, ErrWorkOrderNotFound
+	}
+	if err != nil {
+		return wo, err
+	}
+
+	rows, err := q.Query(`
+		SELECT id, tahap, urutan, status, pengrajin, estimasi_selesai, berat_masuk, berat_keluar,
+			catatan, started_at, completed_at
+		FROM work_order_stages
+		WHERE work_order_id = $1
+		ORDER BY urutan`, workOrderID)
+	if err != nil {
+		return wo, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s model.WorkOrderStage
+		if err := rows.Scan(&s.ID, &s.Tahap, &s.Urutan, &s.Status, &s.Pengrajin, &s.EstimasiSelesai,
+			&s.BeratMasuk, &s.BeratKeluar, &s.Catatan, &s.StartedAt, &s.CompletedAt); err != nil {
+			return wo, err
+		}
+		if s.BeratMasuk != nil && s.BeratKeluar != nil {
+			susut := *s.BeratMasuk - *s.BeratKeluar
+			s.Susut = &susut
+		}
+		wo.Stages = append(wo.Stages, s)
+	}
+	return wo, rows.Err()
+}
+
+// WorkOrdersForOrder membaca semua work order milik satu pesanan
+func WorkOrdersForOrder(q database.Querier, orderID int) ([]model.WorkOrder, error) {
+	rows, err := q.Query(`SELECT wo.id FROM work_orders wo WHERE wo.custom_order_id = $1 ORDER BY wo.id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	workOrders := []model.WorkOrder{}
+	for _, id := range ids {
+		wo, err := GetWorkOrder(q, id)
+		if err != nil {
+			return nil, err
+		}
+		workOrders = append(workOrders, wo)
+	}
+	return workOrders, nil
+}
+
+// WorkshopJob adalah satu baris di dashboard bengkel
+type WorkshopJob struct {
+	model.WorkOrder
+	Pengrajin string `json:"pengrajin"`
+}
+
+// WorkshopJobs mengembalikan work order yang masih berjalan dikelompokkan per tahap,
+// diurutkan dari estimasi selesai terdekat
+func WorkshopJobs(q database.Querier, filter WorkshopFilter) (map[string][]WorkshopJob, error) {
+	query := `
+		SELECT ` + workOrderColumns + `, COALESCE(s.pengrajin, '')
+		FROM work_orders wo
+		LEFT JOIN work_order_stages s ON s.work_order_id = wo.id AND s.tahap = wo.tahap_saat_ini
+		WHERE wo.status = 'open'
+			AND ($1 = '' OR wo.tahap_saat_ini = $1)
+			AND ($2 = '' OR s.pengrajin = $2)
+		ORDER BY COALESCE(s.estimasi_selesai, wo.estimasi_selesai) NULLS LAST, wo.id`
+	rows, err := q.Query(query, filter.Tahap, filter.Pengrajin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := map[string][]WorkshopJob{}
+	for _, tahap := range ProductionStages {
+		jobs[tahap] = []WorkshopJob{}
+	}
+	for rows.Next() {
+		var job WorkshopJob
+		var personalisasi []byte
+		wo := &job.WorkOrder
+		if err := rows.Scan(&wo.ID, &wo.OrderID, &wo.OrderItemID, &wo.Deskripsi, &wo.BeratTarget, &wo.Status,
+			&wo.TahapSaatIni, &wo.EstimasiSelesai, &wo.CreatedAt, &wo.CompletedAt, &wo.Susut, &personalisasi, &job.Pengrajin); err != nil {
+			return nil, err
+		}
+		if wo.Personalisasi, err = DecodePersonalisasi(personalisasi); err != nil {
+			return nil, err
+		}
+		if wo.EstimasiSelesai != nil {
+			wo.Terlambat = time.Now().After(wo.EstimasiSelesai.AddDate(0, 0, 1))
+		}
+		jobs[wo.TahapSaatIni] = append(jobs[wo.TahapSaatIni], job)
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"proyek3/config"
+	"proyek3/database"
+	"proyek3/model"
+)
+
+var (
+	ErrQuoteExpired   = errors.New("quote sudah kedaluwarsa")
+	ErrQuoteSignature = errors.New("tanda tangan quote tidak valid")
+)
+
+// NewQuote membuat penawaran harga untuk user berdasarkan daftar harga saat ini,
+// termasuk promosi otomatis dan voucher yang diminta.
+// Quote belum disimpan; pemanggil bertanggung jawab menyimpannya ke tabel quotes.
+func NewQuote(q database.Querier, userID int, req model.OrderRequest, now time.Time) (model.Quote, error) {
+	order := model.Order{
+		JenisPerhiasan:   req.JenisPerhiasan,
+		JenisEmas:        req.JenisEmas,
+		BeratEmas:        req.BeratEmas,
+		CampuranTambahan: req.CampuranTambahan,
+		PersentaseEmas:   req.PersentaseEmas,
+		Batu:             req.Batu,
+		Personalisasi:    req.Personalisasi,
+	}
+	rules := CurrentPricingRules()
+	breakdown, err := CalculateServerBreakdown(order, rules)
+	if err != nil {
+		return model.Quote{}, err
+	}
+	breakdown, err = ApplyVouchers(q, userID, order, breakdown, req.KodeVoucher, now)
+	if err != nil {
+		return model.Quote{}, err
+	}
+
+	priceSheetVersion, err := RecordPriceSheet(q, rules)
+	if err != nil {
+		return model.Quote{}, err
+	}
+
+	id, err := newQuoteID()
+	if err != nil {
+		return model.Quote{}, err
+	}
+
+	quote := model.Quote{
+		ID:                id,
+		UserID:            userID,
+		JenisPerhiasan:    req.JenisPerhiasan,
+		JenisEmas:         req.JenisEmas,
+		BeratEmas:         req.BeratEmas,
+		CampuranTambahan:  req.CampuranTambahan,
+		PersentaseEmas:    req.PersentaseEmas,
+		Batu:              req.Batu,
+		Personalisasi:     req.Personalisasi,
+		KodeVoucher:       req.KodeVoucher,
+		Rincian:           breakdown,
+		TotalHarga:        breakdown.Total,
+		PriceSheetVersion: priceSheetVersion,
+		ExpiresAt:         now.Add(config.QuoteValidity).UTC().Truncate(time.Second),
+	}
+	quote.Signature = signQuote(quote)
+	return quote, nil
+}
+
+// VerifyQuote memastikan quote tidak diubah sejak dibuat dan masih berlaku. Rincian tidak ikut
+// ditandatangani, jadi totalnya harus sama dengan TotalHarga yang ditandatangani.
+func VerifyQuote(quote model.Quote, now time.Time) error {
+	if !hmac.Equal([]byte(quote.Signature), []byte(signQuote(quote))) {
+		return ErrQuoteSignature
+	}
+	if quote.Rincian.Total != quote.TotalHarga {
+		return ErrQuoteSignature
+	}
+	if now.After(quote.ExpiresAt) {
+		return ErrQuoteExpired
+	}
+	return nil
+}
+
+// signQuote menandatangani semua field quote yang memengaruhi harga dengan HMAC-SHA256
+func signQuote(quote model.Quote) string {
+	batu, _ := json.Marshal(quote.Batu)
+	payload := fmt.Sprintf("%s|%d|%s|%s|%s|%s|%s|%s|%s|%s|%s|%d",
+		quote.ID, quote.UserID, quote.JenisPerhiasan, quote.JenisEmas, quote.BeratEmas,
+		quote.CampuranTambahan, quote.PersentaseEmas, batu, quote.KodeVoucher, quote.TotalHarga,
+		quote.PriceSheetVersion, quote.ExpiresAt.Unix())
+	if quote.Personalisasi != nil {
+		// Ditambahkan di akhir supaya tanda tangan quote tanpa personalisasi tidak berubah
+		personalisasi, _ := json.Marshal(quote.Personalisasi)
+		payload += "|" + string(personalisasi)
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.JwtSecret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newQuoteID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "Q-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"proyek3/config"
+	"proyek3/model"
+)
+
+func TestVerifyQuoteRejectsTamperedTotals(t *testing.T) {
+	config.JwtSecret = "test-secret"
+	now := time.Now()
+	quote := model.Quote{
+		ID:                "Q-test",
+		UserID:            7,
+		JenisPerhiasan:    "Cincin",
+		JenisEmas:         "Emas 22K",
+		BeratEmas:         2 * model.MilligramsPerGram,
+		PersentaseEmas:    7500,
+		Rincian:           model.PriceBreakdown{Subtotal: 4500000, Total: 4995000},
+		TotalHarga:        4995000,
+		PriceSheetVersion: "ps-test",
+		ExpiresAt:         now.Add(time.Hour).Truncate(time.Second),
+	}
+	quote.Signature = signQuote(quote)
+	if err := VerifyQuote(quote, now); err != nil {
+		t.Fatalf("quote asli ditolak: %v", err)
+	}
+
+	tampered := quote
+	tampered.Rincian.Total = 1000
+	if err := VerifyQuote(tampered, now); err != ErrQuoteSignature {
+		t.Fatalf("rincian diubah: %v, ingin ErrQuoteSignature", err)
+	}
+	tampered = quote
+	tampered.TotalHarga = 1000
+	tampered.Rincian.Total = 1000
+	if err := VerifyQuote(tampered, now); err != ErrQuoteSignature {
+		t.Fatalf("total diubah: %v, ingin ErrQuoteSignature", err)
+	}
+	if err := VerifyQuote(quote, now.Add(2*time.Hour)); err != ErrQuoteExpired {
+		t.Fatalf("quote kedaluwarsa: %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Status refund
+const (
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+)
+
+var (
+	ErrInvalidRefund     = errors.New("refund tidak valid")
+	ErrRefundInProgress  = errors.New("masih ada refund pesanan yang belum selesai diproses")
+	ErrNothingToRefund   = errors.New("tidak ada pembayaran pesanan yang bisa di-refund")
+	ErrRefundOrderStatus = errors.New("pesanan dengan status ini tidak bisa di-refund")
+)
+
+// RefundRequest adalah permintaan refund admin. Jumlah 0 berarti seluruh dana yang tersisa.
+// Restock kosong berarti stok dikembalikan jika barang belum diserahkan ke pelanggan.
+type RefundRequest struct {
+	Jumlah  model.Rupiah `json:"jumlah"`
+	Alasan  string       `json:"alasan"`
+	Restock *bool        `json:"restock"`
+}
+
+// refundablePayment adalah pembayaran lunas pesanan beserta dana yang sudah atau sedang di-refund
+type refundablePayment struct {
+	ID       int
+	OrderID  string
+	Gross    model.Rupiah
+	Refunded model.Rupiah
+}
+
+const refundColumns = `id, custom_order_id, payment_id, (SELECT order_id FROM payments WHERE id = payment_id),
+	jumlah, alasan, refund_key, status, keterangan, actor, created_at, completed_at`
+
+func scanRefund(row rowScanner) (model.Refund, error) {
+	var r model.Refund
+	err := row.Scan(&r.ID, &r.OrderID, &r.PaymentID, &r.PaymentOrderID, &r.Jumlah, &r.Alasan, &r.RefundKey,
+		&r.Status, &r.Keterangan, &r.Actor, &r.CreatedAt, &r.CompletedAt)
+	return r, err
+}
+
+// refundablePayments mengambil pembayaran lunas pesanan, yang terbaru lebih dulu
+func refundablePayments(q database.Querier, orderID int) ([]refundablePayment, error) {
+	rows, err := q.Query(`
+		SELECT p.id, p.order_id, p.gross_amount, COALESCE((
+			SELECT SUM(r.jumlah) FROM refunds r WHERE r.payment_id = p.id AND r.status IN ($2, $3)
+		), 0)
+		FROM payments p
+		LEFT JOIN custom_orders c ON c.order_id = p.order_id
+		WHERE (p.custom_order_id = $1 OR (p.custom_order_id IS NULL AND c.id = $1))
+			AND p.status IN ('settlement', 'partial_refund')
+		ORDER BY p.created_at DESC, p.id DESC`, orderID, RefundPending, RefundSucceeded)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []refundablePayment
+	for rows.Next() {
+		var p refundablePayment
+		if err := rows.Scan(&p.ID, &p.OrderID, &p.Gross, &p.Refunded); err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
+
+// ListRefunds menampilkan semua refund pesanan, yang terlama lebih dulu
+func ListRefunds(q database.Querier, orderID int) ([]model.Refund, error) {
+	rows, err := q.Query(`SELECT `+refundColumns+` FROM refunds WHERE custom_order_id = $1 ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refunds := []model.Refund{}
+	for rows.Next() {
+		r, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, r)
+	}
+	return refunds, rows.Err()
+}
+
+// PendingRefunds mengambil refund pesanan yang belum selesai, misalnya karena proses sebelumnya
+// terhenti setelah gateway dipanggil
+func PendingRefunds(q database.Querier, orderID int) ([]model.Refund, error) {
+	rows, err := q.Query(`SELECT `+refundColumns+` FROM refunds WHERE custom_order_id = $1 AND status = $2 ORDER BY id`,
+		orderID, RefundPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []model.Refund
+	for rows.Next() {
+		r, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, r)
+	}
+	return refunds, rows.Err()
+}
+
+// HasRefunds memeriksa apakah pembayaran (order ID Midtrans) pernah di-refund lewat API refund
+func HasRefunds(q database.Querier, paymentOrderID string) (bool, error) {
+	var exists bool
+	err := q.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM refunds r JOIN payments p ON p.id = r.payment_id WHERE p.order_id = $1)`,
+		paymentOrderID).Scan(&exists)
+	return exists, err
+}
+
+// PrepareRefunds mengunci pesanan lalu membagi jumlah refund ke pembayaran lunas, dimulai dari
+// pembayaran terbaru. Setiap bagian disimpan sebagai refund pending dengan refund_key unik
+// sebelum gateway dipanggil, sehingga refund yang terputus bisa dikirim ulang tanpa dobel.
+func PrepareRefunds(q database.Querier, orderID int, req RefundRequest, actor string) ([]model.Refund, error) {
+	var status string
+	err := q.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case OrderDraft, OrderAwaitingPayment, OrderRefunded:
+		return nil, fmt.Errorf("%w: %s", ErrRefundOrderStatus, status)
+	}
+	if req.Alasan == "" {
+		return nil, fmt.Errorf("%w: alasan wajib diisi", ErrInvalidRefund)
+	}
+	if req.Jumlah < 0 {
+		return nil, fmt.Errorf("%w: jumlah tidak boleh negatif", ErrInvalidRefund)
+	}
+
+	var pending bool
+	if err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM refunds WHERE custom_order_id = $1 AND status = $2)`,
+		orderID, RefundPending).Scan(&pending); err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrRefundInProgress
+	}
+
+	payments, err := refundablePayments(q, orderID)
+	if err != nil {
+		return nil, err
+	}
+	var available model.Rupiah
+	for _, p := range payments {
+		available += p.Gross - p.Refunded
+	}
+	if available <= 0 {
+		return nil, ErrNothingToRefund
+	}
+	remaining := req.Jumlah
+	if remaining == 0 {
+		remaining = available
+	}
+	if remaining > available {
+		return nil, fmt.Errorf("%w: jumlah melebihi dana yang bisa di-refund (%s)", ErrInvalidRefund, FormatRupiah(available))
+	}
+
+	var refunds []model.Refund
+	for i, p := range payments {
+		if remaining == 0 {
+			break
+		}
+		jumlah := p.Gross - p.Refunded
+		if jumlah <= 0 {
+			continue
+		}
+		if jumlah > remaining {
+			jumlah = remaining
+		}
+		refund := model.Refund{
+			OrderID:        orderID,
+			PaymentID:      p.ID,
+			PaymentOrderID: p.OrderID,
+			Jumlah:         jumlah,
+			Alasan:         req.Alasan,
+			RefundKey:      NewMidtransOrderID(fmt.Sprintf("rf-%d-%d", orderID, i)),
+			Status:         RefundPending,
+			Actor:          actor,
+		}
+		err := q.QueryRow(`
+			INSERT INTO refunds (custom_order_id, payment_id, jumlah, alasan, refund_key, status, actor)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, created_at`,
+			orderID, p.ID, jumlah, req.Alasan, refund.RefundKey, RefundPending, actor).Scan(&refund.ID, &refund.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+		remaining -= jumlah
+	}
+	return refunds, nil
+}
+
+// CompleteRefund menyimpan hasil pemanggilan gateway. Refund yang hasilnya belum pasti tetap pending
+// dengan keterangan error terakhir supaya dikirim ulang dengan refund_key yang sama.
+func CompleteRefund(q database.Querier, refund *model.Refund) error {
+	return q.QueryRow(`
+		UPDATE refunds SET status = $1, keterangan = $2,
+			completed_at = CASE WHEN $1 = 'pending' THEN NULL ELSE NOW() END
+		WHERE id = $3
+		RETURNING completed_at`, refund.Status, refund.Keterangan, refund.ID).Scan(&refund.CompletedAt)
+}
+
+// SettleRefunds menerapkan refund yang berhasil ke payments dan pesanan. Pembayaran yang dananya
+// kembali seluruhnya berstatus refund, sisanya partial_refund. Jika seluruh dana pesanan sudah
+// dikembalikan pesanan menjadi refunded: work order dihentikan, kredit tukar tambah dan tabungan
+// emas dikembalikan, dan stok dikembalikan jika restock. Refund sebagian menutup pesanan yang
+// sudah selesai atau batal sebagai partially_refunded; pesanan yang masih berjalan tetap berjalan.
+func SettleRefunds(q database.Querier, orderID int, refunds []model.Refund, restock *bool, actor string) (string, error) {
+	var total model.Rupiah
+	for _, r := range refunds {
+		if r.Status != RefundSucceeded {
+			continue
+		}
+		total += r.Jumlah
+		_, err := q.Exec(`
+			UPDATE payments p SET status = CASE WHEN p.gross_amount <= COALESCE((
+				SELECT SUM(r.jumlah) FROM refunds r WHERE r.payment_id = p.id AND r.status = $2
+			), 0) THEN 'refund' ELSE 'partial_refund' END, updated_at = NOW()
+			WHERE p.id = $1`, r.PaymentID, RefundSucceeded)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var status string
+	if err := q.QueryRow(`SELECT COALESCE(status, '') FROM custom_orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&status); err != nil {
+		return "", err
+	}
+	if total == 0 {
+		return status, nil
+	}
+
+	err := RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    orderID,
+		Tipe:       EventPayment,
+		Keterangan: "Refund " + FormatRupiah(total) + ": " + refunds[0].Alasan,
+		Actor:      actor,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payments, err := refundablePayments(q, orderID)
+	if err != nil {
+		return "", err
+	}
+	var remaining model.Rupiah
+	for _, p := range payments {
+		remaining += p.Gross - p.Refunded
+	}
+
+	if remaining > 0 {
+		if status != OrderCompleted && status != OrderCancelled {
+			return status, nil
+		}
+		if err := TransitionOrder(q, orderID, OrderPartiallyRefunded, actor, "Refund sebagian"); err != nil {
+			return "", err
+		}
+		return OrderPartiallyRefunded, nil
+	}
+
+	// Barang yang belum diserahkan kembali ke stok kecuali admin menentukan lain
+	doRestock := status == OrderPaid || status == OrderInProduction || status == OrderQualityCheck ||
+		status == OrderReady || status == OrderCancelled
+	if restock != nil {
+		doRestock = *restock
+	}
+	if err := TransitionOrder(q, orderID, OrderRefunded, actor, "Refund penuh"); err != nil {
+		return "", err
+	}
+	if err := ReleaseTradeInCredits(q, orderID); err != nil {
+		return "", err
+	}
+	if err := ReverseOrderSavings(q, orderID, actor); err != nil {
+		return "", err
+	}
+	if err := CancelPaymentSchedule(q, orderID); err != nil {
+		return "", err
+	}
+	if doRestock {
+		if err := RestockOrderItems(q, orderID); err != nil {
+			return "", err
+		}
+	}
+	return OrderRefunded, nil
+}
+
+// SendRefundEmail memberi tahu pelanggan tentang refund yang berhasil. Kegagalan hanya dicatat.
+func SendRefundEmail(q database.Querier, orderID int, refunds []model.Refund, status string) {
+	var total model.Rupiah
+	for _, r := range refunds {
+		if r.Status == RefundSucceeded {
+			total += r.Jumlah
+		}
+	}
+	if total == 0 {
+		return
+	}
+	content := fmt.Sprintf("<p>Dana pesanan #%d sebesar <b>%s</b> sudah kami kembalikan ke metode pembayaran Anda.</p><p>Alasan: %s</p>",
+		orderID, FormatRupiah(total), html.EscapeString(refunds[0].Alasan))
+	if status == OrderRefunded {
+		content += "<p>Seluruh pembayaran pesanan ini sudah dikembalikan.</p>"
+	}
+	content += "<p>Waktu dana diterima mengikuti ketentuan bank atau penyedia pembayaran.</p>"
+	NotifyOrderOwner(q, orderID, fmt.Sprintf("Refund pesanan #%d", orderID), content)
+}
@@ -0,0 +1,501 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Status setoran tabungan emas
+const (
+	SavingsDepositPending = "pending"
+	SavingsDepositSettled = "settled"
+	SavingsDepositFailed  = "failed"
+)
+
+// Jenis mutasi pada buku besar tabungan emas
+const (
+	SavingsEntryDeposit       = "deposit"        // setoran rupiah yang dikonversi ke gram
+	SavingsEntryOrder         = "order"          // gram ditarik sebagai perhiasan untuk pesanan
+	SavingsEntryOrderReversal = "order_reversal" // gram dikembalikan karena pesanan batal atau diubah
+	SavingsEntrySellback      = "sellback"       // gram dijual kembali ke toko dengan harga buyback
+)
+
+// MinSavingsDeposit adalah setoran terkecil yang diterima
+const MinSavingsDeposit model.Rupiah = 10000
+
+var (
+	ErrInvalidSavings         = errors.New("data tabungan emas tidak valid")
+	ErrSavingsAccountNotFound = errors.New("rekening tabungan emas tidak ditemukan")
+	ErrSavingsAccountExists   = errors.New("rekening tabungan emas untuk jenis emas ini sudah ada")
+	ErrInsufficientGold       = errors.New("saldo tabungan emas tidak cukup")
+	ErrSavingsLocked          = errors.New("tabungan emas hanya bisa dipakai sebelum pesanan dibayar")
+)
+
+// gramsForRupiah mengonversi rupiah ke gram pada harga per gram tertentu, dibulatkan ke bawah
+// supaya nilai gram tidak pernah melebihi uang yang dibayarkan
+func gramsForRupiah(jumlah, hargaPerGram model.Rupiah) model.Gram {
+	if hargaPerGram <= 0 || jumlah <= 0 {
+		return 0
+	}
+	return model.Gram(jumlah.Int64() * model.MilligramsPerGram / hargaPerGram.Int64())
+}
+
+// OpenSavingsAccount membuka rekening tabungan emas; satu rekening per jenis emas untuk setiap user
+func OpenSavingsAccount(q database.Querier, userID int, jenisEmas string) (model.SavingsAccount, error) {
+	account := model.SavingsAccount{UserID: userID, JenisEmas: strings.TrimSpace(jenisEmas)}
+	if _, ok := GoldPricePerGram(account.JenisEmas); !ok {
+		return account, ErrUnknownJenisEmas
+	}
+	err := q.QueryRow(`
+		INSERT INTO savings_accounts (user_id, jenis_emas) VALUES ($1, $2)
+		ON CONFLICT (user_id, jenis_emas) DO NOTHING
+		RETURNING id, created_at`, account.UserID, account.JenisEmas).Scan(&account.ID, &account.CreatedAt)
+	if err == sql.ErrNoRows {
+		return account, ErrSavingsAccountExists
+	}
+	return account, err
+}
+
+const savingsAccountColumns = `a.id, a.user_id, a.jenis_emas,
+	COALESCE((SELECT SUM(e.gram) FROM savings_ledger e WHERE e.account_id = a.id), 0), a.created_at`
+
+func scanSavingsAccount(row rowScanner) (model.SavingsAccount, error) {
+	var a model.SavingsAccount
+	err := row.Scan(&a.ID, &a.UserID, &a.JenisEmas, &a.Saldo, &a.CreatedAt)
+	return a, err
+}
+
+// GetSavingsAccount membaca rekening beserta saldonya. Dengan forUpdate rekening dikunci
+// supaya saldo tidak ditarik dua kali bersamaan.
+func GetSavingsAccount(q database.Querier, id int, forUpdate bool) (model.SavingsAccount, error) {
+	if forUpdate {
+		if _, err := q.Exec(`SELECT id FROM savings_accounts WHERE id = $1 FOR UPDATE`, id); err != nil {
+			return model.SavingsAccount{}, err
+		}
+	}
+	a, err := scanSavingsAccount(q.QueryRow(`SELECT `+savingsAccountColumns+` FROM savings_accounts a WHERE a.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return a, ErrSavingsAccountNotFound
+	}
+	return a, err
+}
+
+// ListSavingsAccounts membaca semua rekening tabungan emas milik user
+func ListSavingsAccounts(q database.Querier, userID int) ([]model.SavingsAccount, error) {
+	rows, err := q.Query(`SELECT `+savingsAccountColumns+` FROM savings_accounts a WHERE a.user_id = $1 ORDER BY a.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []model.SavingsAccount
+	for rows.Next() {
+		a, err := scanSavingsAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// SavingsSellbackPrice adalah harga per gram saat tabungan dijual kembali:
+// harga emas dari daftar harga saat ini dipotong spread buyback
+func SavingsSellbackPrice(jenisEmas string, rules PricingRules) (model.Rupiah, error) {
+	harga, ok := GoldPricePerGram(jenisEmas)
+	if !ok {
+		return 0, ErrUnknownJenisEmas
+	}
+	potongan, err := harga.MulPersen(rules.BuybackSpreadFor(jenisEmas))
+	if err != nil {
+		return 0, err
+	}
+	return harga - potongan, nil
+}
+
+func insertSavingsEntry(q database.Querier, e *model.SavingsEntry) error {
+	return q.QueryRow(`
+		INSERT INTO savings_ledger (account_id, tipe, gram, harga_per_gram, nilai, price_sheet_version,
+			deposit_id, custom_order_id, metode_pembayaran, referensi_pembayaran, keterangan, actor)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, 0), $9, $10, $11, $12)
+		RETURNING id, created_at`,
+		e.AccountID, e.Tipe, e.Gram, e.HargaPerGram, e.Nilai, e.PriceSheetVersion,
+		e.DepositID, e.CustomOrderID, e.MetodePembayaran, e.ReferensiPembayaran, e.Keterangan, e.Actor).Scan(&e.ID, &e.CreatedAt)
+}
+
+// SavingsStatement membaca mutasi rekening dalam rentang waktu [from, to) beserta saldo awal.
+// Waktu nol berarti tanpa batas. Saldo setiap mutasi adalah saldo setelah mutasi tersebut.
+func SavingsStatement(q database.Querier, accountID int, from, to time.Time) (model.Gram, []model.SavingsEntry, error) {
+	var saldoAwal model.Gram
+	if !from.IsZero() {
+		err := q.QueryRow(`SELECT COALESCE(SUM(gram), 0) FROM savings_ledger WHERE account_id = $1 AND created_at < $2`,
+			accountID, from).Scan(&saldoAwal)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var fromArg, toArg interface{}
+	if !from.IsZero() {
+		fromArg = from
+	}
+	if !to.IsZero() {
+		toArg = to
+	}
+	rows, err := q.Query(`
+		SELECT id, account_id, tipe, gram, harga_per_gram, nilai, price_sheet_version, deposit_id,
+			custom_order_id, metode_pembayaran, referensi_pembayaran, keterangan, actor, saldo, created_at
+		FROM (
+			SELECT e.*, SUM(e.gram) OVER (ORDER BY e.created_at, e.id) AS saldo
+			FROM savings_ledger e WHERE e.account_id = $1
+		) e
+		WHERE ($2::timestamptz IS NULL OR created_at >= $2) AND ($3::timestamptz IS NULL OR created_at < $3)
+		ORDER BY created_at, id`, accountID, fromArg, toArg)
+	if err != nil {
+		return saldoAwal, nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.SavingsEntry
+	for rows.Next() {
+		var e model.SavingsEntry
+		var depositID, orderID sql.NullInt64
+		err := rows.Scan(&e.ID, &e.AccountID, &e.Tipe, &e.Gram, &e.HargaPerGram, &e.Nilai, &e.PriceSheetVersion, &depositID,
+			&orderID, &e.MetodePembayaran, &e.ReferensiPembayaran, &e.Keterangan, &e.Actor, &e.Saldo, &e.CreatedAt)
+		if err != nil {
+			return saldoAwal, nil, err
+		}
+		e.DepositID, e.CustomOrderID = int(depositID.Int64), int(orderID.Int64)
+		entries = append(entries, e)
+	}
+	return saldoAwal, entries, rows.Err()
+}
+
+// NewSavingsDeposit menghitung gram yang didapat dari setoran dengan harga beli saat ini.
+// Harga dan versi daftar harga dikunci sampai pembayaran lunas.
+func NewSavingsDeposit(q database.Querier, account model.SavingsAccount, jumlah model.Rupiah) (model.SavingsDeposit, error) {
+	d := model.SavingsDeposit{AccountID: account.ID, Jumlah: jumlah, Status: SavingsDepositPending}
+	if jumlah < MinSavingsDeposit {
+		return d, fmt.Errorf("%w: setoran minimal %s", ErrInvalidSavings, FormatRupiah(MinSavingsDeposit))
+	}
+	harga, ok := GoldPricePerGram(account.JenisEmas)
+	if !ok {
+		return d, ErrUnknownJenisEmas
+	}
+	d.HargaPerGram = harga
+	d.Gram = gramsForRupiah(jumlah, harga)
+	if d.Gram <= 0 {
+		return d, fmt.Errorf("%w: setoran terlalu kecil untuk dikonversi ke gram", ErrInvalidSavings)
+	}
+	version, err := CurrentPriceSheetVersion(q)
+	if err != nil {
+		return d, err
+	}
+	d.PriceSheetVersion = version
+	return d, nil
+}
+
+// SaveSavingsDeposit menyimpan setoran yang menunggu pembayaran Midtrans
+func SaveSavingsDeposit(q database.Querier, d *model.SavingsDeposit) error {
+	return q.QueryRow(`
+		INSERT INTO savings_deposits (account_id, payment_order_id, jumlah, harga_per_gram, gram, price_sheet_version, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		d.AccountID, d.PaymentOrderID, d.Jumlah, d.HargaPerGram, d.Gram, d.PriceSheetVersion, d.Status).Scan(&d.ID, &d.CreatedAt)
+}
+
+// SettleSavingsDeposit memproses notifikasi Midtrans untuk setoran tabungan emas. Gram masuk ke
+// buku besar hanya sekali saat lunas; setoran yang gagal ditandai failed. found bernilai false
+// jika paymentOrderID bukan setoran tabungan.
+func SettleSavingsDeposit(q database.Querier, paymentOrderID, transactionStatus string) (bool, error) {
+	var d model.SavingsDeposit
+	err := q.QueryRow(`
+		SELECT id, account_id, jumlah, harga_per_gram, gram, price_sheet_version, status
+		FROM savings_deposits WHERE payment_order_id = $1 FOR UPDATE`, paymentOrderID).Scan(
+		&d.ID, &d.AccountID, &d.Jumlah, &d.HargaPerGram, &d.Gram, &d.PriceSheetVersion, &d.Status)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	status, _ := OrderStatusForTransaction(transactionStatus)
+	// Setoran yang sudah gagal tetap dikreditkan jika dananya ternyata masuk
+	if d.Status == SavingsDepositSettled || (d.Status == SavingsDepositFailed && status != OrderPaid) {
+		return true, nil
+	}
+	switch status {
+	case OrderPaid:
+		entry := model.SavingsEntry{
+			AccountID:         d.AccountID,
+			Tipe:              SavingsEntryDeposit,
+			Gram:              d.Gram,
+			HargaPerGram:      d.HargaPerGram,
+			Nilai:             d.Jumlah,
+			PriceSheetVersion: d.PriceSheetVersion,
+			DepositID:         d.ID,
+			Keterangan:        "Setoran " + FormatRupiah(d.Jumlah) + " (" + paymentOrderID + ")",
+			Actor:             ActorMidtrans,
+		}
+		if err := insertSavingsEntry(q, &entry); err != nil {
+			return true, err
+		}
+		_, err = q.Exec(`UPDATE savings_deposits SET status = $1, settled_at = NOW() WHERE id = $2`, SavingsDepositSettled, d.ID)
+	case OrderCancelled:
+		_, err = q.Exec(`UPDATE savings_deposits SET status = $1, settled_at = NOW() WHERE id = $2`, SavingsDepositFailed, d.ID)
+	}
+	return true, err
+}
+
+// SellBackSavings menjual kembali gram tabungan ke toko dengan harga buyback saat ini.
+// Uang dibayarkan tunai atau transfer oleh admin.
+func SellBackSavings(q database.Querier, accountID int, gram model.Gram, metode, referensi, actor string) (model.SavingsEntry, error) {
+	entry := model.SavingsEntry{AccountID: accountID, Tipe: SavingsEntrySellback, Actor: actor}
+	if gram <= 0 {
+		return entry, fmt.Errorf("%w: gram harus lebih dari 0", ErrInvalidSavings)
+	}
+	if metode != PayoutCash && metode != PayoutTransfer {
+		return entry, fmt.Errorf("%w: metode pembayaran harus tunai atau transfer", ErrInvalidSavings)
+	}
+	referensi = strings.TrimSpace(referensi)
+	if metode == PayoutTransfer && referensi == "" {
+		return entry, fmt.Errorf("%w: referensi transfer wajib diisi", ErrInvalidSavings)
+	}
+
+	account, err := GetSavingsAccount(q, accountID, true)
+	if err != nil {
+		return entry, err
+	}
+	if gram > account.Saldo {
+		return entry, ErrInsufficientGold
+	}
+	rules := CurrentPricingRules()
+	harga, err := SavingsSellbackPrice(account.JenisEmas, rules)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Gram = -gram
+	entry.HargaPerGram = harga
+	if entry.Nilai, err = harga.MulGram(gram); err != nil {
+		return entry, err
+	}
+	entry.PriceSheetVersion, err = RecordPriceSheet(q, rules)
+	if err != nil {
+		return entry, err
+	}
+	entry.MetodePembayaran = metode
+	entry.ReferensiPembayaran = referensi
+	entry.Keterangan = fmt.Sprintf("Jual kembali %s gram (potongan %s%%)", gram, rules.BuybackSpreadFor(account.JenisEmas))
+	if err := insertSavingsEntry(q, &entry); err != nil {
+		return entry, err
+	}
+	entry.Saldo = account.Saldo - gram
+	return entry, nil
+}
+
+// ApplySavings mengganti baris tabungan emas pada rincian harga. Seperti kredit tukar tambah,
+// nilainya dipotong dari total setelah pajak dan tidak boleh membuat total negatif.
+func ApplySavings(breakdown model.PriceBreakdown, lines []model.PriceLine) model.PriceBreakdown {
+	items := make([]model.PriceLine, 0, len(breakdown.Items)+len(lines))
+	for _, item := range breakdown.Items {
+		if item.Kode != "tabungan_emas" {
+			items = append(items, item)
+		}
+	}
+	breakdown.Total += breakdown.TabunganEmas
+	breakdown.TabunganEmas = 0
+	for _, line := range lines {
+		if line.Jumlah > 0 {
+			line.Jumlah = -line.Jumlah
+		}
+		if -line.Jumlah > breakdown.Total {
+			line.Jumlah = -breakdown.Total
+		}
+		if line.Jumlah == 0 {
+			continue
+		}
+		breakdown.TabunganEmas -= line.Jumlah
+		breakdown.Total += line.Jumlah
+		items = append(items, line)
+	}
+	breakdown.Items = items
+	return breakdown
+}
+
+// ReverseOrderSavings mengembalikan gram yang ditarik untuk pesanan dengan harga yang sama
+// saat ditarik, misalnya karena pesanan dibatalkan
+func ReverseOrderSavings(q database.Querier, orderID int, actor string) error {
+	rows, err := q.Query(`
+		SELECT account_id, harga_per_gram, price_sheet_version, SUM(gram)
+		FROM savings_ledger
+		WHERE custom_order_id = $1 AND tipe IN ($2, $3)
+		GROUP BY account_id, harga_per_gram, price_sheet_version
+		HAVING SUM(gram) < 0`, orderID, SavingsEntryOrder, SavingsEntryOrderReversal)
+	if err != nil {
+		return err
+	}
+	var reversals []model.SavingsEntry
+	for rows.Next() {
+		var e model.SavingsEntry
+		if err := rows.Scan(&e.AccountID, &e.HargaPerGram, &e.PriceSheetVersion, &e.Gram); err != nil {
+			rows.Close()
+			return err
+		}
+		reversals = append(reversals, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range reversals {
+		e.Tipe = SavingsEntryOrderReversal
+		e.Gram = -e.Gram
+		nilai, err := e.HargaPerGram.MulGram(e.Gram)
+		if err != nil {
+			return err
+		}
+		e.Nilai = nilai
+		e.CustomOrderID = orderID
+		e.Keterangan = fmt.Sprintf("Pengembalian tabungan dari pesanan #%d", orderID)
+		e.Actor = actor
+		if err := insertSavingsEntry(q, &e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetOrderSavings menarik gram dari tabungan emas pemilik pesanan sebagai perhiasan. Rekening yang
+// dipakai adalah rekening dengan jenis emas yang sama dengan pesanan, dan gram yang ditarik tidak
+// melebihi berat emas pesanan. gram nil berarti ditarik semaksimal mungkin; nol mengembalikan gram
+// ke tabungan. Transaksi pembayaran yang masih pending harus dibatalkan pemanggil.
+func SetOrderSavings(q database.Querier, orderID int, gram *model.Gram, actor string) (model.PriceBreakdown, error) {
+	breakdown, status, err := orderBreakdown(q, orderID, true)
+	if err != nil {
+		return breakdown, err
+	}
+	if status != OrderDraft && status != OrderAwaitingPayment {
+		return breakdown, ErrSavingsLocked
+	}
+	// Jadwal cicilan dihitung dari total saat dibuat sehingga total tidak boleh berubah lagi
+	if active, err := HasActivePaymentSchedule(q, orderID); err != nil {
+		return breakdown, err
+	} else if active {
+		return breakdown, ErrScheduleActive
+	}
+	if gram != nil && *gram < 0 {
+		return breakdown, fmt.Errorf("%w: gram tidak boleh negatif", ErrInvalidSavings)
+	}
+
+	var userID int
+	var jenisEmas string
+	var beratEmas model.Gram
+	err = q.QueryRow(`SELECT user_id, jenis_emas, berat_emas FROM custom_orders WHERE id = $1`, orderID).Scan(&userID, &jenisEmas, &beratEmas)
+	if err != nil {
+		return breakdown, err
+	}
+
+	// Gram yang sudah ditarik untuk pesanan ini dikembalikan dulu lalu ditarik ulang
+	if err := ReverseOrderSavings(q, orderID, actor); err != nil {
+		return breakdown, err
+	}
+
+	var lines []model.PriceLine
+	if gram == nil || *gram > 0 {
+		var accountID int
+		err := q.QueryRow(`SELECT id FROM savings_accounts WHERE user_id = $1 AND jenis_emas = $2`, userID, jenisEmas).Scan(&accountID)
+		if err == sql.ErrNoRows {
+			return breakdown, ErrSavingsAccountNotFound
+		}
+		if err != nil {
+			return breakdown, err
+		}
+		account, err := GetSavingsAccount(q, accountID, true)
+		if err != nil {
+			return breakdown, err
+		}
+		harga, ok := GoldPricePerGram(account.JenisEmas)
+		if !ok {
+			return breakdown, ErrUnknownJenisEmas
+		}
+
+		tarik := account.Saldo
+		if gram != nil {
+			if *gram > account.Saldo {
+				return breakdown, ErrInsufficientGold
+			}
+			tarik = *gram
+		}
+		if tarik > beratEmas {
+			tarik = beratEmas
+		}
+		// Nilai gram tidak boleh melebihi tagihan pesanan
+		nilai, err := harga.MulGram(tarik)
+		if err != nil {
+			return breakdown, err
+		}
+		if payable := breakdown.Total + breakdown.TabunganEmas; nilai > payable {
+			tarik = gramsForRupiah(payable, harga)
+			if nilai, err = harga.MulGram(tarik); err != nil {
+				return breakdown, err
+			}
+		}
+		if tarik <= 0 {
+			return breakdown, ErrInsufficientGold
+		}
+		priceSheetVersion, err := CurrentPriceSheetVersion(q)
+		if err != nil {
+			return breakdown, err
+		}
+
+		entry := model.SavingsEntry{
+			AccountID:         account.ID,
+			Tipe:              SavingsEntryOrder,
+			Gram:              -tarik,
+			HargaPerGram:      harga,
+			Nilai:             nilai,
+			PriceSheetVersion: priceSheetVersion,
+			CustomOrderID:     orderID,
+			Keterangan:        fmt.Sprintf("Ditarik sebagai perhiasan untuk pesanan #%d", orderID),
+			Actor:             actor,
+		}
+		if err := insertSavingsEntry(q, &entry); err != nil {
+			return breakdown, err
+		}
+		lines = append(lines, model.PriceLine{
+			Kode:       "tabungan_emas",
+			Keterangan: fmt.Sprintf("Tabungan emas %s gram", tarik),
+			Jumlah:     -entry.Nilai,
+		})
+	}
+
+	breakdown = ApplySavings(breakdown, lines)
+	rincian, err := json.Marshal(breakdown)
+	if err != nil {
+		return breakdown, err
+	}
+	if _, err := q.Exec(`UPDATE custom_orders SET total_harga = $1, rincian_harga = $2, updated_at = NOW() WHERE id = $3`,
+		breakdown.Total, rincian, orderID); err != nil {
+		return breakdown, err
+	}
+
+	keterangan := "Tabungan emas dikembalikan dari pesanan"
+	if breakdown.TabunganEmas > 0 {
+		keterangan = "Tabungan emas dipakai sebesar " + FormatRupiah(breakdown.TabunganEmas)
+	}
+	return breakdown, RecordOrderEvent(q, model.OrderEvent{
+		OrderID:    orderID,
+		Tipe:       EventNote,
+		Keterangan: keterangan,
+		Actor:      actor,
+	})
+}
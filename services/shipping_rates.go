@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"proyek3/config"
+	"proyek3/database"
+	"proyek3/model"
+)
+
+var ErrNoShippingRate = errors.New("layanan kurir tidak tersedia untuk tujuan ini")
+
+// ShippingRateRequest adalah data paket untuk menghitung ongkos kirim
+type ShippingRateRequest struct {
+	Asal          string       `json:"asal"`
+	Tujuan        string       `json:"tujuan"`
+	KodePos       string       `json:"kode_pos"`
+	Berat         model.Gram   `json:"berat"`
+	NilaiAsuransi model.Rupiah `json:"nilai_asuransi"`
+	Kurir         string       `json:"kurir,omitempty"` // kosong berarti semua kurir
+}
+
+// ShippingRate adalah tarif satu layanan kurir, termasuk premi asuransi paket
+type ShippingRate struct {
+	Kurir    string       `json:"kurir"`
+	Layanan  string       `json:"layanan"`
+	Ongkir   model.Rupiah `json:"ongkir"`
+	Asuransi model.Rupiah `json:"asuransi"`
+	Estimasi string       `json:"estimasi"`
+}
+
+// ShippingRateProvider menghitung tarif kurir yang tersedia untuk satu paket
+type ShippingRateProvider interface {
+	Rates(req ShippingRateRequest) ([]ShippingRate, error)
+}
+
+// NewShippingRateProvider memilih implementasi tarif sesuai config.ShippingRateProvider
+func NewShippingRateProvider() ShippingRateProvider {
+	if config.ShippingRateProvider == "http" {
+		return &HTTPRateProvider{
+			BaseURL: strings.TrimRight(config.ShippingRateURL, "/"),
+			APIKey:  config.ShippingRateAPIKey,
+			Client:  &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+	return CurrentStaticRates()
+}
+
+// FindShippingRate mencari tarif untuk kurir dan layanan tertentu
+func FindShippingRate(provider ShippingRateProvider, req ShippingRateRequest, layanan string) (ShippingRate, error) {
+	rates, err := provider.Rates(req)
+	if err != nil {
+		return ShippingRate{}, err
+	}
+	for _, rate := range rates {
+		if strings.EqualFold(rate.Kurir, req.Kurir) && strings.EqualFold(rate.Layanan, layanan) {
+			return rate, nil
+		}
+	}
+	return ShippingRate{}, ErrNoShippingRate
+}
+
+// StaticRate adalah satu baris tabel tarif per kilogram; Tujuan "*" berlaku untuk semua kota
+type StaticRate struct {
+	Kurir    string
+	Layanan  string
+	Tujuan   string
+	PerKg    model.Rupiah
+	Estimasi string
+}
+
+// StaticRateProvider menghitung ongkos kirim dari tabel tarif per kilogram.
+// Berat dibulatkan ke atas per kilogram dan premi asuransi adalah persentase nilai barang.
+type StaticRateProvider struct {
+	Table         []StaticRate
+	InsuranceRate model.Persen
+	MinInsurance  model.Rupiah
+}
+
+// DefaultStaticRates dipakai jika tabel shipping_rates kosong atau tidak bisa dibaca
+var DefaultStaticRates = StaticRateProvider{
+	Table: []StaticRate{
+		{Kurir: "JNE", Layanan: "REG", Tujuan: "*", PerKg: 12000, Estimasi: "2-3 hari"},
+		{Kurir: "JNE", Layanan: "YES", Tujuan: "*", PerKg: 22000, Estimasi: "1 hari"},
+		{Kurir: "SiCepat", Layanan: "REG", Tujuan: "*", PerKg: 11000, Estimasi: "2-3 hari"},
+		{Kurir: "SiCepat", Layanan: "BEST", Tujuan: "*", PerKg: 20000, Estimasi: "1 hari"},
+		{Kurir: "JNE", Layanan: "REG", Tujuan: "Bandung", PerKg: 8000, Estimasi: "1-2 hari"},
+		{Kurir: "SiCepat", Layanan: "REG", Tujuan: "Bandung", PerKg: 7000, Estimasi: "1-2 hari"},
+	},
+	InsuranceRate: 20, // 0,20% dari nilai barang
+	MinInsurance:  5000,
+}
+
+// CurrentStaticRates membaca tabel tarif dari database, dengan tarif bawaan sebagai cadangan
+func CurrentStaticRates() StaticRateProvider {
+	provider := DefaultStaticRates
+	if database.DB == nil {
+		return provider
+	}
+	table, err := loadStaticRates()
+	if err != nil {
+		log.Printf("Error loading shipping rates, using defaults: %v", err)
+		return provider
+	}
+	if len(table) > 0 {
+		provider.Table = table
+	}
+	return provider
+}
+
+func loadStaticRates() ([]StaticRate, error) {
+	rows, err := database.DB.Query(`SELECT kurir, layanan, tujuan, per_kg, estimasi FROM shipping_rates`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var table []StaticRate
+	for rows.Next() {
+		var rate StaticRate
+		if err := rows.Scan(&rate.Kurir, &rate.Layanan, &rate.Tujuan, &rate.PerKg, &rate.Estimasi); err != nil {
+			return nil, err
+		}
+		table = append(table, rate)
+	}
+	return table, rows.Err()
+}
+
+func (p StaticRateProvider) Rates(req ShippingRateRequest) ([]ShippingRate, error) {
+	// Berat ditagih per kilogram, dibulatkan ke atas, minimal 1 kg
+	const milligramsPerKg = 1000 * model.MilligramsPerGram
+	kg := (int64(req.Berat) + milligramsPerKg - 1) / milligramsPerKg
+	if kg < 1 {
+		kg = 1
+	}
+	asuransi, err := req.NilaiAsuransi.MulPersen(p.InsuranceRate)
+	if err != nil {
+		return nil, err
+	}
+	if asuransi < p.MinInsurance {
+		asuransi = p.MinInsurance
+	}
+
+	// Tarif khusus kota tujuan menggantikan tarif "*" untuk layanan yang sama
+	chosen := map[string]StaticRate{}
+	for _, row := range p.Table {
+		if req.Kurir != "" && !strings.EqualFold(row.Kurir, req.Kurir) {
+			continue
+		}
+		specific := strings.EqualFold(row.Tujuan, strings.TrimSpace(req.Tujuan))
+		if row.Tujuan != "*" && !specific {
+			continue
+		}
+		key := strings.ToUpper(row.Kurir + "/" + row.Layanan)
+		if _, ok := chosen[key]; !ok || specific {
+			chosen[key] = row
+		}
+	}
+
+	rates := make([]ShippingRate, 0, len(chosen))
+	for _, row := range chosen {
+		ongkir, err := row.PerKg.MulInt(kg)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, ShippingRate{
+			Kurir:    row.Kurir,
+			Layanan:  row.Layanan,
+			Ongkir:   ongkir,
+			Asuransi: asuransi,
+			Estimasi: row.Estimasi,
+		})
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].Kurir != rates[j].Kurir {
+			return rates[i].Kurir < rates[j].Kurir
+		}
+		return rates[i].Layanan < rates[j].Layanan
+	})
+	return rates, nil
+}
+
+// HTTPRateProvider meminta tarif ke layanan tarif eksternal melalui POST {BaseURL}/rates.
+// Body permintaan adalah ShippingRateRequest dan respons berbentuk {"rates": [ShippingRate...]},
+// sehingga bisa diarahkan ke stub lokal lewat SHIPPING_RATE_URL.
+type HTTPRateProvider struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+func (p *HTTPRateProvider) Rates(req ShippingRateRequest) ([]ShippingRate, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, p.BaseURL+"/rates", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+
+	resp, err := p.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("shipping rate service status %d: %s", resp.StatusCode, msg)
+	}
+
+	var result struct {
+		Rates []ShippingRate `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("shipping rate service response: %w", err)
+	}
+	// Tarif negatif akan mengurangi total pesanan, jadi seluruh respons dianggap tidak valid
+	for _, rate := range result.Rates {
+		if rate.Ongkir < 0 || rate.Asuransi < 0 {
+			return nil, fmt.Errorf("shipping rate service returned negative rate for %s %s: ongkir %s, asuransi %s",
+				rate.Kurir, rate.Layanan, rate.Ongkir, rate.Asuransi)
+		}
+	}
+	return result.Rates, nil
+}
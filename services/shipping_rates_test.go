@@ -0,0 +1,64 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestRateServer menjalankan layanan tarif palsu yang selalu menjawab dengan body tertentu
+func newTestRateServer(t *testing.T, body string) *HTTPRateProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/rates" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var req ShippingRateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("body permintaan: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return &HTTPRateProvider{BaseURL: srv.URL, APIKey: "test-key", Client: srv.Client()}
+}
+
+func TestHTTPRateProviderRates(t *testing.T) {
+	p := newTestRateServer(t, `{"rates": [{"kurir": "JNE", "layanan": "REG", "ongkir": 24000, "asuransi": 5000, "estimasi": "2-3 hari"}]}`)
+	rate, err := FindShippingRate(p, ShippingRateRequest{Tujuan: "Bandung", Berat: 1500000, Kurir: "jne"}, "reg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.Ongkir != 24000 || rate.Asuransi != 5000 {
+		t.Fatalf("tarif = %+v", rate)
+	}
+}
+
+func TestHTTPRateProviderRejectsNegativeRates(t *testing.T) {
+	for _, body := range []string{
+		`{"rates": [{"kurir": "JNE", "layanan": "REG", "ongkir": -24000, "asuransi": 5000}]}`,
+		`{"rates": [{"kurir": "JNE", "layanan": "REG", "ongkir": 24000, "asuransi": -1}]}`,
+	} {
+		p := newTestRateServer(t, body)
+		if rates, err := p.Rates(ShippingRateRequest{Tujuan: "Bandung", Berat: 1000000}); err == nil {
+			t.Fatalf("tarif negatif diterima: %+v", rates)
+		}
+	}
+}
+
+func TestHTTPRateProviderServiceError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	p := &HTTPRateProvider{BaseURL: srv.URL, Client: srv.Client()}
+	if _, err := p.Rates(ShippingRateRequest{}); err == nil {
+		t.Fatal("error status 503 tidak dikembalikan")
+	}
+}
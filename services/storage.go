@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"proyek3/config"
+)
+
+var ErrFileNotFound = errors.New("file tidak ditemukan")
+
+// Storage menyimpan file lampiran berdasarkan key, misalnya "orders/12/abc.jpg"
+type Storage interface {
+	Put(key, contentType string, r io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+}
+
+// NewStorage memilih implementasi Storage sesuai config.StorageDriver
+func NewStorage() Storage {
+	if config.StorageDriver == "supabase" {
+		return &SupabaseStorage{
+			BaseURL: strings.TrimRight(config.SupabaseURL, "/"),
+			Key:     config.SupabaseServiceKey,
+			Bucket:  config.SupabaseBucket,
+			Client:  &http.Client{Timeout: 30 * time.Second},
+		}
+	}
+	return LocalStorage{Dir: config.UploadDir}
+}
+
+// LocalStorage menyimpan file di folder lokal
+type LocalStorage struct {
+	Dir string
+}
+
+func (s LocalStorage) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
+
+func (s LocalStorage) Put(key, contentType string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s LocalStorage) Get(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrFileNotFound
+	}
+	return f, err
+}
+
+// SupabaseStorage menyimpan file di bucket privat Supabase Storage melalui REST API
+type SupabaseStorage struct {
+	BaseURL string
+	Key     string
+	Bucket  string
+	Client  *http.Client
+}
+
+func (s *SupabaseStorage) objectURL(key string) string {
+	return fmt.Sprintf("%s/storage/v1/object/%s/%s", s.BaseURL, s.Bucket, strings.TrimLeft(key, "/"))
+}
+
+func (s *SupabaseStorage) Put(key, contentType string, r io.Reader) error {
+	req, err := http.NewRequest(http.MethodPost, s.objectURL(key), r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Key)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("supabase storage upload status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (s *SupabaseStorage) Get(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Key)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		resp.Body.Close()
+		return nil, ErrFileNotFound
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("supabase storage download status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// crockford adalah alfabet Base32 Crockford yang dipakai ULID
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	ulidMu   sync.Mutex
+	ulidLast [16]byte
+)
+
+// NewULID membuat ULID: 48 bit waktu milidetik diikuti 80 bit acak, 26 karakter Base32 Crockford.
+// ULID pada milidetik yang sama menaikkan bagian acak ULID sebelumnya sehingga tetap urut dan unik.
+func NewULID() string {
+	ulidMu.Lock()
+	defer ulidMu.Unlock()
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixMilli()))
+	var id [16]byte
+	copy(id[:6], ts[2:])
+
+	if string(id[:6]) <= string(ulidLast[:6]) && incrementEntropy(&ulidLast) {
+		id = ulidLast
+	} else if _, err := rand.Read(id[6:]); err != nil {
+		panic("ulid: crypto/rand: " + err.Error())
+	}
+	ulidLast = id
+	return encodeULID(id)
+}
+
+// incrementEntropy menambah satu bagian acak ULID; false jika bagian acak sudah maksimal
+func incrementEntropy(id *[16]byte) bool {
+	for i := 15; i >= 6; i-- {
+		id[i]++
+		if id[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID menulis 128 bit ULID sebagai 26 karakter Base32 (130 bit dengan dua bit nol di depan)
+func encodeULID(id [16]byte) string {
+	out := make([]byte, 26)
+	for i := range out {
+		var v byte
+		for b := 0; b < 5; b++ {
+			bit := i*5 + b - 2
+			v <<= 1
+			if bit >= 0 && id[bit/8]&(0x80>>(bit%8)) != 0 {
+				v |= 1
+			}
+		}
+		out[i] = crockford[v]
+	}
+	return string(out)
+}
@@ -0,0 +1,420 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"proyek3/database"
+	"proyek3/model"
+)
+
+// Status redemption voucher
+const (
+	RedemptionReserved = "reserved" // dipesan saat pesanan dibuat, belum dibayar
+	RedemptionRedeemed = "redeemed" // pembayaran berhasil
+	RedemptionReleased = "released" // pembayaran gagal/kedaluwarsa/dibatalkan, kuota dikembalikan
+)
+
+var (
+	ErrVoucherNotFound      = errors.New("voucher tidak ditemukan")
+	ErrVoucherNotActive     = errors.New("voucher tidak berlaku saat ini")
+	ErrVoucherNotApplicable = errors.New("voucher tidak berlaku untuk perhiasan ini")
+	ErrVoucherMinPurchase   = errors.New("total belanja belum mencapai minimum voucher")
+	ErrVoucherExhausted     = errors.New("kuota voucher sudah habis")
+)
+
+const voucherColumns = `id, COALESCE(kode, ''), nama, tipe, persen, nominal, maks_diskon, min_pembelian,
+	batas_per_user, batas_total, berlaku_mulai, berlaku_sampai, jenis_perhiasan, jenis_emas, otomatis, aktif`
+
+// voucherItem adalah bagian pesanan yang diperiksa terhadap syarat jenis perhiasan dan jenis emas
+// voucher, beserta harganya sebelum pajak pesanan
+type voucherItem struct {
+	JenisPerhiasan string
+	JenisEmas      string
+	Subtotal       model.Rupiah
+}
+
+// ApplyVouchers menerapkan promosi otomatis terbaik dan voucher berkode (jika ada)
+// pada rincian harga. Promosi otomatis yang tidak memenuhi syarat dilewati, sedangkan
+// voucher berkode yang tidak memenuhi syarat mengembalikan error agar klien tahu alasannya.
+func ApplyVouchers(q database.Querier, userID int, order model.Order, breakdown model.PriceBreakdown, kode string, at time.Time) (model.PriceBreakdown, error) {
+	items := []voucherItem{{JenisPerhiasan: order.JenisPerhiasan, JenisEmas: order.JenisEmas, Subtotal: breakdown.Subtotal}}
+	return applyVouchers(q, userID, items, breakdown, kode, at)
+}
+
+// ApplyCartVouchers menerapkan voucher pada checkout keranjang. Syarat jenis perhiasan dan jenis
+// emas diperiksa per item, dan potongan hanya dihitung dari subtotal item yang memenuhi syarat.
+func ApplyCartVouchers(q database.Querier, userID int, cart []model.CartItem, breakdown model.PriceBreakdown, kode string, at time.Time) (model.PriceBreakdown, error) {
+	items := make([]voucherItem, 0, len(cart))
+	for _, item := range cart {
+		vi := voucherItem{Subtotal: item.Subtotal}
+		switch {
+		case item.Custom != nil:
+			vi.JenisPerhiasan, vi.JenisEmas = item.Custom.JenisPerhiasan, item.Custom.JenisEmas
+		case item.Emas != nil:
+			// Perhiasan jadi tidak punya jenis perhiasan, jenis emasnya mengikuti karat seperti di order_items
+			vi.JenisEmas = fmt.Sprintf("Emas %dK", item.Emas.Karatan)
+		}
+		items = append(items, vi)
+	}
+	return applyVouchers(q, userID, items, breakdown, kode, at)
+}
+
+func applyVouchers(q database.Querier, userID int, items []voucherItem, breakdown model.PriceBreakdown, kode string, at time.Time) (model.PriceBreakdown, error) {
+	promotions, err := loadAutomaticPromotions(q, at)
+	if err != nil {
+		return breakdown, err
+	}
+
+	var best *model.Voucher
+	var bestDiscount model.Rupiah
+	for i := range promotions {
+		promo := &promotions[i]
+		if checkVoucher(q, *promo, userID, items, breakdown, at) != nil {
+			continue
+		}
+		if discount := voucherDiscount(*promo, voucherBase(*promo, items, breakdown)); discount > bestDiscount {
+			best, bestDiscount = promo, discount
+		}
+	}
+	if best != nil {
+		breakdown = ApplyDiscount(breakdown, discountLine(*best, bestDiscount))
+	}
+
+	if kode == "" {
+		return breakdown, nil
+	}
+
+	voucher, err := loadVoucherByCode(q, kode)
+	if err == sql.ErrNoRows {
+		return breakdown, ErrVoucherNotFound
+	}
+	if err != nil {
+		return breakdown, err
+	}
+	if err := checkVoucher(q, voucher, userID, items, breakdown, at); err != nil {
+		return breakdown, err
+	}
+	return ApplyDiscount(breakdown, discountLine(voucher, voucherDiscount(voucher, voucherBase(voucher, items, breakdown)))), nil
+}
+
+// ApplyDiscount menambahkan baris diskon sebelum pajak lalu menghitung ulang pajak dan total.
+// Pajak dihitung dari subtotal setelah diskon.
+func ApplyDiscount(breakdown model.PriceBreakdown, line model.PriceLine) model.PriceBreakdown {
+	if line.Jumlah > 0 {
+		line.Jumlah = -line.Jumlah
+	}
+	// Diskon tidak boleh membuat harga sebelum pajak menjadi negatif
+	if remaining := breakdown.Subtotal - breakdown.Diskon; -line.Jumlah > remaining {
+		line.Jumlah = -remaining
+	}
+	breakdown.Diskon -= line.Jumlah
+
+	items := make([]model.PriceLine, 0, len(breakdown.Items)+1)
+	for _, item := range breakdown.Items {
+		if item.Kode != "pajak" {
+			items = append(items, item)
+		}
+	}
+	items = append(items, line)
+
+	// Harga setelah diskon tidak melebihi subtotal yang pajaknya sudah berhasil dihitung,
+	// sehingga perkalian ini tidak bisa melewati batas Rupiah
+	breakdown.Pajak, _ = (breakdown.Subtotal - breakdown.Diskon).MulPersen(breakdown.TarifPajak)
+	for _, item := range breakdown.Items {
+		if item.Kode == "pajak" {
+			item.Jumlah = breakdown.Pajak
+			items = append(items, item)
+		}
+	}
+	breakdown.Items = items
+	breakdown.Total = breakdown.Subtotal - breakdown.Diskon + breakdown.Pajak + breakdown.Ongkir - breakdown.TukarTambah - breakdown.TabunganEmas
+	return breakdown
+}
+
+// ReserveRedemptions mencatat pemakaian voucher untuk pesanan di dalam transaksi.
+// Baris voucher dikunci dan batas pemakaian diperiksa ulang supaya kuota tidak terlampaui
+// oleh pesanan yang dibuat bersamaan.
+func ReserveRedemptions(tx *sql.Tx, customOrderID, userID int, breakdown model.PriceBreakdown, at time.Time) error {
+	for _, line := range breakdown.Items {
+		if line.Kode != "diskon" || line.VoucherID == 0 {
+			continue
+		}
+
+		voucher, err := scanVoucher(tx.QueryRow(`SELECT `+voucherColumns+` FROM vouchers WHERE id = $1 FOR UPDATE`, line.VoucherID))
+		if err != nil {
+			return err
+		}
+		if !voucher.Aktif || at.Before(voucher.BerlakuMulai) || at.After(voucher.BerlakuSampai) {
+			return ErrVoucherNotActive
+		}
+		if err := checkVoucherUsage(tx, voucher, userID); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO voucher_redemptions (voucher_id, user_id, custom_order_id, diskon, status)
+			VALUES ($1, $2, $3, $4, $5)`,
+			voucher.ID, userID, customOrderID, -line.Jumlah, RedemptionReserved)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfirmRedemptions menandai voucher pesanan sebagai terpakai setelah pembayaran berhasil
+func ConfirmRedemptions(q database.Querier, customOrderID int) error {
+	_, err := q.Exec(`
+		UPDATE voucher_redemptions SET status = $1, updated_at = NOW()
+		WHERE custom_order_id = $2 AND status = $3`,
+		RedemptionRedeemed, customOrderID, RedemptionReserved)
+	return err
+}
+
+// ReleaseRedemptions mengembalikan kuota voucher jika pembayaran kedaluwarsa atau dibatalkan
+func ReleaseRedemptions(q database.Querier, customOrderID int) error {
+	_, err := q.Exec(`
+		UPDATE voucher_redemptions SET status = $1, updated_at = NOW()
+		WHERE custom_order_id = $2 AND status = $3`,
+		RedemptionReleased, customOrderID, RedemptionReserved)
+	return err
+}
+
+// SaveVoucher menyimpan voucher baru (ID nol) atau memperbarui voucher yang ada
+func SaveVoucher(q database.Querier, v *model.Voucher) error {
+	if err := validateVoucher(*v); err != nil {
+		return err
+	}
+
+	jenisPerhiasan, _ := json.Marshal(nonNil(v.JenisPerhiasan))
+	jenisEmas, _ := json.Marshal(nonNil(v.JenisEmas))
+	var kode interface{}
+	if v.Kode != "" {
+		kode = strings.ToUpper(strings.TrimSpace(v.Kode))
+	}
+
+	if v.ID == 0 {
+		return q.QueryRow(`
+			INSERT INTO vouchers (kode, nama, tipe, persen, nominal, maks_diskon, min_pembelian, batas_per_user,
+				batas_total, berlaku_mulai, berlaku_sampai, jenis_perhiasan, jenis_emas, otomatis, aktif)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			RETURNING id`,
+			kode, v.Nama, v.Tipe, v.Persen, v.Nominal, v.MaksDiskon, v.MinPembelian, v.BatasPerUser,
+			v.BatasTotal, v.BerlakuMulai, v.BerlakuSampai, jenisPerhiasan, jenisEmas, v.Otomatis, v.Aktif).Scan(&v.ID)
+	}
+
+	res, err := q.Exec(`
+		UPDATE vouchers SET kode = $1, nama = $2, tipe = $3, persen = $4, nominal = $5, maks_diskon = $6,
+			min_pembelian = $7, batas_per_user = $8, batas_total = $9, berlaku_mulai = $10, berlaku_sampai = $11,
+			jenis_perhiasan = $12, jenis_emas = $13, otomatis = $14, aktif = $15
+		WHERE id = $16`,
+		kode, v.Nama, v.Tipe, v.Persen, v.Nominal, v.MaksDiskon, v.MinPembelian, v.BatasPerUser,
+		v.BatasTotal, v.BerlakuMulai, v.BerlakuSampai, jenisPerhiasan, jenisEmas, v.Otomatis, v.Aktif, v.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// validateVoucher menolak voucher yang potongannya tidak masuk akal. Nilai negatif akan
+// berubah menjadi tambahan harga atau potongan tanpa batas saat diterapkan.
+func validateVoucher(v model.Voucher) error {
+	if v.Tipe != model.VoucherPersen && v.Tipe != model.VoucherNominal {
+		return fmt.Errorf("tipe voucher harus %q atau %q", model.VoucherPersen, model.VoucherNominal)
+	}
+	if v.Tipe == model.VoucherPersen && (v.Persen <= 0 || v.Persen > model.PersenDenominator) {
+		return errors.New("persen voucher harus lebih dari 0 dan paling banyak 100")
+	}
+	if v.Persen < 0 || v.Persen > model.PersenDenominator {
+		return errors.New("persen voucher harus antara 0 dan 100")
+	}
+	if v.Nominal < 0 || v.MaksDiskon < 0 || v.MinPembelian < 0 {
+		return errors.New("nominal, maks_diskon dan min_pembelian tidak boleh negatif")
+	}
+	if v.BatasPerUser < 0 || v.BatasTotal < 0 {
+		return errors.New("batas pemakaian voucher tidak boleh negatif")
+	}
+	if !v.Otomatis && strings.TrimSpace(v.Kode) == "" {
+		return errors.New("voucher tanpa kode harus berupa promosi otomatis")
+	}
+	if !v.BerlakuSampai.After(v.BerlakuMulai) {
+		return errors.New("berlaku_sampai harus setelah berlaku_mulai")
+	}
+	return nil
+}
+
+// ListVouchers mengembalikan semua voucher dan promosi, terbaru lebih dulu
+func ListVouchers(q database.Querier) ([]model.Voucher, error) {
+	rows, err := q.Query(`SELECT ` + voucherColumns + ` FROM vouchers ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vouchers []model.Voucher
+	for rows.Next() {
+		v, err := scanVoucher(rows)
+		if err != nil {
+			return nil, err
+		}
+		vouchers = append(vouchers, v)
+	}
+	return vouchers, rows.Err()
+}
+
+// checkVoucher memeriksa masa berlaku, syarat pesanan dan batas pemakaian voucher.
+// Minimum pembelian dibandingkan dengan harga item yang memenuhi syarat saja.
+func checkVoucher(q database.Querier, v model.Voucher, userID int, items []voucherItem, breakdown model.PriceBreakdown, at time.Time) error {
+	if !v.Aktif || at.Before(v.BerlakuMulai) || at.After(v.BerlakuSampai) {
+		return ErrVoucherNotActive
+	}
+	applicable := false
+	for _, item := range items {
+		applicable = applicable || voucherMatches(v, item)
+	}
+	if !applicable {
+		return ErrVoucherNotApplicable
+	}
+	if voucherBase(v, items, breakdown) < v.MinPembelian {
+		return ErrVoucherMinPurchase
+	}
+	return checkVoucherUsage(q, v, userID)
+}
+
+// checkVoucherUsage menghitung pemakaian yang masih dipesan atau sudah terpakai
+func checkVoucherUsage(q database.Querier, v model.Voucher, userID int) error {
+	var total, milikUser int
+	err := q.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE user_id = $2)
+		FROM voucher_redemptions
+		WHERE voucher_id = $1 AND status IN ($3, $4)`,
+		v.ID, userID, RedemptionReserved, RedemptionRedeemed).Scan(&total, &milikUser)
+	if err != nil {
+		return err
+	}
+	if (v.BatasTotal > 0 && total >= v.BatasTotal) || (v.BatasPerUser > 0 && milikUser >= v.BatasPerUser) {
+		return ErrVoucherExhausted
+	}
+	return nil
+}
+
+func voucherMatches(v model.Voucher, item voucherItem) bool {
+	return matchesAny(v.JenisPerhiasan, item.JenisPerhiasan) && matchesAny(v.JenisEmas, item.JenisEmas)
+}
+
+// voucherBase menjumlahkan subtotal item yang memenuhi syarat voucher, dibatasi sisa harga
+// sebelum pajak setelah diskon yang sudah diterapkan
+func voucherBase(v model.Voucher, items []voucherItem, breakdown model.PriceBreakdown) model.Rupiah {
+	var base model.Rupiah
+	for _, item := range items {
+		if voucherMatches(v, item) {
+			base += item.Subtotal
+		}
+	}
+	if remaining := breakdown.Subtotal - breakdown.Diskon; base > remaining {
+		base = remaining
+	}
+	return base
+}
+
+// voucherDiscount menghitung besar potongan dari harga sebelum pajak item yang memenuhi syarat
+func voucherDiscount(v model.Voucher, base model.Rupiah) model.Rupiah {
+	var discount model.Rupiah
+	switch v.Tipe {
+	case model.VoucherPersen:
+		var err error
+		if discount, err = base.MulPersen(v.Persen); err != nil {
+			discount = base // tetap dibatasi base di bawah
+		}
+		if v.MaksDiskon > 0 && discount > v.MaksDiskon {
+			discount = v.MaksDiskon
+		}
+	case model.VoucherNominal:
+		discount = v.Nominal
+	}
+	if discount > base {
+		discount = base
+	}
+	return discount
+}
+
+func discountLine(v model.Voucher, discount model.Rupiah) model.PriceLine {
+	keterangan := "Promo " + v.Nama
+	if v.Kode != "" {
+		keterangan = fmt.Sprintf("Voucher %s (%s)", v.Kode, v.Nama)
+	}
+	return model.PriceLine{Kode: "diskon", Keterangan: keterangan, Jumlah: -discount, VoucherID: v.ID}
+}
+
+func loadAutomaticPromotions(q database.Querier, at time.Time) ([]model.Voucher, error) {
+	rows, err := q.Query(`
+		SELECT `+voucherColumns+` FROM vouchers
+		WHERE otomatis AND aktif AND berlaku_mulai <= $1 AND berlaku_sampai >= $1`, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promotions []model.Voucher
+	for rows.Next() {
+		v, err := scanVoucher(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, v)
+	}
+	return promotions, rows.Err()
+}
+
+func loadVoucherByCode(q database.Querier, kode string) (model.Voucher, error) {
+	return scanVoucher(q.QueryRow(`SELECT `+voucherColumns+` FROM vouchers WHERE kode = $1`, strings.ToUpper(strings.TrimSpace(kode))))
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanVoucher(row rowScanner) (model.Voucher, error) {
+	var v model.Voucher
+	var jenisPerhiasan, jenisEmas []byte
+	err := row.Scan(&v.ID, &v.Kode, &v.Nama, &v.Tipe, &v.Persen, &v.Nominal, &v.MaksDiskon, &v.MinPembelian,
+		&v.BatasPerUser, &v.BatasTotal, &v.BerlakuMulai, &v.BerlakuSampai, &jenisPerhiasan, &jenisEmas, &v.Otomatis, &v.Aktif)
+	if err != nil {
+		return v, err
+	}
+	if err := json.Unmarshal(jenisPerhiasan, &v.JenisPerhiasan); err != nil {
+		return v, err
+	}
+	if err := json.Unmarshal(jenisEmas, &v.JenisEmas); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// matchesAny bernilai true jika daftar kosong (berlaku untuk semua) atau memuat value
+func matchesAny(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
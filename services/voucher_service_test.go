@@ -0,0 +1,128 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"proyek3/model"
+)
+
+func TestVoucherBaseCountsEligibleCartItemsOnly(t *testing.T) {
+	items := []voucherItem{
+		{JenisPerhiasan: "Cincin", JenisEmas: "Emas Kuning", Subtotal: 3000000},
+		{JenisPerhiasan: "Kalung", JenisEmas: "Emas Putih", Subtotal: 5000000},
+		{JenisEmas: "Emas 24K", Subtotal: 2000000},
+	}
+	breakdown := model.PriceBreakdown{Subtotal: 10000000}
+
+	cincin := model.Voucher{Tipe: model.VoucherPersen, Persen: 1000, JenisPerhiasan: []string{"cincin"}}
+	if base := voucherBase(cincin, items, breakdown); base != 3000000 {
+		t.Fatalf("base voucher cincin = %s, ingin 3000000", base)
+	}
+	if discount := voucherDiscount(cincin, voucherBase(cincin, items, breakdown)); discount != 300000 {
+		t.Fatalf("diskon voucher cincin = %s, ingin 300000", discount)
+	}
+
+	semua := model.Voucher{Tipe: model.VoucherNominal, Nominal: 100000}
+	if base := voucherBase(semua, items, breakdown); base != 10000000 {
+		t.Fatalf("base voucher tanpa syarat = %s, ingin 10000000", base)
+	}
+
+	gelang := model.Voucher{Tipe: model.VoucherNominal, Nominal: 100000, JenisPerhiasan: []string{"Gelang"}}
+	for _, item := range items {
+		if voucherMatches(gelang, item) {
+			t.Fatalf("voucher gelang berlaku untuk %+v", item)
+		}
+	}
+
+	// Diskon sebelumnya membatasi base supaya potongan tidak melebihi sisa harga
+	breakdown.Diskon = 8000000
+	if base := voucherBase(semua, items, breakdown); base != 2000000 {
+		t.Fatalf("base setelah diskon = %s, ingin 2000000", base)
+	}
+}
+
+func TestValidateVoucher(t *testing.T) {
+	mulai := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	valid := model.Voucher{Kode: "HEMAT", Tipe: model.VoucherPersen, Persen: 1000, BerlakuMulai: mulai, BerlakuSampai: mulai.AddDate(0, 1, 0)}
+
+	tests := []struct {
+		name  string
+		ubah  func(v *model.Voucher)
+		gagal bool
+	}{
+		{"persen valid", func(v *model.Voucher) {}, false},
+		{"persen 100", func(v *model.Voucher) { v.Persen = model.PersenDenominator }, false},
+		{"persen nol", func(v *model.Voucher) { v.Persen = 0 }, true},
+		{"persen negatif", func(v *model.Voucher) { v.Persen = -1000 }, true},
+		{"persen di atas 100", func(v *model.Voucher) { v.Persen = model.PersenDenominator + 1 }, true},
+		{"maks diskon negatif", func(v *model.Voucher) { v.MaksDiskon = -1 }, true},
+		{"nominal valid", func(v *model.Voucher) { v.Tipe, v.Persen, v.Nominal = model.VoucherNominal, 0, 50000 }, false},
+		{"nominal negatif", func(v *model.Voucher) { v.Tipe, v.Persen, v.Nominal = model.VoucherNominal, 0, -50000 }, true},
+		{"min pembelian negatif", func(v *model.Voucher) { v.MinPembelian = -1 }, true},
+		{"tanpa kode bukan otomatis", func(v *model.Voucher) { v.Kode = " " }, true},
+		{"periode terbalik", func(v *model.Voucher) { v.BerlakuSampai = v.BerlakuMulai }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := valid
+			tt.ubah(&v)
+			if err := validateVoucher(v); (err != nil) != tt.gagal {
+				t.Fatalf("validateVoucher(%+v) = %v, ingin gagal %v", v, err, tt.gagal)
+			}
+		})
+	}
+}
+
+func TestApplyDiscount(t *testing.T) {
+	base := func() model.PriceBreakdown {
+		return model.PriceBreakdown{
+			Subtotal:   1000000,
+			TarifPajak: 1100,
+			Pajak:      110000,
+			Total:      1110000,
+			Items: []model.PriceLine{
+				{Kode: "emas", Jumlah: 1000000},
+				{Kode: "pajak", Jumlah: 110000},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		breakdown model.PriceBreakdown
+		line      model.PriceLine
+		diskon    model.Rupiah
+		pajak     model.Rupiah
+		total     model.Rupiah
+	}{
+		{"potongan negatif", base(), model.PriceLine{Kode: "diskon", Jumlah: -100000}, 100000, 99000, 999000},
+		{"potongan positif dianggap potongan", base(), model.PriceLine{Kode: "diskon", Jumlah: 100000}, 100000, 99000, 999000},
+		{"dibatasi subtotal", base(), model.PriceLine{Kode: "diskon", Jumlah: -2000000}, 1000000, 0, 0},
+		{"ongkir tidak dikenai pajak", func() model.PriceBreakdown {
+			b := base()
+			b.Ongkir = 50000
+			return b
+		}(), model.PriceLine{Kode: "diskon", Jumlah: -500000}, 500000, 55000, 605000},
+		{"tukar tambah mengurangi total", func() model.PriceBreakdown {
+			b := base()
+			b.TukarTambah = 200000
+			return b
+		}(), model.PriceLine{Kode: "diskon", Jumlah: -500000}, 500000, 55000, 355000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ApplyDiscount(tt.breakdown, tt.line)
+			if got.Diskon != tt.diskon || got.Pajak != tt.pajak || got.Total != tt.total {
+				t.Fatalf("diskon %s pajak %s total %s, ingin %s %s %s", got.Diskon, got.Pajak, got.Total, tt.diskon, tt.pajak, tt.total)
+			}
+			last := got.Items[len(got.Items)-1]
+			if last.Kode != "pajak" || last.Jumlah != got.Pajak {
+				t.Fatalf("baris pajak harus terakhir dan sesuai: %+v", got.Items)
+			}
+			if diskon := got.Items[len(got.Items)-2]; diskon.Kode != "diskon" || diskon.Jumlah != -tt.diskon {
+				t.Fatalf("baris diskon = %+v, ingin %s", diskon, -tt.diskon)
+			}
+		})
+	}
+}